@@ -72,7 +72,9 @@ if [ ! -z "$BOOKING_ID" ]; then
     # Demo 4: Cancel booking
     echo "Demo 4: Cancelling the booking"
     echo "------------------------------"
-    curl -s -X DELETE "$BASE_URL/bookings/$BOOKING_ID" | jq '.'
+    curl -s -X DELETE "$BASE_URL/bookings/$BOOKING_ID" \
+        -H "Content-Type: application/json" \
+        -d '{"reasonCode": "change_of_plans"}' | jq '.'
     echo ""
     
     # Demo 5: Try to book the same room again (should succeed now)
@@ -33,7 +33,9 @@ make_booking() {
 # Function to cancel a booking
 cancel_booking() {
     local booking_id=$1
-    curl -s -X DELETE "$BASE_URL/bookings/$booking_id" | jq -r '.success // false'
+    curl -s -X DELETE "$BASE_URL/bookings/$booking_id" \
+        -H "Content-Type: application/json" \
+        -d '{"reasonCode": "guest_request"}' | jq -r '.success // false'
 }
 
 # Function to set row locking
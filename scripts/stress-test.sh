@@ -1,9 +1,16 @@
 #!/bin/bash
 
 BASE_URL="http://localhost:3000/api"
+METRICS_URL="http://localhost:3000/metrics"
 TOTAL_REQUESTS=50
 CONCURRENT_BATCHES=10
 ROOM_ID=1
+# Server-side checks after each run; set ASSERT_SERVER_METRICS=false to only report
+ASSERT_SERVER_METRICS=${ASSERT_SERVER_METRICS:-true}
+MAX_OVERLAPPING_BOOKINGS=${MAX_OVERLAPPING_BOOKINGS:-0}
+STATUS_FILE=$(mktemp)
+trap 'rm -f "$STATUS_FILE"' EXIT
+FAILURES=0
 
 echo "🚀 Stress Testing Hotel Booking API"
 echo "==================================="
@@ -23,7 +30,7 @@ run_batch() {
     echo "Running batch $batch_num (requests $start_id - $((start_id + 9)))..."
     
     for i in $(seq $start_id $((start_id + 9))); do
-        curl -s -X POST "$BASE_URL/bookings" \
+        curl -s -o /dev/null -w "%{http_code}\n" -X POST "$BASE_URL/bookings" \
             -H "Content-Type: application/json" \
             -d "{
                 \"guestName\": \"StressTest Guest $i\",
@@ -33,12 +40,47 @@ run_batch() {
                 \"checkInDate\": \"2024-12-0$((1 + (i % 9)))\",
                 \"checkOutDate\": \"2024-12-0$((5 + (i % 9)))\",
                 \"paymentMethod\": \"credit_card\"
-            }" > /dev/null 2>&1 &
+            }" >> "$STATUS_FILE" 2>/dev/null &
     done
     
     wait
 }
 
+server_counter() {
+    curl -s "$METRICS_URL" | jq -r --arg name "$1" '.counters[$name] // 0'
+}
+
+# Compares what the server counted during a run with what the clients saw, so a race the server mishandled
+# without any client noticing (e.g. a booking created twice) still fails the run
+check_server_metrics() {
+    local label=$1 created_before=$2 conflicts_before=$3
+    local client_created client_conflicts server_created server_conflicts overlaps
+    client_created=$(grep -c '^201$' "$STATUS_FILE")
+    client_conflicts=$(grep -c '^409$' "$STATUS_FILE")
+    server_created=$(( $(server_counter bookings.created) - created_before ))
+    server_conflicts=$(( $(server_counter bookings.conflicts) - conflicts_before ))
+    overlaps=$(curl -s "$BASE_URL/admin/consistency-snapshot" | jq -r '.data.overlappingBookings // 0')
+
+    echo "   Clients: $client_created created, $client_conflicts conflicts (409)"
+    echo "   Server:  $server_created created, $server_conflicts conflicts, $overlaps overlapping bookings"
+
+    if [ "$ASSERT_SERVER_METRICS" != "true" ]; then
+        return
+    fi
+    if [ "$server_created" -ne "$client_created" ]; then
+        echo "❌ $label: server created $server_created bookings but clients saw $client_created"
+        FAILURES=$((FAILURES + 1))
+    fi
+    if [ "$server_conflicts" -lt "$client_conflicts" ]; then
+        echo "❌ $label: server counted $server_conflicts conflicts but clients saw $client_conflicts"
+        FAILURES=$((FAILURES + 1))
+    fi
+    if [ "$overlaps" -gt "$MAX_OVERLAPPING_BOOKINGS" ]; then
+        echo "❌ $label: $overlaps overlapping bookings (oversold rooms), at most $MAX_OVERLAPPING_BOOKINGS allowed"
+        FAILURES=$((FAILURES + 1))
+    fi
+}
+
 # Test with row locking enabled
 echo "Test 1: Stress test WITH row locking"
 echo "------------------------------------"
@@ -47,6 +89,9 @@ curl -s -X POST "$BASE_URL/settings/row-locking" \
     -d '{"enabled": true}' > /dev/null
 
 echo "Running $TOTAL_REQUESTS requests in $CONCURRENT_BATCHES concurrent batches..."
+: > "$STATUS_FILE"
+created_before=$(server_counter bookings.created)
+conflicts_before=$(server_counter bookings.conflicts)
 start_time=$(date +%s)
 
 for batch in $(seq 1 $CONCURRENT_BATCHES); do
@@ -58,6 +103,7 @@ end_time=$(date +%s)
 duration=$((end_time - start_time))
 
 echo "✅ Completed in $duration seconds"
+check_server_metrics "With row locking" "$created_before" "$conflicts_before"
 echo ""
 
 # Test with row locking disabled
@@ -68,6 +114,9 @@ curl -s -X POST "$BASE_URL/settings/row-locking" \
     -d '{"enabled": false}' > /dev/null
 
 echo "Running $TOTAL_REQUESTS requests in $CONCURRENT_BATCHES concurrent batches..."
+: > "$STATUS_FILE"
+created_before=$(server_counter bookings.created)
+conflicts_before=$(server_counter bookings.conflicts)
 start_time=$(date +%s)
 
 for batch in $(seq 1 $CONCURRENT_BATCHES); do
@@ -79,6 +128,7 @@ end_time=$(date +%s)
 duration=$((end_time - start_time))
 
 echo "✅ Completed in $duration seconds"
+check_server_metrics "Without row locking" "$created_before" "$conflicts_before"
 echo ""
 
 echo "🔍 Checking final database state..."
@@ -116,4 +166,10 @@ echo "   - Performance metrics"
 echo ""
 echo "🐳 Docker logs:"
 echo "   - Server logs: Check your terminal where 'npm run dev' is running"
-echo "   - PostgreSQL logs: docker-compose logs postgres"
\ No newline at end of file
+echo "   - PostgreSQL logs: docker-compose logs postgres"
+
+if [ "$FAILURES" -gt 0 ]; then
+    echo ""
+    echo "❌ $FAILURES server metric check(s) failed"
+    exit 1
+fi
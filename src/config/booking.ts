@@ -0,0 +1,49 @@
+import dotenv from 'dotenv';
+
+dotenv.config();
+
+const bookingConfig = {
+  // Furthest check-out date clients may book, counted in days from today
+  horizonDays: parseInt(process.env.BOOKING_HORIZON_DAYS || '365'),
+  // Applied to each night after adjustments, e.g. 0.07 for 7%
+  taxRate: parseFloat(process.env.BOOKING_TAX_RATE || '0'),
+  // Room holds: default and maximum lifetime, and how often expired holds are released
+  holdMinutes: parseInt(process.env.HOLD_MINUTES || '15'),
+  maxHoldMinutes: parseInt(process.env.MAX_HOLD_MINUTES || '60'),
+  holdReaperIntervalMs: parseInt(process.env.HOLD_REAPER_INTERVAL_MS || '30000'),
+  // Orphan cleanup: how often it runs, and whether it only reports (the default) or also deletes
+  orphanCleanupIntervalMs: parseInt(process.env.ORPHAN_CLEANUP_INTERVAL_MS || '300000'),
+  orphanCleanupDryRun: process.env.ORPHAN_CLEANUP_DRY_RUN !== 'false',
+  // Integrity check: how often it runs and how many finished days it recomputes
+  integrityCheckIntervalMs: parseInt(process.env.INTEGRITY_CHECK_INTERVAL_MS || '3600000'),
+  integrityCheckDays: parseInt(process.env.INTEGRITY_CHECK_DAYS || '7'),
+  // How often checked-out stays missed by the check-out event are finalized
+  stayFinalizerIntervalMs: parseInt(process.env.STAY_FINALIZER_INTERVAL_MS || '600000'),
+  // Installment plans: most installments per booking, days between due dates, days an overdue installment
+  // may stay unpaid before the booking is cancelled (when autoCancel is on), and how often that is checked
+  maxInstallments: parseInt(process.env.MAX_INSTALLMENTS || '6'),
+  installmentIntervalDays: parseInt(process.env.INSTALLMENT_INTERVAL_DAYS || '30'),
+  installmentGraceDays: parseInt(process.env.INSTALLMENT_GRACE_DAYS || '3'),
+  installmentAutoCancel: process.env.INSTALLMENT_AUTO_CANCEL !== 'false',
+  installmentMonitorIntervalMs: parseInt(process.env.INSTALLMENT_MONITOR_INTERVAL_MS || '3600000'),
+  // Pending bookings still without a completed payment this many hours after booking are cancelled and their
+  // rooms released (0 turns the reaper off); and how often that is checked
+  pendingBookingTtlHours: parseInt(process.env.PENDING_BOOKING_TTL_HOURS || '24'),
+  pendingBookingReaperIntervalMs: parseInt(process.env.PENDING_BOOKING_REAPER_INTERVAL_MS || '900000'),
+  // Booking queue: when enabled, bookings and holds for the same room (or room type, when one is assigned) wait
+  // their turn in this process instead of contending for locks; how many may wait and for how long
+  bookingQueueEnabled: process.env.BOOKING_QUEUE_ENABLED === 'true',
+  bookingQueueMaxWaiting: parseInt(process.env.BOOKING_QUEUE_MAX_WAITING || '50'),
+  bookingQueueTimeoutMs: parseInt(process.env.BOOKING_QUEUE_TIMEOUT_MS || '10000'),
+  // Sandbox endpoints under /admin/demos; off by default in production
+  demoEndpointsEnabled: (process.env.DEMO_ENDPOINTS_ENABLED || (process.env.NODE_ENV === 'production' ? 'false' : 'true')) === 'true',
+  // Bearer token the demo endpoints require; they are refused while it is unset
+  demoEndpointsToken: process.env.DEMO_ENDPOINTS_TOKEN || '',
+  // Sandbox rooms older than this are retired and their open bookings cancelled; and how often that is checked
+  sandboxRoomTtlMinutes: parseInt(process.env.SANDBOX_ROOM_TTL_MINUTES || '60'),
+  sandboxCleanupIntervalMs: parseInt(process.env.SANDBOX_CLEANUP_INTERVAL_MS || '600000'),
+  // Diagnostics under /debug, which show other sessions' queries; off by default in production
+  debugEndpointsEnabled: (process.env.DEBUG_ENDPOINTS_ENABLED || (process.env.NODE_ENV === 'production' ? 'false' : 'true')) === 'true',
+};
+
+export { bookingConfig };
@@ -0,0 +1,61 @@
+import fs from 'fs';
+import dotenv from 'dotenv';
+import { logger } from '../utils/logger';
+
+dotenv.config();
+
+export interface CancellationPolicy {
+  code: string;
+  displayName: string;
+  // Cancelling at least this many days before check-in is free; null means never free
+  freeUntilDays: number | null;
+  // Share of the amount paid kept as a fee once the free window has passed
+  lateFeePercent: number;
+}
+
+const FLEXIBLE: CancellationPolicy = { code: 'flexible', displayName: 'Flexible', freeUntilDays: 1, lateFeePercent: 50 };
+const MODERATE: CancellationPolicy = { code: 'moderate', displayName: 'Moderate', freeUntilDays: 7, lateFeePercent: 50 };
+const NON_REFUNDABLE: CancellationPolicy = { code: 'non_refundable', displayName: 'Non-refundable', freeUntilDays: null, lateFeePercent: 100 };
+
+// Keyed by room type; "default" covers types without their own entry
+const DEFAULT_POLICIES: Record<string, CancellationPolicy> = {
+  default: MODERATE,
+  Standard: FLEXIBLE,
+  Deluxe: MODERATE,
+  Suite: NON_REFUNDABLE,
+};
+
+// CANCELLATION_POLICIES_FILE points at a JSON object of room type -> CancellationPolicy replacing the defaults
+function loadCancellationPolicies(): Record<string, CancellationPolicy> {
+  const file = process.env.CANCELLATION_POLICIES_FILE;
+  if (!file) {
+    return DEFAULT_POLICIES;
+  }
+
+  const policies = JSON.parse(fs.readFileSync(file, 'utf8'));
+  if (!policies || typeof policies !== 'object' || !policies.default ||
+    Object.values(policies).some((policy: any) => typeof policy.code !== 'string' || typeof policy.lateFeePercent !== 'number')) {
+    throw new Error(`${file} must map room types (including "default") to policies with a code and lateFeePercent`);
+  }
+
+  logger.info('Cancellation policies loaded', { file, roomTypes: Object.keys(policies).length });
+  return policies;
+}
+
+class CancellationPolicyRegistry {
+  constructor(private policies: Record<string, CancellationPolicy>) {}
+
+  forRoomType(roomType: string): CancellationPolicy {
+    return this.policies[roomType] || this.policies.default;
+  }
+
+  // Fee kept when cancelling daysBeforeCheckIn days ahead (negative once the stay has started)
+  feeFor(policy: CancellationPolicy, paidAmount: number, daysBeforeCheckIn: number): number {
+    if (policy.freeUntilDays !== null && daysBeforeCheckIn >= policy.freeUntilDays) {
+      return 0;
+    }
+    return Math.round(paidAmount * policy.lateFeePercent) / 100;
+  }
+}
+
+export const cancellationPolicies = new CancellationPolicyRegistry(loadCancellationPolicies());
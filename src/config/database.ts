@@ -1,5 +1,8 @@
 import { Pool, PoolClient } from 'pg';
 import dotenv from 'dotenv';
+import { markStage } from '../utils/stageTiming';
+import { degradation } from '../utils/degradation';
+import { degradationConfig } from './degradation';
 
 dotenv.config();
 
@@ -16,6 +19,18 @@ const pool = new Pool({
 
 export { pool };
 
+degradation.registerCheck('database', () => pool.waitingCount >= degradationConfig.poolWaitingThreshold
+  ? `${pool.waitingCount} requests waiting for one of ${pool.totalCount} connections`
+  : null);
+
 export async function getClient(): Promise<PoolClient> {
-  return await pool.connect();
+  let client: PoolClient;
+  try {
+    client = await pool.connect();
+  } catch (error) {
+    degradation.report('database', `could not get a connection: ${error instanceof Error ? error.message : String(error)}`);
+    throw error;
+  }
+  markStage('db');
+  return client;
 }
\ No newline at end of file
@@ -0,0 +1,16 @@
+import dotenv from 'dotenv';
+
+dotenv.config();
+
+const degradationConfig = {
+  // Requests waiting for a pool connection before the database counts as degraded
+  poolWaitingThreshold: parseInt(process.env.DEGRADED_POOL_WAITING || '5'),
+  // Share of a subscriber's event buffer in use before the event bus counts as degraded
+  eventBacklogRatio: parseFloat(process.env.DEGRADED_EVENT_BACKLOG_RATIO || '0.8'),
+  // A payment call slower than this marks the payment gateway degraded
+  slowPaymentMs: parseInt(process.env.DEGRADED_SLOW_PAYMENT_MS || '2000'),
+  // How long a reported problem (such as a slow payment) keeps the component degraded
+  reportTtlMs: parseInt(process.env.DEGRADED_REPORT_TTL_MS || '60000'),
+};
+
+export { degradationConfig };
@@ -0,0 +1,58 @@
+import dotenv from 'dotenv';
+import { createHash } from 'crypto';
+
+dotenv.config();
+
+const KEY_ID_PATTERN = /^[A-Za-z0-9_-]{1,32}$/;
+
+// Development and tests run without configured keys on fixed keys derived from these labels; production refuses to
+const developmentKey = (label: string) => createHash('sha256').update(`room-booking-api ${label}`).digest();
+
+const production = process.env.NODE_ENV === 'production';
+
+// "<id>:<base64 of 32 bytes>" pairs separated by commas
+const parseKeys = (value: string): Map<string, Buffer> => {
+  const keys = new Map<string, Buffer>();
+  for (const entry of value.split(',').map(part => part.trim()).filter(Boolean)) {
+    const [id, encoded] = entry.split(':');
+    const key = Buffer.from(encoded ?? '', 'base64');
+    if (!KEY_ID_PATTERN.test(id) || key.length !== 32) {
+      throw new Error('GUEST_ENCRYPTION_KEYS entries must be <id>:<base64 of a 32-byte key>');
+    }
+    keys.set(id, key);
+  }
+  return keys;
+};
+
+let keys = parseKeys(process.env.GUEST_ENCRYPTION_KEYS || '');
+if (keys.size === 0) {
+  if (production) {
+    throw new Error('GUEST_ENCRYPTION_KEYS must be set when NODE_ENV=production');
+  }
+  keys = new Map([['dev', developmentKey('guest encryption key')]]);
+}
+
+const currentKeyId = process.env.GUEST_ENCRYPTION_KEY_ID || keys.keys().next().value!;
+if (!keys.has(currentKeyId)) {
+  throw new Error('GUEST_ENCRYPTION_KEY_ID must name one of the GUEST_ENCRYPTION_KEYS');
+}
+
+const lookupKey = process.env.GUEST_LOOKUP_KEY
+  ? Buffer.from(process.env.GUEST_LOOKUP_KEY, 'base64')
+  : production ? null : developmentKey('guest lookup key');
+if (!lookupKey || lookupKey.length < 32) {
+  throw new Error('GUEST_LOOKUP_KEY must be the base64 of at least 32 bytes');
+}
+
+const encryptionConfig = {
+  // Every key guest contact details may still be encrypted with, by id. Keep a retired key listed until
+  // reencrypt-guests has moved every row off it.
+  keys,
+  // Key new and updated values are encrypted with
+  currentKeyId,
+  // HMAC key of the email lookup hash. Changing it needs reencrypt-guests too: guests can't be found by
+  // email until their hash has been recomputed.
+  lookupKey,
+};
+
+export { encryptionConfig };
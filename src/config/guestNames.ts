@@ -0,0 +1,25 @@
+import dotenv from 'dotenv';
+
+dotenv.config();
+
+// printable: any visible characters from any script (control and formatting characters are refused, as they
+// break CSV exports and PDFs); letters: letters and combining marks from any script plus the punctuation
+// names use; latin: the same, limited to Latin script for downstream systems that cannot render others
+const NAME_PATTERNS: Record<string, RegExp> = {
+  printable: /^[^\p{C}\p{Zl}\p{Zp}]+$/u,
+  letters: /^[\p{L}\p{M}][\p{L}\p{M} '’.\-]*$/u,
+  latin: /^[\p{Script=Latin}\p{M}][\p{Script=Latin}\p{M} '’.\-]*$/u,
+};
+
+const charset = process.env.GUEST_NAME_CHARSET || 'printable';
+if (!NAME_PATTERNS[charset]) {
+  throw new Error(`GUEST_NAME_CHARSET must be one of: ${Object.keys(NAME_PATTERNS).join(', ')}`);
+}
+
+const guestNameConfig = {
+  charset,
+  pattern: NAME_PATTERNS[charset],
+  maxLength: parseInt(process.env.GUEST_NAME_MAX_LENGTH || '100'),
+};
+
+export { guestNameConfig };
@@ -0,0 +1,34 @@
+import dotenv from 'dotenv';
+import { IsolationLevel } from '../services/transactionManager';
+
+dotenv.config();
+
+const LEVELS: IsolationLevel[] = ['READ COMMITTED', 'REPEATABLE READ', 'SERIALIZABLE'];
+
+// TX_ISOLATION_LEVELS maps transaction names to the level they run at, e.g.
+// "createBooking=SERIALIZABLE,quoteStay=READ_COMMITTED"; operations not listed keep the level their code asks for
+function parseLevels(value: string): Record<string, IsolationLevel> {
+  const levels: Record<string, IsolationLevel> = {};
+  for (const entry of value.split(',').map(part => part.trim()).filter(Boolean)) {
+    const [name, level] = entry.split('=').map(part => part?.trim());
+    const normalized = level?.replace(/_/g, ' ').toUpperCase() as IsolationLevel;
+    if (!name || !LEVELS.includes(normalized)) {
+      throw new Error(`TX_ISOLATION_LEVELS entry "${entry}" must be name=${LEVELS.map(l => l.replace(' ', '_')).join('|')}`);
+    }
+    levels[name] = normalized;
+  }
+  return levels;
+}
+
+const isolationConfig = {
+  levels: parseLevels(process.env.TX_ISOLATION_LEVELS || ''),
+  // Extra attempts for a transaction that fails with a serialization failure before the error is passed on
+  serializationRetries: parseInt(process.env.TX_SERIALIZATION_RETRIES || '2'),
+  // runInTransactionWithRetry: attempts in all for a transaction that keeps deadlocking or failing to
+  // serialize, and the backoff before each rerun (doubling from the base up to the cap, jittered)
+  retryMaxAttempts: parseInt(process.env.TX_RETRY_MAX_ATTEMPTS || '4'),
+  retryBaseDelayMs: parseInt(process.env.TX_RETRY_BASE_DELAY_MS || '20'),
+  retryMaxDelayMs: parseInt(process.env.TX_RETRY_MAX_DELAY_MS || '500'),
+};
+
+export { isolationConfig };
@@ -0,0 +1,27 @@
+import dotenv from 'dotenv';
+
+dotenv.config();
+
+// row: bookings lock the room's row (SELECT ... FOR UPDATE) from the availability check to commit;
+// advisory: they take transaction-scoped advisory locks on the room and each date bucket of the stay instead
+export type RoomLockStrategy = 'row' | 'advisory';
+
+export const ROOM_LOCK_STRATEGIES: RoomLockStrategy[] = ['row', 'advisory'];
+
+const strategy = process.env.ROOM_LOCK_STRATEGY || 'row';
+if (!ROOM_LOCK_STRATEGIES.includes(strategy as RoomLockStrategy)) {
+  throw new Error(`ROOM_LOCK_STRATEGY must be one of: ${ROOM_LOCK_STRATEGIES.join(', ')}`);
+}
+
+const bucketDays = parseInt(process.env.ADVISORY_LOCK_BUCKET_DAYS || '7');
+if (!Number.isInteger(bucketDays) || bucketDays <= 0) {
+  throw new Error('ADVISORY_LOCK_BUCKET_DAYS must be a positive whole number');
+}
+
+const lockingConfig = {
+  strategy: strategy as RoomLockStrategy,
+  // Days of the calendar one advisory lock covers; stays sharing a bucket of the same room wait for each other
+  bucketDays,
+};
+
+export { lockingConfig };
@@ -0,0 +1,12 @@
+import dotenv from 'dotenv';
+
+dotenv.config();
+
+const loyaltyConfig = {
+  // Points earned for each paid night, credited when the stay is finalized at check-out
+  pointsPerNight: parseInt(process.env.LOYALTY_POINTS_PER_NIGHT || '10'),
+  // What one point is worth when redeemed as payment
+  pointValue: parseFloat(process.env.LOYALTY_POINT_VALUE || '0.5'),
+};
+
+export { loyaltyConfig };
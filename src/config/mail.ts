@@ -0,0 +1,25 @@
+import dotenv from 'dotenv';
+
+dotenv.config();
+
+const mailConfig = {
+  // smtp sends real mail; noop only logs (the default, so development never mails guests by accident)
+  transport: process.env.MAIL_TRANSPORT === 'smtp' ? 'smtp' as const : 'noop' as const,
+  from: process.env.MAIL_FROM || 'Hotel Booking <no-reply@hotel.example>',
+  smtp: {
+    host: process.env.SMTP_HOST || 'localhost',
+    port: parseInt(process.env.SMTP_PORT || '587'),
+    // Implicit TLS (usually port 465); otherwise STARTTLS is used when the server offers it
+    secure: process.env.SMTP_SECURE === 'true',
+    user: process.env.SMTP_USER || '',
+    password: process.env.SMTP_PASSWORD || '',
+    timeoutMs: parseInt(process.env.SMTP_TIMEOUT_MS || '10000'),
+  },
+  // Receipt emails: attempts before giving up, base delay between attempts (multiplied by the attempt
+  // number), and how often undelivered receipts are swept
+  maxAttempts: parseInt(process.env.RECEIPT_EMAIL_MAX_ATTEMPTS || '5'),
+  retryDelayMs: parseInt(process.env.RECEIPT_EMAIL_RETRY_DELAY_MS || '60000'),
+  sweepIntervalMs: parseInt(process.env.RECEIPT_EMAIL_SWEEP_INTERVAL_MS || '60000'),
+};
+
+export { mailConfig };
@@ -0,0 +1,24 @@
+import dotenv from 'dotenv';
+
+dotenv.config();
+
+const mediaConfig = {
+  // disk keeps uploads under dir and serves them at publicUrl; s3 puts them in a bucket
+  storage: process.env.MEDIA_STORAGE === 's3' ? 's3' as const : 'disk' as const,
+  dir: process.env.MEDIA_DIR || 'uploads',
+  // Prefix of photo URLs; for s3 defaults to the bucket's own URL
+  publicUrl: process.env.MEDIA_PUBLIC_URL || '',
+  maxBytes: parseInt(process.env.MEDIA_MAX_BYTES || String(5 * 1024 * 1024)),
+  contentTypes: ['image/jpeg', 'image/png', 'image/webp'],
+  s3: {
+    bucket: process.env.S3_BUCKET || '',
+    region: process.env.S3_REGION || 'us-east-1',
+    // For S3-compatible stores (MinIO, R2); objects are then addressed path-style
+    endpoint: process.env.S3_ENDPOINT || '',
+    accessKeyId: process.env.S3_ACCESS_KEY_ID || '',
+    secretAccessKey: process.env.S3_SECRET_ACCESS_KEY || '',
+    timeoutMs: parseInt(process.env.S3_TIMEOUT_MS || '10000'),
+  },
+};
+
+export { mediaConfig };
@@ -0,0 +1,45 @@
+import dotenv from 'dotenv';
+import { randomBytes } from 'crypto';
+
+dotenv.config();
+
+export interface PageSizeLimit {
+  default: number;
+  max: number;
+}
+
+// Page sizes of each paginated listing. History entries are small and usually read end to end, so they
+// come in bigger pages than bookings and settlement issues
+const DEFAULT_PAGE_SIZES: Record<string, PageSizeLimit> = {
+  bookings: { default: 20, max: 100 },
+  bookingHistory: { default: 50, max: 500 },
+  roomStatusHistory: { default: 50, max: 500 },
+  settlementIssues: { default: 20, max: 100 },
+};
+
+// PAGE_SIZES overrides them by listing name as default/max, e.g. "bookings=50/200,bookingHistory=100/1000";
+// listings not mentioned keep their built-in sizes
+function parsePageSizes(value: string): Record<string, PageSizeLimit> {
+  const sizes = { ...DEFAULT_PAGE_SIZES };
+  for (const entry of value.split(',').map(part => part.trim()).filter(Boolean)) {
+    const [name, limits] = entry.split('=').map(part => part?.trim());
+    const [size, max] = (limits ?? '').split('/').map(Number);
+    if (!name || !sizes[name] || !Number.isInteger(size) || !Number.isInteger(max) || size <= 0 || max < size) {
+      throw new Error(
+        `PAGE_SIZES entry "${entry}" must be name=default/max with 0 < default <= max and name one of: ` +
+        Object.keys(DEFAULT_PAGE_SIZES).join(', ')
+      );
+    }
+    sizes[name] = { default: size, max };
+  }
+  return sizes;
+}
+
+const paginationConfig = {
+  // Key cursors are signed with. Without one a random key is made at startup, so cursors stop working
+  // after a restart and aren't shared between instances; set it when running more than one
+  cursorSecret: process.env.CURSOR_SECRET || randomBytes(32).toString('hex'),
+  pageSizes: parsePageSizes(process.env.PAGE_SIZES || ''),
+};
+
+export { paginationConfig };
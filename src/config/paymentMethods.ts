@@ -0,0 +1,89 @@
+import fs from 'fs';
+import dotenv from 'dotenv';
+import { logger } from '../utils/logger';
+
+dotenv.config();
+
+export interface PaymentMethodConfig {
+  code: string;
+  displayName: string;
+  enabled: boolean;
+  requiresGateway: boolean;
+  supportsRefund: boolean;
+  minAmount?: number;
+  maxAmount?: number;
+  // Added on top of every payment made with the method and shown on its receipt, e.g. 2.5 for 2.5%
+  surchargePercent?: number;
+}
+
+// No amount limits by default; set minAmount/maxAmount in PAYMENT_METHODS_FILE or through the admin API
+const DEFAULT_PAYMENT_METHODS: PaymentMethodConfig[] = [
+  { code: 'credit_card', displayName: 'Credit card', enabled: true, requiresGateway: true, supportsRefund: true },
+  { code: 'debit_card', displayName: 'Debit card', enabled: true, requiresGateway: true, supportsRefund: true },
+  { code: 'bank_transfer', displayName: 'Bank transfer', enabled: true, requiresGateway: false, supportsRefund: true },
+  { code: 'cash', displayName: 'Cash', enabled: true, requiresGateway: false, supportsRefund: false },
+];
+
+// PAYMENT_METHODS_FILE points at a JSON array of PaymentMethodConfig replacing the defaults
+function loadPaymentMethods(): PaymentMethodConfig[] {
+  const file = process.env.PAYMENT_METHODS_FILE;
+  if (!file) {
+    return DEFAULT_PAYMENT_METHODS;
+  }
+
+  const methods = JSON.parse(fs.readFileSync(file, 'utf8'));
+  if (!Array.isArray(methods) || methods.some(method => typeof method.code !== 'string')) {
+    throw new Error(`${file} must contain an array of payment methods with a code`);
+  }
+
+  logger.info('Payment methods loaded', { file, count: methods.length });
+  return methods;
+}
+
+class PaymentMethodRegistry {
+  private methods = new Map<string, PaymentMethodConfig>();
+
+  constructor(methods: PaymentMethodConfig[]) {
+    methods.forEach(method => this.methods.set(method.code, method));
+  }
+
+  get(code: string): PaymentMethodConfig | undefined {
+    return this.methods.get(code);
+  }
+
+  list(): PaymentMethodConfig[] {
+    return this.all().filter(method => method.enabled);
+  }
+
+  // Including disabled methods
+  all(): PaymentMethodConfig[] {
+    return Array.from(this.methods.values());
+  }
+
+  // Adds or replaces a method; stored changes are applied through PaymentMethodService
+  set(method: PaymentMethodConfig) {
+    this.methods.set(method.code, method);
+  }
+
+  surchargeFor(code: string, amount: number): number {
+    const percent = this.methods.get(code)?.surchargePercent ?? 0;
+    return Math.round(amount * percent) / 100;
+  }
+
+  // Returns a reason when the method cannot be used for this amount, or null if it can
+  validate(code: string, amount?: number): string | null {
+    const method = this.methods.get(code);
+    if (!method || !method.enabled) {
+      return `must be one of: ${this.list().map(m => m.code).join(', ')}`;
+    }
+    if (amount !== undefined && method.minAmount !== undefined && amount < method.minAmount) {
+      return `${method.displayName} requires an amount of at least ${method.minAmount}`;
+    }
+    if (amount !== undefined && method.maxAmount !== undefined && amount > method.maxAmount) {
+      return `${method.displayName} accepts at most ${method.maxAmount}`;
+    }
+    return null;
+  }
+}
+
+export const paymentMethods = new PaymentMethodRegistry(loadPaymentMethods());
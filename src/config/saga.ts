@@ -0,0 +1,29 @@
+import dotenv from 'dotenv';
+
+dotenv.config();
+
+const GATEWAY_OUTCOMES = ['succeed', 'fail', 'none'];
+
+const simulatedOutcome = process.env.SIMULATED_GATEWAY_OUTCOME || 'succeed';
+if (!GATEWAY_OUTCOMES.includes(simulatedOutcome)) {
+  throw new Error(`SIMULATED_GATEWAY_OUTCOME must be one of: ${GATEWAY_OUTCOMES.join(', ')}`);
+}
+
+const sagaConfig = {
+  // How long a booking made with POST /bookings/with-payment waits for the gateway's answer before it is
+  // cancelled, and how often overdue ones are looked for
+  paymentTimeoutMinutes: parseInt(process.env.SAGA_PAYMENT_TIMEOUT_MINUTES || '15'),
+  monitorIntervalMs: parseInt(process.env.SAGA_MONITOR_INTERVAL_MS || '60000'),
+  // Outbox relay: how often it sends due messages, how many per run, and the attempts a message gets
+  // (with a doubling delay from retryDelayMs) before it is marked failed
+  outboxRelayIntervalMs: parseInt(process.env.OUTBOX_RELAY_INTERVAL_MS || '1000'),
+  outboxBatchSize: parseInt(process.env.OUTBOX_BATCH_SIZE || '20'),
+  outboxMaxAttempts: parseInt(process.env.OUTBOX_MAX_ATTEMPTS || '5'),
+  outboxRetryDelayMs: parseInt(process.env.OUTBOX_RETRY_DELAY_MS || '5000'),
+  // The built-in gateway only simulates one: it answers each charge with a payment.succeeded or payment.failed
+  // webhook after webhookDelayMs, or not at all with none (post the webhook yourself)
+  simulatedOutcome: simulatedOutcome as 'succeed' | 'fail' | 'none',
+  simulatedWebhookDelayMs: parseInt(process.env.SIMULATED_GATEWAY_WEBHOOK_DELAY_MS || '200'),
+};
+
+export { sagaConfig };
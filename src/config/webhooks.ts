@@ -0,0 +1,12 @@
+import dotenv from 'dotenv';
+
+dotenv.config();
+
+const webhookConfig = {
+  // Shared secret the payment gateway signs callbacks with; webhooks are refused while it is unset
+  paymentSecret: process.env.PAYMENT_WEBHOOK_SECRET || '',
+  // Signed timestamps older (or newer) than this are rejected, which stops replays of captured requests
+  toleranceSeconds: parseInt(process.env.PAYMENT_WEBHOOK_TOLERANCE_SECONDS || '300'),
+};
+
+export { webhookConfig };
@@ -0,0 +1,629 @@
+import { Request, Response } from 'express';
+import { AdminService } from '../services/adminService';
+import { DemoService } from '../services/demoService';
+import { SettlementService } from '../services/settlementService';
+import { PromoCodeService } from '../services/promoCodeService';
+import { SchemaService } from '../services/schemaService';
+import { RoomInventoryService } from '../services/roomInventoryService';
+import { RoomImportService } from '../services/roomImportService';
+import { LockDiagnosticsService } from '../services/lockDiagnosticsService';
+import { MAX_RECONCILIATION_DAYS, ReconciliationService } from '../services/reconciliationService';
+import { MAX_REPORT_DAYS, ReportService } from '../services/reportService';
+import { bookingConfig } from '../config/booking';
+import { logger } from '../utils/logger';
+import { secretsMatch } from '../utils/signatures';
+import { ConflictError, NotFoundError, PreconditionFailedError, ValidationError } from '../utils/errors';
+import { addDays, isValidDateString, nightsBetween, today } from '../utils/date';
+import { eventBus, Topic } from '../events/eventBus';
+
+const adminService = new AdminService();
+const demoService = new DemoService();
+const settlementService = new SettlementService();
+const promoCodeService = new PromoCodeService();
+const schemaService = new SchemaService();
+const roomInventoryService = new RoomInventoryService();
+const roomImportService = new RoomImportService();
+const lockDiagnosticsService = new LockDiagnosticsService();
+const reconciliationService = new ReconciliationService();
+const reportService = new ReportService();
+
+const OCCUPANCY_STREAM_INTERVAL_MS = parseInt(process.env.OCCUPANCY_STREAM_INTERVAL_MS || '15000');
+const OCCUPANCY_CHANGE_TOPICS: Topic[] = [
+  'booking.created', 'booking.updated', 'booking.cancelled', 'booking.status_changed', 'hold.created', 'hold.released',
+  'room.housekeeping_changed'
+];
+
+export const getConsistencySnapshot = async (req: Request, res: Response) => {
+  try {
+    const snapshot = await adminService.getConsistencySnapshot();
+
+    res.json({
+      success: true,
+      data: snapshot
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get consistency snapshot', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getOccupancyBoard = async (req: Request, res: Response) => {
+  try {
+    const date = req.query.date === undefined ? today() : req.query.date;
+    if (!isValidDateString(date)) {
+      return res.status(400).json({
+        success: false,
+        message: 'date must be in YYYY-MM-DD format'
+      });
+    }
+
+    const board = await adminService.getOccupancyBoard(date);
+
+    res.json({
+      success: true,
+      data: board
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get occupancy board', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+// Server-sent events: pushes today's board immediately, whenever bookings or holds change, and on every interval
+export const streamOccupancyBoard = (req: Request, res: Response) => {
+  res.writeHead(200, {
+    'Content-Type': 'text/event-stream',
+    'Cache-Control': 'no-cache',
+    Connection: 'keep-alive'
+  });
+
+  const push = async () => {
+    try {
+      const board = await adminService.getOccupancyBoard(today());
+      res.write(`event: occupancy\ndata: ${JSON.stringify(board)}\n\n`);
+    } catch (error) {
+      const errorMessage = error instanceof Error ? error.message : String(error);
+      logger.error('Failed to push occupancy board', { error: errorMessage });
+      res.write(`event: error\ndata: ${JSON.stringify({ message: errorMessage })}\n\n`);
+    }
+  };
+
+  // Pushes run one at a time. Changes arriving during a push, from any of the topics, only mark the board stale,
+  // so a burst of them is covered by a single extra push once the current one is done.
+  let pushing = false;
+  let stale = false;
+  let closed = false;
+  const schedulePush = () => {
+    if (closed) {
+      return;
+    }
+    if (pushing) {
+      stale = true;
+      return;
+    }
+    pushing = true;
+    push().finally(() => {
+      pushing = false;
+      if (stale) {
+        stale = false;
+        schedulePush();
+      }
+    });
+  };
+
+  schedulePush();
+  const timer = setInterval(schedulePush, OCCUPANCY_STREAM_INTERVAL_MS);
+  const unsubscribers = OCCUPANCY_CHANGE_TOPICS.map(topic => eventBus.subscribe(topic, schedulePush, {
+    name: 'occupancyStream', maxAttempts: 1
+  }));
+
+  req.on('close', () => {
+    closed = true;
+    clearInterval(timer);
+    unsubscribers.forEach(unsubscribe => unsubscribe());
+  });
+};
+
+export const getChannelReport = async (req: Request, res: Response) => {
+  try {
+    const to = req.query.to === undefined ? today() : req.query.to;
+    const from = req.query.from === undefined && isValidDateString(to) ? addDays(to, -30) : req.query.from;
+
+    if (!isValidDateString(from) || !isValidDateString(to) || from > to) {
+      return res.status(400).json({
+        success: false,
+        message: 'from and to must be dates in YYYY-MM-DD format with from <= to'
+      });
+    }
+
+    const report = await adminService.getChannelReport(from, to);
+
+    res.json({
+      success: true,
+      data: report
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get channel report', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+// from..to for the KPI reports, defaulting to the 30 days up to today; null when the range is invalid
+const reportRange = (req: Request): { from: string; to: string } | null => {
+  const to = req.query.to === undefined ? today() : req.query.to;
+  const from = req.query.from === undefined && isValidDateString(to) ? addDays(to, -30) : req.query.from;
+
+  if (!isValidDateString(from) || !isValidDateString(to) || from > to || nightsBetween(from, to) >= MAX_REPORT_DAYS) {
+    return null;
+  }
+  return { from, to };
+};
+
+export const getOccupancyReport = async (req: Request, res: Response) => {
+  try {
+    const range = reportRange(req);
+    if (!range) {
+      return res.status(400).json({
+        success: false,
+        message: `from and to must be dates in YYYY-MM-DD format with from <= to, at most ${MAX_REPORT_DAYS} days`
+      });
+    }
+
+    const report = await reportService.getOccupancyReport(range.from, range.to);
+
+    res.json({
+      success: true,
+      data: report
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get occupancy report', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getRevenueReport = async (req: Request, res: Response) => {
+  try {
+    const range = reportRange(req);
+    if (!range) {
+      return res.status(400).json({
+        success: false,
+        message: `from and to must be dates in YYYY-MM-DD format with from <= to, at most ${MAX_REPORT_DAYS} days`
+      });
+    }
+
+    const report = await reportService.getRevenueReport(range.from, range.to);
+
+    res.json({
+      success: true,
+      data: report
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get revenue report', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getCancellationAnalytics = async (req: Request, res: Response) => {
+  try {
+    const to = req.query.to === undefined ? today() : req.query.to;
+    const from = req.query.from === undefined && isValidDateString(to) ? addDays(to, -30) : req.query.from;
+
+    if (!isValidDateString(from) || !isValidDateString(to) || from > to) {
+      return res.status(400).json({
+        success: false,
+        message: 'from and to must be dates in YYYY-MM-DD format with from <= to'
+      });
+    }
+
+    const analytics = await adminService.getCancellationAnalytics(from, to);
+
+    res.json({
+      success: true,
+      data: analytics
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get cancellation analytics', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+// One day (?date=, default today) as a JSON report, or a from/to range streamed as one JSON line per day
+// (application/x-ndjson) so a long range is never built up in memory
+export const getReconciliation = async (req: Request, res: Response) => {
+  const { date, from, to } = req.query;
+
+  if (from === undefined && to === undefined) {
+    const day = date ?? today();
+    if (!isValidDateString(day)) {
+      return res.status(400).json({
+        success: false,
+        message: 'date must be a date in YYYY-MM-DD format'
+      });
+    }
+
+    try {
+      const report = await reconciliationService.reconcileDay(day);
+      return res.json({
+        success: true,
+        data: report
+      });
+    } catch (error) {
+      const errorMessage = error instanceof Error ? error.message : String(error);
+      logger.error('Failed to get reconciliation report', { error: errorMessage });
+      return res.status(500).json({
+        success: false,
+        message: errorMessage
+      });
+    }
+  }
+
+  if (date !== undefined || !isValidDateString(from) || !isValidDateString(to) || from > to ||
+    nightsBetween(from, to) >= MAX_RECONCILIATION_DAYS) {
+    return res.status(400).json({
+      success: false,
+      message: `pass either date, or from and to (YYYY-MM-DD, from <= to, at most ${MAX_RECONCILIATION_DAYS} days)`
+    });
+  }
+
+  let closed = false;
+  req.on('close', () => { closed = true; });
+  res.status(200).type('application/x-ndjson');
+
+  try {
+    for await (const day of reconciliationService.reconcileRange(from, to)) {
+      if (closed) {
+        break;
+      }
+      res.write(JSON.stringify(day) + '\n');
+    }
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Reconciliation stream failed', { error: errorMessage, from, to });
+    // Headers are gone; the last line tells the client the stream is incomplete
+    res.write(JSON.stringify({ error: errorMessage }) + '\n');
+  }
+  res.end();
+};
+
+// Runs the orphan cleanup on demand; reports only unless the body sets dryRun to false
+export const cleanupOrphans = async (req: Request, res: Response) => {
+  try {
+    const dryRun = req.body?.dryRun !== false;
+    const report = await adminService.cleanupOrphans(dryRun);
+
+    res.json({
+      success: true,
+      data: report,
+      message: dryRun ? 'Dry run: nothing was changed' : 'Orphaned rows cleaned up'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to clean up orphans', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+// Runs the integrity check now; ?days= overrides how many finished days are recomputed
+export const checkIntegrity = async (req: Request, res: Response) => {
+  try {
+    const days = req.query.days === undefined ? bookingConfig.integrityCheckDays : Number(req.query.days);
+    if (!Number.isInteger(days) || days < 1 || days > 366) {
+      return res.status(400).json({
+        success: false,
+        message: 'days must be an integer between 1 and 366'
+      });
+    }
+
+    const report = await adminService.checkIntegrity(days);
+
+    res.json({
+      success: true,
+      data: report,
+      message: report.drifts.length > 0 ? 'Drift detected' : 'No drift'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to check integrity', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+// Demo endpoints write rooms and bookings, so callers must present the configured token
+const hasDemoToken = (req: Request): boolean => {
+  const given = req.header('Authorization')?.match(/^Bearer (.+)$/)?.[1];
+  return bookingConfig.demoEndpointsToken !== '' && given !== undefined
+    && secretsMatch(given, bookingConfig.demoEndpointsToken);
+};
+
+// Sets up a sandbox room that is already booked, for exercising 409 handling in clients
+export const simulateConflict = async (req: Request, res: Response) => {
+  if (!bookingConfig.demoEndpointsEnabled) {
+    return res.status(404).json({
+      success: false,
+      message: 'Demo endpoints are disabled'
+    });
+  }
+  if (!hasDemoToken(req)) {
+    return res.status(401).json({
+      success: false,
+      message: 'A valid demo token is required'
+    });
+  }
+
+  try {
+    const simulation = await demoService.simulateConflict();
+
+    res.status(201).json({
+      success: true,
+      data: simulation,
+      message: 'Sandbox room booked; send conflictingRequest to get a 409'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to simulate conflict', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+// Staff work queue: checked-out stays whose payments don't match the booking total (?status=open|resolved)
+export const getSettlementIssues = async (req: Request, res: Response) => {
+  try {
+    const page = await settlementService.listIssues(req.query.status ?? 'open', req.query);
+
+    res.json({
+      success: true,
+      data: page
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get settlement issues', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const resolveSettlementIssue = async (req: Request, res: Response) => {
+  try {
+    const issue = await settlementService.resolveIssue(parseInt(req.params.id), req.body?.note);
+
+    res.json({
+      success: true,
+      data: issue,
+      message: 'Settlement issue resolved'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to resolve settlement issue', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(error instanceof NotFoundError ? 404 : 500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const createPromoCode = async (req: Request, res: Response) => {
+  try {
+    const promoCode = await promoCodeService.createPromoCode(req.body);
+
+    res.status(201).json({
+      success: true,
+      data: promoCode,
+      message: 'Promo code created'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to create promo code', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(error instanceof ConflictError ? 409 : 500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getPromoCodes = async (req: Request, res: Response) => {
+  try {
+    const promoCodes = await promoCodeService.listPromoCodes();
+
+    res.json({
+      success: true,
+      data: promoCodes
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get promo codes', { error: errorMessage });
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+// Table and column docs of the live database as JSON, markdown, or a mermaid / Graphviz ER diagram
+export const getSchemaDocs = async (req: Request, res: Response) => {
+  try {
+    const format = schemaService.parseFormat(req.query.format);
+    const tables = await schemaService.describe();
+
+    if (format !== 'json') {
+      return res.type(format === 'markdown' ? 'text/markdown' : 'text/plain').send(schemaService.render(tables, format));
+    }
+    res.json({
+      success: true,
+      data: tables
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get schema docs', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+// Diffs a PMS room export against the rooms table; with apply: true the plan is carried out in one transaction
+export const reconcileRoomInventory = async (req: Request, res: Response) => {
+  try {
+    const pmsRooms = roomInventoryService.parseExport(req.body);
+    if (req.body.planHash !== undefined && typeof req.body.planHash !== 'string') {
+      throw new ValidationError('Invalid PMS export', { planHash: 'must be the planHash of a previous dry run' });
+    }
+    const apply = req.body.apply === true;
+    const result = await roomInventoryService.reconcile(pmsRooms, { apply, planHash: req.body.planHash });
+
+    res.json({
+      success: true,
+      data: result,
+      message: apply ? 'Room inventory reconciled' : 'Dry run: nothing was changed'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to reconcile room inventory', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(error instanceof PreconditionFailedError ? 412 : 500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+// text/csv body; ?dryRun=true only validates and reports which rooms would be created
+export const importRooms = async (req: Request, res: Response) => {
+  try {
+    if (typeof req.body !== 'string') {
+      throw new ValidationError('Invalid room import', { csv: 'send the rooms as text/csv' });
+    }
+    const dryRun = req.query.dryRun === 'true';
+    const report = await roomImportService.importCsv(req.body, { dryRun });
+
+    res.status(dryRun || report.created === 0 ? 200 : 201).json({
+      success: true,
+      data: report,
+      message: dryRun
+        ? `Dry run: ${report.created} rooms would be created`
+        : `${report.created} rooms created, ${report.errors.length} rows rejected`
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to import rooms', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+// Lock holders and waiters right now, wait cycles among them and the deadlocks lost recently
+export const getLockDiagnostics = async (req: Request, res: Response) => {
+  if (!bookingConfig.debugEndpointsEnabled) {
+    return res.status(404).json({
+      success: false,
+      message: 'Debug endpoints are disabled'
+    });
+  }
+
+  try {
+    const diagnostics = await lockDiagnosticsService.snapshot();
+
+    res.json({
+      success: true,
+      data: diagnostics
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to read lock diagnostics', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
@@ -1,12 +1,44 @@
 import { Request, Response } from 'express';
 import { BookingService } from '../services/bookingService';
+import { WaitlistService } from '../services/waitlistService';
+import { AuditService } from '../services/auditService';
+import { BookingNoteService } from '../services/bookingNoteService';
+import { UpgradeBidService } from '../services/upgradeBidService';
+import { PaymentPlanService } from '../services/paymentPlanService';
+import { RefundService } from '../services/refundService';
+import { BookingSagaService } from '../services/bookingSagaService';
 import { logger } from '../utils/logger';
+import { metrics } from '../utils/metrics';
+import { ROOM_LOCK_STRATEGIES } from '../config/locking';
+import {
+  BookingStateError, ConflictError, NotFoundError, PreconditionFailedError, StayRestrictionError, ValidationError
+} from '../utils/errors';
+import { BookingStatus } from '../types';
+import { parseIdList } from '../utils/query';
 
 const bookingService = new BookingService();
+const waitlistService = new WaitlistService(bookingService);
+const auditService = new AuditService();
+const noteService = new BookingNoteService();
+const upgradeBidService = new UpgradeBidService();
+const paymentPlanService = new PaymentPlanService();
+const refundService = new RefundService();
+const bookingSagaService = new BookingSagaService();
+
+// Lifecycle violations are conflicts with the booking's current state, reported with a machine-readable code
+const sendBookingStateError = (res: Response, error: BookingStateError) => res.status(409).json({
+  success: false,
+  code: error.code,
+  message: error.message,
+  status: error.status,
+  requestedStatus: error.requestedStatus,
+  allowedStatuses: error.allowedStatuses
+});
 
 export const createBooking = async (req: Request, res: Response) => {
   try {
     const result = await bookingService.createBooking(req.body);
+    metrics.increment('bookings.created');
     res.status(201).json({
       success: true,
       data: result,
@@ -15,6 +47,185 @@ export const createBooking = async (req: Request, res: Response) => {
   } catch (error) {
     const errorMessage = error instanceof Error ? error.message : String(error);
     logger.error('Failed to create booking', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields,
+        ...(error instanceof StayRestrictionError ? { violations: error.violations } : {})
+      });
+    }
+
+    if (error instanceof ConflictError) {
+      // Concurrency tests compare this with the 409s their clients saw
+      metrics.increment('bookings.conflicts');
+      return res.status(409).json({
+        success: false,
+        message: errorMessage
+      });
+    }
+
+    res.status(400).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+// Books now and charges through the gateway afterwards; the saga shows whether the payment went through
+export const createBookingWithPayment = async (req: Request, res: Response) => {
+  try {
+    const result = await bookingSagaService.start(req.body);
+    metrics.increment('bookings.created');
+    res.status(202).json({
+      success: true,
+      data: result,
+      message: 'Booking created; payment is being processed'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to create booking with payment', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields,
+        ...(error instanceof StayRestrictionError ? { violations: error.violations } : {})
+      });
+    }
+
+    if (error instanceof ConflictError) {
+      metrics.increment('bookings.conflicts');
+      return res.status(409).json({
+        success: false,
+        message: errorMessage
+      });
+    }
+
+    res.status(400).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getBookingSaga = async (req: Request, res: Response) => {
+  try {
+    const saga = await bookingSagaService.getSaga(parseInt(req.params.id));
+
+    if (!saga) {
+      return res.status(404).json({
+        success: false,
+        message: 'Booking saga not found'
+      });
+    }
+
+    res.json({
+      success: true,
+      data: saga
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get booking saga', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const createAdjoiningBookings = async (req: Request, res: Response) => {
+  try {
+    const result = await bookingService.createAdjoiningBookings(req.body);
+    metrics.increment('bookings.created', result.bookings.length);
+    res.status(201).json({
+      success: true,
+      data: result,
+      message: `${result.bookings.length} adjoining rooms booked`
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to book adjoining rooms', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields,
+        ...(error instanceof StayRestrictionError ? { violations: error.violations } : {})
+      });
+    }
+
+    if (error instanceof ConflictError) {
+      metrics.increment('bookings.conflicts');
+      return res.status(409).json({
+        success: false,
+        message: errorMessage
+      });
+    }
+
+    res.status(400).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const quoteBooking = async (req: Request, res: Response) => {
+  try {
+    const quote = await bookingService.quoteStay(req.body);
+    res.json({
+      success: true,
+      data: quote
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to quote booking', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(error instanceof NotFoundError ? 404 : 500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const createHold = async (req: Request, res: Response) => {
+  try {
+    const hold = await bookingService.createHold(req.body);
+    res.status(201).json({
+      success: true,
+      data: hold,
+      message: 'Room held; pass the token as holdToken when creating the booking'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to create hold', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    if (error instanceof ConflictError) {
+      return res.status(409).json({
+        success: false,
+        message: errorMessage
+      });
+    }
+
     res.status(400).json({
       success: false,
       message: errorMessage
@@ -22,6 +233,42 @@ export const createBooking = async (req: Request, res: Response) => {
   }
 };
 
+// ?ids=1,2,3 fetches specific bookings; otherwise the query string is a search. The two don't mix: search
+// filters next to ids are rejected rather than silently ignored
+export const getBookings = async (req: Request, res: Response) => {
+  try {
+    const filters = Object.keys(req.query).filter(key => key !== 'ids');
+    if (req.query.ids !== undefined && filters.length > 0) {
+      throw new ValidationError('Invalid query', { ids: `cannot be combined with ${filters.join(', ')}` });
+    }
+
+    const result = req.query.ids !== undefined
+      ? await bookingService.getBookingsByIds(parseIdList(req.query.ids))
+      : await bookingService.searchBookings(req.query);
+
+    res.json({
+      success: true,
+      data: result
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get bookings', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
 export const getBooking = async (req: Request, res: Response) => {
   try {
     const bookingId = parseInt(req.params.id);
@@ -34,6 +281,7 @@ export const getBooking = async (req: Request, res: Response) => {
       });
     }
 
+    res.setHeader('ETag', `"${booking.version}"`);
     res.json({
       success: true,
       data: booking
@@ -48,18 +296,382 @@ export const getBooking = async (req: Request, res: Response) => {
   }
 };
 
+export const getBookingHistory = async (req: Request, res: Response) => {
+  try {
+    const history = await auditService.getBookingHistory(parseInt(req.params.id), req.query);
+
+    if (!history) {
+      return res.status(404).json({
+        success: false,
+        message: 'Booking not found'
+      });
+    }
+
+    res.json({
+      success: true,
+      data: history
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get booking history', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const addBookingNote = async (req: Request, res: Response) => {
+  try {
+    const note = await noteService.addNote(parseInt(req.params.id), req.body);
+
+    res.status(201).json({
+      success: true,
+      data: note,
+      message: 'Note added'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to add booking note', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(error instanceof NotFoundError ? 404 : 500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getBookingNotes = async (req: Request, res: Response) => {
+  try {
+    const visibility = noteService.parseVisibility(req.query.visibility);
+    const notes = await noteService.getNotes(parseInt(req.params.id), visibility);
+
+    if (!notes) {
+      return res.status(404).json({
+        success: false,
+        message: 'Booking not found'
+      });
+    }
+
+    res.json({
+      success: true,
+      data: notes
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get booking notes', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const placeUpgradeBid = async (req: Request, res: Response) => {
+  try {
+    const bid = await upgradeBidService.placeBid(parseInt(req.params.id), req.body);
+
+    res.status(201).json({
+      success: true,
+      data: bid,
+      message: 'Upgrade bid placed; it is awarded if a room of that type frees up'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to place upgrade bid', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    if (error instanceof BookingStateError) {
+      return sendBookingStateError(res, error);
+    }
+
+    const status = error instanceof NotFoundError ? 404 : error instanceof ConflictError ? 409 : 500;
+    res.status(status).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getUpgradeBids = async (req: Request, res: Response) => {
+  try {
+    const bids = await upgradeBidService.getBids(parseInt(req.params.id));
+
+    if (!bids) {
+      return res.status(404).json({
+        success: false,
+        message: 'Booking not found'
+      });
+    }
+
+    res.json({
+      success: true,
+      data: bids
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get upgrade bids', { error: errorMessage });
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getPaymentPlan = async (req: Request, res: Response) => {
+  try {
+    const plan = await paymentPlanService.getPlan(parseInt(req.params.id));
+
+    if (!plan) {
+      return res.status(404).json({
+        success: false,
+        message: 'Booking not found'
+      });
+    }
+
+    res.json({
+      success: true,
+      data: plan
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get payment plan', { error: errorMessage });
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const payInstallment = async (req: Request, res: Response) => {
+  try {
+    const result = await paymentPlanService.payNextInstallment(parseInt(req.params.id), req.body?.paymentMethod);
+
+    res.status(201).json({
+      success: true,
+      data: result,
+      message: `Installment ${result.installment.sequence} paid`
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to pay installment', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    if (error instanceof BookingStateError) {
+      return sendBookingStateError(res, error);
+    }
+
+    const status = error instanceof NotFoundError ? 404 : error instanceof ConflictError ? 409 : 500;
+    res.status(status).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getRefunds = async (req: Request, res: Response) => {
+  try {
+    const refunds = await refundService.getRefunds(parseInt(req.params.id));
+
+    if (!refunds) {
+      return res.status(404).json({
+        success: false,
+        message: 'Booking not found'
+      });
+    }
+
+    res.json({
+      success: true,
+      data: refunds
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get refunds', { error: errorMessage });
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+// Starts the refund and answers 202: the money moves once the gateway settles it, so poll GET .../refunds
+export const requestRefund = async (req: Request, res: Response) => {
+  try {
+    const refund = await refundService.requestRefund(parseInt(req.params.id), req.body || {});
+
+    res.status(202).json({
+      success: true,
+      data: refund,
+      message: refund.status === 'failed' ? `Refund could not be started: ${refund.failure_reason}` : 'Refund requested'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to request refund', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    if (error instanceof BookingStateError) {
+      return sendBookingStateError(res, error);
+    }
+
+    const status = error instanceof NotFoundError ? 404 : error instanceof ConflictError ? 409 : 500;
+    res.status(status).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const updateBooking = async (req: Request, res: Response) => {
+  try {
+    const bookingId = parseInt(req.params.id);
+    const ifMatch = req.header('If-Match');
+    if (!ifMatch) {
+      return res.status(428).json({
+        success: false,
+        message: 'If-Match header with the booking ETag is required'
+      });
+    }
+
+    // "*" matches any version; otherwise the ETag is the quoted version number
+    const expectedVersion = ifMatch.trim() === '*' ? undefined : parseInt(ifMatch.replace(/^W\//, '').replace(/"/g, ''));
+    if (expectedVersion !== undefined && isNaN(expectedVersion)) {
+      return res.status(400).json({
+        success: false,
+        message: 'If-Match must be an ETag returned by GET /bookings/:id'
+      });
+    }
+
+    const booking = await bookingService.updateBooking(bookingId, req.body, expectedVersion);
+
+    res.setHeader('ETag', `"${booking.version}"`);
+    res.json({
+      success: true,
+      data: booking,
+      message: 'Booking updated successfully'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to update booking', { error: errorMessage });
+
+    if (error instanceof BookingStateError) {
+      return sendBookingStateError(res, error);
+    }
+
+    if (error instanceof PreconditionFailedError) {
+      return res.status(412).json({
+        success: false,
+        message: errorMessage,
+        currentVersion: error.currentVersion
+      });
+    }
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    const status = error instanceof NotFoundError ? 404 : error instanceof ConflictError ? 409 : 400;
+    res.status(status).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
 export const cancelBooking = async (req: Request, res: Response) => {
   try {
     const bookingId = parseInt(req.params.id);
-    await bookingService.cancelBooking(bookingId);
+    const { reasonCode, reasonText } = req.body || {};
+    const cancellation = await bookingService.cancelBooking(bookingId, { code: reasonCode, text: reasonText });
     
     res.json({
       success: true,
+      data: cancellation,
       message: 'Booking cancelled successfully'
     });
   } catch (error) {
     const errorMessage = error instanceof Error ? error.message : String(error);
     logger.error('Failed to cancel booking', { error: errorMessage });
+
+    if (error instanceof BookingStateError) {
+      return sendBookingStateError(res, error);
+    }
+
+    if (error instanceof NotFoundError) {
+      return res.status(404).json({
+        success: false,
+        message: errorMessage
+      });
+    }
+
+    if (error instanceof ConflictError) {
+      return res.status(409).json({
+        success: false,
+        message: errorMessage
+      });
+    }
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
     res.status(400).json({
       success: false,
       message: errorMessage
@@ -67,6 +679,148 @@ export const cancelBooking = async (req: Request, res: Response) => {
   }
 };
 
+export const joinWaitlist = async (req: Request, res: Response) => {
+  try {
+    const entry = await waitlistService.join(req.body);
+
+    res.status(201).json({
+      success: true,
+      data: entry,
+      message: entry.auto_book
+        ? 'Added to the waitlist; the room will be booked automatically when it frees up'
+        : 'Added to the waitlist; you will be notified when the room frees up'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to join waitlist', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    if (error instanceof ConflictError) {
+      return res.status(409).json({
+        success: false,
+        message: errorMessage
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getWaitlistEntry = async (req: Request, res: Response) => {
+  try {
+    const entry = await waitlistService.getEntry(parseInt(req.params.id));
+
+    if (!entry) {
+      return res.status(404).json({
+        success: false,
+        message: 'Waitlist entry not found'
+      });
+    }
+
+    res.json({
+      success: true,
+      data: entry
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get waitlist entry', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+// One handler per lifecycle move: confirm, check in, check out, no-show
+const changeBookingStatus = (to: Exclude<BookingStatus, 'pending' | 'cancelled'>) => async (req: Request, res: Response) => {
+  try {
+    const bookingId = parseInt(req.params.id);
+    const booking = await bookingService.changeStatus(bookingId, to);
+
+    res.setHeader('ETag', `"${booking.version}"`);
+    res.json({
+      success: true,
+      data: booking,
+      message: `Booking is now ${to}`
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to change booking status', { error: errorMessage, to });
+
+    if (error instanceof BookingStateError) {
+      return sendBookingStateError(res, error);
+    }
+
+    res.status(error instanceof NotFoundError ? 404 : error instanceof ConflictError ? 409 : 500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const confirmBooking = changeBookingStatus('confirmed');
+export const checkInBooking = changeBookingStatus('checked_in');
+export const checkOutBooking = changeBookingStatus('checked_out');
+export const markBookingNoShow = changeBookingStatus('no_show');
+
+export const bulkUpdateRoomPricing = async (req: Request, res: Response) => {
+  try {
+    const { roomIds, priceAdjustment } = req.body;
+    const fields: Record<string, string> = {};
+
+    if (!Array.isArray(roomIds) || roomIds.length === 0 ||
+      !roomIds.every(id => Number.isInteger(id) && id > 0)) {
+      fields.roomIds = 'must be a non-empty array of room ids';
+    }
+    if (typeof priceAdjustment !== 'number' || !Number.isFinite(priceAdjustment)) {
+      fields.priceAdjustment = 'must be a number';
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid pricing request', fields);
+    }
+
+    const outcomes = await bookingService.bulkUpdateRoomPricing(roomIds, priceAdjustment);
+
+    res.json({
+      success: true,
+      data: outcomes
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to update room pricing', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    if (error instanceof ConflictError) {
+      return res.status(409).json({
+        success: false,
+        message: errorMessage
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
 export const setRowLocking = async (req: Request, res: Response) => {
   try {
     const { enabled } = req.body;
@@ -84,4 +838,49 @@ export const setRowLocking = async (req: Request, res: Response) => {
       message: errorMessage
     });
   }
-};
\ No newline at end of file
+};
+
+export const setBookingQueue = async (req: Request, res: Response) => {
+  try {
+    const { enabled } = req.body;
+    bookingService.setBookingQueue(enabled === true);
+
+    res.json({
+      success: true,
+      message: `Booking queue ${enabled === true ? 'enabled' : 'disabled'}`
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to set booking queue', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const setLockStrategy = async (req: Request, res: Response) => {
+  try {
+    const { strategy } = req.body;
+    if (!ROOM_LOCK_STRATEGIES.includes(strategy)) {
+      return res.status(400).json({
+        success: false,
+        message: 'Invalid lock strategy',
+        errors: { strategy: `must be one of: ${ROOM_LOCK_STRATEGIES.join(', ')}` }
+      });
+    }
+    bookingService.setLockStrategy(strategy);
+
+    res.json({
+      success: true,
+      message: `Room lock strategy set to ${strategy}`
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to set room lock strategy', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
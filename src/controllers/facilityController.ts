@@ -0,0 +1,116 @@
+import { Request, Response } from 'express';
+import { FacilityService } from '../services/facilityService';
+import { logger } from '../utils/logger';
+import { ConflictError, NotFoundError, ValidationError } from '../utils/errors';
+
+const facilityService = new FacilityService();
+
+const sendFacilityError = (res: Response, error: unknown) => {
+  const errorMessage = error instanceof Error ? error.message : String(error);
+
+  if (error instanceof ValidationError) {
+    return res.status(400).json({
+      success: false,
+      message: errorMessage,
+      errors: error.fields
+    });
+  }
+
+  const status = error instanceof NotFoundError ? 404 : error instanceof ConflictError ? 409 : 500;
+  res.status(status).json({
+    success: false,
+    message: errorMessage
+  });
+};
+
+export const listFacilities = async (req: Request, res: Response) => {
+  try {
+    const facilities = await facilityService.listFacilities();
+
+    res.json({
+      success: true,
+      data: facilities
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to list facilities', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const createFacility = async (req: Request, res: Response) => {
+  try {
+    const facility = await facilityService.createFacility(req.body || {});
+
+    res.status(201).json({
+      success: true,
+      data: facility,
+      message: 'Facility created'
+    });
+  } catch (error) {
+    logger.error('Failed to create facility', { error: error instanceof Error ? error.message : String(error) });
+    sendFacilityError(res, error);
+  }
+};
+
+export const updateFacility = async (req: Request, res: Response) => {
+  try {
+    const facility = await facilityService.updateFacility(parseInt(req.params.id), req.body || {});
+
+    res.json({
+      success: true,
+      data: facility,
+      message: 'Facility updated'
+    });
+  } catch (error) {
+    logger.error('Failed to update facility', { error: error instanceof Error ? error.message : String(error) });
+    sendFacilityError(res, error);
+  }
+};
+
+// ?force=true also detaches the facility from the room types using it
+export const deleteFacility = async (req: Request, res: Response) => {
+  try {
+    await facilityService.deleteFacility(parseInt(req.params.id), req.query.force === 'true');
+
+    res.json({
+      success: true,
+      message: 'Facility deleted'
+    });
+  } catch (error) {
+    logger.error('Failed to delete facility', { error: error instanceof Error ? error.message : String(error) });
+    sendFacilityError(res, error);
+  }
+};
+
+export const attachFacility = async (req: Request, res: Response) => {
+  try {
+    const facility = await facilityService.attach(req.params.roomType, parseInt(req.params.facilityId));
+
+    res.json({
+      success: true,
+      data: facility,
+      message: 'Facility attached'
+    });
+  } catch (error) {
+    logger.error('Failed to attach facility', { error: error instanceof Error ? error.message : String(error) });
+    sendFacilityError(res, error);
+  }
+};
+
+export const detachFacility = async (req: Request, res: Response) => {
+  try {
+    await facilityService.detach(req.params.roomType, parseInt(req.params.facilityId));
+
+    res.json({
+      success: true,
+      message: 'Facility detached'
+    });
+  } catch (error) {
+    logger.error('Failed to detach facility', { error: error instanceof Error ? error.message : String(error) });
+    sendFacilityError(res, error);
+  }
+};
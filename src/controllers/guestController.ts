@@ -0,0 +1,130 @@
+import { Request, Response } from 'express';
+import { GuestService } from '../services/guestService';
+import { BookingService } from '../services/bookingService';
+import { LoyaltyService } from '../services/loyaltyService';
+import { logger } from '../utils/logger';
+import { ConflictError, NotFoundError, ValidationError } from '../utils/errors';
+
+const guestService = new GuestService();
+const bookingService = new BookingService();
+const loyaltyService = new LoyaltyService();
+
+const sendGuestError = (res: Response, error: unknown, action: string) => {
+  const errorMessage = error instanceof Error ? error.message : String(error);
+  logger.error(`Failed to ${action}`, { error: errorMessage });
+
+  if (error instanceof ValidationError) {
+    return res.status(400).json({
+      success: false,
+      message: errorMessage,
+      errors: error.fields
+    });
+  }
+
+  const status = error instanceof NotFoundError ? 404 : error instanceof ConflictError ? 409 : 500;
+  res.status(status).json({
+    success: false,
+    message: errorMessage
+  });
+};
+
+export const createGuest = async (req: Request, res: Response) => {
+  try {
+    const guest = await guestService.createGuest(req.body);
+
+    res.status(201).json({
+      success: true,
+      data: guest,
+      message: 'Guest created successfully'
+    });
+  } catch (error) {
+    sendGuestError(res, error, 'create guest');
+  }
+};
+
+export const getGuest = async (req: Request, res: Response) => {
+  try {
+    const guest = await guestService.getGuest(parseInt(req.params.id));
+
+    if (!guest) {
+      return res.status(404).json({
+        success: false,
+        message: 'Guest not found'
+      });
+    }
+
+    res.json({
+      success: true,
+      data: guest
+    });
+  } catch (error) {
+    sendGuestError(res, error, 'get guest');
+  }
+};
+
+export const updateGuest = async (req: Request, res: Response) => {
+  try {
+    const guest = await guestService.updateGuest(parseInt(req.params.id), req.body);
+
+    res.json({
+      success: true,
+      data: guest,
+      message: 'Guest updated successfully'
+    });
+  } catch (error) {
+    sendGuestError(res, error, 'update guest');
+  }
+};
+
+export const deleteGuest = async (req: Request, res: Response) => {
+  try {
+    await guestService.deleteGuest(parseInt(req.params.id));
+
+    res.json({
+      success: true,
+      message: 'Guest deleted successfully'
+    });
+  } catch (error) {
+    sendGuestError(res, error, 'delete guest');
+  }
+};
+
+export const getGuestBookings = async (req: Request, res: Response) => {
+  try {
+    const guestId = parseInt(req.params.id);
+    if (!await guestService.getGuest(guestId)) {
+      return res.status(404).json({
+        success: false,
+        message: 'Guest not found'
+      });
+    }
+
+    const bookings = await bookingService.getBookingsForGuest(guestId);
+
+    res.json({
+      success: true,
+      data: bookings
+    });
+  } catch (error) {
+    sendGuestError(res, error, 'get guest bookings');
+  }
+};
+
+export const getGuestLoyalty = async (req: Request, res: Response) => {
+  try {
+    const account = await loyaltyService.getAccount(parseInt(req.params.id));
+    if (!account) {
+      return res.status(404).json({
+        success: false,
+        message: 'Guest not found'
+      });
+    }
+
+    res.json({
+      success: true,
+      data: account
+    });
+  } catch (error) {
+    sendGuestError(res, error, 'get guest loyalty points');
+  }
+};
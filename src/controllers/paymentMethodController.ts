@@ -0,0 +1,50 @@
+import { Request, Response } from 'express';
+import { paymentMethods } from '../config/paymentMethods';
+import { PaymentMethodService } from '../services/paymentMethodService';
+import { logger } from '../utils/logger';
+import { ValidationError } from '../utils/errors';
+
+const paymentMethodService = new PaymentMethodService();
+
+export const listPaymentMethods = (req: Request, res: Response) => {
+  res.json({
+    success: true,
+    data: paymentMethods.list()
+  });
+};
+
+// Disabled methods included
+export const listAllPaymentMethods = (req: Request, res: Response) => {
+  res.json({
+    success: true,
+    data: paymentMethods.all()
+  });
+};
+
+export const savePaymentMethod = async (req: Request, res: Response) => {
+  try {
+    const method = await paymentMethodService.saveMethod(req.params.code, req.body);
+
+    res.json({
+      success: true,
+      data: method,
+      message: 'Payment method saved'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to save payment method', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
@@ -0,0 +1,100 @@
+import { Request, Response } from 'express';
+import { RatePlanService } from '../services/ratePlanService';
+import { logger } from '../utils/logger';
+import { NotFoundError, ValidationError } from '../utils/errors';
+
+const ratePlanService = new RatePlanService();
+
+export const listRatePlans = async (req: Request, res: Response) => {
+  try {
+    const plans = await ratePlanService.listPlans();
+
+    res.json({
+      success: true,
+      data: plans
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to list rate plans', { error: errorMessage });
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const saveRatePlan = async (req: Request, res: Response) => {
+  try {
+    const plan = await ratePlanService.savePlan(req.params.roomType, req.body || {});
+
+    res.json({
+      success: true,
+      data: plan,
+      message: 'Rate plan saved'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to save rate plan', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const addRateSeason = async (req: Request, res: Response) => {
+  try {
+    const season = await ratePlanService.addSeason(req.params.roomType, req.body || {});
+
+    res.status(201).json({
+      success: true,
+      data: season,
+      message: 'Rate season added'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to add rate season', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const removeRateSeason = async (req: Request, res: Response) => {
+  try {
+    await ratePlanService.removeSeason(parseInt(req.params.id));
+
+    res.json({
+      success: true,
+      message: 'Rate season removed'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to remove rate season', { error: errorMessage });
+
+    res.status(error instanceof NotFoundError ? 404 : 500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
@@ -0,0 +1,145 @@
+import { Request, Response } from 'express';
+import { ReceiptService } from '../services/receiptService';
+import { DisputeService } from '../services/disputeService';
+import { logger } from '../utils/logger';
+import { ConflictError, NotFoundError, ValidationError } from '../utils/errors';
+import { parseIdList } from '../utils/query';
+
+const receiptService = new ReceiptService();
+const disputeService = new DisputeService();
+
+export const getReceipts = async (req: Request, res: Response) => {
+  try {
+    const receiptIds = parseIdList(req.query.ids);
+    const result = await receiptService.getReceiptsByIds(receiptIds);
+
+    res.json({
+      success: true,
+      data: result
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get receipts', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getReceipt = async (req: Request, res: Response) => {
+  try {
+    const receiptId = parseInt(req.params.id);
+    const receipt = await receiptService.getReceipt(receiptId);
+
+    if (!receipt) {
+      return res.status(404).json({
+        success: false,
+        message: 'Receipt not found'
+      });
+    }
+
+    res.json({
+      success: true,
+      data: receipt
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get receipt', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const openDispute = async (req: Request, res: Response) => {
+  try {
+    const dispute = await disputeService.openDispute(parseInt(req.params.id), req.body ?? {});
+
+    res.status(201).json({
+      success: true,
+      data: dispute,
+      message: 'Dispute opened; the booking cannot be changed or cancelled until it is resolved'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to open dispute', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    const status = error instanceof NotFoundError ? 404 : error instanceof ConflictError ? 409 : 500;
+    res.status(status).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getDisputes = async (req: Request, res: Response) => {
+  try {
+    const disputes = await disputeService.getDisputes(parseInt(req.params.id));
+
+    if (!disputes) {
+      return res.status(404).json({
+        success: false,
+        message: 'Receipt not found'
+      });
+    }
+
+    res.json({
+      success: true,
+      data: disputes
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get disputes', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const resolveDispute = async (req: Request, res: Response) => {
+  try {
+    const dispute = await disputeService.resolveDispute(parseInt(req.params.id), req.body ?? {});
+
+    res.json({
+      success: true,
+      data: dispute,
+      message: dispute.status === 'lost' ? 'Dispute lost; the amount was charged back' : 'Dispute won'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to resolve dispute', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(error instanceof NotFoundError ? 404 : 500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
@@ -0,0 +1,420 @@
+import { Request, Response } from 'express';
+import { RoomService } from '../services/roomService';
+import { MaintenanceService } from '../services/maintenanceService';
+import { HousekeepingService } from '../services/housekeepingService';
+import { RoomPhotoService } from '../services/roomPhotoService';
+import { AdjoiningRoomService } from '../services/adjoiningRoomService';
+import { RoomStatusHistoryService } from '../services/roomStatusHistoryService';
+import { parseMultipart } from '../utils/multipart';
+import { logger } from '../utils/logger';
+import { ConflictError, NotFoundError, ValidationError } from '../utils/errors';
+
+const roomService = new RoomService();
+const maintenanceService = new MaintenanceService();
+const housekeepingService = new HousekeepingService();
+const roomPhotoService = new RoomPhotoService();
+const adjoiningRoomService = new AdjoiningRoomService();
+const roomStatusHistoryService = new RoomStatusHistoryService();
+
+export const listRoomTypes = async (req: Request, res: Response) => {
+  try {
+    const roomTypes = await roomService.listRoomTypes();
+
+    res.json({
+      success: true,
+      data: roomTypes
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to list room types', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const compareRoomTypes = async (req: Request, res: Response) => {
+  try {
+    const types = typeof req.query.types === 'string'
+      ? req.query.types.split(',').map(type => type.trim()).filter(type => type !== '')
+      : [];
+
+    if (types.length < 2) {
+      return res.status(400).json({
+        success: false,
+        message: 'Provide at least two room types to compare, e.g. ?types=Standard,Deluxe'
+      });
+    }
+
+    const comparison = await roomService.compareRoomTypes(types);
+
+    res.json({
+      success: true,
+      data: comparison
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to compare room types', { error: errorMessage });
+    res.status(error instanceof NotFoundError ? 404 : 500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const createMaintenanceBlock = async (req: Request, res: Response) => {
+  try {
+    const block = await maintenanceService.createBlock(parseInt(req.params.id), req.body || {});
+
+    res.status(201).json({
+      success: true,
+      data: block,
+      message: 'Room taken out of service for maintenance'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to create maintenance block', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    const status = error instanceof NotFoundError ? 404 : error instanceof ConflictError ? 409 : 500;
+    res.status(status).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getMaintenanceBlocks = async (req: Request, res: Response) => {
+  try {
+    const blocks = await maintenanceService.listBlocks(parseInt(req.params.id));
+
+    if (!blocks) {
+      return res.status(404).json({
+        success: false,
+        message: 'Room not found'
+      });
+    }
+
+    res.json({
+      success: true,
+      data: blocks
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get maintenance blocks', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const cancelMaintenanceBlock = async (req: Request, res: Response) => {
+  try {
+    const block = await maintenanceService.cancelBlock(parseInt(req.params.id), parseInt(req.params.blockId));
+
+    res.json({
+      success: true,
+      data: block,
+      message: 'Room back in service'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to cancel maintenance block', { error: errorMessage });
+    res.status(error instanceof NotFoundError ? 404 : 500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const updateRoomAttributes = async (req: Request, res: Response) => {
+  try {
+    const room = await roomService.updateAttributes(parseInt(req.params.id), req.body ?? {});
+
+    res.json({
+      success: true,
+      data: room,
+      message: 'Room attributes updated'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to update room attributes', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(error instanceof NotFoundError ? 404 : 500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getRoomStatusHistory = async (req: Request, res: Response) => {
+  try {
+    const history = await roomStatusHistoryService.getHistory(parseInt(req.params.id), req.query);
+
+    if (!history) {
+      return res.status(404).json({
+        success: false,
+        message: 'Room not found'
+      });
+    }
+
+    res.json({
+      success: true,
+      data: history
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get room status history', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+// ?checkInDate=&checkOutDate=&rooms=2&roomType=
+export const searchAdjoiningRooms = async (req: Request, res: Response) => {
+  try {
+    const sets = await adjoiningRoomService.findSets({
+      checkInDate: req.query.checkInDate as string,
+      checkOutDate: req.query.checkOutDate as string,
+      rooms: req.query.rooms === undefined ? 2 : Number(req.query.rooms),
+      roomType: req.query.roomType as string | undefined
+    });
+
+    res.json({
+      success: true,
+      data: sets
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to search adjoining rooms', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getAdjoiningRooms = async (req: Request, res: Response) => {
+  try {
+    const roomIds = await adjoiningRoomService.listAdjoining(parseInt(req.params.id));
+
+    res.json({
+      success: true,
+      data: roomIds
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get adjoining rooms', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+const sendAdjoiningError = (res: Response, error: unknown) => {
+  const errorMessage = error instanceof Error ? error.message : String(error);
+  logger.error('Failed to update adjoining rooms', { error: errorMessage });
+
+  if (error instanceof ValidationError) {
+    return res.status(400).json({
+      success: false,
+      message: errorMessage,
+      errors: error.fields
+    });
+  }
+
+  res.status(error instanceof NotFoundError ? 404 : 500).json({
+    success: false,
+    message: errorMessage
+  });
+};
+
+export const linkAdjoiningRoom = async (req: Request, res: Response) => {
+  try {
+    const roomIds = await adjoiningRoomService.link(parseInt(req.params.id), parseInt(req.params.otherId));
+
+    res.json({
+      success: true,
+      data: roomIds,
+      message: 'Rooms marked as adjoining'
+    });
+  } catch (error) {
+    sendAdjoiningError(res, error);
+  }
+};
+
+export const unlinkAdjoiningRoom = async (req: Request, res: Response) => {
+  try {
+    const roomIds = await adjoiningRoomService.unlink(parseInt(req.params.id), parseInt(req.params.otherId));
+
+    res.json({
+      success: true,
+      data: roomIds,
+      message: 'Rooms no longer adjoining'
+    });
+  } catch (error) {
+    sendAdjoiningError(res, error);
+  }
+};
+
+export const updateHousekeepingStatus = async (req: Request, res: Response) => {
+  try {
+    const room = await housekeepingService.setStatus(parseInt(req.params.id), req.body?.status);
+
+    res.json({
+      success: true,
+      data: room,
+      message: `Room marked ${room.housekeeping_status}`
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to update housekeeping status', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    const status = error instanceof NotFoundError ? 404 : error instanceof ConflictError ? 409 : 500;
+    res.status(status).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getHousekeepingTasks = async (req: Request, res: Response) => {
+  try {
+    const tasks = await housekeepingService.taskList(req.query.date);
+
+    res.json({
+      success: true,
+      data: tasks
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get housekeeping tasks', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+// multipart/form-data with a "photo" file and optional "caption" and "position"; the route buffers the raw body
+export const uploadRoomTypePhoto = async (req: Request, res: Response) => {
+  try {
+    if (!Buffer.isBuffer(req.body)) {
+      throw new ValidationError('Invalid upload', { body: 'must be multipart/form-data' });
+    }
+    const photo = await roomPhotoService.addPhoto(req.params.roomType, await parseMultipart(req.body, req.headers['content-type']));
+
+    res.status(201).json({
+      success: true,
+      data: photo,
+      message: 'Photo uploaded'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to upload room type photo', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(error instanceof NotFoundError ? 404 : 500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const getRoomTypePhotos = async (req: Request, res: Response) => {
+  try {
+    const photos = await roomPhotoService.listPhotos(req.params.roomType);
+
+    res.json({
+      success: true,
+      data: photos
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to get room type photos', { error: errorMessage });
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const deleteRoomTypePhoto = async (req: Request, res: Response) => {
+  try {
+    await roomPhotoService.deletePhoto(req.params.roomType, parseInt(req.params.photoId));
+
+    res.json({
+      success: true,
+      message: 'Photo deleted'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to delete room type photo', { error: errorMessage });
+    res.status(error instanceof NotFoundError ? 404 : 500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
@@ -0,0 +1,72 @@
+import { Request, Response } from 'express';
+import { StayRestrictionService } from '../services/stayRestrictionService';
+import { logger } from '../utils/logger';
+import { NotFoundError, ValidationError } from '../utils/errors';
+
+const stayRestrictionService = new StayRestrictionService();
+
+export const listStayRestrictions = async (req: Request, res: Response) => {
+  try {
+    const restrictions = await stayRestrictionService.listRestrictions();
+
+    res.json({
+      success: true,
+      data: restrictions
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to list stay restrictions', { error: errorMessage });
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const saveStayRestrictions = async (req: Request, res: Response) => {
+  try {
+    const restrictions = await stayRestrictionService.saveRestrictions(req.params.roomType, req.body || {});
+
+    res.json({
+      success: true,
+      data: restrictions,
+      message: 'Stay restrictions saved'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to save stay restrictions', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(error instanceof NotFoundError ? 404 : 500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
+
+export const removeStayRestrictions = async (req: Request, res: Response) => {
+  try {
+    await stayRestrictionService.removeRestrictions(req.params.roomType);
+
+    res.json({
+      success: true,
+      message: 'Stay restrictions removed'
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to remove stay restrictions', { error: errorMessage });
+
+    res.status(error instanceof NotFoundError ? 404 : 500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
@@ -0,0 +1,61 @@
+import { Request, Response } from 'express';
+import { PaymentWebhookService } from '../services/paymentWebhookService';
+import { webhookConfig } from '../config/webhooks';
+import { verifySignature } from '../utils/signatures';
+import { logger } from '../utils/logger';
+import { ValidationError } from '../utils/errors';
+
+const paymentWebhookService = new PaymentWebhookService();
+
+// Gateway callback: signed with PAYMENT_WEBHOOK_SECRET over the raw body. Duplicates and out-of-order
+// deliveries are acknowledged with 200 so the gateway stops retrying them; an event for an unknown transaction
+// gets 404 so it is retried, since the gateway may call back before the payment it is about has been committed.
+export const receivePaymentWebhook = async (req: Request, res: Response) => {
+  if (!webhookConfig.paymentSecret) {
+    return res.status(503).json({
+      success: false,
+      message: 'Payment webhooks are not configured'
+    });
+  }
+
+  const rawBody: Buffer = (req as any).rawBody ?? Buffer.from('');
+  if (!verifySignature(req.header('X-Signature'), rawBody, webhookConfig.paymentSecret, webhookConfig.toleranceSeconds)) {
+    logger.warn('Rejected payment webhook with an invalid signature');
+    return res.status(401).json({
+      success: false,
+      message: 'Invalid webhook signature'
+    });
+  }
+
+  try {
+    const result = await paymentWebhookService.handleEvent(req.body);
+    if (result.outcome === 'unmatched') {
+      return res.status(404).json({
+        success: false,
+        data: result,
+        message: 'No payment or refund matches this transaction yet'
+      });
+    }
+
+    res.json({
+      success: true,
+      data: result
+    });
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Failed to handle payment webhook', { error: errorMessage });
+
+    if (error instanceof ValidationError) {
+      return res.status(400).json({
+        success: false,
+        message: errorMessage,
+        errors: error.fields
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      message: errorMessage
+    });
+  }
+};
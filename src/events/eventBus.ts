@@ -0,0 +1,177 @@
+import { logger } from '../utils/logger';
+import { metrics } from '../utils/metrics';
+import { degradation } from '../utils/degradation';
+import { degradationConfig } from '../config/degradation';
+
+// Payload carried by each topic; publishers and subscribers are checked against this map
+export interface EventTopics {
+  'booking.created': { bookingId: number; roomId: number; guestId: number };
+  'booking.updated': { bookingId: number; fields: string[] };
+  'booking.cancelled': { bookingId: number; roomId: number; reasonCode: string };
+  'booking.status_changed': { bookingId: number; roomId: number; from: string; to: string };
+  'hold.created': { holdId: number; roomId: number };
+  'hold.released': { count: number };
+  'room.housekeeping_changed': { roomId: number; status: string };
+  'waitlist.notified': { entryId: number; roomId: number; guestEmail: string };
+  'waitlist.promoted': { entryId: number; roomId: number; bookingId: number };
+  'upgrade.awarded': { bidId: number; bookingId: number; fromRoomId: number; toRoomId: number };
+  'receipt.issued': { receiptId: number; bookingId: number };
+}
+
+export type Topic = keyof EventTopics;
+
+// What to do when a subscriber's buffer is full: evict the oldest queued event or drop the new one
+export type OverflowPolicy = 'drop_oldest' | 'drop_newest';
+
+export interface SubscribeOptions {
+  name: string;
+  concurrency?: number;
+  bufferSize?: number;
+  overflow?: OverflowPolicy;
+  maxAttempts?: number;
+  retryDelayMs?: number;
+}
+
+type Handler<T extends Topic> = (payload: EventTopics[T]) => void | Promise<void>;
+
+const wait = (ms: number) => new Promise(resolve => setTimeout(resolve, ms));
+
+// One subscriber's bounded queue, drained by up to `concurrency` workers. A handler that throws is
+// retried, so delivery is at-least-once for the life of the process.
+class Subscription<T extends Topic> {
+  private queue: EventTopics[T][] = [];
+  private active = 0;
+  private closed = false;
+  private readonly concurrency: number;
+  private readonly bufferSize: number;
+  private readonly overflow: OverflowPolicy;
+  private readonly maxAttempts: number;
+  private readonly retryDelayMs: number;
+
+  constructor(private topic: T, private handler: Handler<T>, private options: SubscribeOptions) {
+    this.concurrency = options.concurrency ?? 1;
+    this.bufferSize = options.bufferSize ?? 1000;
+    this.overflow = options.overflow ?? 'drop_oldest';
+    this.maxAttempts = options.maxAttempts ?? 3;
+    this.retryDelayMs = options.retryDelayMs ?? 100;
+  }
+
+  enqueue(payload: EventTopics[T]): boolean {
+    if (this.closed) {
+      return false;
+    }
+
+    if (this.queue.length >= this.bufferSize) {
+      metrics.increment(`events.dropped.${this.topic}`);
+      logger.warn('Event buffer full', { topic: this.topic, subscriber: this.options.name, overflow: this.overflow });
+      if (this.overflow === 'drop_newest') {
+        return false;
+      }
+      this.queue.shift();
+    }
+
+    this.queue.push(payload);
+    this.drain();
+    return true;
+  }
+
+  // Share of the buffer holding undelivered events
+  backlog(): { subscriber: string; ratio: number } {
+    return { subscriber: this.options.name, ratio: this.queue.length / this.bufferSize };
+  }
+
+  close() {
+    this.closed = true;
+    this.queue = [];
+  }
+
+  private drain() {
+    while (this.active < this.concurrency && this.queue.length > 0) {
+      const payload = this.queue.shift()!;
+      this.active++;
+      this.deliver(payload).finally(() => {
+        this.active--;
+        this.drain();
+      });
+    }
+  }
+
+  private async deliver(payload: EventTopics[T]) {
+    for (let attempt = 1; attempt <= this.maxAttempts; attempt++) {
+      try {
+        await this.handler(payload);
+        metrics.increment(`events.delivered.${this.topic}`);
+        return;
+      } catch (error) {
+        const errorMessage = error instanceof Error ? error.message : String(error);
+        if (attempt === this.maxAttempts || this.closed) {
+          metrics.increment(`events.failed.${this.topic}`);
+          logger.error('Event delivery failed', {
+            topic: this.topic, subscriber: this.options.name, attempts: attempt, error: errorMessage
+          });
+          return;
+        }
+        await wait(this.retryDelayMs * attempt);
+      }
+    }
+  }
+}
+
+class EventBus {
+  private static instance: EventBus;
+  private subscriptions = new Map<Topic, Set<Subscription<any>>>();
+
+  private constructor() {}
+
+  static getInstance(): EventBus {
+    if (!EventBus.instance) {
+      EventBus.instance = new EventBus();
+    }
+    return EventBus.instance;
+  }
+
+  // Returns an unsubscribe function; events still queued for the subscriber are discarded
+  subscribe<T extends Topic>(topic: T, handler: Handler<T>, options: SubscribeOptions): () => void {
+    const subscription = new Subscription(topic, handler, options);
+    if (!this.subscriptions.has(topic)) {
+      this.subscriptions.set(topic, new Set());
+    }
+    this.subscriptions.get(topic)!.add(subscription);
+
+    return () => {
+      subscription.close();
+      this.subscriptions.get(topic)?.delete(subscription);
+    };
+  }
+
+  // Never blocks the publisher; returns how many subscribers accepted the event
+  publish<T extends Topic>(topic: T, payload: EventTopics[T]): number {
+    metrics.increment(`events.published.${topic}`);
+    let accepted = 0;
+    this.subscriptions.get(topic)?.forEach(subscription => {
+      if (subscription.enqueue(payload)) {
+        accepted++;
+      }
+    });
+    return accepted;
+  }
+
+  // Subscribers whose buffer is at least `ratio` full, fullest first
+  backedUpSubscribers(ratio: number): string[] {
+    const backlogs: { subscriber: string; ratio: number }[] = [];
+    this.subscriptions.forEach((subscriptions, topic) => subscriptions.forEach(subscription => {
+      const backlog = subscription.backlog();
+      if (backlog.ratio >= ratio) {
+        backlogs.push({ subscriber: `${backlog.subscriber} (${topic})`, ratio: backlog.ratio });
+      }
+    }));
+    return backlogs.sort((a, b) => b.ratio - a.ratio).map(({ subscriber }) => subscriber);
+  }
+}
+
+export const eventBus = EventBus.getInstance();
+
+degradation.registerCheck('event_bus', () => {
+  const backedUp = eventBus.backedUpSubscribers(degradationConfig.eventBacklogRatio);
+  return backedUp.length > 0 ? `event backlog in ${backedUp.join(', ')}` : null;
+});
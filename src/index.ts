@@ -2,8 +2,34 @@ import express from 'express';
 import cors from 'cors';
 import dotenv from 'dotenv';
 import bookingRoutes from './routes/bookingRoutes';
+import receiptRoutes from './routes/receiptRoutes';
+import adminRoutes from './routes/adminRoutes';
+import roomRoutes from './routes/roomRoutes';
+import guestRoutes from './routes/guestRoutes';
+import webhookRoutes from './routes/webhookRoutes';
 import { logger } from './utils/logger';
 import { pool } from './config/database';
+import { stageTiming } from './middleware/stageTiming';
+import { responseCompression } from './middleware/responseCompression';
+import { responseEnvelope } from './middleware/responseEnvelope';
+import { actor } from './middleware/actor';
+import { degradedComponents } from './middleware/degradedComponents';
+import { metrics } from './utils/metrics';
+import { degradation } from './utils/degradation';
+import { startHoldReaper } from './workers/holdReaper';
+import { startOrphanCleanup } from './workers/orphanCleanup';
+import { startWaitlistPromoter } from './workers/waitlistPromoter';
+import { startStayFinalizer } from './workers/stayFinalizer';
+import { startIntegrityChecker } from './workers/integrityChecker';
+import { startUpgradeMatcher } from './workers/upgradeMatcher';
+import { startInstallmentMonitor } from './workers/installmentMonitor';
+import { startReceiptMailer } from './workers/receiptMailer';
+import { startPendingBookingReaper } from './workers/pendingBookingReaper';
+import { startOutboxRelay } from './workers/outboxRelay';
+import { startBookingSagaMonitor } from './workers/bookingSagaMonitor';
+import { startSandboxCleanup } from './workers/sandboxCleanup';
+import { PaymentMethodService } from './services/paymentMethodService';
+import { mediaConfig } from './config/media';
 
 dotenv.config();
 
@@ -12,10 +38,30 @@ const PORT = process.env.PORT || 3000;
 
 // Middleware
 app.use(cors());
-app.use(express.json());
+app.use(express.json({
+  type: ['application/json', 'application/merge-patch+json'],
+  // Webhook signatures are computed over the exact bytes received
+  verify: (req, res, buf) => { (req as any).rawBody = buf; }
+}));
+// Must come before stageTiming so timing headers are set before the body is encoded
+app.use(responseCompression);
+app.use(stageTiming);
+app.use(responseEnvelope);
+app.use(actor);
+app.use(degradedComponents);
 
 // Routes
 app.use('/api', bookingRoutes);
+app.use('/api', receiptRoutes);
+app.use('/api', adminRoutes);
+app.use('/api', roomRoutes);
+app.use('/api', guestRoutes);
+app.use('/api', webhookRoutes);
+
+// Uploaded photos, when they are kept on local disk
+if (mediaConfig.storage === 'disk') {
+  app.use('/media', express.static(mediaConfig.dir));
+}
 
 // Health check
 app.get('/health', async (req, res) => {
@@ -28,12 +74,42 @@ app.get('/health', async (req, res) => {
   } catch (error) {
     const errorMessage = error instanceof Error ? error.message : String(error);
     logger.error('Health check failed', { error: errorMessage });
+    degradation.report('database', `health check failed: ${errorMessage}`);
     res.status(503).json({ status: 'unhealthy', error: errorMessage });
   }
 });
 
+// Which dependencies are degraded and why; unlike /health this answers 200 while the service still works
+app.get('/status', async (req, res) => {
+  try {
+    const client = await pool.connect();
+    try {
+      await client.query('SELECT 1');
+    } finally {
+      client.release();
+    }
+  } catch (error) {
+    degradation.report('database', `status probe failed: ${error instanceof Error ? error.message : String(error)}`);
+  }
+
+  const degraded = degradation.degradedComponents();
+  res.json({
+    status: degraded.length > 0 ? 'degraded' : 'ok',
+    degraded,
+    timestamp: new Date().toISOString()
+  });
+});
+
+// In-process counters and stage timings
+app.get('/metrics', (req, res) => {
+  res.json(metrics.snapshot());
+});
+
 // Error handling middleware
 app.use((error: Error, req: express.Request, res: express.Response, next: express.NextFunction) => {
+  if ((error as { type?: string }).type === 'entity.too.large') {
+    return res.status(413).json({ success: false, message: 'Request body is too large' });
+  }
   logger.error('Unhandled error', { error: error.message, stack: error.stack });
   res.status(500).json({ success: false, message: 'Internal server error' });
 });
@@ -41,6 +117,21 @@ app.use((error: Error, req: express.Request, res: express.Response, next: expres
 // Start server
 app.listen(PORT, () => {
   logger.info(`Server running on port ${PORT}`);
+  new PaymentMethodService().loadStored().catch(error => {
+    logger.error('Failed to load stored payment methods', { error: error instanceof Error ? error.message : String(error) });
+  });
+  startHoldReaper();
+  startOrphanCleanup();
+  startWaitlistPromoter();
+  startStayFinalizer();
+  startIntegrityChecker();
+  startUpgradeMatcher();
+  startInstallmentMonitor();
+  startReceiptMailer();
+  startPendingBookingReaper();
+  startOutboxRelay();
+  startBookingSagaMonitor();
+  startSandboxCleanup();
 });
 
 export default app;
\ No newline at end of file
@@ -0,0 +1,28 @@
+import { mailConfig } from '../config/mail';
+import { logger } from '../utils/logger';
+import { SmtpMailer } from './smtpMailer';
+
+export interface MailMessage {
+  to: string;
+  subject: string;
+  text: string;
+}
+
+// Resolves once the message has been accepted for delivery; throws if it was not
+export interface Mailer {
+  send(message: MailMessage): Promise<void>;
+}
+
+// Sends nothing; keeps what it was given so tests can inspect it
+export class NoopMailer implements Mailer {
+  readonly sent: MailMessage[] = [];
+
+  async send(message: MailMessage): Promise<void> {
+    this.sent.push(message);
+    logger.debug('Mail not sent (noop mailer)', { to: message.to, subject: message.subject });
+  }
+}
+
+export function createMailer(): Mailer {
+  return mailConfig.transport === 'smtp' ? new SmtpMailer(mailConfig.smtp, mailConfig.from) : new NoopMailer();
+}
@@ -0,0 +1,135 @@
+import net from 'net';
+import tls from 'tls';
+import { randomUUID } from 'crypto';
+import { Mailer, MailMessage } from './mailer';
+
+export interface SmtpOptions {
+  host: string;
+  port: number;
+  secure: boolean;
+  user: string;
+  password: string;
+  timeoutMs: number;
+}
+
+// Reads SMTP replies off a socket; a multiline reply ends with a line whose code is followed by a space
+class ReplyReader {
+  private buffer = '';
+  private error: Error | null = null;
+  private waiting: { resolve: (reply: { code: number; text: string }) => void; reject: (error: Error) => void } | null = null;
+  private onData = (chunk: Buffer) => {
+    this.buffer += chunk.toString('utf8');
+    this.flush();
+  };
+
+  constructor(private socket: net.Socket) {
+    socket.on('data', this.onData);
+    socket.on('error', error => this.fail(error));
+    socket.on('close', () => this.fail(new Error('SMTP connection closed')));
+    socket.on('timeout', () => {
+      this.fail(new Error('SMTP server timed out'));
+      socket.destroy();
+    });
+  }
+
+  next(): Promise<{ code: number; text: string }> {
+    return new Promise((resolve, reject) => {
+      if (this.error) {
+        return reject(this.error);
+      }
+      this.waiting = { resolve, reject };
+      this.flush();
+    });
+  }
+
+  // Stops reading, so the socket can be handed to TLS after STARTTLS
+  detach() {
+    this.socket.removeListener('data', this.onData);
+  }
+
+  private fail(error: Error) {
+    this.error = this.error ?? error;
+    this.waiting?.reject(this.error);
+    this.waiting = null;
+  }
+
+  private flush() {
+    const lines = this.buffer.split('\r\n');
+    const last = lines.findIndex(line => /^\d{3}( |$)/.test(line));
+    if (last === -1 || !this.waiting) {
+      return;
+    }
+    this.buffer = lines.slice(last + 1).join('\r\n');
+    const { resolve } = this.waiting;
+    this.waiting = null;
+    resolve({
+      code: parseInt(lines[last].slice(0, 3)),
+      text: lines.slice(0, last + 1).map(line => line.slice(4)).join('\n')
+    });
+  }
+}
+
+const dotStuff = (text: string) => text.replace(/\r?\n/g, '\r\n').replace(/^\./gm, '..');
+
+// Minimal SMTP client: one connection per message, STARTTLS when offered, AUTH LOGIN when credentials are set
+export class SmtpMailer implements Mailer {
+  constructor(private options: SmtpOptions, private from: string) {}
+
+  async send(message: MailMessage): Promise<void> {
+    let socket: net.Socket = this.options.secure
+      ? tls.connect({ host: this.options.host, port: this.options.port, servername: this.options.host })
+      : net.connect({ host: this.options.host, port: this.options.port });
+    socket.setTimeout(this.options.timeoutMs);
+    let reader = new ReplyReader(socket);
+
+    const command = async (line: string | null, expected: number) => {
+      if (line !== null) {
+        socket.write(`${line}\r\n`);
+      }
+      const reply = await reader.next();
+      if (reply.code !== expected) {
+        throw new Error(`SMTP ${line?.split(' ')[0] ?? 'greeting'} failed: ${reply.code} ${reply.text}`);
+      }
+      return reply;
+    };
+
+    try {
+      await command(null, 220);
+      let hello = await command('EHLO localhost', 250);
+
+      if (!this.options.secure && /STARTTLS/i.test(hello.text)) {
+        await command('STARTTLS', 220);
+        reader.detach();
+        socket = tls.connect({ socket, servername: this.options.host });
+        socket.setTimeout(this.options.timeoutMs);
+        reader = new ReplyReader(socket);
+        hello = await command('EHLO localhost', 250);
+      }
+
+      if (this.options.user) {
+        await command('AUTH LOGIN', 334);
+        await command(Buffer.from(this.options.user).toString('base64'), 334);
+        await command(Buffer.from(this.options.password).toString('base64'), 235);
+      }
+
+      const fromAddress = this.from.match(/<([^>]+)>/)?.[1] ?? this.from;
+      await command(`MAIL FROM:<${fromAddress}>`, 250);
+      await command(`RCPT TO:<${message.to}>`, 250);
+      await command('DATA', 354);
+      const headers = [
+        `From: ${this.from}`,
+        `To: ${message.to}`,
+        `Subject: ${message.subject}`,
+        `Date: ${new Date().toUTCString()}`,
+        `Message-ID: <${randomUUID()}@${fromAddress.split('@')[1] ?? 'localhost'}>`,
+        'MIME-Version: 1.0',
+        'Content-Type: text/plain; charset=utf-8',
+        'Content-Transfer-Encoding: 8bit'
+      ];
+      await command(`${headers.join('\r\n')}\r\n\r\n${dotStuff(message.text)}\r\n.`, 250);
+      await command('QUIT', 221).catch(() => undefined);
+    } finally {
+      socket.destroy();
+    }
+  }
+}
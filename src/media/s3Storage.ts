@@ -0,0 +1,53 @@
+import { DeleteObjectCommand, PutObjectCommand, S3Client } from '@aws-sdk/client-s3';
+import { Storage } from './storage';
+
+export interface S3Options {
+  bucket: string;
+  region: string;
+  endpoint: string;
+  accessKeyId: string;
+  secretAccessKey: string;
+  timeoutMs: number;
+}
+
+// S3's URI encoding: everything but unreserved characters, with the key's slashes kept
+const encodeKey = (key: string) => key.split('/')
+  .map(segment => encodeURIComponent(segment).replace(/[!'()*]/g, c => `%${c.charCodeAt(0).toString(16).toUpperCase()}`))
+  .join('/');
+
+// Objects in an S3 (or S3-compatible) bucket. Without an access key the SDK's default credential chain
+// (environment, shared config, instance or task role) is used.
+export class S3Storage implements Storage {
+  private readonly client: S3Client;
+  private readonly baseUrl: string;
+
+  constructor(private options: S3Options, private publicUrl: string) {
+    this.client = new S3Client({
+      region: options.region,
+      endpoint: options.endpoint || undefined,
+      forcePathStyle: Boolean(options.endpoint),
+      credentials: options.accessKeyId
+        ? { accessKeyId: options.accessKeyId, secretAccessKey: options.secretAccessKey }
+        : undefined,
+      requestHandler: { connectionTimeout: options.timeoutMs, requestTimeout: options.timeoutMs }
+    });
+    this.baseUrl = options.endpoint
+      ? `${options.endpoint.replace(/\/$/, '')}/${options.bucket}`
+      : `https://${options.bucket}.s3.${options.region}.amazonaws.com`;
+  }
+
+  async put(key: string, body: Buffer, contentType: string): Promise<void> {
+    await this.client.send(new PutObjectCommand({
+      Bucket: this.options.bucket, Key: key, Body: body, ContentType: contentType
+    }));
+  }
+
+  // S3 answers a delete of a missing key with success too
+  async delete(key: string): Promise<void> {
+    await this.client.send(new DeleteObjectCommand({ Bucket: this.options.bucket, Key: key }));
+  }
+
+  url(key: string): string {
+    return `${this.publicUrl ? this.publicUrl.replace(/\/$/, '') : this.baseUrl}/${encodeKey(key)}`;
+  }
+}
@@ -0,0 +1,45 @@
+import fs from 'fs/promises';
+import path from 'path';
+import { mediaConfig } from '../config/media';
+import { S3Storage } from './s3Storage';
+
+// Where uploaded media lives. Keys are relative paths such as room-types/Suite/abc.jpg.
+export interface Storage {
+  put(key: string, body: Buffer, contentType: string): Promise<void>;
+  // Deleting a key that isn't there is not an error
+  delete(key: string): Promise<void>;
+  url(key: string): string;
+}
+
+// Files under a local directory, served by the app itself at publicUrl
+export class DiskStorage implements Storage {
+  constructor(private dir: string, private publicUrl: string) {}
+
+  async put(key: string, body: Buffer): Promise<void> {
+    const file = this.resolve(key);
+    await fs.mkdir(path.dirname(file), { recursive: true });
+    await fs.writeFile(file, body);
+  }
+
+  async delete(key: string): Promise<void> {
+    await fs.rm(this.resolve(key), { force: true });
+  }
+
+  url(key: string): string {
+    return `${this.publicUrl}/${key.split('/').map(encodeURIComponent).join('/')}`;
+  }
+
+  private resolve(key: string): string {
+    const file = path.resolve(this.dir, key);
+    if (!file.startsWith(path.resolve(this.dir) + path.sep)) {
+      throw new Error(`Storage key ${key} is outside the media directory`);
+    }
+    return file;
+  }
+}
+
+export function createStorage(): Storage {
+  return mediaConfig.storage === 's3'
+    ? new S3Storage(mediaConfig.s3, mediaConfig.publicUrl)
+    : new DiskStorage(mediaConfig.dir, mediaConfig.publicUrl || '/media');
+}
@@ -0,0 +1,10 @@
+import { Request, Response, NextFunction } from 'express';
+import { runAsActor } from '../utils/actor';
+
+const MAX_ACTOR_LENGTH = 100;
+
+// Attributes changes made by this request to the caller named in X-Actor
+export const actor = (req: Request, res: Response, next: NextFunction) => {
+  const name = req.header('X-Actor')?.trim().slice(0, MAX_ACTOR_LENGTH) || 'anonymous';
+  runAsActor(name, next);
+};
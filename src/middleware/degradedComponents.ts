@@ -0,0 +1,18 @@
+import { Request, Response, NextFunction } from 'express';
+import { degradation } from '../utils/degradation';
+
+// Names the degraded dependencies on every JSON response (X-Degraded-Components: database, event_bus),
+// so clients can back off or note the context of a failure; the header is absent when all is well
+export const degradedComponents = (req: Request, res: Response, next: NextFunction) => {
+  const json = res.json.bind(res);
+
+  res.json = (body?: any) => {
+    const degraded = degradation.degradedComponents();
+    if (degraded.length > 0) {
+      res.setHeader('X-Degraded-Components', degraded.map(({ component }) => component).join(', '));
+    }
+    return json(body);
+  };
+
+  next();
+};
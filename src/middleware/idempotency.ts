@@ -0,0 +1,98 @@
+import crypto from 'crypto';
+import { Request, Response, NextFunction } from 'express';
+import { pool } from '../config/database';
+import { logger } from '../utils/logger';
+
+const KEY_TTL_HOURS = 24;
+// A request still marked in progress after this long is taken to have died (a crash, a lost connection) and a
+// retry with its key runs again instead of getting 409 until the key expires
+const IN_PROGRESS_LEASE_SECONDS = 60;
+
+// Honors an Idempotency-Key header: the first request with a key runs normally and its response is
+// stored; retries with the same key and body get that response replayed instead of running again.
+export const idempotency = async (req: Request, res: Response, next: NextFunction) => {
+  const key = req.header('Idempotency-Key');
+  if (!key) {
+    return next();
+  }
+
+  if (key.length > 255) {
+    return res.status(400).json({ success: false, message: 'Idempotency-Key must be at most 255 characters' });
+  }
+
+  const requestHash = crypto.createHash('sha256').update(JSON.stringify(req.body ?? null)).digest('hex');
+  const scope = [key, req.method, req.baseUrl + req.path];
+
+  try {
+    await pool.query(
+      `DELETE FROM idempotency_keys
+       WHERE key = $1 AND method = $2 AND path = $3 AND created_at < CURRENT_TIMESTAMP - make_interval(hours => $4)`,
+      [...scope, KEY_TTL_HOURS]
+    );
+
+    const inserted = await pool.query(
+      `INSERT INTO idempotency_keys (key, method, path, request_hash, status)
+       VALUES ($1, $2, $3, $4, 'in_progress')
+       ON CONFLICT (key, method, path) DO UPDATE SET created_at = CURRENT_TIMESTAMP
+         WHERE idempotency_keys.status = 'in_progress'
+           AND idempotency_keys.request_hash = EXCLUDED.request_hash
+           AND idempotency_keys.created_at < CURRENT_TIMESTAMP - make_interval(secs => $5)
+       RETURNING key`,
+      [...scope, requestHash, IN_PROGRESS_LEASE_SECONDS]
+    );
+
+    if (inserted.rows.length === 0) {
+      const existing = await pool.query(
+        'SELECT * FROM idempotency_keys WHERE key = $1 AND method = $2 AND path = $3',
+        scope
+      );
+      const record = existing.rows[0];
+
+      if (!record || record.request_hash !== requestHash) {
+        return res.status(422).json({
+          success: false,
+          message: 'Idempotency-Key was already used with a different request body'
+        });
+      }
+      if (record.status !== 'completed') {
+        return res.status(409).json({
+          success: false,
+          message: 'A request with this Idempotency-Key is still being processed'
+        });
+      }
+
+      res.setHeader('Idempotent-Replayed', 'true');
+      return res.status(record.response_status).json(record.response_body);
+    }
+  } catch (error) {
+    const errorMessage = error instanceof Error ? error.message : String(error);
+    logger.error('Idempotency check failed', { error: errorMessage });
+    return res.status(500).json({ success: false, message: errorMessage });
+  }
+
+  const json = res.json.bind(res);
+  res.json = (body?: any) => {
+    // Conflicts (a clash with a concurrent change, a room taken at that moment) and server errors are not
+    // recorded, so the client can retry them with the same key
+    const store = res.statusCode === 409 || res.statusCode >= 500
+      ? pool.query(
+        `DELETE FROM idempotency_keys WHERE key = $1 AND method = $2 AND path = $3 AND status = 'in_progress'`, scope
+      )
+      : pool.query(
+        `UPDATE idempotency_keys
+         SET status = 'completed', response_status = $4, response_body = $5, completed_at = CURRENT_TIMESTAMP
+         WHERE key = $1 AND method = $2 AND path = $3 AND status = 'in_progress'`,
+        [...scope, res.statusCode, JSON.stringify(body)]
+      );
+
+    // Send only once the outcome is recorded, so an immediate retry replays it instead of seeing 409
+    store
+      .catch(error => {
+        logger.error('Failed to record idempotent response', { error: error instanceof Error ? error.message : String(error) });
+      })
+      .then(() => json(body));
+    return res;
+  };
+
+  next();
+};
@@ -0,0 +1,67 @@
+import zlib from 'zlib';
+import { Request, Response, NextFunction } from 'express';
+import { logger } from '../utils/logger';
+
+const MIN_COMPRESS_BYTES = 1024;
+const MAX_RESPONSE_BYTES = parseInt(process.env.MAX_RESPONSE_BYTES || String(5 * 1024 * 1024));
+
+function pickEncoding(acceptEncoding: string | undefined): 'br' | 'gzip' | null {
+  const accepted = (acceptEncoding || '').split(',').map(value => value.trim().split(';')[0]);
+  if (accepted.includes('br')) {
+    return 'br';
+  }
+  if (accepted.includes('gzip')) {
+    return 'gzip';
+  }
+  return null;
+}
+
+function compress(payload: Buffer, encoding: 'br' | 'gzip'): Promise<Buffer> {
+  return new Promise((resolve, reject) => {
+    const done = (error: Error | null, result: Buffer) => (error ? reject(error) : resolve(result));
+    if (encoding === 'br') {
+      zlib.brotliCompress(payload, done);
+    } else {
+      zlib.gzip(payload, done);
+    }
+  });
+}
+
+// Replaces res.json: oversized bodies become a structured error, large bodies are compressed
+export const responseCompression = (req: Request, res: Response, next: NextFunction) => {
+  res.json = (body?: any) => {
+    let payload = Buffer.from(JSON.stringify(body) ?? '');
+
+    if (payload.length > MAX_RESPONSE_BYTES) {
+      logger.warn('Response too large', { path: req.originalUrl, bytes: payload.length });
+      res.status(400);
+      payload = Buffer.from(JSON.stringify({
+        success: false,
+        code: 'RESPONSE_TOO_LARGE',
+        message: 'Response exceeds the maximum size; narrow the date range or request fewer items',
+        maxBytes: MAX_RESPONSE_BYTES
+      }));
+    }
+
+    res.setHeader('Content-Type', 'application/json; charset=utf-8');
+    res.vary('Accept-Encoding');
+
+    const encoding = pickEncoding(req.headers['accept-encoding']);
+    if (!encoding || payload.length < MIN_COMPRESS_BYTES) {
+      return res.send(payload);
+    }
+
+    compress(payload, encoding)
+      .then(compressed => {
+        res.setHeader('Content-Encoding', encoding);
+        res.send(compressed);
+      })
+      .catch(error => {
+        logger.error('Response compression failed', { error: error instanceof Error ? error.message : String(error) });
+        res.send(payload);
+      });
+    return res;
+  };
+
+  next();
+};
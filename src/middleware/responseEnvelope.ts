@@ -0,0 +1,46 @@
+import { randomUUID } from 'crypto';
+import { performance } from 'perf_hooks';
+import { Request, Response, NextFunction } from 'express';
+import { transactionOutcome } from '../utils/stageTiming';
+import { responseWarnings, runWithResponseWarnings } from '../utils/responseWarnings';
+
+const ENVELOPE_BY_DEFAULT = process.env.RESPONSE_ENVELOPE === 'true';
+
+function wantsEnvelope(req: Request): boolean {
+  const header = req.header('X-Response-Envelope');
+  if (header !== undefined) {
+    return header === 'true' || header === '1';
+  }
+  return ENVELOPE_BY_DEFAULT;
+}
+
+// Every response carries X-Request-Id; opted-in responses also get a meta block with timing,
+// transaction outcome and warnings. Must come after stageTiming so the transaction stages are visible.
+export const responseEnvelope = (req: Request, res: Response, next: NextFunction) => {
+  const startedAt = performance.now();
+  const requestId = req.header('X-Request-Id') || randomUUID();
+  res.setHeader('X-Request-Id', requestId);
+
+  runWithResponseWarnings(() => {
+    const json = res.json.bind(res);
+
+    res.json = (body?: any) => {
+      if (!wantsEnvelope(req)) {
+        return json(body);
+      }
+
+      const meta = {
+        request_id: requestId,
+        duration_ms: Math.round((performance.now() - startedAt) * 10) / 10,
+        tx_outcome: transactionOutcome(),
+        warnings: responseWarnings()
+      };
+
+      // Standard { success, data, message } bodies gain meta; anything else is wrapped as data
+      const isStandard = body !== null && typeof body === 'object' && !Array.isArray(body) && 'success' in body;
+      return json(isStandard ? { ...body, meta } : { data: body, meta });
+    };
+
+    next();
+  });
+};
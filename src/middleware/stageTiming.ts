@@ -0,0 +1,30 @@
+import { Request, Response, NextFunction } from 'express';
+import { markStage, runWithStageTiming, stageDurations } from '../utils/stageTiming';
+import { metrics } from '../utils/metrics';
+
+// Stages marked along the way: handler → service → db (connection acquired) → commit (or rollback) → response
+export const stageTiming = (req: Request, res: Response, next: NextFunction) => {
+  runWithStageTiming(() => {
+    const json = res.json.bind(res);
+
+    res.json = (body?: any) => {
+      markStage('response');
+      const durations = stageDurations();
+
+      res.setHeader('Server-Timing', durations
+        .map(({ stage, durationMs }) => `${stage};dur=${durationMs.toFixed(1)}`)
+        .join(', '));
+
+      // Requests no route matched (404s, probes) share one label, so arbitrary paths can't each create a metric
+      const route = req.route ? `${req.method} ${req.baseUrl}${req.route.path}` : 'unmatched';
+      durations.forEach(({ stage, durationMs }) => {
+        metrics.observe(`stage.${stage} ${route}`, durationMs);
+      });
+
+      return json(body);
+    };
+
+    markStage('handler');
+    next();
+  });
+};
@@ -0,0 +1,46 @@
+import express, { Router } from 'express';
+import {
+  getConsistencySnapshot,
+  getOccupancyBoard,
+  streamOccupancyBoard,
+  getCancellationAnalytics,
+  getChannelReport,
+  getOccupancyReport,
+  getRevenueReport,
+  cleanupOrphans,
+  checkIntegrity,
+  simulateConflict,
+  getSettlementIssues,
+  resolveSettlementIssue,
+  createPromoCode,
+  getPromoCodes,
+  getSchemaDocs,
+  getReconciliation,
+  reconcileRoomInventory,
+  importRooms,
+  getLockDiagnostics
+} from '../controllers/adminController';
+
+const router = Router();
+
+router.get('/admin/consistency-snapshot', getConsistencySnapshot);
+router.get('/admin/occupancy/today', getOccupancyBoard);
+router.get('/admin/occupancy/today/stream', streamOccupancyBoard);
+router.get('/admin/analytics/cancellations', getCancellationAnalytics);
+router.get('/admin/analytics/channels', getChannelReport);
+router.get('/admin/reports/occupancy', getOccupancyReport);
+router.get('/admin/reports/revenue', getRevenueReport);
+router.post('/admin/orphans/cleanup', cleanupOrphans);
+router.post('/admin/integrity/check', checkIntegrity);
+router.post('/admin/demos/simulate-conflict', simulateConflict);
+router.get('/admin/settlement-issues', getSettlementIssues);
+router.post('/admin/settlement-issues/:id/resolve', resolveSettlementIssue);
+router.post('/admin/promo-codes', createPromoCode);
+router.get('/admin/promo-codes', getPromoCodes);
+router.get('/admin/schema', getSchemaDocs);
+router.get('/admin/reconciliation', getReconciliation);
+router.post('/admin/rooms/reconcile', reconcileRoomInventory);
+router.post('/admin/rooms/import', express.text({ type: 'text/csv', limit: '5mb' }), importRooms);
+router.get('/debug/locks', getLockDiagnostics);
+
+export default router;
@@ -1,11 +1,40 @@
 import { Router } from 'express';
-import { createBooking, getBooking, cancelBooking, setRowLocking } from '../controllers/bookingController';
+import { idempotency } from '../middleware/idempotency';
+import {
+  createBooking, createBookingWithPayment, getBookingSaga, createAdjoiningBookings, quoteBooking, createHold, getBookings, getBooking, getBookingHistory, addBookingNote, getBookingNotes, placeUpgradeBid, getUpgradeBids, getPaymentPlan, payInstallment, getRefunds, requestRefund, updateBooking, cancelBooking, bulkUpdateRoomPricing, setRowLocking, setLockStrategy, setBookingQueue,
+  confirmBooking, checkInBooking, checkOutBooking, markBookingNoShow, joinWaitlist, getWaitlistEntry
+} from '../controllers/bookingController';
 
 const router = Router();
 
-router.post('/bookings', createBooking);
+router.post('/bookings', idempotency, createBooking);
+router.post('/bookings/with-payment', idempotency, createBookingWithPayment);
+router.post('/bookings/adjoining', idempotency, createAdjoiningBookings);
+router.post('/bookings/quote', quoteBooking);
+router.post('/bookings/holds', idempotency, createHold);
+router.post('/bookings/waitlist', idempotency, joinWaitlist);
+router.get('/bookings/waitlist/:id', getWaitlistEntry);
+router.get('/booking-sagas/:id', getBookingSaga);
+router.get('/bookings', getBookings);
 router.get('/bookings/:id', getBooking);
+router.get('/bookings/:id/history', getBookingHistory);
+router.post('/bookings/:id/notes', addBookingNote);
+router.get('/bookings/:id/notes', getBookingNotes);
+router.post('/bookings/:id/upgrade-bids', idempotency, placeUpgradeBid);
+router.get('/bookings/:id/upgrade-bids', getUpgradeBids);
+router.get('/bookings/:id/payment-plan', getPaymentPlan);
+router.post('/bookings/:id/payment-plan/pay', idempotency, payInstallment);
+router.get('/bookings/:id/refunds', getRefunds);
+router.post('/bookings/:id/refunds', idempotency, requestRefund);
+router.patch('/bookings/:id', updateBooking);
 router.delete('/bookings/:id', cancelBooking);
+router.post('/bookings/:id/confirm', confirmBooking);
+router.post('/bookings/:id/check-in', checkInBooking);
+router.post('/bookings/:id/check-out', checkOutBooking);
+router.post('/bookings/:id/no-show', markBookingNoShow);
+router.post('/admin/rooms/pricing', bulkUpdateRoomPricing);
 router.post('/settings/row-locking', setRowLocking);
+router.post('/settings/lock-strategy', setLockStrategy);
+router.post('/settings/booking-queue', setBookingQueue);
 
 export default router;
\ No newline at end of file
@@ -0,0 +1,13 @@
+import { Router } from 'express';
+import { createGuest, getGuest, updateGuest, deleteGuest, getGuestBookings, getGuestLoyalty } from '../controllers/guestController';
+
+const router = Router();
+
+router.post('/guests', createGuest);
+router.get('/guests/:id', getGuest);
+router.patch('/guests/:id', updateGuest);
+router.delete('/guests/:id', deleteGuest);
+router.get('/guests/:id/bookings', getGuestBookings);
+router.get('/guests/:id/loyalty', getGuestLoyalty);
+
+export default router;
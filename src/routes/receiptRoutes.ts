@@ -0,0 +1,16 @@
+import { Router } from 'express';
+import { getReceipts, getReceipt, openDispute, getDisputes, resolveDispute } from '../controllers/receiptController';
+import { listPaymentMethods, listAllPaymentMethods, savePaymentMethod } from '../controllers/paymentMethodController';
+
+const router = Router();
+
+router.get('/receipts', getReceipts);
+router.get('/receipts/:id', getReceipt);
+router.post('/receipts/:id/disputes', openDispute);
+router.get('/receipts/:id/disputes', getDisputes);
+router.post('/admin/disputes/:id/resolve', resolveDispute);
+router.get('/payment-methods', listPaymentMethods);
+router.get('/admin/payment-methods', listAllPaymentMethods);
+router.put('/admin/payment-methods/:code', savePaymentMethod);
+
+export default router;
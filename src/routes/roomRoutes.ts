@@ -0,0 +1,49 @@
+import express, { Router } from 'express';
+import {
+  listRoomTypes, compareRoomTypes, updateRoomAttributes, searchAdjoiningRooms, getAdjoiningRooms, linkAdjoiningRoom,
+  unlinkAdjoiningRoom, getRoomStatusHistory, createMaintenanceBlock, getMaintenanceBlocks, cancelMaintenanceBlock,
+  updateHousekeepingStatus, getHousekeepingTasks, uploadRoomTypePhoto, getRoomTypePhotos, deleteRoomTypePhoto
+} from '../controllers/roomController';
+import { listRatePlans, saveRatePlan, addRateSeason, removeRateSeason } from '../controllers/ratePlanController';
+import { listStayRestrictions, saveStayRestrictions, removeStayRestrictions } from '../controllers/stayRestrictionController';
+import { mediaConfig } from '../config/media';
+import {
+  listFacilities, createFacility, updateFacility, deleteFacility, attachFacility, detachFacility
+} from '../controllers/facilityController';
+
+const router = Router();
+
+router.get('/room-types', listRoomTypes);
+router.get('/room-types/compare', compareRoomTypes);
+router.get('/rooms/adjoining', searchAdjoiningRooms);
+router.get('/rooms/:id/status-history', getRoomStatusHistory);
+router.patch('/admin/rooms/:id', updateRoomAttributes);
+router.get('/admin/rooms/:id/adjoining', getAdjoiningRooms);
+router.put('/admin/rooms/:id/adjoining/:otherId', linkAdjoiningRoom);
+router.delete('/admin/rooms/:id/adjoining/:otherId', unlinkAdjoiningRoom);
+router.post('/admin/rooms/:id/maintenance', createMaintenanceBlock);
+router.get('/admin/rooms/:id/maintenance', getMaintenanceBlocks);
+router.delete('/admin/rooms/:id/maintenance/:blockId', cancelMaintenanceBlock);
+router.put('/housekeeping/rooms/:id', updateHousekeepingStatus);
+router.get('/housekeeping/tasks', getHousekeepingTasks);
+router.get('/admin/rate-plans', listRatePlans);
+router.put('/admin/rate-plans/:roomType', saveRatePlan);
+router.post('/admin/rate-plans/:roomType/seasons', addRateSeason);
+router.delete('/admin/rate-plans/seasons/:id', removeRateSeason);
+router.get('/admin/stay-restrictions', listStayRestrictions);
+router.put('/admin/stay-restrictions/:roomType', saveStayRestrictions);
+router.delete('/admin/stay-restrictions/:roomType', removeStayRestrictions);
+router.get('/admin/facilities', listFacilities);
+router.post('/admin/facilities', createFacility);
+router.patch('/admin/facilities/:id', updateFacility);
+router.delete('/admin/facilities/:id', deleteFacility);
+router.put('/admin/room-types/:roomType/facilities/:facilityId', attachFacility);
+router.delete('/admin/room-types/:roomType/facilities/:facilityId', detachFacility);
+// Room for the multipart framing around the largest photo allowed
+const photoUpload = express.raw({ type: 'multipart/form-data', limit: mediaConfig.maxBytes + 64 * 1024 });
+
+router.get('/room-types/:roomType/photos', getRoomTypePhotos);
+router.post('/admin/room-types/:roomType/photos', photoUpload, uploadRoomTypePhoto);
+router.delete('/admin/room-types/:roomType/photos/:photoId', deleteRoomTypePhoto);
+
+export default router;
@@ -0,0 +1,8 @@
+import { Router } from 'express';
+import { receivePaymentWebhook } from '../controllers/webhookController';
+
+const router = Router();
+
+router.post('/webhooks/payments', receivePaymentWebhook);
+
+export default router;
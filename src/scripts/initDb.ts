@@ -1,5 +1,6 @@
 import { pool } from '../config/database';
 import { logger } from '../utils/logger';
+import { sealContact } from '../services/guestContact';
 
 const createTables = async () => {
   const client = await pool.connect();
@@ -12,9 +13,14 @@ const createTables = async () => {
       CREATE TABLE IF NOT EXISTS guests (
         id SERIAL PRIMARY KEY,
         name VARCHAR(255) NOT NULL,
-        email VARCHAR(255) UNIQUE NOT NULL,
-        phone VARCHAR(20) NOT NULL,
+        -- Encrypted with the key named by pii_key_id (see guestContact.ts); NULL there means not encrypted yet
+        email TEXT UNIQUE NOT NULL,
+        phone TEXT NOT NULL,
+        email_lookup VARCHAR(64),
+        pii_key_id VARCHAR(32),
+        document_id VARCHAR(50),
         booking_count INTEGER DEFAULT 0,
+        loyalty_points INTEGER NOT NULL DEFAULT 0 CHECK (loyalty_points >= 0),
         created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
         updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
       )
@@ -27,23 +33,61 @@ const createTables = async () => {
         room_number VARCHAR(10) UNIQUE NOT NULL,
         room_type VARCHAR(50) NOT NULL,
         price_per_night DECIMAL(10,2) NOT NULL,
+        floor INTEGER,
+        view_type VARCHAR(10) CHECK (view_type IN ('city', 'garden', 'pool', 'sea')),
+        smoking_allowed BOOLEAN NOT NULL DEFAULT FALSE,
+        accessible BOOLEAN NOT NULL DEFAULT FALSE,
         is_available BOOLEAN DEFAULT TRUE,
         booking_count INTEGER DEFAULT 0,
+        retired_at TIMESTAMP,
+        is_sandbox BOOLEAN NOT NULL DEFAULT FALSE,
+        housekeeping_status VARCHAR(20) NOT NULL DEFAULT 'clean',
+        housekeeping_updated_at TIMESTAMP,
+        housekeeping_updated_by VARCHAR(100),
         created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
         updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
       )
     `);
 
+    // Create promo codes table (times_used is only ever incremented with the limit check in the same UPDATE)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS promo_codes (
+        id SERIAL PRIMARY KEY,
+        code VARCHAR(30) UNIQUE NOT NULL,
+        discount_type VARCHAR(20) NOT NULL,
+        discount_value DECIMAL(10,2) NOT NULL,
+        valid_from DATE NOT NULL,
+        valid_until DATE NOT NULL,
+        usage_limit INTEGER,
+        times_used INTEGER NOT NULL DEFAULT 0,
+        room_types TEXT[],
+        active BOOLEAN NOT NULL DEFAULT TRUE,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        CHECK (usage_limit IS NULL OR times_used <= usage_limit)
+      )
+    `);
+
     // Create bookings table
     await client.query(`
       CREATE TABLE IF NOT EXISTS bookings (
         id SERIAL PRIMARY KEY,
         guest_id INTEGER REFERENCES guests(id),
+        -- The name this stay is booked under; the guest's profile keeps its own
+        guest_name VARCHAR(255) NOT NULL,
         room_id INTEGER REFERENCES rooms(id),
         check_in_date DATE NOT NULL,
         check_out_date DATE NOT NULL,
         total_amount DECIMAL(10,2) NOT NULL,
+        price_breakdown JSONB,
+        channel VARCHAR(50) NOT NULL DEFAULT 'direct',
+        promo_code_id INTEGER REFERENCES promo_codes(id),
+        discount_amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+        group_id UUID,
         status VARCHAR(20) DEFAULT 'pending',
+        cancellation_reason_code VARCHAR(50),
+        cancellation_reason_text TEXT,
+        cancelled_at TIMESTAMP,
+        version INTEGER NOT NULL DEFAULT 1,
         created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
         updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
       )
@@ -58,6 +102,8 @@ const createTables = async () => {
         payment_method VARCHAR(50) NOT NULL,
         status VARCHAR(20) DEFAULT 'pending',
         transaction_id VARCHAR(100) UNIQUE NOT NULL,
+        gateway_event_at TIMESTAMP,
+        surcharge_amount DECIMAL(10,2) NOT NULL DEFAULT 0,
         created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
         updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
       )
@@ -69,16 +115,446 @@ const createTables = async () => {
         id SERIAL PRIMARY KEY,
         booking_id INTEGER REFERENCES bookings(id),
         payment_id INTEGER REFERENCES payments(id),
+        kind VARCHAR(20) NOT NULL DEFAULT 'payment',
         receipt_number VARCHAR(50) UNIQUE NOT NULL,
         total_amount DECIMAL(10,2) NOT NULL,
+        surcharge_amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+        payment_method VARCHAR(50),
+        gateway_reference VARCHAR(100),
+        email_status VARCHAR(20),
+        email_attempts INTEGER NOT NULL DEFAULT 0,
+        email_last_error TEXT,
+        email_next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        email_sent_at TIMESTAMP,
+        version INTEGER NOT NULL DEFAULT 1,
         generated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
       )
     `);
 
+    // Create room holds table (short reservations awaiting payment)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS room_holds (
+        id SERIAL PRIMARY KEY,
+        token UUID UNIQUE NOT NULL,
+        room_id INTEGER REFERENCES rooms(id),
+        check_in_date DATE NOT NULL,
+        check_out_date DATE NOT NULL,
+        status VARCHAR(20) DEFAULT 'active',
+        booking_id INTEGER REFERENCES bookings(id),
+        expires_at TIMESTAMP NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+      )
+    `);
+
+    // Create cancellation records table (fee and refundable amount for each cancellation)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS cancellation_records (
+        id SERIAL PRIMARY KEY,
+        booking_id INTEGER UNIQUE REFERENCES bookings(id),
+        policy_code VARCHAR(50) NOT NULL,
+        days_before_check_in INTEGER NOT NULL,
+        paid_amount DECIMAL(10,2) NOT NULL,
+        fee_amount DECIMAL(10,2) NOT NULL,
+        refundable_amount DECIMAL(10,2) NOT NULL,
+        fee_waived BOOLEAN DEFAULT FALSE,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+      )
+    `);
+
+    // Create price adjustments table (price changes from modified stays)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS price_adjustments (
+        id SERIAL PRIMARY KEY,
+        booking_id INTEGER REFERENCES bookings(id),
+        previous_amount DECIMAL(10,2) NOT NULL,
+        new_amount DECIMAL(10,2) NOT NULL,
+        delta DECIMAL(10,2) NOT NULL,
+        reason VARCHAR(50) NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+      )
+    `);
+
+    // Create waitlist table (guests waiting for a room to be freed)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS booking_waitlist (
+        id SERIAL PRIMARY KEY,
+        room_id INTEGER REFERENCES rooms(id),
+        check_in_date DATE NOT NULL,
+        check_out_date DATE NOT NULL,
+        guest_name VARCHAR(255) NOT NULL,
+        guest_email TEXT NOT NULL,
+        guest_phone TEXT NOT NULL,
+        pii_key_id VARCHAR(32),
+        payment_method VARCHAR(50) NOT NULL,
+        auto_book BOOLEAN DEFAULT FALSE,
+        status VARCHAR(20) DEFAULT 'waiting',
+        booking_id INTEGER REFERENCES bookings(id),
+        failure_reason TEXT,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        processed_at TIMESTAMP
+      )
+    `);
+
+    // Create booking audit table (one row per change, with the fields that changed)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS booking_audit (
+        id BIGSERIAL PRIMARY KEY,
+        booking_id INTEGER NOT NULL REFERENCES bookings(id),
+        action VARCHAR(20) NOT NULL,
+        actor VARCHAR(100) NOT NULL,
+        changes JSONB NOT NULL,
+        transaction_id BIGINT NOT NULL DEFAULT txid_current(),
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+      )
+    `);
+
+    // Create payment webhook events table (every gateway callback received, for deduplication and tracing)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS payment_webhook_events (
+        event_id VARCHAR(255) PRIMARY KEY,
+        type VARCHAR(50) NOT NULL,
+        transaction_id VARCHAR(100) NOT NULL,
+        payment_id INTEGER REFERENCES payments(id) ON DELETE SET NULL,
+        outcome VARCHAR(20),
+        event_created_at TIMESTAMP NOT NULL,
+        received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+      )
+    `);
+
+    // Create settlement issues table (checked-out stays whose payments don't match the folio)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS settlement_issues (
+        id SERIAL PRIMARY KEY,
+        booking_id INTEGER UNIQUE NOT NULL REFERENCES bookings(id),
+        kind VARCHAR(20) NOT NULL,
+        folio_total DECIMAL(10,2) NOT NULL,
+        paid_total DECIMAL(10,2) NOT NULL,
+        difference DECIMAL(10,2) NOT NULL,
+        status VARCHAR(20) NOT NULL DEFAULT 'open',
+        resolution_note TEXT,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        resolved_at TIMESTAMP
+      )
+    `);
+
+    // Create integrity checkpoints table (per-day aggregates compared against later recomputation)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS integrity_checkpoints (
+        day DATE NOT NULL,
+        metric VARCHAR(50) NOT NULL,
+        row_count INTEGER NOT NULL,
+        total DECIMAL(14,2) NOT NULL,
+        checksum CHAR(32) NOT NULL,
+        recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (day, metric)
+      )
+    `);
+
+    // Create booking notes table (staff comments, internal or guest-facing)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS booking_notes (
+        id SERIAL PRIMARY KEY,
+        booking_id INTEGER NOT NULL REFERENCES bookings(id),
+        author VARCHAR(100) NOT NULL,
+        body TEXT NOT NULL,
+        visibility VARCHAR(20) NOT NULL DEFAULT 'internal',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+      )
+    `);
+
+    // Create loyalty ledger (every change to a guest's points; one row of each kind per booking)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS loyalty_transactions (
+        id SERIAL PRIMARY KEY,
+        guest_id INTEGER NOT NULL REFERENCES guests(id),
+        booking_id INTEGER NOT NULL REFERENCES bookings(id),
+        kind VARCHAR(20) NOT NULL,
+        points INTEGER NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE (booking_id, kind)
+      )
+    `);
+
+    // Create upgrade bids table (offers to move to a sold-out room type, awarded when one frees up)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS upgrade_bids (
+        id SERIAL PRIMARY KEY,
+        booking_id INTEGER NOT NULL REFERENCES bookings(id),
+        room_type VARCHAR(50) NOT NULL,
+        max_amount DECIMAL(10,2) NOT NULL,
+        status VARCHAR(20) NOT NULL DEFAULT 'open',
+        charged_amount DECIMAL(10,2),
+        decline_reason TEXT,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        processed_at TIMESTAMP
+      )
+    `);
+
+    // Create installments table (payment plans: what is due when, and the payment that settled it)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS installments (
+        id SERIAL PRIMARY KEY,
+        booking_id INTEGER NOT NULL REFERENCES bookings(id),
+        sequence INTEGER NOT NULL,
+        amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+        due_date DATE NOT NULL,
+        status VARCHAR(20) NOT NULL DEFAULT 'due',
+        payment_id INTEGER REFERENCES payments(id),
+        paid_at TIMESTAMP,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE (booking_id, sequence)
+      )
+    `);
+
+    // Create payment disputes table (chargebacks against payment receipts)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS payment_disputes (
+        id SERIAL PRIMARY KEY,
+        receipt_id INTEGER NOT NULL REFERENCES receipts(id),
+        payment_id INTEGER NOT NULL REFERENCES payments(id),
+        booking_id INTEGER NOT NULL REFERENCES bookings(id),
+        amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+        reason TEXT NOT NULL,
+        status VARCHAR(20) NOT NULL DEFAULT 'open',
+        chargeback_payment_id INTEGER REFERENCES payments(id),
+        resolution_note TEXT,
+        opened_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        resolved_at TIMESTAMP
+      )
+    `);
+
+    // Create refunds table (money returned to the method a payment was made with, settled by the gateway later)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS refunds (
+        id SERIAL PRIMARY KEY,
+        booking_id INTEGER NOT NULL REFERENCES bookings(id),
+        payment_id INTEGER NOT NULL REFERENCES payments(id),
+        receipt_id INTEGER REFERENCES receipts(id),
+        amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+        payment_method VARCHAR(50) NOT NULL,
+        refund_reference VARCHAR(100) UNIQUE NOT NULL,
+        status VARCHAR(20) NOT NULL DEFAULT 'pending',
+        failure_reason TEXT,
+        gateway_event_at TIMESTAMP,
+        requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        settled_at TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+      )
+    `);
+
+    // Create rate plan tables (dynamic nightly rates per room type: weekend and occupancy multipliers, seasons)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS rate_plans (
+        room_type VARCHAR(50) PRIMARY KEY,
+        weekend_multiplier DECIMAL(5,3) NOT NULL DEFAULT 1 CHECK (weekend_multiplier > 0),
+        occupancy_tiers JSONB NOT NULL DEFAULT '[]',
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+      )
+    `);
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS rate_seasons (
+        id SERIAL PRIMARY KEY,
+        room_type VARCHAR(50) NOT NULL,
+        name VARCHAR(100) NOT NULL,
+        start_date DATE NOT NULL,
+        end_date DATE NOT NULL CHECK (end_date >= start_date),
+        price_per_night DECIMAL(10,2) CHECK (price_per_night > 0),
+        multiplier DECIMAL(5,3) CHECK (multiplier > 0),
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        CHECK ((price_per_night IS NULL) <> (multiplier IS NULL))
+      )
+    `);
+
+    // Create stay restrictions table (length of stay, booking window and closed-to-arrival weekdays per room type)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS stay_restrictions (
+        room_type VARCHAR(50) PRIMARY KEY,
+        min_nights INTEGER NOT NULL DEFAULT 1 CHECK (min_nights >= 1),
+        max_nights INTEGER CHECK (max_nights >= min_nights),
+        max_advance_days INTEGER CHECK (max_advance_days >= 0),
+        closed_to_arrival_days SMALLINT[] NOT NULL DEFAULT '{}',
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+      )
+    `);
+
+    // Create room maintenance blocks table (rooms out of service for a date range)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS room_maintenance_blocks (
+        id SERIAL PRIMARY KEY,
+        room_id INTEGER NOT NULL REFERENCES rooms(id),
+        start_date DATE NOT NULL,
+        end_date DATE NOT NULL CHECK (end_date > start_date),
+        reason TEXT NOT NULL,
+        status VARCHAR(20) NOT NULL DEFAULT 'active',
+        created_by VARCHAR(100) NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        cancelled_at TIMESTAMP
+      )
+    `);
+
+    // Create facilities tables (amenities such as Wi-Fi or a balcony, attached to room types)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS facilities (
+        id SERIAL PRIMARY KEY,
+        name VARCHAR(100) UNIQUE NOT NULL,
+        description TEXT,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+      )
+    `);
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS room_type_facilities (
+        room_type VARCHAR(50) NOT NULL,
+        facility_id INTEGER NOT NULL REFERENCES facilities(id),
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (room_type, facility_id)
+      )
+    `);
+
+    // Create room type photos table (the files themselves live in media storage under storage_key)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS room_type_photos (
+        id SERIAL PRIMARY KEY,
+        room_type VARCHAR(50) NOT NULL,
+        storage_key VARCHAR(255) UNIQUE NOT NULL,
+        content_type VARCHAR(50) NOT NULL,
+        size_bytes INTEGER NOT NULL,
+        caption VARCHAR(200),
+        position INTEGER NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+      )
+    `);
+
+    // Create adjoining rooms table (each connecting door once, lower room id first)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS adjoining_rooms (
+        room_id INTEGER NOT NULL REFERENCES rooms(id),
+        adjoining_room_id INTEGER NOT NULL REFERENCES rooms(id),
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (room_id, adjoining_room_id),
+        CHECK (room_id < adjoining_room_id)
+      )
+    `);
+
+    // Create room status history table: one row per change to whether (or for which dates) a room can be booked
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS room_status_history (
+        id SERIAL PRIMARY KEY,
+        room_id INTEGER NOT NULL REFERENCES rooms(id),
+        event VARCHAR(30) NOT NULL,
+        is_available BOOLEAN NOT NULL,
+        booking_id INTEGER,
+        hold_id INTEGER,
+        maintenance_block_id INTEGER,
+        start_date DATE,
+        end_date DATE,
+        actor VARCHAR(100) NOT NULL,
+        transaction_id BIGINT NOT NULL DEFAULT txid_current(),
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+      )
+    `);
+
+    // Create outbox table: commands and events written in the transaction that causes them, sent by the relay
+    // worker after commit
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS outbox_messages (
+        id BIGSERIAL PRIMARY KEY,
+        topic VARCHAR(50) NOT NULL,
+        payload JSONB NOT NULL,
+        attempts INTEGER NOT NULL DEFAULT 0,
+        available_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        processed_at TIMESTAMP,
+        failed_at TIMESTAMP,
+        last_error TEXT,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+      )
+    `);
+
+    // Create booking sagas table: bookings made before they are paid, and how the payment turned out
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS booking_sagas (
+        id SERIAL PRIMARY KEY,
+        booking_id INTEGER NOT NULL UNIQUE REFERENCES bookings(id),
+        status VARCHAR(20) NOT NULL DEFAULT 'awaiting_payment'
+          CHECK (status IN ('awaiting_payment', 'completed', 'compensated')),
+        amount DECIMAL(10,2) NOT NULL,
+        payment_method VARCHAR(50) NOT NULL,
+        payment_id INTEGER REFERENCES payments(id),
+        receipt_id INTEGER REFERENCES receipts(id),
+        failure_reason TEXT,
+        expires_at TIMESTAMP NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+      )
+    `);
+
+    // Audit rows are never rewritten
+    await client.query(`
+      CREATE OR REPLACE FUNCTION reject_booking_audit_update() RETURNS trigger AS $$
+      BEGIN
+        RAISE EXCEPTION 'booking_audit rows are immutable';
+      END;
+      $$ LANGUAGE plpgsql
+    `);
+    // Audit entries can't be edited or removed, row by row or by emptying the table
+    await client.query(`
+      CREATE OR REPLACE TRIGGER booking_audit_immutable BEFORE UPDATE OR DELETE ON booking_audit
+      FOR EACH ROW EXECUTE FUNCTION reject_booking_audit_update()
+    `);
+    await client.query(`
+      CREATE OR REPLACE TRIGGER booking_audit_no_truncate BEFORE TRUNCATE ON booking_audit
+      FOR EACH STATEMENT EXECUTE FUNCTION reject_booking_audit_update()
+    `);
+    await client.query('REVOKE TRUNCATE ON booking_audit FROM PUBLIC');
+
+    // Create payment methods table (admin changes overriding the configured payment methods)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS payment_methods (
+        code VARCHAR(50) PRIMARY KEY,
+        display_name VARCHAR(100) NOT NULL,
+        enabled BOOLEAN NOT NULL DEFAULT TRUE,
+        requires_gateway BOOLEAN NOT NULL DEFAULT TRUE,
+        supports_refund BOOLEAN NOT NULL DEFAULT TRUE,
+        min_amount DECIMAL(10,2),
+        max_amount DECIMAL(10,2),
+        surcharge_percent DECIMAL(5,2) NOT NULL DEFAULT 0 CHECK (surcharge_percent BETWEEN 0 AND 100),
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+      )
+    `);
+
+    // Create idempotency keys table (stored responses for retried POSTs)
+    await client.query(`
+      CREATE TABLE IF NOT EXISTS idempotency_keys (
+        key VARCHAR(255) NOT NULL,
+        method VARCHAR(10) NOT NULL,
+        path VARCHAR(255) NOT NULL,
+        request_hash CHAR(64) NOT NULL,
+        status VARCHAR(20) DEFAULT 'in_progress',
+        response_status INTEGER,
+        response_body JSONB,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        completed_at TIMESTAMP,
+        PRIMARY KEY (key, method, path)
+      )
+    `);
+
     // Add missing columns if they don't exist (for existing databases)
     await client.query(`
       ALTER TABLE guests 
-      ADD COLUMN IF NOT EXISTS booking_count INTEGER DEFAULT 0
+      ADD COLUMN IF NOT EXISTS booking_count INTEGER DEFAULT 0,
+      ADD COLUMN IF NOT EXISTS document_id VARCHAR(50),
+      ADD COLUMN IF NOT EXISTS loyalty_points INTEGER NOT NULL DEFAULT 0 CHECK (loyalty_points >= 0),
+      ADD COLUMN IF NOT EXISTS email_lookup VARCHAR(64),
+      ADD COLUMN IF NOT EXISTS pii_key_id VARCHAR(32),
+      ALTER COLUMN email TYPE TEXT,
+      ALTER COLUMN phone TYPE TEXT
+    `);
+
+    await client.query(`
+      ALTER TABLE booking_waitlist
+      ADD COLUMN IF NOT EXISTS pii_key_id VARCHAR(32),
+      ALTER COLUMN guest_email TYPE TEXT,
+      ALTER COLUMN guest_phone TYPE TEXT
     `);
 
     await client.query(`
@@ -86,6 +562,101 @@ const createTables = async () => {
       ADD COLUMN IF NOT EXISTS booking_count INTEGER DEFAULT 0
     `);
 
+    // Rooms the property no longer has are retired rather than deleted, so their bookings keep their room
+    await client.query(`
+      ALTER TABLE rooms
+      ADD COLUMN IF NOT EXISTS retired_at TIMESTAMP
+    `);
+
+    // Sandbox rooms made by the demo endpoints; they are left out of assignment, reports and analytics
+    await client.query(`
+      ALTER TABLE rooms
+      ADD COLUMN IF NOT EXISTS is_sandbox BOOLEAN NOT NULL DEFAULT FALSE
+    `);
+
+    // Check-in waits for housekeeping: a room is dirty from check-out until it is marked clean
+    await client.query(`
+      ALTER TABLE rooms
+      ADD COLUMN IF NOT EXISTS housekeeping_status VARCHAR(20) NOT NULL DEFAULT 'clean',
+      ADD COLUMN IF NOT EXISTS housekeeping_updated_at TIMESTAMP,
+      ADD COLUMN IF NOT EXISTS housekeeping_updated_by VARCHAR(100)
+    `);
+
+    await client.query(`
+      ALTER TABLE rooms
+      ADD COLUMN IF NOT EXISTS floor INTEGER,
+      ADD COLUMN IF NOT EXISTS view_type VARCHAR(10) CHECK (view_type IN ('city', 'garden', 'pool', 'sea')),
+      ADD COLUMN IF NOT EXISTS smoking_allowed BOOLEAN NOT NULL DEFAULT FALSE,
+      ADD COLUMN IF NOT EXISTS accessible BOOLEAN NOT NULL DEFAULT FALSE
+    `);
+
+    await client.query(`
+      ALTER TABLE payments
+      ADD COLUMN IF NOT EXISTS gateway_event_at TIMESTAMP
+    `);
+
+    // Payment method surcharges are part of what was paid, but not of the stay's price
+    await client.query(`
+      ALTER TABLE payments
+      ADD COLUMN IF NOT EXISTS surcharge_amount DECIMAL(10,2) NOT NULL DEFAULT 0
+    `);
+    await client.query(`
+      ALTER TABLE receipts
+      ADD COLUMN IF NOT EXISTS surcharge_amount DECIMAL(10,2) NOT NULL DEFAULT 0
+    `);
+
+    // Receipt email delivery; email_status is null for receipts that are not mailed
+    await client.query(`
+      ALTER TABLE receipts
+      ADD COLUMN IF NOT EXISTS email_status VARCHAR(20),
+      ADD COLUMN IF NOT EXISTS email_attempts INTEGER NOT NULL DEFAULT 0,
+      ADD COLUMN IF NOT EXISTS email_last_error TEXT,
+      ADD COLUMN IF NOT EXISTS email_next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+      ADD COLUMN IF NOT EXISTS email_sent_at TIMESTAMP
+    `);
+
+    // Where a receipt's money came from, so refunds can go back the same way
+    await client.query(`
+      ALTER TABLE receipts
+      ADD COLUMN IF NOT EXISTS payment_method VARCHAR(50),
+      ADD COLUMN IF NOT EXISTS gateway_reference VARCHAR(100)
+    `);
+
+    // Gateway events about refunds point at the refund instead of a payment
+    await client.query(`
+      ALTER TABLE payment_webhook_events
+      ADD COLUMN IF NOT EXISTS refund_id INTEGER REFERENCES refunds(id) ON DELETE SET NULL
+    `);
+
+    // Payment receipts are issued per payment; a stay's single final receipt has no payment
+    await client.query(`
+      ALTER TABLE receipts
+      ADD COLUMN IF NOT EXISTS kind VARCHAR(20) NOT NULL DEFAULT 'payment',
+      ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1
+    `);
+
+    await client.query(`
+      ALTER TABLE bookings 
+      ADD COLUMN IF NOT EXISTS price_breakdown JSONB,
+      ADD COLUMN IF NOT EXISTS cancellation_reason_code VARCHAR(50),
+      ADD COLUMN IF NOT EXISTS cancellation_reason_text TEXT,
+      ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP,
+      ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1,
+      ADD COLUMN IF NOT EXISTS channel VARCHAR(50) NOT NULL DEFAULT 'direct',
+      ADD COLUMN IF NOT EXISTS promo_code_id INTEGER REFERENCES promo_codes(id),
+      ADD COLUMN IF NOT EXISTS discount_amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+      ADD COLUMN IF NOT EXISTS group_id UUID,
+      ADD COLUMN IF NOT EXISTS guest_name VARCHAR(255)
+    `);
+
+    // Bookings made before the name was kept per booking take their guest's current name
+    await client.query(`
+      UPDATE bookings b SET guest_name = g.name FROM guests g WHERE g.id = b.guest_id AND b.guest_name IS NULL
+    `);
+    await client.query(`
+      ALTER TABLE bookings ALTER COLUMN guest_name SET NOT NULL
+    `);
+
     // Insert sample rooms
     await client.query(`
       INSERT INTO rooms (room_number, room_type, price_per_night) VALUES
@@ -102,6 +673,10 @@ const createTables = async () => {
       CREATE INDEX IF NOT EXISTS idx_guests_email ON guests(email)
     `);
 
+    await client.query(`
+      CREATE UNIQUE INDEX IF NOT EXISTS idx_guests_email_lookup ON guests(email_lookup)
+    `);
+
     await client.query(`
       CREATE INDEX IF NOT EXISTS idx_rooms_availability ON rooms(is_available)
     `);
@@ -118,6 +693,87 @@ const createTables = async () => {
       CREATE INDEX IF NOT EXISTS idx_bookings_status ON bookings(status)
     `);
 
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_room_holds_active_expiry ON room_holds(expires_at) WHERE status = 'active'
+    `);
+
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_booking_waitlist_waiting ON booking_waitlist(room_id, created_at) WHERE status = 'waiting'
+    `);
+
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_booking_audit_booking ON booking_audit(booking_id, id)
+    `);
+
+    await client.query(`
+      CREATE UNIQUE INDEX IF NOT EXISTS idx_receipts_final_per_booking ON receipts(booking_id) WHERE kind = 'final'
+    `);
+
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_booking_notes_booking ON booking_notes(booking_id, id)
+    `);
+
+    await client.query(`
+      CREATE UNIQUE INDEX IF NOT EXISTS idx_upgrade_bids_open_per_booking ON upgrade_bids(booking_id) WHERE status = 'open'
+    `);
+
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_installments_open_due ON installments(due_date) WHERE status IN ('due', 'overdue')
+    `);
+
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_refunds_booking ON refunds(booking_id, id)
+    `);
+
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_maintenance_blocks_active ON room_maintenance_blocks(room_id, start_date)
+      WHERE status = 'active'
+    `);
+
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_rate_seasons_room_type ON rate_seasons(room_type, start_date)
+    `);
+
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_room_type_photos_order ON room_type_photos(room_type, position, id)
+    `);
+
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_room_status_history_room ON room_status_history(room_id, id)
+    `);
+
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_adjoining_rooms_adjoining ON adjoining_rooms(adjoining_room_id)
+    `);
+
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_bookings_group ON bookings(group_id) WHERE group_id IS NOT NULL
+    `);
+
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_outbox_messages_due ON outbox_messages(available_at, id)
+      WHERE processed_at IS NULL AND failed_at IS NULL
+    `);
+
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_booking_sagas_awaiting ON booking_sagas(expires_at) WHERE status = 'awaiting_payment'
+    `);
+
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_booking_sagas_payment ON booking_sagas(payment_id) WHERE payment_id IS NOT NULL
+    `);
+
+    await client.query(`
+      CREATE INDEX IF NOT EXISTS idx_receipts_email_due ON receipts(email_next_attempt_at)
+      WHERE email_status IN ('pending', 'sending')
+    `);
+
+    // A receipt is disputed once at a time, and never again after it was charged back
+    await client.query(`
+      CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_disputes_active_per_receipt ON payment_disputes(receipt_id)
+      WHERE status IN ('open', 'lost')
+    `);
+
     await client.query('COMMIT');
     logger.info('Database initialized successfully');
     
@@ -138,15 +794,20 @@ const populateTestData = async () => {
     await client.query('BEGIN');
 
     // Insert test guests
-    await client.query(`
-      INSERT INTO guests (name, email, phone) VALUES
-      ('John Doe', 'john.doe@example.com', '555-0001'),
-      ('Jane Smith', 'jane.smith@example.com', '555-0002'),
-      ('Bob Johnson', 'bob.johnson@example.com', '555-0003'),
-      ('Alice Brown', 'alice.brown@example.com', '555-0004'),
-      ('Charlie Wilson', 'charlie.wilson@example.com', '555-0005')
-      ON CONFLICT (email) DO NOTHING
-    `);
+    for (const [name, email, phone] of [
+      ['John Doe', 'john.doe@example.com', '555-0001'],
+      ['Jane Smith', 'jane.smith@example.com', '555-0002'],
+      ['Bob Johnson', 'bob.johnson@example.com', '555-0003'],
+      ['Alice Brown', 'alice.brown@example.com', '555-0004'],
+      ['Charlie Wilson', 'charlie.wilson@example.com', '555-0005']
+    ]) {
+      const contact = sealContact(email, phone);
+      await client.query(
+        `INSERT INTO guests (name, email, phone, email_lookup, pii_key_id) VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT DO NOTHING`,
+        [name, contact.email, contact.phone, contact.emailLookup, contact.keyId]
+      );
+    }
 
     // Add more test rooms
     await client.query(`
@@ -172,6 +833,36 @@ const populateTestData = async () => {
   }
 };
 
+// Capacity planning: bulk-generates rooms R000001..RNNNNNN with a realistic type mix
+// (60% Standard, 30% Deluxe, 10% Suite) so availability queries and indexes can be tested at scale
+const populateScaledInventory = async (roomCount: number) => {
+  const client = await pool.connect();
+  
+  try {
+    await client.query('BEGIN');
+
+    const result = await client.query(`
+      INSERT INTO rooms (room_number, room_type, price_per_night)
+      SELECT 'R' || LPAD(n::text, 6, '0'),
+             CASE WHEN n % 10 < 6 THEN 'Standard' WHEN n % 10 < 9 THEN 'Deluxe' ELSE 'Suite' END,
+             CASE WHEN n % 10 < 6 THEN 100.00 WHEN n % 10 < 9 THEN 150.00 ELSE 250.00 END
+      FROM generate_series(1, $1::int) AS n
+      ON CONFLICT (room_number) DO NOTHING
+    `, [roomCount]);
+
+    await client.query('COMMIT');
+    await client.query('ANALYZE rooms');
+    logger.info('Scaled room inventory populated', { requested: roomCount, inserted: result.rowCount });
+    
+  } catch (error) {
+    await client.query('ROLLBACK');
+    logger.error('Failed to populate scaled inventory', { error: error instanceof Error ? error.message : String(error) });
+    throw error;
+  } finally {
+    client.release();
+  }
+};
+
 // Function to reset counters (useful for testing)
 const resetBookingCounters = async () => {
   const client = await pool.connect();
@@ -196,8 +887,13 @@ const resetBookingCounters = async () => {
 
 // Run if called directly
 if (require.main === module) {
+  // e.g. npm run init-db -- --rooms 5000 (or SEED_ROOM_COUNT=5000)
+  const roomsArg = process.argv.indexOf('--rooms');
+  const scaledRoomCount = parseInt(roomsArg >= 0 ? process.argv[roomsArg + 1] : process.env.SEED_ROOM_COUNT || '0');
+
   createTables()
     .then(() => populateTestData())
+    .then(() => (scaledRoomCount > 0 ? populateScaledInventory(scaledRoomCount) : undefined))
     .then(() => {
       logger.info('Database setup complete');
       process.exit(0);
@@ -208,4 +904,4 @@ if (require.main === module) {
     });
 }
 
-export { createTables, populateTestData, resetBookingCounters };
\ No newline at end of file
+export { createTables, populateTestData, populateScaledInventory, resetBookingCounters };
\ No newline at end of file
@@ -0,0 +1,212 @@
+import fs from 'fs';
+import { pool } from '../config/database';
+import { logger } from '../utils/logger';
+import { addDays, today } from '../utils/date';
+import { BookingService } from '../services/bookingService';
+import { sealContact } from '../services/guestContact';
+import { BookingStatus } from '../types';
+
+// Fixture files (fixtures/*.json) describe a demo or regression setup as data. Dates are offsets from
+// today so fixtures never age out of the booking horizon.
+interface StayFixture {
+  roomNumber: string;
+  checkInOffsetDays: number;
+  nights: number;
+}
+
+interface BookingFixture extends StayFixture {
+  ref: string;
+  guestEmail: string;
+  paymentMethod: string;
+  status?: BookingStatus;
+}
+
+interface HoldFixture extends StayFixture {
+  ref: string;
+  minutes?: number;
+}
+
+interface ConflictFixture {
+  description: string;
+  booking: StayFixture & { guestEmail: string; paymentMethod: string };
+  expectError: string;
+}
+
+export interface Fixture {
+  name: string;
+  description?: string;
+  rooms: { roomNumber: string; roomType: string; pricePerNight: number }[];
+  guests: { name: string; email: string; phone: string }[];
+  bookings?: BookingFixture[];
+  holds?: HoldFixture[];
+  conflicts?: ConflictFixture[];
+}
+
+export interface ConflictOutcome {
+  description: string;
+  expectError: string;
+  actualError: string | null;
+  passed: boolean;
+}
+
+export interface LoadedFixture {
+  roomIds: Record<string, number>;
+  bookingIds: Record<string, number>;
+  holdTokens: Record<string, string>;
+}
+
+// Lifecycle steps from a freshly created (pending) booking to each fixture status
+const STATUS_PATH: Record<BookingStatus, Exclude<BookingStatus, 'pending' | 'cancelled'>[]> = {
+  pending: [],
+  confirmed: ['confirmed'],
+  checked_in: ['confirmed', 'checked_in'],
+  checked_out: ['confirmed', 'checked_in', 'checked_out'],
+  no_show: ['confirmed', 'no_show'],
+  cancelled: []
+};
+
+const bookingService = new BookingService();
+
+export function readFixture(file: string): Fixture {
+  const fixture = JSON.parse(fs.readFileSync(file, 'utf8'));
+  if (!fixture || typeof fixture.name !== 'string' || !Array.isArray(fixture.rooms) || !Array.isArray(fixture.guests)) {
+    throw new Error(`${file} must be a fixture with a name, rooms and guests`);
+  }
+  return fixture;
+}
+
+const stayDates = (stay: StayFixture) => {
+  const checkInDate = addDays(today(), stay.checkInOffsetDays);
+  return { checkInDate, checkOutDate: addDays(checkInDate, stay.nights) };
+};
+
+// Inserts rooms and guests, then creates bookings and holds through the booking service so payments,
+// receipts and room availability are exactly what the API would produce
+export async function loadFixture(fixture: Fixture): Promise<LoadedFixture> {
+  const roomIds: Record<string, number> = {};
+  for (const room of fixture.rooms) {
+    const result = await pool.query(
+      `INSERT INTO rooms (room_number, room_type, price_per_night) VALUES ($1, $2, $3)
+       ON CONFLICT (room_number) DO UPDATE SET room_type = EXCLUDED.room_type, price_per_night = EXCLUDED.price_per_night
+       RETURNING id`,
+      [room.roomNumber, room.roomType, room.pricePerNight]
+    );
+    roomIds[room.roomNumber] = result.rows[0].id;
+  }
+
+  for (const guest of fixture.guests) {
+    const contact = sealContact(guest.email, guest.phone);
+    await pool.query(
+      `INSERT INTO guests (name, email, phone, email_lookup, pii_key_id) VALUES ($1, $2, $3, $4, $5)
+       ON CONFLICT DO NOTHING`,
+      [guest.name, contact.email, contact.phone, contact.emailLookup, contact.keyId]
+    );
+  }
+
+  const guests = new Map(fixture.guests.map(guest => [guest.email, guest]));
+  const guestFor = (email: string) => {
+    const guest = guests.get(email);
+    if (!guest) {
+      throw new Error(`Fixture ${fixture.name} references unknown guest ${email}`);
+    }
+    return guest;
+  };
+
+  const bookingIds: Record<string, number> = {};
+  for (const booking of fixture.bookings || []) {
+    const guest = guestFor(booking.guestEmail);
+    const result = await bookingService.createBooking({
+      guestName: guest.name,
+      guestEmail: guest.email,
+      guestPhone: guest.phone,
+      roomId: roomIds[booking.roomNumber],
+      paymentMethod: booking.paymentMethod,
+      ...stayDates(booking)
+    });
+    bookingIds[booking.ref] = result.booking.id;
+
+    if (booking.status === 'cancelled') {
+      await bookingService.cancelBooking(result.booking.id, { code: 'other', text: `fixture ${fixture.name}` });
+    }
+    for (const status of STATUS_PATH[booking.status || 'pending']) {
+      await bookingService.changeStatus(result.booking.id, status);
+    }
+  }
+
+  const holdTokens: Record<string, string> = {};
+  for (const hold of fixture.holds || []) {
+    const created = await bookingService.createHold({
+      roomId: roomIds[hold.roomNumber],
+      minutes: hold.minutes,
+      ...stayDates(hold)
+    });
+    holdTokens[hold.ref] = created.token;
+  }
+
+  logger.info('Fixture loaded', {
+    fixture: fixture.name,
+    rooms: fixture.rooms.length,
+    bookings: Object.keys(bookingIds).length,
+    holds: Object.keys(holdTokens).length
+  });
+  return { roomIds, bookingIds, holdTokens };
+}
+
+// Replays each intentional conflict against a loaded fixture and reports whether it failed as expected
+export async function runConflicts(fixture: Fixture, loaded: LoadedFixture): Promise<ConflictOutcome[]> {
+  const outcomes: ConflictOutcome[] = [];
+
+  for (const conflict of fixture.conflicts || []) {
+    const guest = fixture.guests.find(candidate => candidate.email === conflict.booking.guestEmail);
+    let actualError: string | null = null;
+
+    try {
+      await bookingService.createBooking({
+        guestName: guest?.name ?? conflict.booking.guestEmail,
+        guestEmail: conflict.booking.guestEmail,
+        guestPhone: guest?.phone ?? '555-0000',
+        roomId: loaded.roomIds[conflict.booking.roomNumber],
+        paymentMethod: conflict.booking.paymentMethod,
+        ...stayDates(conflict.booking)
+      });
+    } catch (error) {
+      actualError = error instanceof Error ? error.message : String(error);
+    }
+
+    outcomes.push({
+      description: conflict.description,
+      expectError: conflict.expectError,
+      actualError,
+      passed: actualError === conflict.expectError
+    });
+  }
+
+  return outcomes;
+}
+
+// Run if called directly: npm run load-fixtures -- fixtures/double-booking.json [--conflicts]
+if (require.main === module) {
+  const files = process.argv.slice(2).filter(arg => !arg.startsWith('--'));
+  const withConflicts = process.argv.includes('--conflicts');
+
+  (async () => {
+    let failed = 0;
+    for (const file of files) {
+      const fixture = readFixture(file);
+      const loaded = await loadFixture(fixture);
+
+      if (withConflicts) {
+        for (const outcome of await runConflicts(fixture, loaded)) {
+          console.log(`${outcome.passed ? 'PASS' : 'FAIL'} ${fixture.name}: ${outcome.description}` +
+            (outcome.passed ? '' : ` (expected "${outcome.expectError}", got "${outcome.actualError}")`));
+          failed += outcome.passed ? 0 : 1;
+        }
+      }
+    }
+    await pool.end();
+    process.exit(failed > 0 ? 1 : 0);
+  })().catch((error) => {
+    logger.error('Loading fixtures failed', { error: error instanceof Error ? error.message : String(error) });
+    process.exit(1);
+  });
+}
@@ -0,0 +1,126 @@
+import { pool } from '../config/database';
+import { logger } from '../utils/logger';
+import { runInTransaction } from '../services/transactionManager';
+
+interface RebuildOptions {
+  fromRoomId?: number;
+  toRoomId?: number;
+  batchSize: number;
+  dryRun: boolean;
+}
+
+interface RoomStatusDiff {
+  roomId: number;
+  roomNumber: string;
+  isAvailable: { current: boolean; expected: boolean };
+  bookingCount: { current: number; expected: number };
+}
+
+// Recomputes rooms.is_available and rooms.booking_count from the bookings still holding the room (and, for
+// availability, the room's unexpired active hold), one batch of rooms per transaction, and returns the rows
+// that were (or would be) changed.
+const rebuildRoomStatus = async (options: RebuildOptions): Promise<RoomStatusDiff[]> => {
+  const diffs: RoomStatusDiff[] = [];
+  let lastRoomId = (options.fromRoomId ?? 1) - 1;
+
+  for (;;) {
+    const batch = await runInTransaction(async ({ client }) => {
+      const result = await client.query(`
+        SELECT r.id, r.room_number, r.is_available, COALESCE(r.booking_count, 0) AS booking_count,
+               (SELECT COUNT(*) FROM bookings b
+                 WHERE b.room_id = r.id AND b.status IN ('pending', 'confirmed', 'checked_in')) AS active_bookings,
+               EXISTS (SELECT 1 FROM room_holds h
+                        WHERE h.room_id = r.id AND h.status = 'active' AND h.expires_at > CURRENT_TIMESTAMP) AS held
+        FROM rooms r
+        WHERE r.id > $1 AND ($2::int IS NULL OR r.id <= $2)
+        ORDER BY r.id
+        LIMIT $3
+        FOR UPDATE OF r
+      `, [lastRoomId, options.toRoomId ?? null, options.batchSize]);
+
+      const batchDiffs: RoomStatusDiff[] = [];
+      for (const row of result.rows) {
+        const activeBookings = Number(row.active_bookings);
+        const diff: RoomStatusDiff = {
+          roomId: row.id,
+          roomNumber: row.room_number,
+          isAvailable: { current: row.is_available, expected: activeBookings === 0 && !row.held },
+          bookingCount: { current: Number(row.booking_count), expected: activeBookings }
+        };
+
+        if (diff.isAvailable.current === diff.isAvailable.expected &&
+          diff.bookingCount.current === diff.bookingCount.expected) {
+          continue;
+        }
+
+        batchDiffs.push(diff);
+        if (!options.dryRun) {
+          await client.query(
+            'UPDATE rooms SET is_available = $1, booking_count = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3',
+            [diff.isAvailable.expected, diff.bookingCount.expected, diff.roomId]
+          );
+        }
+      }
+
+      const lastRow = result.rows[result.rows.length - 1];
+      return { rows: result.rows.length, lastId: lastRow ? lastRow.id : null, diffs: batchDiffs };
+    }, { name: 'rebuildRoomStatus' });
+
+    diffs.push(...batch.diffs);
+    if (batch.lastId === null || batch.rows < options.batchSize) {
+      break;
+    }
+    lastRoomId = batch.lastId;
+  }
+
+  logger.info(options.dryRun ? 'Room status dry run complete' : 'Room status rebuilt', {
+    changedRooms: diffs.length
+  });
+  return diffs;
+};
+
+const parseArgs = (args: string[]): RebuildOptions => {
+  const options: RebuildOptions = { batchSize: 100, dryRun: false };
+
+  for (let i = 0; i < args.length; i++) {
+    switch (args[i]) {
+      case '--from-room':
+        options.fromRoomId = parseInt(args[++i]);
+        break;
+      case '--to-room':
+        options.toRoomId = parseInt(args[++i]);
+        break;
+      case '--batch-size':
+        options.batchSize = parseInt(args[++i]);
+        break;
+      case '--dry-run':
+        options.dryRun = true;
+        break;
+      default:
+        throw new Error(`Unknown option: ${args[i]}`);
+    }
+  }
+
+  return options;
+};
+
+// Run if called directly
+if (require.main === module) {
+  Promise.resolve()
+    .then(() => rebuildRoomStatus(parseArgs(process.argv.slice(2))))
+    .then(diffs => {
+      diffs.forEach(diff => {
+        console.log(`Room ${diff.roomNumber} (id ${diff.roomId}): ` +
+          `is_available ${diff.isAvailable.current} -> ${diff.isAvailable.expected}, ` +
+          `booking_count ${diff.bookingCount.current} -> ${diff.bookingCount.expected}`);
+      });
+      return pool.end();
+    })
+    .then(() => process.exit(0))
+    .catch((error) => {
+      logger.error('Room status rebuild failed', { error: error instanceof Error ? error.message : String(error) });
+      process.exit(1);
+    });
+}
+
+export { rebuildRoomStatus };
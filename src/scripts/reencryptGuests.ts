@@ -0,0 +1,121 @@
+import { pool } from '../config/database';
+import { encryptionConfig } from '../config/encryption';
+import { logger } from '../utils/logger';
+import { runInTransaction } from '../services/transactionManager';
+import { openContactField, SealedContact, sealContact } from '../services/guestContact';
+
+interface ReencryptOptions {
+  batchSize: number;
+  // Rewrite every row, not just those on another key (after GUEST_LOOKUP_KEY changed)
+  all: boolean;
+  dryRun: boolean;
+}
+
+interface ContactTable {
+  name: 'guests' | 'booking_waitlist';
+  select: string;
+  update: string;
+  updateParams: (id: number, contact: SealedContact) => unknown[];
+}
+
+// Rows still in plain text (no key id) or encrypted with another key than GUEST_ENCRYPTION_KEY_ID
+const CONTACT_TABLES: ContactTable[] = [
+  {
+    name: 'guests',
+    select: `SELECT id, email, phone, pii_key_id FROM guests
+             WHERE id > $1 AND ($2 OR pii_key_id IS DISTINCT FROM $3)
+             ORDER BY id LIMIT $4 FOR UPDATE`,
+    update: `UPDATE guests SET email = $2, phone = $3, email_lookup = $4, pii_key_id = $5, updated_at = CURRENT_TIMESTAMP
+             WHERE id = $1`,
+    updateParams: (id, contact) => [id, contact.email, contact.phone, contact.emailLookup, contact.keyId]
+  },
+  {
+    name: 'booking_waitlist',
+    select: `SELECT id, guest_email AS email, guest_phone AS phone, pii_key_id FROM booking_waitlist
+             WHERE id > $1 AND ($2 OR pii_key_id IS DISTINCT FROM $3)
+             ORDER BY id LIMIT $4 FOR UPDATE`,
+    update: 'UPDATE booking_waitlist SET guest_email = $2, guest_phone = $3, pii_key_id = $4 WHERE id = $1',
+    updateParams: (id, contact) => [id, contact.email, contact.phone, contact.keyId]
+  }
+];
+
+// Moves guest and waitlist contact details onto the current encryption key, encrypting rows written before
+// encryption on the way, one batch per transaction. Returns how many rows of each table were (or would be)
+// rewritten. Run after adding a key and making it current; the old key can be dropped once this finds nothing.
+const reencryptGuests = async (options: ReencryptOptions): Promise<Record<string, number>> => {
+  const counts: Record<string, number> = {};
+
+  for (const table of CONTACT_TABLES) {
+    let lastId = 0;
+    counts[table.name] = 0;
+
+    for (;;) {
+      const batch = await runInTransaction(async ({ client }) => {
+        const result = await client.query(table.select, [lastId, options.all, encryptionConfig.currentKeyId, options.batchSize]);
+
+        if (!options.dryRun) {
+          for (const row of result.rows) {
+            const contact = sealContact(
+              openContactField(row.email, 'email', row.pii_key_id),
+              openContactField(row.phone, 'phone', row.pii_key_id)
+            );
+            await client.query(table.update, table.updateParams(row.id, contact));
+          }
+        }
+
+        const lastRow = result.rows[result.rows.length - 1];
+        return { rows: result.rows.length, lastId: lastRow ? lastRow.id : null };
+      }, { name: 'reencryptGuests' });
+
+      counts[table.name] += batch.rows;
+      if (batch.lastId === null || batch.rows < options.batchSize) {
+        break;
+      }
+      lastId = batch.lastId;
+    }
+  }
+
+  logger.info(options.dryRun ? 'Guest re-encryption dry run complete' : 'Guest contact details re-encrypted', {
+    keyId: encryptionConfig.currentKeyId, ...counts
+  });
+  return counts;
+};
+
+const parseArgs = (args: string[]): ReencryptOptions => {
+  const options: ReencryptOptions = { batchSize: 500, all: false, dryRun: false };
+
+  for (let i = 0; i < args.length; i++) {
+    switch (args[i]) {
+      case '--batch-size':
+        options.batchSize = parseInt(args[++i]);
+        break;
+      case '--all':
+        options.all = true;
+        break;
+      case '--dry-run':
+        options.dryRun = true;
+        break;
+      default:
+        throw new Error(`Unknown option: ${args[i]}`);
+    }
+  }
+
+  return options;
+};
+
+// Run if called directly
+if (require.main === module) {
+  Promise.resolve()
+    .then(() => reencryptGuests(parseArgs(process.argv.slice(2))))
+    .then(counts => {
+      Object.entries(counts).forEach(([table, rows]) => console.log(`${table}: ${rows} rows`));
+      return pool.end();
+    })
+    .then(() => process.exit(0))
+    .catch((error) => {
+      logger.error('Guest re-encryption failed', { error: error instanceof Error ? error.message : String(error) });
+      process.exit(1);
+    });
+}
+
+export { reencryptGuests };
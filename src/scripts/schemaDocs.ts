@@ -0,0 +1,19 @@
+import { pool } from '../config/database';
+import { SchemaService } from '../services/schemaService';
+import { logger } from '../utils/logger';
+
+// Run if called directly: npm run schema-docs -- --format markdown|mermaid|dot|json (markdown by default)
+if (require.main === module) {
+  const formatIndex = process.argv.indexOf('--format');
+  const schemaService = new SchemaService();
+
+  (async () => {
+    const format = schemaService.parseFormat(formatIndex === -1 ? 'markdown' : process.argv[formatIndex + 1]);
+    const tables = await schemaService.describe();
+    process.stdout.write(format === 'json' ? JSON.stringify(tables, null, 2) + '\n' : schemaService.render(tables, format));
+    await pool.end();
+  })().catch((error) => {
+    logger.error('Generating schema docs failed', { error: error instanceof Error ? error.message : String(error) });
+    process.exit(1);
+  });
+}
@@ -0,0 +1,173 @@
+import { PoolClient } from 'pg';
+import { getClient } from '../config/database';
+import { runInTransaction } from './transactionManager';
+import { logger } from '../utils/logger';
+import { NotFoundError, ValidationError } from '../utils/errors';
+import { isValidDateString } from '../utils/date';
+import { AdjoiningRoomSet } from '../types';
+
+// A party can book at most this many connected rooms in one go
+export const MAX_ADJOINING_ROOMS = 4;
+
+export interface AdjoiningSearch {
+  checkInDate: string;
+  checkOutDate: string;
+  rooms: number;
+  roomType?: string;
+}
+
+export function adjoiningSearchErrors(search: Partial<Record<keyof AdjoiningSearch, unknown>>): Record<string, string> {
+  const fields: Record<string, string> = {};
+  if (!isValidDateString(search.checkInDate)) {
+    fields.checkInDate = 'must be a date in YYYY-MM-DD format';
+  }
+  if (!isValidDateString(search.checkOutDate)) {
+    fields.checkOutDate = 'must be a date in YYYY-MM-DD format';
+  } else if (isValidDateString(search.checkInDate) && search.checkOutDate <= search.checkInDate) {
+    fields.checkOutDate = 'must be after checkInDate';
+  }
+  if (!Number.isInteger(search.rooms) || (search.rooms as number) < 2 || (search.rooms as number) > MAX_ADJOINING_ROOMS) {
+    fields.rooms = `must be a whole number from 2 to ${MAX_ADJOINING_ROOMS}`;
+  }
+  if (search.roomType !== undefined && (typeof search.roomType !== 'string' || search.roomType.trim() === '')) {
+    fields.roomType = 'must be a room type';
+  }
+  return fields;
+}
+
+// Disjoint sets of `rooms` free rooms, each reachable from the others through connecting doors. Free means
+// bookable now, not retired and not in maintenance during the stay. Sets are grown breadth-first from the
+// lowest room number, so a set is as compact as the doors allow.
+export async function findAdjoiningSets(client: PoolClient, search: AdjoiningSearch): Promise<AdjoiningRoomSet[]> {
+  const free = await client.query(
+    `SELECT id, room_number, room_type FROM rooms r
+     WHERE r.is_available AND r.retired_at IS NULL AND NOT r.is_sandbox AND ($3::varchar IS NULL OR r.room_type = $3)
+       AND NOT EXISTS (SELECT 1 FROM room_maintenance_blocks m
+                       WHERE m.room_id = r.id AND m.status = 'active' AND m.start_date < $2 AND m.end_date > $1)
+     ORDER BY room_number`,
+    [search.checkInDate, search.checkOutDate, search.roomType?.trim() ?? null]
+  );
+  const rooms = new Map<number, { id: number; room_number: string; room_type: string }>(
+    free.rows.map(row => [row.id, row])
+  );
+  const doors = await client.query(
+    'SELECT room_id, adjoining_room_id FROM adjoining_rooms WHERE room_id = ANY($1) AND adjoining_room_id = ANY($1)',
+    [Array.from(rooms.keys())]
+  );
+  const neighbours = new Map<number, number[]>();
+  for (const { room_id, adjoining_room_id } of doors.rows) {
+    neighbours.set(room_id, [...(neighbours.get(room_id) ?? []), adjoining_room_id]);
+    neighbours.set(adjoining_room_id, [...(neighbours.get(adjoining_room_id) ?? []), room_id]);
+  }
+  const byNumber = (a: number, b: number) => rooms.get(a)!.room_number.localeCompare(rooms.get(b)!.room_number);
+
+  const used = new Set<number>();
+  const sets: AdjoiningRoomSet[] = [];
+  for (const start of rooms.keys()) {
+    if (used.has(start)) {
+      continue;
+    }
+    const picked = [start];
+    for (let i = 0; i < picked.length && picked.length < search.rooms; i++) {
+      for (const next of (neighbours.get(picked[i]) ?? []).sort(byNumber)) {
+        if (!used.has(next) && !picked.includes(next) && picked.length < search.rooms) {
+          picked.push(next);
+        }
+      }
+    }
+    if (picked.length === search.rooms) {
+      picked.forEach(id => used.add(id));
+      sets.push({
+        roomIds: picked,
+        roomNumbers: picked.map(id => rooms.get(id)!.room_number),
+        roomTypes: picked.map(id => rooms.get(id)!.room_type)
+      });
+    }
+  }
+  return sets;
+}
+
+// Which rooms connect to which. A door is stored once, but works both ways.
+export class AdjoiningRoomService {
+  async link(roomId: number, otherRoomId: number): Promise<number[]> {
+    const [low, high] = this.validatePair(roomId, otherRoomId);
+    const client = await getClient();
+
+    try {
+      const rooms = await client.query('SELECT id FROM rooms WHERE id = ANY($1)', [[low, high]]);
+      if (rooms.rows.length < 2) {
+        throw new NotFoundError('Room not found');
+      }
+      await client.query(
+        'INSERT INTO adjoining_rooms (room_id, adjoining_room_id) VALUES ($1, $2) ON CONFLICT DO NOTHING',
+        [low, high]
+      );
+
+      logger.info('Adjoining rooms linked', { roomId: low, adjoiningRoomId: high });
+      return this.adjoiningRoomIds(client, roomId);
+    } finally {
+      client.release();
+    }
+  }
+
+  async unlink(roomId: number, otherRoomId: number): Promise<number[]> {
+    const [low, high] = this.validatePair(roomId, otherRoomId);
+    const client = await getClient();
+
+    try {
+      const deleted = await client.query(
+        'DELETE FROM adjoining_rooms WHERE room_id = $1 AND adjoining_room_id = $2',
+        [low, high]
+      );
+      if (deleted.rowCount === 0) {
+        throw new NotFoundError('Rooms are not adjoining');
+      }
+
+      logger.info('Adjoining rooms unlinked', { roomId: low, adjoiningRoomId: high });
+      return this.adjoiningRoomIds(client, roomId);
+    } finally {
+      client.release();
+    }
+  }
+
+  async listAdjoining(roomId: number): Promise<number[]> {
+    const client = await getClient();
+
+    try {
+      return await this.adjoiningRoomIds(client, roomId);
+    } finally {
+      client.release();
+    }
+  }
+
+  async findSets(search: AdjoiningSearch): Promise<AdjoiningRoomSet[]> {
+    const fields = adjoiningSearchErrors(search);
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid adjoining rooms search', fields);
+    }
+
+    // Named so TX_ISOLATION_LEVELS can run the search at a stricter level
+    return runInTransaction(({ client }) => findAdjoiningSets(client, search), { name: 'searchAdjoiningRooms', readOnly: true });
+  }
+
+  private validatePair(roomId: number, otherRoomId: number): [number, number] {
+    if (!Number.isInteger(roomId) || !Number.isInteger(otherRoomId) || roomId <= 0 || otherRoomId <= 0) {
+      throw new ValidationError('Invalid adjoining rooms', { roomId: 'must be positive integers' });
+    }
+    if (roomId === otherRoomId) {
+      throw new ValidationError('Invalid adjoining rooms', { roomId: 'a room cannot adjoin itself' });
+    }
+    return roomId < otherRoomId ? [roomId, otherRoomId] : [otherRoomId, roomId];
+  }
+
+  private async adjoiningRoomIds(client: PoolClient, roomId: number): Promise<number[]> {
+    const result = await client.query(
+      `SELECT adjoining_room_id AS id FROM adjoining_rooms WHERE room_id = $1
+       UNION
+       SELECT room_id FROM adjoining_rooms WHERE adjoining_room_id = $1
+       ORDER BY id`,
+      [roomId]
+    );
+    return result.rows.map(row => row.id);
+  }
+}
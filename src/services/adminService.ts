@@ -0,0 +1,384 @@
+import { runInTransaction } from './transactionManager';
+import { recordRoomStatus } from './roomStatusHistoryService';
+import { getClient } from '../config/database';
+import { logger } from '../utils/logger';
+import { metrics } from '../utils/metrics';
+import { addDays, formatDate, today } from '../utils/date';
+
+export interface ConsistencySnapshot {
+  takenAt: string;
+  activeBookings: number;
+  occupiedRoomNights: number;
+  bookingsTotal: number;
+  paymentsTotal: number;
+  receiptsTotal: number;
+  overlappingBookings: number;
+  roomsUnavailableWithoutBooking: number;
+  orphans: {
+    paymentsWithoutBooking: number;
+    receiptsWithoutBooking: number;
+    receiptsWithoutPayment: number;
+    activeBookingsWithoutPayment: number;
+    activeBookingsWithoutReceipt: number;
+  };
+}
+
+export interface OrphanCleanupReport {
+  dryRun: boolean;
+  receiptIds: number[];
+  paymentIds: number[];
+  roomIds: number[];
+}
+
+export interface IntegrityDrift {
+  day: string;
+  metric: string;
+  recorded: { rowCount: number; total: number; checksum: string };
+  current: { rowCount: number; total: number; checksum: string };
+}
+
+export interface IntegrityReport {
+  from: string;
+  to: string;
+  checkpointsRecorded: number;
+  drifts: IntegrityDrift[];
+}
+
+// Per-day aggregates over rows that must not change once the day is over: receipts and payments by the day
+// they were created (amounts only; payment status may still move), and room-nights of checked-out stays.
+// Each yields day, row_count, total and an md5 over the contributing rows for $1..$2.
+const INTEGRITY_METRICS: Record<string, string> = {
+  receipts: `
+    SELECT d::date AS day, COUNT(rec.id) AS row_count, COALESCE(SUM(rec.total_amount), 0) AS total,
+           md5(COALESCE(string_agg(rec.id || ':' || rec.total_amount, ',' ORDER BY rec.id), '')) AS checksum
+    FROM generate_series($1::date, $2::date, interval '1 day') d
+    LEFT JOIN receipts rec ON rec.generated_at >= d AND rec.generated_at < d + interval '1 day'
+    GROUP BY d ORDER BY d
+  `,
+  payments: `
+    SELECT d::date AS day, COUNT(p.id) AS row_count, COALESCE(SUM(p.amount), 0) AS total,
+           md5(COALESCE(string_agg(p.id || ':' || p.amount, ',' ORDER BY p.id), '')) AS checksum
+    FROM generate_series($1::date, $2::date, interval '1 day') d
+    LEFT JOIN payments p ON p.created_at >= d AND p.created_at < d + interval '1 day'
+    GROUP BY d ORDER BY d
+  `,
+  room_nights: `
+    SELECT d::date AS day, COUNT(b.id) AS row_count, COUNT(b.id) AS total,
+           md5(COALESCE(string_agg(b.id::text, ',' ORDER BY b.id), '')) AS checksum
+    FROM generate_series($1::date, $2::date, interval '1 day') d
+    LEFT JOIN bookings b ON b.status = 'checked_out' AND b.check_in_date <= d AND b.check_out_date > d
+    GROUP BY d ORDER BY d
+  `
+};
+
+const CANCELLED_IN_RANGE = `
+  FROM bookings b
+  JOIN rooms r ON r.id = b.room_id AND NOT r.is_sandbox
+  WHERE b.status = 'cancelled'
+    AND b.cancelled_at >= $1::date AND b.cancelled_at < $2::date + 1
+`;
+
+export class AdminService {
+  // All aggregates come from one serializable snapshot so they can be compared with each other
+  async getConsistencySnapshot(): Promise<ConsistencySnapshot> {
+    const row = await runInTransaction(async ({ client }) => {
+      const result = await client.query(`
+        SELECT
+          (SELECT COUNT(*) FROM bookings WHERE status <> 'cancelled') AS active_bookings,
+          (SELECT COALESCE(SUM(check_out_date - check_in_date), 0)
+             FROM bookings WHERE status <> 'cancelled') AS occupied_room_nights,
+          (SELECT COALESCE(SUM(total_amount), 0) FROM bookings WHERE status <> 'cancelled') AS bookings_total,
+          -- Surcharges are charged on top of the stay, so they are left out to compare with the bookings total
+          (SELECT COALESCE(SUM(p.amount - p.surcharge_amount), 0) FROM payments p
+             JOIN bookings b ON b.id = p.booking_id
+            WHERE b.status <> 'cancelled' AND p.status = 'completed') AS payments_total,
+          (SELECT COALESCE(SUM(rec.total_amount - rec.surcharge_amount), 0) FROM receipts rec
+             JOIN bookings b ON b.id = rec.booking_id
+            WHERE b.status <> 'cancelled' AND rec.kind IN ('payment', 'chargeback')) AS receipts_total,
+          (SELECT COUNT(*) FROM bookings a
+             JOIN bookings b ON a.room_id = b.room_id AND a.id < b.id
+            WHERE a.status <> 'cancelled' AND b.status <> 'cancelled'
+              AND a.check_in_date < b.check_out_date AND b.check_in_date < a.check_out_date) AS overlapping_bookings,
+          (SELECT COUNT(*) FROM rooms r
+            WHERE NOT r.is_available
+              AND NOT EXISTS (SELECT 1 FROM bookings b
+                               WHERE b.room_id = r.id AND b.status IN ('pending', 'confirmed', 'checked_in'))
+              AND NOT EXISTS (SELECT 1 FROM room_holds h
+                               WHERE h.room_id = r.id AND h.status = 'active' AND h.expires_at > CURRENT_TIMESTAMP)
+          ) AS rooms_unavailable_without_booking,
+          (SELECT COUNT(*) FROM payments p
+            WHERE NOT EXISTS (SELECT 1 FROM bookings b WHERE b.id = p.booking_id)) AS payments_without_booking,
+          (SELECT COUNT(*) FROM receipts rec
+            WHERE NOT EXISTS (SELECT 1 FROM bookings b WHERE b.id = rec.booking_id)) AS receipts_without_booking,
+          (SELECT COUNT(*) FROM receipts rec
+            WHERE rec.kind = 'payment'
+              AND NOT EXISTS (SELECT 1 FROM payments p WHERE p.id = rec.payment_id)) AS receipts_without_payment,
+          (SELECT COUNT(*) FROM bookings b
+            WHERE b.status <> 'cancelled'
+              AND NOT EXISTS (SELECT 1 FROM payments p WHERE p.booking_id = b.id)) AS active_bookings_without_payment,
+          (SELECT COUNT(*) FROM bookings b
+            WHERE b.status <> 'cancelled'
+              AND NOT EXISTS (SELECT 1 FROM receipts rec WHERE rec.booking_id = b.id)) AS active_bookings_without_receipt,
+          CURRENT_TIMESTAMP AS taken_at
+      `);
+
+      return result.rows[0];
+    }, { name: 'consistencySnapshot', isolationLevel: 'SERIALIZABLE', readOnly: true, deferrable: true });
+
+    return {
+      takenAt: new Date(row.taken_at).toISOString(),
+      activeBookings: Number(row.active_bookings),
+      occupiedRoomNights: Number(row.occupied_room_nights),
+      bookingsTotal: Number(row.bookings_total),
+      paymentsTotal: Number(row.payments_total),
+      receiptsTotal: Number(row.receipts_total),
+      overlappingBookings: Number(row.overlapping_bookings),
+      roomsUnavailableWithoutBooking: Number(row.rooms_unavailable_without_booking),
+      orphans: {
+        paymentsWithoutBooking: Number(row.payments_without_booking),
+        receiptsWithoutBooking: Number(row.receipts_without_booking),
+        receiptsWithoutPayment: Number(row.receipts_without_payment),
+        activeBookingsWithoutPayment: Number(row.active_bookings_without_payment),
+        activeBookingsWithoutReceipt: Number(row.active_bookings_without_receipt)
+      }
+    };
+  }
+
+  // Arrivals, departures, in-house stays and room states for one day, assembled in a single query
+  async getOccupancyBoard(date: string) {
+    const client = await getClient();
+
+    try {
+      const result = await client.query(`
+        WITH stays AS (
+          SELECT b.id AS booking_id, b.check_in_date, b.check_out_date, b.status,
+                 b.guest_name, r.id AS room_id, r.room_number, r.room_type
+          FROM bookings b
+          JOIN guests g ON g.id = b.guest_id
+          JOIN rooms r ON r.id = b.room_id AND NOT r.is_sandbox
+          WHERE b.status NOT IN ('cancelled', 'no_show')
+            AND b.check_in_date <= $1::date AND b.check_out_date >= $1::date
+        )
+        SELECT
+          (SELECT COALESCE(json_agg(s ORDER BY s.room_number), '[]')
+             FROM stays s WHERE s.check_in_date = $1::date) AS arrivals,
+          (SELECT COALESCE(json_agg(s ORDER BY s.room_number), '[]')
+             FROM stays s WHERE s.check_out_date = $1::date) AS departures,
+          (SELECT COALESCE(json_agg(s ORDER BY s.room_number), '[]')
+             FROM stays s WHERE s.check_in_date < $1::date AND s.check_out_date > $1::date) AS in_house,
+          (SELECT COALESCE(json_agg(json_build_object(
+                    'room_id', r.id,
+                    'room_number', r.room_number,
+                    'room_type', r.room_type,
+                    'is_available', r.is_available,
+                    'housekeeping_status', r.housekeeping_status
+                  ) ORDER BY r.room_number), '[]')
+             FROM rooms r WHERE NOT r.is_sandbox) AS rooms
+      `, [date]);
+
+      const row = result.rows[0];
+      return {
+        date,
+        arrivals: row.arrivals,
+        departures: row.departures,
+        inHouse: row.in_house,
+        rooms: row.rooms
+      };
+    } finally {
+      client.release();
+    }
+  }
+
+  // Bookings, room-nights and revenue per channel for stays overlapping from..to (inclusive).
+  // Room-nights are clipped to the range; revenue is the full booking total of non-cancelled stays.
+  async getChannelReport(from: string, to: string) {
+    const client = await getClient();
+
+    try {
+      const result = await client.query(`
+        SELECT b.channel,
+               COUNT(*) FILTER (WHERE b.status <> 'cancelled')::int AS bookings,
+               COUNT(*) FILTER (WHERE b.status = 'cancelled')::int AS cancellations,
+               COALESCE(SUM(LEAST(b.check_out_date, $2::date + 1) - GREATEST(b.check_in_date, $1::date))
+                 FILTER (WHERE b.status NOT IN ('cancelled', 'no_show')), 0)::int AS room_nights,
+               COALESCE(SUM(b.total_amount) FILTER (WHERE b.status <> 'cancelled'), 0)::float AS revenue
+        FROM bookings b
+        JOIN rooms r ON r.id = b.room_id AND NOT r.is_sandbox
+        WHERE b.check_in_date <= $2::date AND b.check_out_date > $1::date
+        GROUP BY b.channel
+        ORDER BY revenue DESC, b.channel
+      `, [from, to]);
+
+      return { from, to, channels: result.rows };
+    } finally {
+      client.release();
+    }
+  }
+
+  // Cancellations made between from and to (inclusive), grouped by reason, room type and lead time
+  async getCancellationAnalytics(from: string, to: string) {
+    return runInTransaction(async ({ client }) => {
+      const params = [from, to];
+
+      const byReason = await client.query(`
+        SELECT b.cancellation_reason_code AS reason_code, COUNT(*)::int AS cancellations,
+               COALESCE(SUM(b.total_amount), 0)::float AS cancelled_amount
+        ${CANCELLED_IN_RANGE}
+        GROUP BY b.cancellation_reason_code
+        ORDER BY cancellations DESC
+      `, params);
+
+      const byRoomType = await client.query(`
+        SELECT r.room_type, b.cancellation_reason_code AS reason_code, COUNT(*)::int AS cancellations
+        ${CANCELLED_IN_RANGE}
+        GROUP BY r.room_type, b.cancellation_reason_code
+        ORDER BY r.room_type, cancellations DESC
+      `, params);
+
+      const byLeadTime = await client.query(`
+        SELECT CASE
+                 WHEN b.check_in_date - b.cancelled_at::date <= 1 THEN '0-1 days'
+                 WHEN b.check_in_date - b.cancelled_at::date <= 7 THEN '2-7 days'
+                 WHEN b.check_in_date - b.cancelled_at::date <= 30 THEN '8-30 days'
+                 ELSE '31+ days'
+               END AS lead_time,
+               b.cancellation_reason_code AS reason_code,
+               COUNT(*)::int AS cancellations
+        ${CANCELLED_IN_RANGE}
+        GROUP BY 1, 2
+        ORDER BY 1, cancellations DESC
+      `, params);
+
+      return {
+        from,
+        to,
+        byReason: byReason.rows,
+        byRoomType: byRoomType.rows,
+        byLeadTime: byLeadTime.rows
+      };
+    }, { name: 'cancellationAnalytics', isolationLevel: 'REPEATABLE READ', readOnly: true });
+  }
+
+  // Removes receipts and payments that lost their booking (or, for payment receipts, their payment) and frees rooms left unavailable
+  // without an active booking or hold. With dryRun the same rows are reported but left untouched.
+  async cleanupOrphans(dryRun: boolean): Promise<OrphanCleanupReport> {
+    const report = await runInTransaction(async ({ client }) => {
+      const receipts = await client.query(`
+        SELECT rec.id FROM receipts rec
+        WHERE NOT EXISTS (SELECT 1 FROM bookings b WHERE b.id = rec.booking_id)
+           OR (rec.kind = 'payment' AND NOT EXISTS (SELECT 1 FROM payments p WHERE p.id = rec.payment_id))
+        ORDER BY rec.id
+        FOR UPDATE
+      `);
+      const receiptIds: number[] = receipts.rows.map(row => row.id);
+
+      // Payments still referenced by a receipt that is kept are left alone
+      const payments = await client.query(`
+        SELECT p.id FROM payments p
+        WHERE NOT EXISTS (SELECT 1 FROM bookings b WHERE b.id = p.booking_id)
+          AND NOT EXISTS (SELECT 1 FROM receipts rec WHERE rec.payment_id = p.id AND rec.id <> ALL($1::int[]))
+        ORDER BY p.id
+        FOR UPDATE
+      `, [receiptIds]);
+      const paymentIds: number[] = payments.rows.map(row => row.id);
+
+      const rooms = await client.query(`
+        SELECT r.id FROM rooms r
+        WHERE NOT r.is_available
+          AND NOT EXISTS (SELECT 1 FROM bookings b
+                           WHERE b.room_id = r.id AND b.status IN ('pending', 'confirmed', 'checked_in'))
+          AND NOT EXISTS (SELECT 1 FROM room_holds h
+                           WHERE h.room_id = r.id AND h.status = 'active' AND h.expires_at > CURRENT_TIMESTAMP)
+        ORDER BY r.id
+        FOR UPDATE OF r
+      `);
+      const roomIds: number[] = rooms.rows.map(row => row.id);
+
+      if (!dryRun) {
+        await client.query('DELETE FROM receipts WHERE id = ANY($1::int[])', [receiptIds]);
+        await client.query('DELETE FROM payments WHERE id = ANY($1::int[])', [paymentIds]);
+        await client.query(
+          'UPDATE rooms SET is_available = TRUE, updated_at = CURRENT_TIMESTAMP WHERE id = ANY($1::int[])',
+          [roomIds]
+        );
+        for (const roomId of roomIds) {
+          await recordRoomStatus(client, roomId, 'orphan_released');
+        }
+      }
+
+      return { dryRun, receiptIds, paymentIds, roomIds };
+    }, { name: 'cleanupOrphans' });
+
+    const counts = {
+      receipts: report.receiptIds.length,
+      payments: report.paymentIds.length,
+      rooms: report.roomIds.length
+    };
+    for (const [kind, count] of Object.entries(counts)) {
+      metrics.increment(`orphans.found.${kind}`, count);
+      if (!dryRun) {
+        metrics.increment(`orphans.removed.${kind}`, count);
+      }
+    }
+    metrics.increment(dryRun ? 'orphans.dry_runs' : 'orphans.runs');
+
+    if (counts.receipts + counts.payments + counts.rooms > 0) {
+      logger.warn(dryRun ? 'Orphaned rows found (dry run)' : 'Orphaned rows cleaned up', { ...report, ...counts });
+    }
+    return report;
+  }
+
+  // Recomputes the per-day integrity metrics for the last `days` finished days and compares them with the
+  // checkpoint taken the first time each day was checked. Days seen for the first time are checkpointed;
+  // a mismatch is reported (and left as is, so it keeps alerting until someone looks).
+  async checkIntegrity(days: number): Promise<IntegrityReport> {
+    const to = addDays(today(), -1);
+    const from = addDays(today(), -days);
+
+    const report = await runInTransaction(async ({ client }) => {
+      let checkpointsRecorded = 0;
+      const drifts: IntegrityDrift[] = [];
+
+      for (const [metric, query] of Object.entries(INTEGRITY_METRICS)) {
+        const current = await client.query(query, [from, to]);
+        const recorded = await client.query(
+          `SELECT day, row_count, total, checksum FROM integrity_checkpoints
+           WHERE metric = $1 AND day BETWEEN $2 AND $3`,
+          [metric, from, to]
+        );
+        const checkpoints = new Map(recorded.rows.map(row => [formatDate(row.day), row]));
+
+        for (const row of current.rows) {
+          const day = formatDate(row.day);
+          const checkpoint = checkpoints.get(day);
+
+          if (!checkpoint) {
+            await client.query(
+              `INSERT INTO integrity_checkpoints (day, metric, row_count, total, checksum)
+               VALUES ($1, $2, $3, $4, $5)
+               ON CONFLICT (day, metric) DO NOTHING`,
+              [day, metric, row.row_count, row.total, row.checksum]
+            );
+            checkpointsRecorded++;
+          } else if (checkpoint.checksum !== row.checksum || Number(checkpoint.total) !== Number(row.total)) {
+            drifts.push({
+              day,
+              metric,
+              recorded: { rowCount: Number(checkpoint.row_count), total: Number(checkpoint.total), checksum: checkpoint.checksum },
+              current: { rowCount: Number(row.row_count), total: Number(row.total), checksum: row.checksum }
+            });
+          }
+        }
+      }
+
+      return { from, to, checkpointsRecorded, drifts };
+    }, { name: 'checkIntegrity', isolationLevel: 'REPEATABLE READ' });
+
+    metrics.increment('integrity.checks');
+    if (report.drifts.length > 0) {
+      metrics.increment('integrity.drift', report.drifts.length);
+      logger.error('Integrity drift detected', { drifts: report.drifts });
+    }
+    return report;
+  }
+}
@@ -0,0 +1,38 @@
+import { PoolClient } from 'pg';
+import { lockingConfig } from '../config/locking';
+
+const DAY_MS = 24 * 60 * 60 * 1000;
+
+// Buckets are counted from the Unix epoch, so the same night always falls in the same bucket. A stay covers
+// the buckets of its first through its last night.
+export function stayBuckets(
+  checkInDate: string, checkOutDate: string, bucketDays: number = lockingConfig.bucketDays
+): [number, number] {
+  const day = (date: string) => Math.floor(Date.parse(`${date}T00:00:00Z`) / DAY_MS);
+  return [Math.floor(day(checkInDate) / bucketDays), Math.floor((day(checkOutDate) - 1) / bucketDays)];
+}
+
+// Waits for the room's advisory lock on every bucket of the stay, released when the transaction ends. Buckets
+// are taken in ascending order, so two stays of the same room can't deadlock on each other.
+export async function lockRoomStay(
+  client: PoolClient, roomId: number, checkInDate: string, checkOutDate: string
+): Promise<void> {
+  const [first, last] = stayBuckets(checkInDate, checkOutDate);
+  await client.query(
+    'SELECT pg_advisory_xact_lock($1, bucket) FROM generate_series($2::int, $3::int) AS bucket',
+    [roomId, first, last]
+  );
+}
+
+// Like lockRoomStay, without waiting; false when another transaction holds one of the buckets. Buckets taken
+// before the busy one stay locked until the transaction ends.
+export async function tryLockRoomStay(
+  client: PoolClient, roomId: number, checkInDate: string, checkOutDate: string
+): Promise<boolean> {
+  const [first, last] = stayBuckets(checkInDate, checkOutDate);
+  const result = await client.query(
+    'SELECT bool_and(pg_try_advisory_xact_lock($1, bucket)) AS locked FROM generate_series($2::int, $3::int) AS bucket',
+    [roomId, first, last]
+  );
+  return result.rows[0].locked === true;
+}
@@ -0,0 +1,78 @@
+import { PoolClient } from 'pg';
+import { getClient } from '../config/database';
+import { currentActor } from '../utils/actor';
+import { formatDate } from '../utils/date';
+import { keysetPage, PageQuery, parseIdPage } from '../utils/query';
+import { Booking, BookingAuditEntry } from '../types';
+
+export type BookingAuditAction = BookingAuditEntry['action'];
+export type FieldChanges = BookingAuditEntry['changes'];
+
+// Bookkeeping columns that change on every write, and the breakdown that total_amount already summarises
+const UNAUDITED_FIELDS = ['created_at', 'updated_at', 'price_breakdown'];
+
+function auditValue(field: string, value: unknown): unknown {
+  if (value instanceof Date) {
+    return field === 'check_in_date' || field === 'check_out_date' ? formatDate(value) : value.toISOString();
+  }
+  return value ?? null;
+}
+
+export class AuditService {
+  // Writes one history row with every field that differs between the two versions of the booking.
+  // Runs on the caller's client so the row commits (or rolls back) with the change it describes.
+  async recordBookingChange(
+    client: PoolClient,
+    action: BookingAuditAction,
+    before: Booking | null,
+    after: Booking,
+    extraChanges: FieldChanges = {}
+  ): Promise<void> {
+    const changes: FieldChanges = {};
+    for (const field of Object.keys(after)) {
+      if (UNAUDITED_FIELDS.includes(field)) {
+        continue;
+      }
+      const oldValue = before ? auditValue(field, (before as any)[field]) : null;
+      const newValue = auditValue(field, (after as any)[field]);
+      if (JSON.stringify(oldValue) !== JSON.stringify(newValue)) {
+        changes[field] = { old: oldValue, new: newValue };
+      }
+    }
+
+    await client.query(
+      `INSERT INTO booking_audit (booking_id, action, actor, changes)
+       VALUES ($1, $2, $3, $4)`,
+      [after.id, action, currentActor(), JSON.stringify({ ...changes, ...extraChanges })]
+    );
+  }
+
+  // Oldest first; null when the booking does not exist
+  async getBookingHistory(
+    bookingId: number, query: PageQuery = {}
+  ): Promise<{ entries: BookingAuditEntry[]; nextCursor: string | null } | null> {
+    const scope = ['history', bookingId];
+    const { limit, afterId } = parseIdPage(query, 'bookingHistory', scope);
+    const client = await getClient();
+
+    try {
+      const booking = await client.query('SELECT id FROM bookings WHERE id = $1', [bookingId]);
+      if (booking.rows.length === 0) {
+        return null;
+      }
+
+      const result = await client.query(
+        `SELECT id, action, actor, changes, transaction_id, created_at
+         FROM booking_audit
+         WHERE booking_id = $1 AND ($2::int IS NULL OR id > $2)
+         ORDER BY id
+         LIMIT $3`,
+        [bookingId, afterId, limit + 1]
+      );
+      const { items, nextCursor } = keysetPage(result.rows, limit, row => [...scope, row.id]);
+      return { entries: items, nextCursor };
+    } finally {
+      client.release();
+    }
+  }
+}
@@ -0,0 +1,92 @@
+import { getClient } from '../config/database';
+import { logger } from '../utils/logger';
+import { NotFoundError, ValidationError } from '../utils/errors';
+import { currentActor } from '../utils/actor';
+import { BookingNote, NoteVisibility } from '../types';
+
+export interface BookingNoteInput {
+  body?: unknown;
+  visibility?: unknown;
+}
+
+const NOTE_VISIBILITIES: NoteVisibility[] = ['internal', 'guest'];
+const MAX_NOTE_LENGTH = 2000;
+
+// Notes are append-only: each one is its own row, so concurrent writers never overwrite each other
+export class BookingNoteService {
+  async addNote(bookingId: number, input: BookingNoteInput): Promise<BookingNote> {
+    const { body, visibility } = this.validateNote(input);
+    const client = await getClient();
+
+    try {
+      // Inserting from the booking row makes a missing booking and the insert one statement
+      const result = await client.query(
+        `INSERT INTO booking_notes (booking_id, author, body, visibility)
+         SELECT id, $2, $3, $4 FROM bookings WHERE id = $1
+         RETURNING *`,
+        [bookingId, currentActor(), body, visibility]
+      );
+
+      if (result.rows.length === 0) {
+        throw new NotFoundError('Booking not found');
+      }
+
+      logger.info('Booking note added', { bookingId, noteId: result.rows[0].id, visibility });
+      return result.rows[0];
+    } finally {
+      client.release();
+    }
+  }
+
+  // Oldest first; null when the booking does not exist
+  async getNotes(bookingId: number, visibility?: NoteVisibility): Promise<BookingNote[] | null> {
+    const client = await getClient();
+
+    try {
+      const booking = await client.query('SELECT id FROM bookings WHERE id = $1', [bookingId]);
+      if (booking.rows.length === 0) {
+        return null;
+      }
+
+      const result = await client.query(
+        `SELECT * FROM booking_notes
+         WHERE booking_id = $1 AND ($2::varchar IS NULL OR visibility = $2)
+         ORDER BY id`,
+        [bookingId, visibility ?? null]
+      );
+      return result.rows;
+    } finally {
+      client.release();
+    }
+  }
+
+  parseVisibility(value: unknown): NoteVisibility | undefined {
+    if (value === undefined) {
+      return undefined;
+    }
+    if (!NOTE_VISIBILITIES.includes(value as NoteVisibility)) {
+      throw new ValidationError('Invalid note query', { visibility: `must be one of: ${NOTE_VISIBILITIES.join(', ')}` });
+    }
+    return value as NoteVisibility;
+  }
+
+  private validateNote(input: BookingNoteInput): { body: string; visibility: NoteVisibility } {
+    const fields: Record<string, string> = {};
+
+    if (typeof input?.body !== 'string' || input.body.trim() === '') {
+      fields.body = 'is required';
+    } else if (input.body.trim().length > MAX_NOTE_LENGTH) {
+      fields.body = `must be at most ${MAX_NOTE_LENGTH} characters`;
+    }
+
+    const visibility = input?.visibility ?? 'internal';
+    if (!NOTE_VISIBILITIES.includes(visibility as NoteVisibility)) {
+      fields.visibility = `must be one of: ${NOTE_VISIBILITIES.join(', ')}`;
+    }
+
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid booking note', fields);
+    }
+    return { body: (input.body as string).trim(), visibility: visibility as NoteVisibility };
+  }
+}
@@ -0,0 +1,215 @@
+import { getClient } from '../config/database';
+import { runInTransaction, runInTransactionWithRetry } from './transactionManager';
+import { BookingService } from './bookingService';
+import { RefundService } from './refundService';
+import { enqueueOutbox } from './outboxService';
+import { paymentGateway } from './paymentGateway';
+import { sagaConfig } from '../config/saga';
+import { paymentMethods } from '../config/paymentMethods';
+import { logger } from '../utils/logger';
+import { metrics } from '../utils/metrics';
+import { eventBus } from '../events/eventBus';
+import { Booking, BookingRequest, BookingSaga, Payment } from '../types';
+
+const roundMoney = (amount: number) => Math.round(amount * 100) / 100;
+
+const toSaga = (row: any): BookingSaga => ({ ...row, amount: Number(row.amount) });
+
+// The saga's id for its charge at the gateway, which is also the payment's transaction_id; the gateway's
+// webhooks name the charge by it
+const chargeReference = (saga: BookingSaga) => `booking-saga-${saga.id}`;
+
+const bookingService = new BookingService();
+const refundService = new RefundService();
+
+// Cancels the saga's booking (unless something else already has) and marks the saga compensated
+async function compensate(saga: BookingSaga, reason: string): Promise<void> {
+  await runInTransaction(async ({ client }) => {
+    const booking = await client.query('SELECT status FROM bookings WHERE id = $1', [saga.booking_id]);
+    if (booking.rows[0]?.status !== 'cancelled') {
+      await bookingService.cancelBooking(saga.booking_id, { code: 'payment_issue', text: reason });
+    }
+    await client.query(
+      `UPDATE booking_sagas SET status = 'compensated', failure_reason = $2, updated_at = CURRENT_TIMESTAMP
+       WHERE id = $1`,
+      [saga.id, reason]
+    );
+  });
+  metrics.increment('sagas.compensated');
+  logger.warn('Booking saga compensated', { sagaId: saga.id, bookingId: saga.booking_id, reason });
+}
+
+// Moves the saga of a payment on once a webhook has changed the payment's status; joins the webhook's
+// transaction, so the saga step is applied exactly when the webhook is. A confirmed payment completes the saga
+// with a receipt, a failed one cancels the booking, and money that arrives after the booking was given up is
+// refunded.
+export async function settleSagaPayment(payment: Payment, failureReason?: string): Promise<void> {
+  await runInTransaction(async ({ client, afterCommit }) => {
+    const found = await client.query('SELECT * FROM booking_sagas WHERE payment_id = $1 FOR UPDATE', [payment.id]);
+    if (found.rows.length === 0) {
+      return;
+    }
+    const saga = toSaga(found.rows[0]);
+
+    if (payment.status === 'failed' && saga.status === 'awaiting_payment') {
+      await compensate(saga, `Payment failed${failureReason ? `: ${failureReason}` : ''}`);
+      return;
+    }
+    if (payment.status !== 'completed') {
+      return;
+    }
+
+    const booking = await client.query('SELECT status FROM bookings WHERE id = $1 FOR UPDATE', [saga.booking_id]);
+    if (saga.status === 'awaiting_payment' && booking.rows[0].status === 'cancelled') {
+      await compensate(saga, 'Booking was cancelled before its payment arrived');
+      saga.status = 'compensated';
+    }
+    if (saga.status === 'compensated') {
+      await refundService.refundPayments(
+        client, saga.booking_id, roundMoney(Number(payment.amount) - Number(payment.surcharge_amount ?? 0))
+      );
+      metrics.increment('sagas.late_payments_refunded');
+      logger.warn('Payment arrived after its booking saga was compensated; refunded', {
+        sagaId: saga.id, bookingId: saga.booking_id, paymentId: payment.id
+      });
+      return;
+    }
+    if (saga.status !== 'awaiting_payment') {
+      return;
+    }
+
+    const receipt = await client.query(
+      `INSERT INTO receipts
+         (booking_id, payment_id, receipt_number, total_amount, surcharge_amount, payment_method, gateway_reference, email_status)
+       VALUES ($1, $2, $3, $4, $5, $6, $7, 'pending')
+       RETURNING *`,
+      [saga.booking_id, payment.id, `RCP_${Date.now()}_${Math.random().toString(36).slice(2, 8)}`, payment.amount,
+        payment.surcharge_amount ?? 0, payment.payment_method, payment.transaction_id]
+    );
+    await client.query(
+      `UPDATE booking_sagas SET status = 'completed', receipt_id = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`,
+      [saga.id, receipt.rows[0].id]
+    );
+    afterCommit(() => {
+      eventBus.publish('receipt.issued', { receiptId: receipt.rows[0].id, bookingId: saga.booking_id });
+    });
+    metrics.increment('sagas.completed');
+    logger.info('Booking saga completed', { sagaId: saga.id, bookingId: saga.booking_id, paymentId: payment.id });
+  });
+}
+
+// Books and pays in steps rather than one transaction, since the gateway answers asynchronously: the booking
+// is made unpaid together with a payment.requested outbox message; the relay records the pending payment, then
+// asks the gateway to charge it through a second message; the gateway's webhook completes the saga or, when the payment fails or doesn't arrive within
+// SAGA_PAYMENT_TIMEOUT_MINUTES, the booking is cancelled again.
+export class BookingSagaService {
+  async start(request: BookingRequest): Promise<{ saga: BookingSaga; booking: Booking }> {
+    const result = await bookingService.queueForRoom(request, () => runInTransactionWithRetry(async ({ client }) => {
+      const booking = await bookingService.createUnpaidBooking(request);
+      const total = Number(booking.total_amount);
+      const amount = roundMoney(total + paymentMethods.surchargeFor(request.paymentMethod, total));
+
+      const inserted = await client.query(
+        `INSERT INTO booking_sagas (booking_id, amount, payment_method, expires_at)
+         VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(mins => $4))
+         RETURNING *`,
+        [booking.id, amount, request.paymentMethod, sagaConfig.paymentTimeoutMinutes]
+      );
+      const saga = toSaga(inserted.rows[0]);
+      await enqueueOutbox(client, 'payment.requested', { sagaId: saga.id });
+      return { saga, booking };
+    }, { name: 'startBookingSaga' }));
+
+    metrics.increment('sagas.started');
+    logger.info('Booking saga started', { sagaId: result.saga.id, bookingId: result.booking.id, amount: result.saga.amount });
+    return result;
+  }
+
+  async getSaga(sagaId: number): Promise<BookingSaga | null> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query('SELECT * FROM booking_sagas WHERE id = $1', [sagaId]);
+      return result.rows.length > 0 ? toSaga(result.rows[0]) : null;
+    } finally {
+      client.release();
+    }
+  }
+
+  // Handler of payment.requested messages. Records the pending payment under the saga's charge reference and
+  // queues the charge itself, both committing with the relay's transaction before the gateway is called, so the
+  // gateway's webhook always finds the payment. A redelivered message finds the payment already recorded.
+  async requestPayment(payload: { sagaId: number }): Promise<void> {
+    await runInTransaction(async ({ client }) => {
+      const found = await client.query('SELECT * FROM booking_sagas WHERE id = $1 FOR UPDATE', [payload.sagaId]);
+      const saga = found.rows.length > 0 ? toSaga(found.rows[0]) : null;
+      if (!saga || saga.status !== 'awaiting_payment' || saga.payment_id !== null) {
+        return;
+      }
+
+      const booking = await client.query('SELECT total_amount FROM bookings WHERE id = $1', [saga.booking_id]);
+      const surcharge = roundMoney(saga.amount - Number(booking.rows[0].total_amount));
+      const payment = await client.query(
+        `INSERT INTO payments (booking_id, amount, payment_method, status, transaction_id, surcharge_amount)
+         VALUES ($1, $2, $3, 'pending', $4, $5)
+         RETURNING id`,
+        [saga.booking_id, saga.amount, saga.payment_method, chargeReference(saga), surcharge]
+      );
+      await client.query(
+        'UPDATE booking_sagas SET payment_id = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1',
+        [saga.id, payment.rows[0].id]
+      );
+      await enqueueOutbox(client, 'payment.charge', { sagaId: saga.id });
+    });
+  }
+
+  // Handler of payment.charge messages, sent once the payment is committed. The gateway treats a repeated
+  // reference as the same charge, so a redelivered message doesn't charge twice.
+  async chargePayment(payload: { sagaId: number }): Promise<void> {
+    const saga = await this.getSaga(payload.sagaId);
+    if (!saga || saga.status !== 'awaiting_payment' || saga.payment_id === null) {
+      return;
+    }
+
+    await paymentGateway.charge({ reference: chargeReference(saga), amount: saga.amount, paymentMethod: saga.payment_method });
+    logger.info('Booking saga payment requested', { sagaId: saga.id, reference: chargeReference(saga) });
+  }
+
+  // Gives up on sagas whose payment hasn't been confirmed in time; a confirmation arriving later is refunded
+  async expireOverdue(): Promise<number[]> {
+    const client = await getClient();
+    let overdue: number[];
+    try {
+      const result = await client.query(
+        `SELECT id FROM booking_sagas WHERE status = 'awaiting_payment' AND expires_at <= CURRENT_TIMESTAMP ORDER BY id`
+      );
+      overdue = result.rows.map(row => row.id);
+    } finally {
+      client.release();
+    }
+
+    const expired: number[] = [];
+    for (const sagaId of overdue) {
+      try {
+        const compensated = await runInTransactionWithRetry(async ({ client }) => {
+          const found = await client.query(
+            `SELECT * FROM booking_sagas WHERE id = $1 AND status = 'awaiting_payment' FOR UPDATE`, [sagaId]
+          );
+          if (found.rows.length === 0) {
+            return false;
+          }
+          await compensate(toSaga(found.rows[0]), `Payment not confirmed within ${sagaConfig.paymentTimeoutMinutes} minutes`);
+          return true;
+        }, { name: 'expireBookingSaga' });
+        if (compensated) {
+          expired.push(sagaId);
+        }
+      } catch (error) {
+        logger.error('Failed to expire booking saga', {
+          sagaId, error: error instanceof Error ? error.message : String(error)
+        });
+      }
+    }
+    return expired;
+  }
+}
@@ -1,93 +1,851 @@
 import { PoolClient } from 'pg';
+import { randomUUID } from 'crypto';
 import { getClient } from '../config/database';
+import { inTransaction, runInTransaction, runInTransactionWithRetry } from './transactionManager';
 import { logger } from '../utils/logger';
-import { Booking, Guest, Room, Payment, Receipt } from '../types';
+import {
+  Booking, Guest, Room, Payment, Receipt, PriceBreakdown, CancellationReason, CANCELLATION_REASON_CODES,
+  RoomHold, BookingStatus, PriceAdjustment, BOOKING_STATUSES, CancellationRecord, BookingQuote, UpgradeCandidate,
+  RoomPreferences, RoomStatusEvent
+} from '../types';
+import { PricingService, RateAdjustments } from './pricingService';
+import { RatePlanService } from './ratePlanService';
+import { StayRestrictionService } from './stayRestrictionService';
+import { BookingStateService, ROOM_HOLDING_STATUSES } from './bookingStateService';
+import { AuditService } from './auditService';
+import { PromoCodeService, toStayDiscount } from './promoCodeService';
+import { LOYALTY_PAYMENT_METHOD, LoyaltyService } from './loyaltyService';
+import { PaymentPlanService } from './paymentPlanService';
+import { assertNotDisputed } from './disputeService';
+import { RefundService } from './refundService';
+import { assertNotInMaintenance } from './maintenanceService';
+import { markRoomDirty } from './housekeepingService';
+import { adjoiningSearchErrors, findAdjoiningSets } from './adjoiningRoomService';
+import { claimRoom, recordRoomStatus, RoomStatusCause } from './roomStatusHistoryService';
+import { sealContact, toGuest, withGuestContact } from './guestContact';
+import { lockRoomStay, tryLockRoomStay } from './advisoryLocks';
+import { versionedRow } from './optimisticLocks';
+import {
+  BookingStateError, ConflictError, NotFoundError, PreconditionFailedError, RoomOutOfServiceError, ValidationError
+} from '../utils/errors';
+import { addDays, formatDate, isValidDateString, today } from '../utils/date';
+import { bookingConfig } from '../config/booking';
+import { lookupHash } from '../utils/fieldEncryption';
+import { lockingConfig, RoomLockStrategy } from '../config/locking';
+import { paymentMethods } from '../config/paymentMethods';
+import { cancellationPolicies } from '../config/cancellationPolicies';
+import { markStage } from '../utils/stageTiming';
+import { nameError, normalizeName } from '../utils/names';
+import { preferenceParams, roomPreferenceErrors } from '../utils/roomAttributes';
+import { addResponseWarning } from '../utils/responseWarnings';
+import { KeyedQueue } from '../utils/keyedQueue';
+import { metrics } from '../utils/metrics';
+import { degradation } from '../utils/degradation';
+import { degradationConfig } from '../config/degradation';
+import { isTransientError, requiresTransactionRerun } from '../utils/pgErrors';
+import { decodeScopedCursor, keysetPage, parsePageSize } from '../utils/query';
+import { eventBus } from '../events/eventBus';
 
-interface BookingRequest {
+export interface BookingRequest {
   guestName: string;
   guestEmail: string;
   guestPhone: string;
-  roomId: number;
+  // Either a specific room, or a room type to have a free room of that type assigned
+  roomId?: number;
+  roomType?: string;
+  // With roomType: only rooms with these attributes are assigned
+  roomPreferences?: RoomPreferences;
+  checkInDate: string;
+  checkOutDate: string;
+  paymentMethod: string;
+  holdToken?: string;
+  channel?: string;
+  promoCode?: string;
+  // Loyalty points to spend on the stay; the card is charged for the rest
+  redeemPoints?: number;
+  // Pay in this many installments (the first at booking) instead of in full
+  installments?: number;
+}
+
+export interface QuoteRequest {
+  roomId?: number;
+  roomType?: string;
+  roomPreferences?: RoomPreferences;
+  checkInDate: string;
+  checkOutDate: string;
+  promoCode?: string;
+  // Include this method's surcharge in the amount due
+  paymentMethod?: string;
+  // When the room is unavailable, also suggest bookable rooms of pricier types
+  includeUpgrades?: boolean;
+}
+
+// One booking per room, all for the same guest and stay
+export interface AdjoiningBookingRequest {
+  guestName: string;
+  guestEmail: string;
+  guestPhone: string;
+  rooms: number;
+  roomType?: string;
   checkInDate: string;
   checkOutDate: string;
   paymentMethod: string;
+  channel?: string;
+  promoCode?: string;
+}
+
+interface HoldRequest {
+  roomId: number;
+  checkInDate: string;
+  checkOutDate: string;
+  minutes?: number;
+}
+
+interface BookingPatch {
+  checkInDate?: string | null;
+  checkOutDate?: string | null;
+  guestName?: string | null;
+}
+
+const PATCHABLE_FIELDS = ['checkInDate', 'checkOutDate', 'guestName'];
+
+// direct, walk_in, ota:<name> or partner:<api key id>
+const CHANNEL_PATTERN = /^(direct|walk_in|ota:[a-z0-9_-]{1,40}|partner:[A-Za-z0-9_-]{1,40})$/;
+
+const UUID_PATTERN = /^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$/i;
+
+// What the stay's promo code took off, before tax
+function discountTotal(priceBreakdown: PriceBreakdown): number {
+  const discount = priceBreakdown.nights
+    .flatMap(night => night.adjustments)
+    .filter(adjustment => adjustment.reason.startsWith('promo:'))
+    .reduce((sum, adjustment) => sum - adjustment.amount, 0);
+  return Math.round(discount * 100) / 100;
 }
 
+const BOOKING_DETAILS_SELECT = `
+  SELECT 
+    b.*,
+    g.email as guest_email,
+    g.phone as guest_phone,
+    g.pii_key_id as guest_pii_key_id,
+    r.room_number,
+    r.room_type,
+    r.price_per_night,
+    p.transaction_id,
+    p.payment_method,
+    p.status as payment_status,
+    rec.receipt_number,
+    fin.receipt_number as final_receipt_number
+  FROM bookings b
+  JOIN guests g ON b.guest_id = g.id
+  JOIN rooms r ON b.room_id = r.id
+  -- The payment taken at booking; later charges (such as an upgrade) are further rows
+  LEFT JOIN LATERAL (SELECT * FROM payments WHERE booking_id = b.id ORDER BY id LIMIT 1) p ON TRUE
+  LEFT JOIN LATERAL (
+    SELECT * FROM receipts WHERE booking_id = b.id AND kind = 'payment' ORDER BY id LIMIT 1
+  ) rec ON TRUE
+  LEFT JOIN receipts fin ON b.id = fin.booking_id AND fin.kind = 'final'
+`;
+
 interface BookingResponse {
   booking: Booking;
   payment: Payment;
   receipt: Receipt;
 }
 
+export interface BulkPricingOutcome {
+  roomId: number;
+  status: 'updated' | 'skipped' | 'failed';
+  attempts: number;
+  newPrice?: number;
+  error?: string;
+}
+
+const BULK_ITEM_MAX_ATTEMPTS = 3;
+
+// Query-string filters for GET /bookings; all optional
+export interface BookingSearchQuery {
+  guestName?: unknown;
+  roomId?: unknown;
+  from?: unknown;
+  to?: unknown;
+  status?: unknown;
+  paymentStatus?: unknown;
+  sort?: unknown;
+  order?: unknown;
+  limit?: unknown;
+  cursor?: unknown;
+}
+
+const BOOKING_SEARCH_FILTERS = `
+  FROM bookings b
+  JOIN guests g ON g.id = b.guest_id
+  WHERE ($1::text IS NULL OR b.guest_name ILIKE $1)
+    AND ($2::int IS NULL OR b.room_id = $2)
+    AND ($3::date IS NULL OR b.check_out_date > $3)
+    AND ($4::date IS NULL OR b.check_in_date < $4)
+    AND ($5::text IS NULL OR b.status = $5)
+    AND ($6::text IS NULL OR EXISTS (SELECT 1 FROM payments p WHERE p.booking_id = b.id AND p.status = $6))
+`;
+
+// Keyset pagination fragments per sort column and direction, built only from these constants
+const BOOKING_SORT_COLUMNS: Record<string, string> = {
+  created_at: 'b.created_at',
+  check_in_date: 'b.check_in_date',
+  total_amount: 'b.total_amount'
+};
+
+const BOOKING_SEARCH_ORDERS: Record<string, { column: string; keyset: string; orderBy: string }> = {};
+for (const [sort, column] of Object.entries(BOOKING_SORT_COLUMNS)) {
+  BOOKING_SEARCH_ORDERS[`${sort}:asc`] = {
+    column: `${column}::text`, keyset: `(${column}, b.id) > ($7, $8)`, orderBy: `${column} ASC, b.id ASC`
+  };
+  BOOKING_SEARCH_ORDERS[`${sort}:desc`] = {
+    column: `${column}::text`, keyset: `(${column}, b.id) < ($7, $8)`, orderBy: `${column} DESC, b.id DESC`
+  };
+}
+
+const PAYMENT_STATUSES = ['pending', 'completed', 'failed', 'refunded'];
+
+// Shared by every BookingService in the process, so requests reaching different instances still queue together
+const roomQueue = new KeyedQueue({
+  maxWaiting: bookingConfig.bookingQueueMaxWaiting, timeoutMs: bookingConfig.bookingQueueTimeoutMs
+});
+
+const bookingQueueKey = (request: { roomId?: number; roomType?: string }) =>
+  request.roomType !== undefined ? `type:${request.roomType.trim()}` : `room:${request.roomId}`;
+
+// Locking settings changed at runtime through the /settings endpoints. Like the queue they are shared by every
+// BookingService in the process, so bookings made by the saga, the waitlist, workers and the demo follow them too
+const lockSettings = {
+  rowLocking: true,
+  bookingQueue: bookingConfig.bookingQueueEnabled,
+  strategy: lockingConfig.strategy
+};
+
+// Whether bookings reserve rooms with advisory locks instead of the room's row lock, as currently set
+export function usesAdvisoryRoomLocks(): boolean {
+  return lockSettings.rowLocking && lockSettings.strategy === 'advisory';
+}
+
 export class BookingService {
-  private enableRowLocking: boolean = true;
+  private pricingService = new PricingService();
+  private ratePlanService = new RatePlanService();
+  private stayRestrictionService = new StayRestrictionService();
+  private stateService = new BookingStateService();
+  private auditService = new AuditService();
+  private promoCodeService = new PromoCodeService();
+  private loyaltyService = new LoyaltyService();
+  private paymentPlanService = new PaymentPlanService();
+  private refundService = new RefundService();
 
   setRowLocking(enabled: boolean) {
-    this.enableRowLocking = enabled;
+    lockSettings.rowLocking = enabled;
     logger.info(`Row locking ${enabled ? 'enabled' : 'disabled'}`);
   }
 
+  // How rooms are locked while locking is enabled; see ROOM_LOCK_STRATEGY
+  setLockStrategy(strategy: RoomLockStrategy) {
+    lockSettings.strategy = strategy;
+    logger.info('Room lock strategy set', { strategy });
+  }
+
+  setBookingQueue(enabled: boolean) {
+    lockSettings.bookingQueue = enabled;
+    logger.info(`Booking queue ${enabled ? 'enabled' : 'disabled'}`);
+  }
+
+  // With the booking queue on, runs work for the same room key one request at a time. Work already inside a
+  // transaction (a room of an adjoining set) runs straight away: waiting in the queue while holding locks
+  // could deadlock with the request ahead, which would be waiting for those locks.
+  private async inRoomQueue<T>(key: string, work: () => Promise<T>): Promise<T> {
+    if (!lockSettings.bookingQueue || inTransaction()) {
+      return work();
+    }
+
+    const queuedAt = Date.now();
+    return roomQueue.run(key, () => {
+      metrics.observe('booking_queue.wait', Date.now() - queuedAt);
+      return work();
+    });
+  }
+
+  // Runs work that books a room for the request in the room's queue, for callers that book inside a transaction
+  // of their own: the booking joins that transaction, so it would skip the queue otherwise
+  queueForRoom<T>(request: { roomId?: number; roomType?: string }, work: () => Promise<T>): Promise<T> {
+    return this.inRoomQueue(bookingQueueKey(request), work);
+  }
+
+  private get advisoryLocking(): boolean {
+    return usesAdvisoryRoomLocks();
+  }
+
   async createBooking(request: BookingRequest): Promise<BookingResponse> {
-    const client = await getClient();
-    
-    try {
-      await client.query('BEGIN');
+    markStage('service');
+    this.validateBookingRequest(request);
+
+    const { booking, payment, receipt } = await this.placeBooking(request, false);
+    return { booking, payment: payment!, receipt: receipt! };
+  }
+
+  // Books the room but leaves the booking pending and unpaid, for the payment saga to charge outside this
+  // transaction. Points and installments are settled while booking, so they can't be used here.
+  async createUnpaidBooking(request: BookingRequest): Promise<Booking> {
+    markStage('service');
+    this.validateBookingRequest(request);
+    const fields: Record<string, string> = {};
+    if (request.redeemPoints !== undefined) {
+      fields.redeemPoints = 'is not available when paying after booking';
+    }
+    if (request.installments !== undefined) {
+      fields.installments = 'is not available when paying after booking';
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid booking request', fields);
+    }
+
+    return (await this.placeBooking(request, true)).booking;
+  }
+
+  private async placeBooking(
+    request: BookingRequest, deferPayment: boolean
+  ): Promise<{ booking: Booking; payment: Payment | null; receipt: Receipt | null }> {
+    const result = await this.inRoomQueue(bookingQueueKey(request), () => runInTransactionWithRetry(async ({ client, afterCommit }) => {
       logger.info('Transaction started', { bookingRequest: request });
 
       // Step 1: Create or get guest
       const guest = await this.createOrGetGuest(client, {
-        name: request.guestName,
+        name: normalizeName(request.guestName),
         email: request.guestEmail,
         phone: request.guestPhone
       });
 
-      // Step 2: Check room availability with optional locking
-      const room = await this.checkRoomAvailability(client, request.roomId);
+      // Step 2: Check room availability with optional locking (a valid hold already reserves the room,
+      // and with a room type the room is picked here, in the same transaction that books it)
+      const room = request.holdToken
+        ? await this.claimHold(client, request.holdToken, request)
+        : request.roomType !== undefined
+          ? await this.assignRoom(client, request.roomType, request.checkInDate, request.checkOutDate, request.roomPreferences)
+          : await this.checkRoomAvailability(client, request.roomId!, request.checkInDate, request.checkOutDate);
+      await this.stayRestrictionService.assertAllowed(client, room.room_type, request.checkInDate, request.checkOutDate);
       
-      // Step 3: Calculate total amount
-      const checkIn = new Date(request.checkInDate);
-      const checkOut = new Date(request.checkOutDate);
-      const nights = Math.ceil((checkOut.getTime() - checkIn.getTime()) / (1000 * 60 * 60 * 24));
-      const totalAmount = room.price_per_night * nights;
+      // Step 3: Calculate total amount from the nightly breakdown at the room type's rate plan, less any promo
+      // code (which is used up here, so a rolled back booking does not count against the code's limit)
+      const promo = request.promoCode !== undefined
+        ? await this.promoCodeService.redeem(client, request.promoCode, room.room_type)
+        : null;
+      const rates = await this.ratePlanService.adjustmentsFor(
+        client, room.room_type, room.price_per_night, request.checkInDate, request.checkOutDate
+      );
+      const priceBreakdown = this.pricingService.priceStay(
+        room.price_per_night, request.checkInDate, request.checkOutDate, promo ? toStayDiscount(promo) : undefined, rates
+      );
+      const totalAmount = priceBreakdown.total;
+      const redemption = request.redeemPoints !== undefined
+        ? this.loyaltyService.redemptionValue(request.redeemPoints, totalAmount)
+        : null;
+      const chargeAmount = Math.round((totalAmount - (redemption?.amount ?? 0)) * 100) / 100;
+      if (request.installments !== undefined && chargeAmount <= 0) {
+        throw new ValidationError('Invalid booking request', { installments: 'nothing is left to pay in installments' });
+      }
+      const schedule = request.installments !== undefined
+        ? this.paymentPlanService.schedule(chargeAmount, request.installments, request.checkInDate)
+        : null;
+      const chargeNow = schedule ? schedule[0].amount : chargeAmount;
+
+      const paymentMethodError = chargeNow > 0 ? paymentMethods.validate(request.paymentMethod, chargeNow) : null;
+      if (paymentMethodError) {
+        throw new ValidationError('Invalid booking request', { paymentMethod: paymentMethodError });
+      }
 
       // Step 4: Create booking
       const booking = await this.createBookingRecord(client, {
         guestId: guest.id,
-        roomId: request.roomId,
+        guestName: normalizeName(request.guestName),
+        roomId: room.id,
         checkInDate: request.checkInDate,
         checkOutDate: request.checkOutDate,
-        totalAmount
+        totalAmount,
+        priceBreakdown,
+        channel: request.channel ?? 'direct',
+        promoCodeId: promo?.id ?? null
       });
 
-      // Step 5: Update room availability
-      await this.updateRoomAvailability(client, request.roomId, false);
+      // Step 5: Update room availability (a held room is already taken, by the hold being converted here)
+      const bookedCause = { bookingId: booking.id, startDate: request.checkInDate, endDate: request.checkOutDate };
+      if (request.holdToken) {
+        await this.updateRoomAvailability(client, room.id, false, 'booked', bookedCause);
+        await client.query(
+          `UPDATE room_holds SET status = 'converted', booking_id = $1 WHERE token = $2`,
+          [booking.id, request.holdToken]
+        );
+      } else {
+        await this.claimRoom(client, room.id, 'booked', bookedCause);
+      }
 
-      // Step 6: Process payment
-      const payment = await this.processPayment(client, {
-        bookingId: booking.id,
-        amount: totalAmount,
-        paymentMethod: request.paymentMethod
-      });
+      // Step 6: Process payment (unless the payment saga charges it later); with loyalty points the card only
+      // pays what the points don't cover, and with a payment plan only the first installment is charged now
+      let payment: Payment | null = null;
+      let receipt: Receipt | null = null;
+      if (!deferPayment) {
+        const cardPayment = chargeNow > 0 || !redemption
+          ? await this.processPayment(client, {
+            bookingId: booking.id,
+            amount: chargeNow,
+            paymentMethod: request.paymentMethod
+          })
+          : null;
+        const pointsPayment = redemption
+          ? await this.loyaltyService.redeem(client, guest.id, booking.id, redemption)
+          : null;
+        payment = (cardPayment ?? pointsPayment)!;
+        if (schedule) {
+          await this.paymentPlanService.createPlan(client, booking.id, schedule, cardPayment!.id);
+        }
 
-      // Step 7: Generate receipt
-      const receipt = await this.generateReceipt(client, booking.id, payment.id, totalAmount);
+        // Step 7: Generate receipt for what was paid now, with the card's surcharge on top; each later
+        // installment gets its own
+        receipt = await this.generateReceipt(
+          client, booking.id, payment, schedule ? Math.round((chargeNow + (redemption?.amount ?? 0)) * 100) / 100 : totalAmount,
+          Number(cardPayment?.surcharge_amount ?? 0)
+        );
+      }
 
       // Step 8: Update booking statistics (NEW - potential deadlock scenario)
-      await this.updateBookingStatistics(client, request.roomId, guest.id);
+      await this.updateBookingStatistics(client, room.id, guest.id);
 
-      await client.query('COMMIT');
-      logger.info('Transaction committed successfully', { bookingId: booking.id });
+      await this.auditService.recordBookingChange(client, 'created', null, booking);
 
+      afterCommit(() => {
+        eventBus.publish('booking.created', { bookingId: booking.id, roomId: room.id, guestId: guest.id });
+        if (receipt) {
+          eventBus.publish('receipt.issued', { receiptId: receipt.id, bookingId: booking.id });
+        }
+      });
       return { booking, payment, receipt };
+    }, { name: 'createBooking' }));
 
-    } catch (error) {
-      await client.query('ROLLBACK');
-      if (error instanceof Error) {
-        logger.error('Transaction rolled back', { error: error.message });
-      } else {
-        logger.error('Transaction rolled back', { error: String(error) });
+    logger.info('Transaction committed successfully', { bookingId: result.booking.id });
+    return result;
+  }
+
+  validateBookingRequest(request: BookingRequest): void {
+    const fields: Record<string, string> = {};
+
+    for (const key of ['guestEmail', 'guestPhone', 'paymentMethod'] as const) {
+      if (typeof request[key] !== 'string' || request[key].trim() === '') {
+        fields[key] = 'is required';
+      }
+    }
+
+    const guestNameError = nameError(request.guestName);
+    if (guestNameError) {
+      fields.guestName = guestNameError;
+    }
+
+    if (!fields.paymentMethod) {
+      const paymentMethodError = paymentMethods.validate(request.paymentMethod);
+      if (paymentMethodError) {
+        fields.paymentMethod = paymentMethodError;
+      }
+    }
+
+    if (request.roomType !== undefined) {
+      if (request.roomId !== undefined) {
+        fields.roomType = 'cannot be combined with roomId';
+      } else if (typeof request.roomType !== 'string' || request.roomType.trim() === '') {
+        fields.roomType = 'must be a room type';
+      } else if (request.holdToken !== undefined) {
+        fields.holdToken = 'holds are for a specific room; pass roomId instead of roomType';
       }
-      throw error;
+    } else if (!Number.isInteger(request.roomId) || request.roomId! <= 0) {
+      fields.roomId = 'must be a positive integer';
+    }
+    Object.assign(fields, this.validateRoomPreferences(request.roomType, request.roomPreferences));
+
+    if (request.holdToken !== undefined &&
+      (typeof request.holdToken !== 'string' || !UUID_PATTERN.test(request.holdToken))) {
+      fields.holdToken = 'must be a hold token returned by POST /bookings/holds';
+    }
+
+    if (request.channel !== undefined &&
+      (typeof request.channel !== 'string' || !CHANNEL_PATTERN.test(request.channel))) {
+      fields.channel = 'must be direct, walk_in, ota:<name> or partner:<key id>';
+    }
+
+    if (request.promoCode !== undefined && (typeof request.promoCode !== 'string' || request.promoCode.trim() === '')) {
+      fields.promoCode = 'must be a promo code';
+    }
+
+    if (request.redeemPoints !== undefined && (!Number.isInteger(request.redeemPoints) || request.redeemPoints <= 0)) {
+      fields.redeemPoints = 'must be a positive integer';
+    }
+
+    if (request.installments !== undefined && (!Number.isInteger(request.installments) ||
+      request.installments < 2 || request.installments > bookingConfig.maxInstallments)) {
+      fields.installments = `must be an integer from 2 to ${bookingConfig.maxInstallments}`;
+    }
+
+    if (!isValidDateString(request.checkInDate)) {
+      fields.checkInDate = 'must be a date in YYYY-MM-DD format';
+    }
+    if (!isValidDateString(request.checkOutDate)) {
+      fields.checkOutDate = 'must be a date in YYYY-MM-DD format';
+    }
+    if (!fields.checkInDate && !fields.checkOutDate) {
+      Object.assign(fields, this.validateStayDates(request.checkInDate, request.checkOutDate));
+    }
+
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid booking request', fields);
+    }
+  }
+
+  // Preferences pick among the rooms of a type, so they make no sense for a specific room
+  private validateRoomPreferences(roomType: unknown, preferences: unknown): Record<string, string> {
+    if (preferences === undefined) {
+      return {};
+    }
+    if (roomType === undefined) {
+      return { roomPreferences: 'only applies with roomType' };
+    }
+    return roomPreferenceErrors(preferences);
+  }
+
+  // Rejects inverted ranges and stays ending beyond the configured booking horizon
+  private validateStayDates(checkInDate: string, checkOutDate: string): Record<string, string> {
+    if (checkOutDate <= checkInDate) {
+      return { checkOutDate: 'must be after checkInDate' };
+    }
+
+    const horizon = addDays(today(), bookingConfig.horizonDays);
+    if (checkOutDate > horizon) {
+      return { checkOutDate: `must not be later than ${horizon} (${bookingConfig.horizonDays} days ahead)` };
+    }
+
+    return {};
+  }
+
+  // Books a set of adjoining rooms as one unit: each room's booking runs in a savepoint of the same transaction,
+  // so if any of them fails (say another guest took a room after the set was picked) none are kept
+  async createAdjoiningBookings(request: AdjoiningBookingRequest): Promise<{ groupId: string; bookings: BookingResponse[] }> {
+    markStage('service');
+    const fields = adjoiningSearchErrors(request);
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid booking request', fields);
+    }
+
+    const groupId = randomUUID();
+    const bookings = await runInTransactionWithRetry(async ({ client }) => {
+      const [set] = await findAdjoiningSets(client, request);
+      if (!set) {
+        throw new ConflictError(`No ${request.rooms} adjoining rooms are free for these dates`);
+      }
+
+      const results: BookingResponse[] = [];
+      for (const roomId of set.roomIds) {
+        results.push(await this.createBooking({
+          guestName: request.guestName,
+          guestEmail: request.guestEmail,
+          guestPhone: request.guestPhone,
+          roomId,
+          checkInDate: request.checkInDate,
+          checkOutDate: request.checkOutDate,
+          paymentMethod: request.paymentMethod,
+          channel: request.channel,
+          promoCode: request.promoCode
+        }));
+      }
+      // Booked in this transaction, so nobody else has seen them yet: no version to check
+      const grouped = await client.query(
+        'UPDATE bookings SET group_id = $1, version = version + 1 WHERE id = ANY($2) RETURNING *',
+        [groupId, results.map(result => result.booking.id)]
+      );
+      return results.map(result => ({
+        ...result, booking: grouped.rows.find(row => row.id === result.booking.id) as Booking
+      }));
+    }, { name: 'createAdjoiningBookings' });
+
+    logger.info('Adjoining rooms booked', { groupId, bookingIds: bookings.map(result => result.booking.id) });
+    return { groupId, bookings };
+  }
+
+  // Prices a stay the way createBooking would, without locking or reserving anything. With a room type the
+  // quote is for the room assignment would pick now (or any room of the type if none is free).
+  async quoteStay(request: QuoteRequest): Promise<BookingQuote> {
+    const fields: Record<string, string> = {};
+    if (request.roomType !== undefined) {
+      if (request.roomId !== undefined) {
+        fields.roomType = 'cannot be combined with roomId';
+      } else if (typeof request.roomType !== 'string' || request.roomType.trim() === '') {
+        fields.roomType = 'must be a room type';
+      }
+    } else if (!Number.isInteger(request.roomId) || request.roomId! <= 0) {
+      fields.roomId = 'must be a positive integer';
+    }
+    Object.assign(fields, this.validateRoomPreferences(request.roomType, request.roomPreferences));
+    if (request.promoCode !== undefined && (typeof request.promoCode !== 'string' || request.promoCode.trim() === '')) {
+      fields.promoCode = 'must be a promo code';
+    }
+    if (request.paymentMethod !== undefined) {
+      const paymentMethodError = paymentMethods.validate(request.paymentMethod);
+      if (paymentMethodError) {
+        fields.paymentMethod = paymentMethodError;
+      }
+    }
+    if (!isValidDateString(request.checkInDate)) {
+      fields.checkInDate = 'must be a date in YYYY-MM-DD format';
+    }
+    if (!isValidDateString(request.checkOutDate)) {
+      fields.checkOutDate = 'must be a date in YYYY-MM-DD format';
+    }
+    if (!fields.checkInDate && !fields.checkOutDate) {
+      Object.assign(fields, this.validateStayDates(request.checkInDate, request.checkOutDate));
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid quote request', fields);
+    }
+
+    // One snapshot for the room, its rates and any upgrade candidates, so they agree with each other
+    const { room, promo, rates, upgrades, violations } = await runInTransaction(async ({ client }) => {
+      // A room in maintenance during the stay counts as unavailable
+      const result = request.roomType !== undefined
+        ? await client.query(
+          `SELECT * FROM (
+             SELECT r.*, EXISTS (SELECT 1 FROM room_maintenance_blocks m
+                                 WHERE m.room_id = r.id AND m.status = 'active'
+                                   AND m.start_date < $3 AND m.end_date > $2) AS in_maintenance
+             FROM rooms r
+             WHERE r.room_type = $1 AND NOT r.is_sandbox
+               AND ($4::int IS NULL OR r.floor = $4) AND ($5::varchar IS NULL OR r.view_type = $5)
+               AND ($6::boolean IS NULL OR r.smoking_allowed = $6) AND ($7::boolean IS NULL OR r.accessible = $7)
+           ) candidates
+           ORDER BY (is_available AND NOT in_maintenance) DESC, room_number LIMIT 1`,
+          [request.roomType.trim(), request.checkInDate, request.checkOutDate, ...preferenceParams(request.roomPreferences)]
+        )
+        : await client.query(
+          `SELECT r.*, EXISTS (SELECT 1 FROM room_maintenance_blocks m
+                               WHERE m.room_id = r.id AND m.status = 'active'
+                                 AND m.start_date < $3 AND m.end_date > $2) AS in_maintenance
+           FROM rooms r WHERE r.id = $1`,
+          [request.roomId, request.checkInDate, request.checkOutDate]
+        );
+      const room: (Room & { in_maintenance: boolean }) | undefined = result.rows[0];
+      if (!room) {
+        return { room, promo: null, rates: undefined, upgrades: [], violations: [] };
+      }
+
+      const promo = request.promoCode !== undefined
+        ? await this.promoCodeService.check(client, request.promoCode, room.room_type)
+        : null;
+      const rates = await this.ratePlanService.adjustmentsFor(
+        client, room.room_type, room.price_per_night, request.checkInDate, request.checkOutDate
+      );
+      const upgrades = request.includeUpgrades === true && !(room.is_available && !room.in_maintenance)
+        ? await this.findUpgrades(client, room, request.checkInDate, request.checkOutDate, request.roomPreferences)
+        : [];
+      const violations = await this.stayRestrictionService.violationsFor(
+        client, room.room_type, request.checkInDate, request.checkOutDate
+      );
+      return { room, promo, rates, upgrades, violations };
+    }, { name: 'quoteStay', isolationLevel: 'REPEATABLE READ', readOnly: true });
+
+    if (!room) {
+      if (request.roomType === undefined) {
+        throw new NotFoundError('Room not found');
+      }
+      throw new ValidationError('Invalid quote request', request.roomPreferences !== undefined
+        ? { roomPreferences: 'no rooms of this type have these attributes' }
+        : { roomType: 'no rooms of this type exist' });
+    }
+
+    const priceBreakdown = this.pricingService.priceStay(
+      room.price_per_night, request.checkInDate, request.checkOutDate, promo ? toStayDiscount(promo) : undefined, rates
+    );
+    const policy = cancellationPolicies.forRoomType(room.room_type);
+    const surcharge = request.paymentMethod !== undefined
+      ? paymentMethods.surchargeFor(request.paymentMethod, priceBreakdown.total)
+      : 0;
+
+    const available = room.is_available && !room.in_maintenance;
+    return {
+      roomId: room.id,
+      roomNumber: room.room_number,
+      roomType: room.room_type,
+      available,
+      checkInDate: request.checkInDate,
+      checkOutDate: request.checkOutDate,
+      priceBreakdown,
+      total: priceBreakdown.total,
+      taxes: priceBreakdown.taxes,
+      surcharge,
+      amountDue: Math.round((priceBreakdown.total + surcharge) * 100) / 100,
+      cancellation: {
+        policyCode: policy.code,
+        displayName: policy.displayName,
+        freeUntil: policy.freeUntilDays === null ? null : addDays(request.checkInDate, -policy.freeUntilDays),
+        lateFeePercent: policy.lateFeePercent,
+        // Any day after freeUntil (or once the stay has started) charges the late fee
+        lateFeeAmount: cancellationPolicies.feeFor(policy, priceBreakdown.total, -1)
+      },
+      restrictionViolations: violations,
+      ...(request.includeUpgrades === true && !available ? {
+        upgrades: upgrades.map(upgrade => ({
+          ...upgrade,
+          priceDifference: Math.round((upgrade.total - priceBreakdown.total) * 100) / 100
+        }))
+      } : {})
+    };
+  }
+
+  // One bookable room of each pricier room type for the stay, cheapest type first, priced with that type's
+  // rate plan (promo codes are not carried over to an upgrade). The guest's room preferences still apply.
+  private async findUpgrades(
+    client: PoolClient, room: Room, checkInDate: string, checkOutDate: string, preferences?: RoomPreferences
+  ): Promise<Omit<UpgradeCandidate, 'priceDifference'>[]> {
+    const result = await client.query(
+      `SELECT DISTINCT ON (r.room_type) r.*
+       FROM rooms r
+       WHERE r.room_type <> $1 AND r.price_per_night > $2 AND r.is_available AND r.retired_at IS NULL AND NOT r.is_sandbox
+         AND ($5::int IS NULL OR r.floor = $5) AND ($6::varchar IS NULL OR r.view_type = $6)
+         AND ($7::boolean IS NULL OR r.smoking_allowed = $7) AND ($8::boolean IS NULL OR r.accessible = $8)
+         AND NOT EXISTS (SELECT 1 FROM room_maintenance_blocks m
+                         WHERE m.room_id = r.id AND m.status = 'active' AND m.start_date < $4 AND m.end_date > $3)
+       ORDER BY r.room_type, r.price_per_night, r.room_number`,
+      [room.room_type, room.price_per_night, checkInDate, checkOutDate, ...preferenceParams(preferences)]
+    );
+
+    const upgrades: Omit<UpgradeCandidate, 'priceDifference'>[] = [];
+    for (const candidate of result.rows as Room[]) {
+      const rates = await this.ratePlanService.adjustmentsFor(
+        client, candidate.room_type, candidate.price_per_night, checkInDate, checkOutDate
+      );
+      const price = this.pricingService.priceStay(candidate.price_per_night, checkInDate, checkOutDate, undefined, rates);
+      upgrades.push({
+        roomId: candidate.id,
+        roomNumber: candidate.room_number,
+        roomType: candidate.room_type,
+        pricePerNight: Number(candidate.price_per_night),
+        total: price.total
+      });
+    }
+    return upgrades.sort((a, b) => a.total - b.total || a.roomType.localeCompare(b.roomType));
+  }
+
+  // Reserves a room for a few minutes so the client can pay; the hold token is later passed to createBooking
+  async createHold(request: HoldRequest): Promise<RoomHold> {
+    markStage('service');
+    const minutes = request.minutes ?? bookingConfig.holdMinutes;
+    const fields: Record<string, string> = {};
+
+    if (!Number.isInteger(request.roomId) || request.roomId <= 0) {
+      fields.roomId = 'must be a positive integer';
+    }
+    if (!isValidDateString(request.checkInDate)) {
+      fields.checkInDate = 'must be a date in YYYY-MM-DD format';
+    }
+    if (!isValidDateString(request.checkOutDate)) {
+      fields.checkOutDate = 'must be a date in YYYY-MM-DD format';
+    }
+    if (!fields.checkInDate && !fields.checkOutDate) {
+      Object.assign(fields, this.validateStayDates(request.checkInDate, request.checkOutDate));
+    }
+    if (!Number.isInteger(minutes) || minutes <= 0 || minutes > bookingConfig.maxHoldMinutes) {
+      fields.minutes = `must be between 1 and ${bookingConfig.maxHoldMinutes}`;
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid hold request', fields);
+    }
+
+    const hold = await this.inRoomQueue(bookingQueueKey(request), () => runInTransactionWithRetry(async ({ client, afterCommit }) => {
+      const room = await this.checkRoomAvailability(client, request.roomId, request.checkInDate, request.checkOutDate);
+      await this.stayRestrictionService.assertAllowed(client, room.room_type, request.checkInDate, request.checkOutDate);
+
+      const result = await client.query(
+        `INSERT INTO room_holds (token, room_id, check_in_date, check_out_date, status, expires_at)
+         VALUES ($1, $2, $3, $4, 'active', CURRENT_TIMESTAMP + make_interval(mins => $5))
+         RETURNING *`,
+        [randomUUID(), request.roomId, request.checkInDate, request.checkOutDate, minutes]
+      );
+
+      await this.claimRoom(client, request.roomId, 'held', {
+        holdId: result.rows[0].id, startDate: request.checkInDate, endDate: request.checkOutDate
+      });
+      afterCommit(() => {
+        eventBus.publish('hold.created', { holdId: result.rows[0].id, roomId: request.roomId });
+      });
+      return result.rows[0];
+    }, { name: 'createHold' }));
+
+    logger.info('Room hold created', { holdId: hold.id, roomId: hold.room_id, expiresAt: hold.expires_at });
+    return hold;
+  }
+
+  private async claimHold(client: PoolClient, token: string, request: BookingRequest): Promise<Room> {
+    const holdResult = await client.query(
+      'SELECT *, expires_at <= CURRENT_TIMESTAMP AS expired FROM room_holds WHERE token = $1 FOR UPDATE',
+      [token]
+    );
+
+    const hold: (RoomHold & { expired: boolean }) | undefined = holdResult.rows[0];
+    if (!hold || hold.status !== 'active' || hold.expired) {
+      throw new Error('Hold is invalid or has expired');
+    }
+    if (hold.room_id !== request.roomId ||
+      formatDate(hold.check_in_date) !== request.checkInDate ||
+      formatDate(hold.check_out_date) !== request.checkOutDate) {
+      throw new Error('Booking does not match the held room and dates');
+    }
+
+    const roomResult = await client.query('SELECT * FROM rooms WHERE id = $1 FOR UPDATE', [hold.room_id]);
+    return roomResult.rows[0];
+  }
+
+  // Frees the rooms of holds that expired without being converted into a booking
+  async releaseExpiredHolds(): Promise<number> {
+    const released = await runInTransaction(async ({ client }) => {
+      const result = await client.query(`
+        UPDATE room_holds SET status = 'released'
+        WHERE id IN (
+          SELECT id FROM room_holds
+          WHERE status = 'active' AND expires_at <= CURRENT_TIMESTAMP
+          ORDER BY room_id
+          FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, room_id, check_in_date, check_out_date
+      `);
+
+      for (const row of result.rows) {
+        await this.updateRoomAvailability(client, row.room_id, true, 'hold_released', {
+          holdId: row.id, startDate: row.check_in_date, endDate: row.check_out_date
+        });
+      }
+      return result.rows.length;
+    }, { name: 'releaseExpiredHolds' });
+
+    if (released > 0) {
+      logger.info('Expired room holds released', { released });
+      eventBus.publish('hold.released', { count: released });
+    }
+    return released;
+  }
+
+  // Pending bookings older than the TTL without a completed payment (the charge failed or never settled),
+  // oldest first, with how many of their nights haven't passed yet
+  async findUnpaidPendingBookings(ttlHours: number): Promise<{ id: number; nights: number }[]> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query(
+        `SELECT b.id, GREATEST(b.check_out_date - GREATEST(b.check_in_date, CURRENT_DATE), 0) AS nights
+         FROM bookings b
+         WHERE b.status = 'pending' AND b.created_at <= CURRENT_TIMESTAMP - make_interval(hours => $1)
+           AND NOT EXISTS (SELECT 1 FROM payments p WHERE p.booking_id = b.id AND p.status = 'completed')
+         ORDER BY b.created_at, b.id`,
+        [ttlHours]
+      );
+      return result.rows;
     } finally {
       client.release();
     }
@@ -95,29 +853,36 @@ export class BookingService {
 
   private async createOrGetGuest(client: PoolClient, guestData: Partial<Guest>): Promise<Guest> {
     // Check if guest exists
+    // By the email's lookup hash, or the email itself for a guest not encrypted yet
     const existingGuest = await client.query(
-      'SELECT * FROM guests WHERE email = $1',
-      [guestData.email]
+      'SELECT * FROM guests WHERE email_lookup = $1 OR (pii_key_id IS NULL AND email = $2)',
+      [lookupHash(guestData.email!), guestData.email]
     );
 
     if (existingGuest.rows.length > 0) {
-      return existingGuest.rows[0];
+      return toGuest(existingGuest.rows[0]);
     }
 
     // Create new guest
+    const contact = sealContact(guestData.email!, guestData.phone!);
     const result = await client.query(
-      `INSERT INTO guests (name, email, phone) 
-       VALUES ($1, $2, $3) 
+      `INSERT INTO guests (name, email, phone, email_lookup, pii_key_id) 
+       VALUES ($1, $2, $3, $4, $5) 
        RETURNING *`,
-      [guestData.name, guestData.email, guestData.phone]
+      [guestData.name, contact.email, contact.phone, contact.emailLookup, contact.keyId]
     );
 
     logger.info('New guest created', { guestId: result.rows[0].id });
-    return result.rows[0];
+    return toGuest(result.rows[0]);
   }
 
-  private async checkRoomAvailability(client: PoolClient, roomId: number): Promise<Room> {
-    const lockClause = this.enableRowLocking ? 'FOR UPDATE' : '';
+  private async checkRoomAvailability(
+    client: PoolClient, roomId: number, checkInDate: string, checkOutDate: string
+  ): Promise<Room> {
+    if (this.advisoryLocking) {
+      await lockRoomStay(client, roomId, checkInDate, checkOutDate);
+    }
+    const lockClause = lockSettings.rowLocking && !this.advisoryLocking ? 'FOR UPDATE' : '';
     
     const result = await client.query(
       `SELECT * FROM rooms WHERE id = $1 ${lockClause}`,
@@ -129,44 +894,123 @@ export class BookingService {
     }
 
     const room = result.rows[0];
+    if (room.retired_at !== null) {
+      throw new RoomOutOfServiceError('Room has been retired');
+    }
     if (!room.is_available) {
-      throw new Error('Room is not available');
+      throw new ConflictError('Room is not available');
     }
+    await assertNotInMaintenance(client, roomId, checkInDate, checkOutDate);
 
     logger.info('Room availability checked', { 
       roomId, 
       available: room.is_available,
-      lockingEnabled: this.enableRowLocking 
+      lockingEnabled: lockSettings.rowLocking,
+      lockStrategy: lockSettings.strategy
     });
 
     return room;
   }
 
+  // Picks the free room of the type with the lowest number, passing over rooms in maintenance during the stay
+  // and rooms without the requested attributes. Rows another transaction is already booking (or blocking) are
+  // skipped rather than waited for, so concurrent requests for the same type end up in different rooms. With
+  // advisory locks, a room whose stay buckets are taken is skipped the same way.
+  private async assignRoom(
+    client: PoolClient, roomType: string, checkInDate: string, checkOutDate: string, preferences?: RoomPreferences
+  ): Promise<Room> {
+    // Advisory locking tries every candidate in turn, so only then are they all fetched
+    const lockClause = this.advisoryLocking ? '' : lockSettings.rowLocking ? 'LIMIT 1 FOR UPDATE SKIP LOCKED' : 'LIMIT 1';
+
+    const candidates = await client.query(
+      `SELECT * FROM rooms
+       WHERE room_type = $1 AND is_available AND retired_at IS NULL AND NOT is_sandbox
+         AND ($4::int IS NULL OR floor = $4) AND ($5::varchar IS NULL OR view_type = $5)
+         AND ($6::boolean IS NULL OR smoking_allowed = $6) AND ($7::boolean IS NULL OR accessible = $7)
+         AND NOT EXISTS (SELECT 1 FROM room_maintenance_blocks m
+                         WHERE m.room_id = rooms.id AND m.status = 'active' AND m.start_date < $3 AND m.end_date > $2)
+       ORDER BY room_number ${lockClause}`,
+      [roomType.trim(), checkInDate, checkOutDate, ...preferenceParams(preferences)]
+    );
+    const result = this.advisoryLocking
+      ? { rows: await this.firstLockableRoom(client, candidates.rows, checkInDate, checkOutDate) }
+      : candidates;
+
+    if (result.rows.length === 0) {
+      const known = await client.query('SELECT 1 FROM rooms WHERE room_type = $1 AND retired_at IS NULL AND NOT is_sandbox LIMIT 1', [roomType.trim()]);
+      if (known.rows.length === 0) {
+        throw new ValidationError('Invalid booking request', { roomType: 'no rooms of this type exist' });
+      }
+      throw new ConflictError(preferences !== undefined
+        ? 'No room of this type with the requested attributes is available'
+        : 'No room of this type is available');
+    }
+
+    logger.info('Room assigned', {
+      roomType, roomId: result.rows[0].id, preferences, lockingEnabled: lockSettings.rowLocking, lockStrategy: lockSettings.strategy
+    });
+    return result.rows[0];
+  }
+
+  // The first candidate whose stay buckets could be locked and that is still free once they are; a booking that
+  // committed between the candidate query and the lock is only visible to the re-read
+  private async firstLockableRoom(
+    client: PoolClient, candidates: Room[], checkInDate: string, checkOutDate: string
+  ): Promise<Room[]> {
+    for (const candidate of candidates) {
+      if (!await tryLockRoomStay(client, candidate.id, checkInDate, checkOutDate)) {
+        continue;
+      }
+      const room = await client.query('SELECT * FROM rooms WHERE id = $1 AND is_available AND retired_at IS NULL', [candidate.id]);
+      if (room.rows.length > 0) {
+        return room.rows;
+      }
+    }
+    return [];
+  }
+
   private async createBookingRecord(client: PoolClient, data: {
     guestId: number;
+    guestName: string;
     roomId: number;
     checkInDate: string;
     checkOutDate: string;
     totalAmount: number;
+    priceBreakdown: PriceBreakdown;
+    channel: string;
+    promoCodeId: number | null;
   }): Promise<Booking> {
     const result = await client.query(
-      `INSERT INTO bookings (guest_id, room_id, check_in_date, check_out_date, total_amount, status) 
-       VALUES ($1, $2, $3, $4, $5, 'pending') 
+      `INSERT INTO bookings (guest_id, guest_name, room_id, check_in_date, check_out_date, total_amount, price_breakdown,
+         channel, promo_code_id, discount_amount, status) 
+       VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, 'pending') 
        RETURNING *`,
-      [data.guestId, data.roomId, data.checkInDate, data.checkOutDate, data.totalAmount]
+      [data.guestId, data.guestName, data.roomId, data.checkInDate, data.checkOutDate, data.totalAmount,
+        JSON.stringify(data.priceBreakdown), data.channel, data.promoCodeId, discountTotal(data.priceBreakdown)]
     );
 
     logger.info('Booking record created', { bookingId: result.rows[0].id });
     return result.rows[0];
   }
 
-  private async updateRoomAvailability(client: PoolClient, roomId: number, isAvailable: boolean): Promise<void> {
+  private async updateRoomAvailability(
+    client: PoolClient, roomId: number, isAvailable: boolean, event: RoomStatusEvent, cause: RoomStatusCause
+  ): Promise<void> {
     await client.query(
       'UPDATE rooms SET is_available = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2',
       [isAvailable, roomId]
     );
+    await recordRoomStatus(client, roomId, event, cause);
 
-    logger.info('Room availability updated', { roomId, isAvailable });
+    logger.info('Room availability updated', { roomId, isAvailable, event });
+  }
+
+  // Without advisory locks the room's row lock already keeps other bookings out; see claimRoom for the other case
+  private async claimRoom(client: PoolClient, roomId: number, event: RoomStatusEvent, cause: RoomStatusCause): Promise<void> {
+    if (!this.advisoryLocking) {
+      return this.updateRoomAvailability(client, roomId, false, event, cause);
+    }
+    return claimRoom(client, roomId, event, cause);
   }
 
   private async processPayment(client: PoolClient, data: {
@@ -177,27 +1021,38 @@ export class BookingService {
     const transactionId = `TXN_${Date.now()}_${Math.random().toString(36).substr(2, 9)}`;
     
     // Simulate payment processing delay
+    const startedAt = Date.now();
     await new Promise(resolve => setTimeout(resolve, 100));
+    const gatewayMs = Date.now() - startedAt;
+    if (gatewayMs > degradationConfig.slowPaymentMs) {
+      degradation.report('payment_gateway', `last payment took ${gatewayMs}ms`);
+    }
 
+    // The method's surcharge is charged on top of the amount owed
+    const surcharge = paymentMethods.surchargeFor(data.paymentMethod, data.amount);
     const result = await client.query(
-      `INSERT INTO payments (booking_id, amount, payment_method, status, transaction_id) 
-       VALUES ($1, $2, $3, 'completed', $4) 
+      `INSERT INTO payments (booking_id, amount, payment_method, status, transaction_id, surcharge_amount) 
+       VALUES ($1, $2, $3, 'completed', $4, $5) 
        RETURNING *`,
-      [data.bookingId, data.amount, data.paymentMethod, transactionId]
+      [data.bookingId, Math.round((data.amount + surcharge) * 100) / 100, data.paymentMethod, transactionId, surcharge]
     );
 
     logger.info('Payment processed', { paymentId: result.rows[0].id, transactionId });
     return result.rows[0];
   }
 
-  private async generateReceipt(client: PoolClient, bookingId: number, paymentId: number, totalAmount: number): Promise<Receipt> {
+  private async generateReceipt(
+    client: PoolClient, bookingId: number, payment: Payment, totalAmount: number, surcharge: number = 0
+  ): Promise<Receipt> {
     const receiptNumber = `RCP_${Date.now()}_${Math.random().toString(36).substr(2, 6)}`;
     
     const result = await client.query(
-      `INSERT INTO receipts (booking_id, payment_id, receipt_number, total_amount) 
-       VALUES ($1, $2, $3, $4) 
+      `INSERT INTO receipts
+         (booking_id, payment_id, receipt_number, total_amount, surcharge_amount, payment_method, gateway_reference, email_status) 
+       VALUES ($1, $2, $3, $4, $5, $6, $7, 'pending') 
        RETURNING *`,
-      [bookingId, paymentId, receiptNumber, totalAmount]
+      [bookingId, payment.id, receiptNumber, Math.round((totalAmount + surcharge) * 100) / 100, surcharge,
+        payment.payment_method, payment.transaction_id]
     );
 
     logger.info('Receipt generated', { receiptId: result.rows[0].id, receiptNumber });
@@ -207,7 +1062,7 @@ export class BookingService {
   // NEW METHOD: Creates deadlock scenario when row locking is disabled
   private async updateBookingStatistics(client: PoolClient, roomId: number, guestId: number): Promise<void> {
     // First, update guest statistics (increment booking count)
-    const lockClause = this.enableRowLocking ? 'FOR UPDATE' : '';
+    const lockClause = lockSettings.rowLocking ? 'FOR UPDATE' : '';
     
     // Access guest first, then room (order matters for deadlock)
     await client.query(
@@ -226,15 +1081,16 @@ export class BookingService {
       [roomId]
     );
 
-    logger.info('Booking statistics updated', { roomId, guestId, lockingEnabled: this.enableRowLocking });
+    logger.info('Booking statistics updated', { roomId, guestId, lockingEnabled: lockSettings.rowLocking });
   }
 
-  async cancelBooking(bookingId: number): Promise<void> {
-    const client = await getClient();
-    
-    try {
-      await client.query('BEGIN');
-      
+  // Cancels under the room type's cancellation policy and returns the record of what is refundable, with the
+  // refunds started for it; they settle later, as the gateway reports back
+  async cancelBooking(bookingId: number, reason: CancellationReason): Promise<CancellationRecord> {
+    markStage('service');
+    this.validateCancellationReason(reason);
+
+    const record = await runInTransactionWithRetry(async ({ client, afterCommit }) => {
       // Get booking details with potential deadlock scenario
       const bookingResult = await client.query(
         'SELECT * FROM bookings WHERE id = $1',
@@ -242,42 +1098,150 @@ export class BookingService {
       );
 
       if (bookingResult.rows.length === 0) {
-        throw new Error('Booking not found');
+        throw new NotFoundError('Booking not found');
       }
 
       const booking = bookingResult.rows[0];
-      
-      // Update booking status
-      await client.query(
-        'UPDATE bookings SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2',
-        ['cancelled', bookingId]
-      );
+      this.stateService.assertTransition(booking.status, 'cancelled');
+
+      // Update booking status; the version guard catches any change since the read above, a concurrent
+      // transition included
+      const cancelled = versionedRow<Booking>(await client.query(
+        `UPDATE bookings
+         SET status = 'cancelled', cancellation_reason_code = $1, cancellation_reason_text = $2,
+             cancelled_at = CURRENT_TIMESTAMP, version = version + 1, updated_at = CURRENT_TIMESTAMP
+         WHERE id = $3 AND version = $4
+         RETURNING *`,
+        [reason.code, reason.text?.trim() || null, bookingId, booking.version]
+      ), 'booking', bookingId, booking.version);
+      // Checked under the row lock taken by the update, so a dispute opened concurrently is seen
+      await assertNotDisputed(client, bookingId, booking.status);
 
       // Make room available again
-      await this.updateRoomAvailability(client, booking.room_id, true);
+      await this.updateRoomAvailability(client, booking.room_id, true, 'cancelled', {
+        bookingId, startDate: booking.check_in_date, endDate: booking.check_out_date
+      });
 
       // NEW: Revert statistics (potential deadlock scenario)
       await this.revertBookingStatistics(client, booking.room_id, booking.guest_id);
 
-      await client.query('COMMIT');
-      logger.info('Booking cancelled successfully', { bookingId });
+      // Points spent on the stay go back in full; the policy only applies to what was paid in money
+      await this.loyaltyService.restoreRedemption(client, booking);
+      await this.paymentPlanService.cancelOpenInstallments(client, bookingId);
+      const record = await this.createCancellationRecord(client, booking, reason);
+      const refunds = record.refundable_amount > 0
+        ? await this.refundService.refundPayments(client, bookingId, record.refundable_amount)
+        : [];
+      await this.auditService.recordBookingChange(client, 'cancelled', booking, cancelled);
 
-    } catch (error) {
-      await client.query('ROLLBACK');
-      if (error instanceof Error) {
-        logger.error('Failed to cancel booking', { bookingId, error: error.message });
-      } else {
-        logger.error('Failed to cancel booking', { bookingId, error: String(error) });
+      afterCommit(() => {
+        eventBus.publish('booking.cancelled', { bookingId, roomId: booking.room_id, reasonCode: reason.code });
+      });
+      return { ...record, refunds };
+    }, { name: 'cancelBooking' });
+
+    logger.info('Booking cancelled successfully', {
+      bookingId, reason: reason.code, fee: record.fee_amount, refundable: record.refundable_amount
+    });
+    if (record.fee_amount > 0) {
+      addResponseWarning(`A cancellation fee of ${record.fee_amount} applies under the ${record.policy_code} policy`);
+    }
+    for (const refund of record.refunds.filter(refund => refund.status === 'failed')) {
+      addResponseWarning(`The refund of ${refund.amount} could not be started: ${refund.failure_reason}`);
+    }
+    return record;
+  }
+
+  // Applies the room type's policy to what was actually paid; hotel-initiated cancellations are always free
+  private async createCancellationRecord(
+    client: PoolClient, booking: Booking, reason: CancellationReason
+  ): Promise<Omit<CancellationRecord, 'refunds'>> {
+    const stay = await client.query(
+      `SELECT r.room_type,
+              $2::date - CURRENT_DATE AS days_before_check_in,
+              (SELECT COALESCE(SUM(p.amount - p.surcharge_amount), 0) FROM payments p
+                WHERE p.booking_id = $1 AND p.status = 'completed' AND p.payment_method <> $4) AS paid_amount
+       FROM rooms r WHERE r.id = $3`,
+      [booking.id, formatDate(booking.check_in_date), booking.room_id, LOYALTY_PAYMENT_METHOD]
+    );
+
+    const { room_type: roomType, days_before_check_in: daysBeforeCheckIn } = stay.rows[0];
+    const paidAmount = Number(stay.rows[0].paid_amount);
+    const policy = cancellationPolicies.forRoomType(roomType);
+    const waived = reason.code === 'hotel_initiated';
+    const feeAmount = waived ? 0 : cancellationPolicies.feeFor(policy, paidAmount, daysBeforeCheckIn);
+
+    const result = await client.query(
+      `INSERT INTO cancellation_records
+         (booking_id, policy_code, days_before_check_in, paid_amount, fee_amount, refundable_amount, fee_waived)
+       VALUES ($1, $2, $3, $4, $5, $6, $7)
+       RETURNING *`,
+      [booking.id, policy.code, daysBeforeCheckIn, paidAmount, feeAmount,
+        Math.round((paidAmount - feeAmount) * 100) / 100, waived]
+    );
+
+    const row = result.rows[0];
+    return {
+      ...row,
+      paid_amount: Number(row.paid_amount),
+      fee_amount: Number(row.fee_amount),
+      refundable_amount: Number(row.refundable_amount)
+    };
+  }
+
+  // Lifecycle moves other than cancellation (confirm, check in, check out, no-show)
+  async changeStatus(bookingId: number, to: Exclude<BookingStatus, 'pending' | 'cancelled'>) {
+    markStage('service');
+
+    const { from } = await runInTransactionWithRetry(async ({ client, afterCommit }) => {
+      const { from, previous, booking } = await this.stateService.transition(client, bookingId, to);
+      await this.auditService.recordBookingChange(client, 'status_changed', previous, booking);
+
+      // The last guest's room has to be cleaned before the next one moves in; clean or inspected will do
+      if (to === 'checked_in') {
+        const room = await client.query('SELECT housekeeping_status FROM rooms WHERE id = $1 FOR UPDATE', [booking.room_id]);
+        if (room.rows[0].housekeeping_status === 'dirty') {
+          throw new BookingStateError('Room has not been cleaned yet', 'ROOM_NOT_READY', from, to);
+        }
       }
-      throw error;
-    } finally {
-      client.release();
+
+      // Leaving the room (check-out, no-show) makes it bookable again
+      if (!ROOM_HOLDING_STATUSES.includes(to)) {
+        await this.updateRoomAvailability(client, booking.room_id, true, to as 'checked_out' | 'no_show', {
+          bookingId, startDate: booking.check_in_date, endDate: booking.check_out_date
+        });
+      }
+      if (to === 'checked_out') {
+        await markRoomDirty(booking.room_id);
+      }
+
+      afterCommit(() => {
+        eventBus.publish('booking.status_changed', { bookingId, roomId: booking.room_id, from, to });
+      });
+      return { from, booking };
+    }, { name: 'changeBookingStatus' });
+
+    logger.info('Booking status changed', { bookingId, from, to });
+    return this.getBookingDetails(bookingId);
+  }
+
+  private validateCancellationReason(reason: CancellationReason): void {
+    if (!reason || !CANCELLATION_REASON_CODES.includes(reason.code)) {
+      throw new ValidationError('Invalid cancellation', {
+        reasonCode: `must be one of: ${CANCELLATION_REASON_CODES.join(', ')}`
+      });
+    }
+    if (reason.text !== undefined && typeof reason.text !== 'string') {
+      throw new ValidationError('Invalid cancellation', { reasonText: 'must be a string' });
+    }
+    if (reason.code === 'other' && !reason.text?.trim()) {
+      throw new ValidationError('Invalid cancellation', { reasonText: 'is required when reasonCode is other' });
     }
   }
 
   // NEW METHOD: Creates deadlock scenario when row locking is disabled
   private async revertBookingStatistics(client: PoolClient, roomId: number, guestId: number): Promise<void> {
-    const lockClause = this.enableRowLocking ? 'FOR UPDATE' : '';
+    const lockClause = lockSettings.rowLocking ? 'FOR UPDATE' : '';
     
     // Access room first, then guest (opposite order from updateBookingStatistics)
     await client.query(
@@ -296,86 +1260,393 @@ export class BookingService {
       [guestId]
     );
 
-    logger.info('Booking statistics reverted', { roomId, guestId, lockingEnabled: this.enableRowLocking });
+    logger.info('Booking statistics reverted', { roomId, guestId, lockingEnabled: lockSettings.rowLocking });
+  }
+
+  // Applies a JSON Merge Patch: absent fields are left untouched, null removes (not allowed here).
+  // With expectedVersion the patch only applies if nobody changed the booking since that version was read.
+  // Date changes reprice the stay; the returned price_adjustment says what is owed or refunded.
+  async updateBooking(bookingId: number, patch: BookingPatch, expectedVersion?: number) {
+    markStage('service');
+    this.validateBookingPatch(patch);
+
+    const priceAdjustment = await runInTransactionWithRetry(async ({ client, afterCommit }) => {
+      const lockClause = lockSettings.rowLocking ? 'FOR UPDATE' : '';
+      const bookingResult = await client.query(
+        `SELECT * FROM bookings WHERE id = $1 ${lockClause}`,
+        [bookingId]
+      );
+
+      if (bookingResult.rows.length === 0) {
+        throw new NotFoundError('Booking not found');
+      }
+
+      const booking: Booking = bookingResult.rows[0];
+      if (expectedVersion !== undefined && booking.version !== expectedVersion) {
+        throw new PreconditionFailedError('Booking was modified by another request', booking.version);
+      }
+      this.stateService.assertModifiable(booking.status);
+      await assertNotDisputed(client, bookingId, booking.status);
+
+      const checkInDate = patch.checkInDate ?? formatDate(booking.check_in_date);
+      const checkOutDate = patch.checkOutDate ?? formatDate(booking.check_out_date);
+      const dateErrors = this.validateStayDates(checkInDate, checkOutDate);
+      if (Object.keys(dateErrors).length > 0) {
+        throw new ValidationError('Invalid booking patch', dateErrors);
+      }
+
+      let priceAdjustment: PriceAdjustment | null = null;
+      if (patch.checkInDate !== undefined || patch.checkOutDate !== undefined) {
+        const room = await client.query(
+          `SELECT price_per_night, room_type FROM rooms WHERE id = $1 ${lockClause}`,
+          [booking.room_id]
+        );
+        await assertNotInMaintenance(client, booking.room_id, checkInDate, checkOutDate);
+        await this.stayRestrictionService.assertAllowed(client, room.rows[0].room_type, checkInDate, checkOutDate);
+        // A promo code redeemed at booking keeps applying to the new dates; it is not counted again
+        const promo = booking.promo_code_id === null
+          ? null
+          : (await client.query('SELECT * FROM promo_codes WHERE id = $1', [booking.promo_code_id])).rows[0];
+        const rates = await this.ratePlanService.adjustmentsFor(
+          client, room.rows[0].room_type, room.rows[0].price_per_night, checkInDate, checkOutDate, bookingId
+        );
+        const priceBreakdown = this.pricingService.priceStay(
+          room.rows[0].price_per_night, checkInDate, checkOutDate, promo ? toStayDiscount(promo) : undefined, rates
+        );
+
+        await client.query(
+          `UPDATE bookings
+           SET check_in_date = $1, check_out_date = $2, total_amount = $3, price_breakdown = $4,
+               discount_amount = $5, updated_at = CURRENT_TIMESTAMP
+           WHERE id = $6`,
+          [checkInDate, checkOutDate, priceBreakdown.total, JSON.stringify(priceBreakdown),
+            discountTotal(priceBreakdown), bookingId]
+        );
+
+        priceAdjustment = await this.recordPriceAdjustment(client, bookingId, Number(booking.total_amount), priceBreakdown.total);
+      }
+
+      // Only this booking's name changes: the guest's profile and their other bookings are left as they are
+      if (patch.guestName !== undefined) {
+        await client.query('UPDATE bookings SET guest_name = $1 WHERE id = $2', [normalizeName(patch.guestName!), bookingId]);
+      }
+
+      // Compare-and-set, so a concurrent writer that slipped in after the read (without row locking) is caught;
+      // it rolls back the date change above too
+      const versioned = versionedRow<Booking>(await client.query(
+        `UPDATE bookings SET version = version + 1, updated_at = CURRENT_TIMESTAMP
+         WHERE id = $1 AND version = $2
+         RETURNING *`,
+        [bookingId, booking.version]
+      ), 'booking', bookingId, booking.version);
+      await this.auditService.recordBookingChange(client, 'updated', booking, versioned);
+
+      afterCommit(() => {
+        eventBus.publish('booking.updated', { bookingId, fields: Object.keys(patch) });
+      });
+      return priceAdjustment;
+    }, { name: 'updateBooking' });
+
+    logger.info('Booking updated', { bookingId, fields: Object.keys(patch), priceDelta: priceAdjustment?.delta ?? 0 });
+    if (priceAdjustment) {
+      addResponseWarning(priceAdjustment.delta > 0
+        ? `An additional payment of ${priceAdjustment.delta} is owed for the modified stay`
+        : `A refund of ${-priceAdjustment.delta} is due for the modified stay`);
+    }
+    return { ...await this.getBookingDetails(bookingId), price_adjustment: priceAdjustment };
+  }
+
+  // Stores the difference between the old and new booking total; nothing is recorded when the price is unchanged
+  private async recordPriceAdjustment(
+    client: PoolClient, bookingId: number, previousAmount: number, newAmount: number
+  ): Promise<PriceAdjustment | null> {
+    const delta = Math.round((newAmount - previousAmount) * 100) / 100;
+    if (delta === 0) {
+      return null;
+    }
+
+    const result = await client.query(
+      `INSERT INTO price_adjustments (booking_id, previous_amount, new_amount, delta, reason)
+       VALUES ($1, $2, $3, $4, 'stay_modified')
+       RETURNING *`,
+      [bookingId, previousAmount, newAmount, delta]
+    );
+
+    const row = result.rows[0];
+    return {
+      ...row,
+      previous_amount: Number(row.previous_amount),
+      new_amount: Number(row.new_amount),
+      delta: Number(row.delta)
+    };
+  }
+
+  private validateBookingPatch(patch: BookingPatch): void {
+    if (!patch || typeof patch !== 'object' || Array.isArray(patch)) {
+      throw new ValidationError('Patch body must be a JSON object');
+    }
+
+    const fields: Record<string, string> = {};
+
+    for (const key of Object.keys(patch)) {
+      if (!PATCHABLE_FIELDS.includes(key)) {
+        fields[key] = 'field cannot be modified';
+      }
+    }
+
+    for (const key of ['checkInDate', 'checkOutDate'] as const) {
+      const value = patch[key];
+      if (value === null) {
+        fields[key] = 'field cannot be removed';
+      } else if (value !== undefined && !isValidDateString(value)) {
+        fields[key] = 'must be a date in YYYY-MM-DD format';
+      }
+    }
+
+    if (patch.guestName === null) {
+      fields.guestName = 'field cannot be removed';
+    } else if (patch.guestName !== undefined && nameError(patch.guestName)) {
+      fields.guestName = nameError(patch.guestName)!;
+    }
+
+    if (Object.keys(fields).length === 0 && Object.keys(patch).length === 0) {
+      throw new ValidationError('Patch body must contain at least one field');
+    }
+
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid booking patch', fields);
+    }
   }
 
   async getBookingDetails(bookingId: number) {
     const client = await getClient();
     
     try {
-      const result = await client.query(`
-        SELECT 
-          b.*,
-          g.name as guest_name,
-          g.email as guest_email,
-          g.phone as guest_phone,
-          r.room_number,
-          r.room_type,
-          r.price_per_night,
-          p.transaction_id,
-          p.payment_method,
-          p.status as payment_status,
-          rec.receipt_number
-        FROM bookings b
-        JOIN guests g ON b.guest_id = g.id
-        JOIN rooms r ON b.room_id = r.id
-        LEFT JOIN payments p ON b.id = p.booking_id
-        LEFT JOIN receipts rec ON b.id = rec.booking_id
-        WHERE b.id = $1
-      `, [bookingId]);
-
-      return result.rows[0] || null;
+      const result = await client.query(`${BOOKING_DETAILS_SELECT} WHERE b.id = $1`, [bookingId]);
+
+      return result.rows[0] ? withGuestContact(result.rows[0]) : null;
     } finally {
       client.release();
     }
   }
 
-  // NEW METHOD: Bulk operation that can cause deadlocks
-  async bulkUpdateRoomPricing(roomIds: number[], priceAdjustment: number): Promise<void> {
+  // A guest's booking history, most recent stay first
+  async getBookingsForGuest(guestId: number) {
     const client = await getClient();
-    
+
     try {
-      await client.query('BEGIN');
-      
+      const result = await client.query(
+        `${BOOKING_DETAILS_SELECT} WHERE b.guest_id = $1 ORDER BY b.check_in_date DESC, b.id DESC`,
+        [guestId]
+      );
+      return result.rows.map(withGuestContact);
+    } finally {
+      client.release();
+    }
+  }
+
+  // Fetches many bookings in one round-trip; ids with no booking are reported as missing
+  async getBookingsByIds(bookingIds: number[]) {
+    const client = await getClient();
+
+    try {
+      const result = await client.query(
+        `${BOOKING_DETAILS_SELECT} WHERE b.id = ANY($1::int[]) ORDER BY b.id`,
+        [bookingIds]
+      );
+
+      const foundIds = new Set(result.rows.map(row => row.id));
+      return {
+        found: result.rows.map(withGuestContact),
+        missing: bookingIds.filter(id => !foundIds.has(id))
+      };
+    } finally {
+      client.release();
+    }
+  }
+
+  // Filtered, sorted booking list with keyset pagination; nextCursor is null on the last page
+  async searchBookings(query: BookingSearchQuery) {
+    const search = this.parseBookingSearch(query);
+    const order = BOOKING_SEARCH_ORDERS[`${search.sort}:${search.order}`];
+
+    return runInTransaction(async ({ client }) => {
+      const page = await client.query(`
+        SELECT b.id, ${order.column} AS cursor_value
+        ${BOOKING_SEARCH_FILTERS}
+          AND ($9::boolean IS FALSE OR ${order.keyset})
+        ORDER BY ${order.orderBy}
+        LIMIT $10
+      `, [
+        search.guestName, search.roomId, search.from, search.to, search.status, search.paymentStatus,
+        search.cursor?.value ?? null, search.cursor?.id ?? null, search.cursor !== null, search.limit + 1
+      ]);
+
+      const { items: rows, nextCursor } = keysetPage(
+        page.rows, search.limit, row => ['bookings', search.sort, search.order, row.cursor_value, row.id]
+      );
+      const details = await client.query(`${BOOKING_DETAILS_SELECT} WHERE b.id = ANY($1::int[])`, [rows.map(row => row.id)]);
+      const byId = new Map(details.rows.map(row => [row.id, withGuestContact(row)]));
+
+      return {
+        bookings: rows.map(row => byId.get(row.id)),
+        nextCursor
+      };
+    }, { name: 'searchBookings', isolationLevel: 'REPEATABLE READ', readOnly: true });
+  }
+
+  private parseBookingSearch(query: BookingSearchQuery) {
+    const fields: Record<string, string> = {};
+    const optionalString = (key: keyof BookingSearchQuery): string | null => {
+      const value = query[key];
+      if (value === undefined) {
+        return null;
+      }
+      if (typeof value !== 'string' || value.trim() === '') {
+        fields[key] = 'must be a non-empty string';
+        return null;
+      }
+      return value.trim();
+    };
+
+    const guestName = optionalString('guestName');
+    const roomIdText = optionalString('roomId');
+    const from = optionalString('from');
+    const to = optionalString('to');
+    const status = optionalString('status');
+    const paymentStatus = optionalString('paymentStatus');
+    const sort = optionalString('sort') ?? 'created_at';
+    const order = optionalString('order') ?? 'desc';
+
+    const roomId = roomIdText === null ? null : Number(roomIdText);
+    if (roomId !== null && (!Number.isInteger(roomId) || roomId <= 0)) {
+      fields.roomId = 'must be a positive integer';
+    }
+    for (const [key, value] of [['from', from], ['to', to]] as const) {
+      if (value !== null && !isValidDateString(value)) {
+        fields[key] = 'must be a date in YYYY-MM-DD format';
+      }
+    }
+    if (status !== null && !BOOKING_STATUSES.includes(status as BookingStatus)) {
+      fields.status = `must be one of: ${BOOKING_STATUSES.join(', ')}`;
+    }
+    if (paymentStatus !== null && !PAYMENT_STATUSES.includes(paymentStatus)) {
+      fields.paymentStatus = `must be one of: ${PAYMENT_STATUSES.join(', ')}`;
+    }
+    if (!BOOKING_SORT_COLUMNS[sort]) {
+      fields.sort = `must be one of: ${Object.keys(BOOKING_SORT_COLUMNS).join(', ')}`;
+    }
+    if (order !== 'asc' && order !== 'desc') {
+      fields.order = 'must be asc or desc';
+    }
+
+    let limit = 0;
+    try {
+      limit = parsePageSize(query.limit, 'bookings');
+    } catch (error) {
+      Object.assign(fields, error instanceof ValidationError ? error.fields : {});
+    }
+
+    // A cursor only continues the listing it came from
+    let cursor: { value: string; id: number } | null = null;
+    if (query.cursor !== undefined) {
+      try {
+        const [value, id] = decodeScopedCursor(query.cursor, ['bookings', sort, order]);
+        if (typeof value !== 'string' || !Number.isInteger(id)) {
+          throw new ValidationError('Invalid cursor', { cursor: 'must be a cursor returned by a previous page' });
+        }
+        cursor = { value, id: id as number };
+      } catch (error) {
+        Object.assign(fields, error instanceof ValidationError ? error.fields : {});
+      }
+    }
+
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid booking search', fields);
+    }
+
+    return {
+      // Escape LIKE wildcards so the name is matched literally
+      guestName: guestName === null ? null : `%${guestName.replace(/[\\%_]/g, '\\$&')}%`,
+      roomId, from, to, status, paymentStatus, sort, order, limit, cursor
+    };
+  }
+
+  // NEW METHOD: Bulk operation that can cause deadlocks
+  // Each room runs in its own savepoint, so a lock timeout on one room is retried (or reported)
+  // without aborting the price changes already applied to the others. Deadlocks and serialization
+  // failures rerun the whole batch.
+  async bulkUpdateRoomPricing(roomIds: number[], priceAdjustment: number): Promise<BulkPricingOutcome[]> {
+    const outcomes = await runInTransactionWithRetry(async () => {
+      const results: BulkPricingOutcome[] = [];
+
       // Process rooms in different orders to create deadlock potential
-      const shuffledRoomIds = this.enableRowLocking ? roomIds : this.shuffleArray([...roomIds]);
+      const shuffledRoomIds = lockSettings.rowLocking ? roomIds : this.shuffleArray([...roomIds]);
       
       for (const roomId of shuffledRoomIds) {
-        const lockClause = this.enableRowLocking ? 'FOR UPDATE' : '';
-        
-        // Get current room data
-        const roomResult = await client.query(
-          `SELECT price_per_night FROM rooms WHERE id = $1 ${lockClause}`,
-          [roomId]
-        );
-        
-        if (roomResult.rows.length > 0) {
-          const currentPrice = roomResult.rows[0].price_per_night;
-          const newPrice = currentPrice + priceAdjustment;
-          
+        results.push(await this.updateRoomPriceWithRetry(roomId, priceAdjustment));
+      }
+
+      return results;
+    }, { name: 'bulkUpdateRoomPricing' });
+
+    logger.info('Bulk room pricing updated', {
+      roomIds: roomIds.length,
+      priceAdjustment,
+      updated: outcomes.filter(outcome => outcome.status === 'updated').length
+    });
+    return outcomes;
+  }
+
+  private async updateRoomPriceWithRetry(roomId: number, priceAdjustment: number): Promise<BulkPricingOutcome> {
+    for (let attempt = 1; ; attempt++) {
+      try {
+        const newPrice = await runInTransaction(async ({ client }) => {
+          const lockClause = lockSettings.rowLocking ? 'FOR UPDATE' : '';
+
+          // Get current room data
+          const roomResult = await client.query(
+            `SELECT price_per_night FROM rooms WHERE id = $1 ${lockClause}`,
+            [roomId]
+          );
+
+          if (roomResult.rows.length === 0) {
+            return null;
+          }
+
+          const price = Number(roomResult.rows[0].price_per_night) + priceAdjustment;
+          if (price < 0) {
+            throw new Error('Price adjustment would make the price negative');
+          }
+
           // Add delay to increase deadlock chance
           await new Promise(resolve => setTimeout(resolve, 25));
-          
+
           await client.query(
             'UPDATE rooms SET price_per_night = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2',
-            [newPrice, roomId]
+            [price, roomId]
           );
+          return price;
+        });
+
+        if (newPrice === null) {
+          return { roomId, status: 'skipped', attempts: attempt, error: 'Room not found' };
         }
+        return { roomId, status: 'updated', attempts: attempt, newPrice };
+
+      } catch (error) {
+        // Retrying in the savepoint cannot get past these; the outer transaction reruns the batch
+        if (requiresTransactionRerun(error)) {
+          throw error;
+        }
+        const message = error instanceof Error ? error.message : String(error);
+        if (isTransientError(error) && attempt < BULK_ITEM_MAX_ATTEMPTS) {
+          logger.warn('Retrying room price update', { roomId, attempt, error: message });
+          await new Promise(resolve => setTimeout(resolve, 25 * attempt));
+          continue;
+        }
+        return { roomId, status: 'failed', attempts: attempt, error: message };
       }
-      
-      await client.query('COMMIT');
-      logger.info('Bulk room pricing updated', { roomIds: roomIds.length, priceAdjustment });
-      
-    } catch (error) {
-      await client.query('ROLLBACK');
-      if (error instanceof Error) {
-        logger.error('Failed to update room pricing', { error: error.message });
-      } else {
-        logger.error('Failed to update room pricing', { error: String(error) });
-      }
-      throw error;
-    } finally {
-      client.release();
     }
   }
 
@@ -0,0 +1,62 @@
+import { PoolClient } from 'pg';
+import { Booking, BookingStatus } from '../types';
+import { BookingStateError, NotFoundError } from '../utils/errors';
+import { versionedRow } from './optimisticLocks';
+
+// Allowed lifecycle moves; terminal statuses have no way out
+const TRANSITIONS: Record<BookingStatus, BookingStatus[]> = {
+  pending: ['confirmed', 'cancelled'],
+  confirmed: ['checked_in', 'cancelled', 'no_show'],
+  checked_in: ['checked_out'],
+  checked_out: [],
+  cancelled: [],
+  no_show: []
+};
+
+// Statuses in which the booking still occupies its room
+export const ROOM_HOLDING_STATUSES: BookingStatus[] = ['pending', 'confirmed', 'checked_in'];
+
+// Statuses in which dates and guest details may still be patched
+const MODIFIABLE_STATUSES: BookingStatus[] = ['pending', 'confirmed'];
+
+export class BookingStateService {
+  allowedTransitions(from: BookingStatus): BookingStatus[] {
+    return TRANSITIONS[from] || [];
+  }
+
+  assertTransition(from: BookingStatus, to: BookingStatus): void {
+    if (!this.allowedTransitions(from).includes(to)) {
+      throw new BookingStateError(
+        `Cannot move a ${from} booking to ${to}`, 'INVALID_TRANSITION', from, to, this.allowedTransitions(from)
+      );
+    }
+  }
+
+  assertModifiable(status: BookingStatus): void {
+    if (!MODIFIABLE_STATUSES.includes(status)) {
+      throw new BookingStateError(`Cannot modify a ${status} booking`, 'BOOKING_NOT_MODIFIABLE', status);
+    }
+  }
+
+  // Locks the booking, validates the move and applies it; must run inside a transaction
+  async transition(
+    client: PoolClient, bookingId: number, to: BookingStatus
+  ): Promise<{ from: BookingStatus; previous: Booking; booking: Booking }> {
+    const current = await client.query('SELECT * FROM bookings WHERE id = $1 FOR UPDATE', [bookingId]);
+    if (current.rows.length === 0) {
+      throw new NotFoundError('Booking not found');
+    }
+
+    const from: BookingStatus = current.rows[0].status;
+    this.assertTransition(from, to);
+
+    const previous: Booking = current.rows[0];
+    const booking = versionedRow<Booking>(await client.query(
+      `UPDATE bookings SET status = $1, version = version + 1, updated_at = CURRENT_TIMESTAMP
+       WHERE id = $2 AND version = $3
+       RETURNING *`,
+      [to, bookingId, previous.version]
+    ), 'booking', bookingId, previous.version);
+    return { from, previous, booking };
+  }
+}
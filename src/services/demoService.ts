@@ -0,0 +1,138 @@
+import { randomBytes } from 'crypto';
+import { BookingRequest, BookingService } from './bookingService';
+import { getClient } from '../config/database';
+import { bookingConfig } from '../config/booking';
+import { logger } from '../utils/logger';
+import { metrics } from '../utils/metrics';
+import { addDays, today } from '../utils/date';
+import { Booking, Room } from '../types';
+
+// Sandbox rooms are flagged is_sandbox, which keeps them out of assignment, reports and analytics; their
+// numbers start with this prefix so they are easy to tell apart
+export const SANDBOX_ROOM_PREFIX = 'SBX-';
+
+export interface ConflictSimulation {
+  room: Room;
+  booking: Booking;
+  // Sending this request now is rejected with 409 because the room is already booked
+  conflictingRequest: {
+    method: 'POST';
+    path: string;
+    body: BookingRequest;
+  };
+  expectedStatus: 409;
+}
+
+export class DemoService {
+  constructor(private bookingService: BookingService = new BookingService()) {}
+
+  // Creates a throwaway room and books it, so a frontend can replay a guaranteed conflict
+  async simulateConflict(): Promise<ConflictSimulation> {
+    const room = await this.createSandboxRoom();
+    const checkInDate = addDays(today(), 30);
+    const checkOutDate = addDays(today(), 32);
+
+    const result = await this.bookingService.createBooking({
+      guestName: 'Sandbox Guest',
+      guestEmail: `sandbox+${room.id}@example.com`,
+      guestPhone: '+10000000000',
+      roomId: room.id,
+      checkInDate,
+      checkOutDate,
+      paymentMethod: 'credit_card',
+      channel: 'direct'
+    });
+
+    logger.info('Conflict simulation prepared', { roomId: room.id, bookingId: result.booking.id });
+
+    return {
+      room: { ...room, is_available: false },
+      booking: result.booking,
+      conflictingRequest: {
+        method: 'POST',
+        path: '/api/bookings',
+        body: {
+          guestName: 'Second Guest',
+          guestEmail: `sandbox+${room.id}-second@example.com`,
+          guestPhone: '+10000000001',
+          roomId: room.id,
+          checkInDate,
+          checkOutDate,
+          paymentMethod: 'credit_card'
+        }
+      },
+      expectedStatus: 409
+    };
+  }
+
+  // Retires sandbox rooms older than the TTL once their open bookings are cancelled. They are retired rather than
+  // deleted, since their bookings and those bookings' audit trail stay.
+  async cleanupSandboxRooms(ttlMinutes: number = bookingConfig.sandboxRoomTtlMinutes): Promise<number[]> {
+    const client = await getClient();
+    let expired: { id: number; booking_ids: number[] }[];
+    try {
+      const result = await client.query(
+        `SELECT r.id, COALESCE(array_agg(b.id ORDER BY b.id) FILTER (WHERE b.id IS NOT NULL), '{}') AS booking_ids
+         FROM rooms r
+         LEFT JOIN bookings b ON b.room_id = r.id AND b.status IN ('pending', 'confirmed')
+         WHERE r.is_sandbox AND r.retired_at IS NULL AND r.created_at <= CURRENT_TIMESTAMP - make_interval(mins => $1)
+         GROUP BY r.id
+         ORDER BY r.id`,
+        [ttlMinutes]
+      );
+      expired = result.rows;
+    } finally {
+      client.release();
+    }
+
+    const retired: number[] = [];
+    for (const room of expired) {
+      try {
+        for (const bookingId of room.booking_ids) {
+          await this.bookingService.cancelBooking(bookingId, { code: 'hotel_initiated', text: 'Sandbox room expired' });
+        }
+        await this.retireSandboxRoom(room.id);
+        retired.push(room.id);
+      } catch (error) {
+        logger.error('Failed to clean up sandbox room', {
+          roomId: room.id, error: error instanceof Error ? error.message : String(error)
+        });
+      }
+    }
+
+    if (retired.length > 0) {
+      metrics.increment('sandbox_rooms.retired', retired.length);
+      logger.info('Sandbox rooms retired', { roomIds: retired });
+    }
+    return retired;
+  }
+
+  private async retireSandboxRoom(roomId: number): Promise<void> {
+    const client = await getClient();
+    try {
+      await client.query(
+        `UPDATE rooms SET retired_at = CURRENT_TIMESTAMP, is_available = FALSE, updated_at = CURRENT_TIMESTAMP
+         WHERE id = $1 AND is_sandbox`,
+        [roomId]
+      );
+    } finally {
+      client.release();
+    }
+  }
+
+  private async createSandboxRoom(): Promise<Room> {
+    const client = await getClient();
+    try {
+      const roomNumber = SANDBOX_ROOM_PREFIX + randomBytes(3).toString('hex');
+      const result = await client.query(
+        `INSERT INTO rooms (room_number, room_type, price_per_night, is_available, is_sandbox)
+         VALUES ($1, 'Standard', 100.00, TRUE, TRUE)
+         RETURNING *`,
+        [roomNumber]
+      );
+      return result.rows[0];
+    } finally {
+      client.release();
+    }
+  }
+}
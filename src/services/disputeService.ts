@@ -0,0 +1,167 @@
+import { PoolClient } from 'pg';
+import { getClient } from '../config/database';
+import { runInTransaction } from './transactionManager';
+import { LOYALTY_PAYMENT_METHOD } from './loyaltyService';
+import { logger } from '../utils/logger';
+import { BookingStateError, ConflictError, NotFoundError, ValidationError } from '../utils/errors';
+import { isUniqueViolation } from '../utils/pgErrors';
+import { BookingStatus, PaymentDispute } from '../types';
+
+const DISPUTE_OUTCOMES = ['won', 'lost'] as const;
+
+function toDispute(row: any): PaymentDispute {
+  return { ...row, amount: Number(row.amount) };
+}
+
+// Throws when the booking has an open dispute; modifying it then could change what is being disputed
+export async function assertNotDisputed(client: PoolClient, bookingId: number, status: BookingStatus): Promise<void> {
+  const open = await client.query(
+    `SELECT 1 FROM payment_disputes WHERE booking_id = $1 AND status = 'open' LIMIT 1`,
+    [bookingId]
+  );
+  if (open.rows.length > 0) {
+    throw new BookingStateError('Booking has an open payment dispute', 'BOOKING_DISPUTED', status);
+  }
+}
+
+// Chargebacks: a dispute is opened against a payment receipt and resolved as won (the money stays) or lost
+// (the disputed amount is recorded as a negative chargeback payment with its own receipt)
+export class DisputeService {
+  async openDispute(receiptId: number, input: { reason?: unknown; amount?: unknown }): Promise<PaymentDispute> {
+    const fields: Record<string, string> = {};
+    if (typeof input?.reason !== 'string' || input.reason.trim() === '') {
+      fields.reason = 'is required';
+    }
+    if (input?.amount !== undefined &&
+      (typeof input.amount !== 'number' || !Number.isFinite(input.amount) || input.amount <= 0)) {
+      fields.amount = 'must be a positive number';
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid dispute', fields);
+    }
+
+    return runInTransaction(async ({ client }) => {
+      const receipt = await client.query(
+        `SELECT rec.id, rec.booking_id, rec.kind, p.id AS payment_id, p.amount, p.payment_method
+         FROM receipts rec
+         LEFT JOIN payments p ON p.id = rec.payment_id
+         WHERE rec.id = $1`,
+        [receiptId]
+      );
+      if (receipt.rows.length === 0) {
+        throw new NotFoundError('Receipt not found');
+      }
+      const { booking_id: bookingId, kind, payment_id: paymentId, payment_method: paymentMethod } = receipt.rows[0];
+      if (kind !== 'payment' || paymentId === null) {
+        throw new ValidationError('Invalid dispute', { receiptId: 'only payment receipts can be disputed' });
+      }
+      if (paymentMethod === LOYALTY_PAYMENT_METHOD) {
+        throw new ValidationError('Invalid dispute', { receiptId: 'loyalty point payments cannot be disputed' });
+      }
+
+      // Serializes with cancellation and edits of the booking, which check for open disputes under the same lock
+      await client.query('SELECT id FROM bookings WHERE id = $1 FOR UPDATE', [bookingId]);
+
+      const paymentAmount = Number(receipt.rows[0].amount);
+      const amount = (input.amount as number | undefined) ?? paymentAmount;
+      if (amount > paymentAmount) {
+        throw new ValidationError('Invalid dispute', { amount: `cannot exceed the payment of ${paymentAmount}` });
+      }
+
+      try {
+        const result = await client.query(
+          `INSERT INTO payment_disputes (receipt_id, payment_id, booking_id, amount, reason)
+           VALUES ($1, $2, $3, $4, $5)
+           RETURNING *`,
+          [receiptId, paymentId, bookingId, Math.round(amount * 100) / 100, (input.reason as string).trim()]
+        );
+
+        logger.info('Payment dispute opened', { disputeId: result.rows[0].id, receiptId, bookingId, amount });
+        return toDispute(result.rows[0]);
+      } catch (error) {
+        if (isUniqueViolation(error)) {
+          throw new ConflictError('This receipt already has an open or lost dispute');
+        }
+        throw error;
+      }
+    }, { name: 'openDispute' });
+  }
+
+  async getDisputes(receiptId: number): Promise<PaymentDispute[] | null> {
+    const client = await getClient();
+
+    try {
+      const receipt = await client.query('SELECT id FROM receipts WHERE id = $1', [receiptId]);
+      if (receipt.rows.length === 0) {
+        return null;
+      }
+      const result = await client.query(
+        'SELECT * FROM payment_disputes WHERE receipt_id = $1 ORDER BY id DESC',
+        [receiptId]
+      );
+      return result.rows.map(toDispute);
+    } finally {
+      client.release();
+    }
+  }
+
+  // Closes an open dispute. A lost one adds the chargeback (payment and receipt) in the same transaction,
+  // so the booking's completed payments drop by the disputed amount.
+  async resolveDispute(disputeId: number, input: { outcome?: unknown; note?: unknown }): Promise<PaymentDispute> {
+    const fields: Record<string, string> = {};
+    if (!DISPUTE_OUTCOMES.includes(input?.outcome as typeof DISPUTE_OUTCOMES[number])) {
+      fields.outcome = `must be one of: ${DISPUTE_OUTCOMES.join(', ')}`;
+    }
+    if (input?.note !== undefined && typeof input.note !== 'string') {
+      fields.note = 'must be a string';
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid resolution', fields);
+    }
+    const outcome = input.outcome as typeof DISPUTE_OUTCOMES[number];
+    const note = (input.note as string | undefined)?.trim() || null;
+
+    return runInTransaction(async ({ client }) => {
+      const current = await client.query(
+        `SELECT d.*, p.payment_method FROM payment_disputes d
+         JOIN payments p ON p.id = d.payment_id
+         WHERE d.id = $1
+         FOR UPDATE OF d`,
+        [disputeId]
+      );
+      if (current.rows.length === 0 || current.rows[0].status !== 'open') {
+        throw new NotFoundError('Open dispute not found');
+      }
+      const dispute = current.rows[0];
+
+      let chargebackPaymentId: number | null = null;
+      if (outcome === 'lost') {
+        const chargeback = await client.query(
+          `INSERT INTO payments (booking_id, amount, payment_method, status, transaction_id)
+           VALUES ($1, $2, $3, 'completed', $4)
+           RETURNING id, transaction_id`,
+          [dispute.booking_id, -Number(dispute.amount), dispute.payment_method,
+            `CB_${Date.now()}_${Math.random().toString(36).slice(2, 11)}`]
+        );
+        chargebackPaymentId = chargeback.rows[0].id;
+        await client.query(
+          `INSERT INTO receipts (booking_id, payment_id, kind, receipt_number, total_amount, payment_method, gateway_reference)
+           VALUES ($1, $2, 'chargeback', $3, $4, $5, $6)`,
+          [dispute.booking_id, chargebackPaymentId, `CBR_${Date.now()}_${Math.random().toString(36).slice(2, 8)}`,
+            -Number(dispute.amount), dispute.payment_method, chargeback.rows[0].transaction_id]
+        );
+      }
+
+      const result = await client.query(
+        `UPDATE payment_disputes
+         SET status = $2, chargeback_payment_id = $3, resolution_note = $4, resolved_at = CURRENT_TIMESTAMP
+         WHERE id = $1
+         RETURNING *`,
+        [disputeId, outcome, chargebackPaymentId, note]
+      );
+
+      logger.info('Payment dispute resolved', { disputeId, bookingId: dispute.booking_id, outcome });
+      return toDispute(result.rows[0]);
+    }, { name: 'resolveDispute' });
+  }
+}
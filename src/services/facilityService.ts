@@ -0,0 +1,180 @@
+import { PoolClient } from 'pg';
+import { getClient } from '../config/database';
+import { runInTransaction } from './transactionManager';
+import { logger } from '../utils/logger';
+import { isUniqueViolation } from '../utils/pgErrors';
+import { ConflictError, NotFoundError, ValidationError } from '../utils/errors';
+import { Facility } from '../types';
+
+// Amenities offered by room types. A facility attached to room types is only deleted when the caller
+// says so with force, which detaches it from all of them in the same transaction.
+export class FacilityService {
+  async listFacilities(): Promise<Facility[]> {
+    const client = await getClient();
+
+    try {
+      return await this.selectFacilities(client, null);
+    } finally {
+      client.release();
+    }
+  }
+
+  async createFacility(input: { name?: unknown; description?: unknown }): Promise<Facility> {
+    const values = this.validateFacility(input, true);
+    const client = await getClient();
+
+    try {
+      const result = await client.query(
+        'INSERT INTO facilities (name, description) VALUES ($1, $2) RETURNING id',
+        [values.name, values.description ?? null]
+      );
+
+      logger.info('Facility created', { facilityId: result.rows[0].id, name: values.name });
+      return (await this.loadFacility(client, result.rows[0].id))!;
+    } catch (error) {
+      if (isUniqueViolation(error)) {
+        throw new ConflictError('A facility with this name already exists');
+      }
+      throw error;
+    } finally {
+      client.release();
+    }
+  }
+
+  // Fields left out keep their current value; a null description clears it
+  async updateFacility(facilityId: number, input: { name?: unknown; description?: unknown }): Promise<Facility> {
+    const values = this.validateFacility(input, false);
+    const client = await getClient();
+
+    try {
+      const result = await client.query(
+        `UPDATE facilities
+         SET name = COALESCE($2, name),
+             description = CASE WHEN $3::boolean THEN $4 ELSE description END,
+             updated_at = CURRENT_TIMESTAMP
+         WHERE id = $1`,
+        [facilityId, values.name ?? null, values.description !== undefined, values.description ?? null]
+      );
+      if (result.rowCount === 0) {
+        throw new NotFoundError('Facility not found');
+      }
+
+      logger.info('Facility updated', { facilityId });
+      return (await this.loadFacility(client, facilityId))!;
+    } catch (error) {
+      if (isUniqueViolation(error)) {
+        throw new ConflictError('A facility with this name already exists');
+      }
+      throw error;
+    } finally {
+      client.release();
+    }
+  }
+
+  async deleteFacility(facilityId: number, force: boolean): Promise<void> {
+    await runInTransaction(async ({ client }) => {
+      const facility = await client.query('SELECT id FROM facilities WHERE id = $1 FOR UPDATE', [facilityId]);
+      if (facility.rows.length === 0) {
+        throw new NotFoundError('Facility not found');
+      }
+
+      const attached = await client.query(
+        'SELECT room_type FROM room_type_facilities WHERE facility_id = $1 ORDER BY room_type',
+        [facilityId]
+      );
+      if (attached.rows.length > 0 && !force) {
+        throw new ConflictError(
+          `Facility is attached to room types ${attached.rows.map(row => row.room_type).join(', ')}; detach it first or delete with force`
+        );
+      }
+
+      await client.query('DELETE FROM room_type_facilities WHERE facility_id = $1', [facilityId]);
+      await client.query('DELETE FROM facilities WHERE id = $1', [facilityId]);
+      logger.info('Facility deleted', { facilityId, detachedFrom: attached.rows.map(row => row.room_type) });
+    }, { name: 'deleteFacility' });
+  }
+
+  // Attaching twice is a no-op
+  async attach(roomType: string, facilityId: number): Promise<Facility> {
+    const client = await getClient();
+
+    try {
+      const rooms = await client.query('SELECT 1 FROM rooms WHERE room_type = $1 LIMIT 1', [roomType]);
+      if (rooms.rows.length === 0) {
+        throw new NotFoundError('Room type not found');
+      }
+      const facility = await client.query('SELECT id FROM facilities WHERE id = $1', [facilityId]);
+      if (facility.rows.length === 0) {
+        throw new NotFoundError('Facility not found');
+      }
+
+      await client.query(
+        `INSERT INTO room_type_facilities (room_type, facility_id) VALUES ($1, $2)
+         ON CONFLICT (room_type, facility_id) DO NOTHING`,
+        [roomType, facilityId]
+      );
+      logger.info('Facility attached', { roomType, facilityId });
+      return (await this.loadFacility(client, facilityId))!;
+    } finally {
+      client.release();
+    }
+  }
+
+  async detach(roomType: string, facilityId: number): Promise<void> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query(
+        'DELETE FROM room_type_facilities WHERE room_type = $1 AND facility_id = $2',
+        [roomType, facilityId]
+      );
+      if (result.rowCount === 0) {
+        throw new NotFoundError('Facility is not attached to this room type');
+      }
+      logger.info('Facility detached', { roomType, facilityId });
+    } finally {
+      client.release();
+    }
+  }
+
+  private async loadFacility(client: PoolClient, facilityId: number): Promise<Facility | null> {
+    const [facility] = await this.selectFacilities(client, facilityId);
+    return facility || null;
+  }
+
+  // All facilities, or just one, each with the room types it is attached to
+  private async selectFacilities(client: PoolClient, facilityId: number | null): Promise<Facility[]> {
+    const result = await client.query(
+      `SELECT f.*,
+              COALESCE(array_agg(rtf.room_type ORDER BY rtf.room_type) FILTER (WHERE rtf.room_type IS NOT NULL), '{}') AS room_types
+       FROM facilities f
+       LEFT JOIN room_type_facilities rtf ON rtf.facility_id = f.id
+       WHERE $1::int IS NULL OR f.id = $1
+       GROUP BY f.id
+       ORDER BY f.name`,
+      [facilityId]
+    );
+    return result.rows;
+  }
+
+  private validateFacility(
+    input: { name?: unknown; description?: unknown }, creating: boolean
+  ): { name?: string; description?: string | null } {
+    const fields: Record<string, string> = {};
+    if ((creating || input?.name !== undefined) &&
+      (typeof input?.name !== 'string' || input.name.trim() === '' || input.name.trim().length > 100)) {
+      fields.name = 'is required (at most 100 characters)';
+    }
+    if (input?.description !== undefined && input.description !== null && typeof input.description !== 'string') {
+      fields.description = 'must be a string or null';
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid facility', fields);
+    }
+
+    return {
+      name: typeof input.name === 'string' ? input.name.trim() : undefined,
+      description: input.description as string | null | undefined
+    };
+  }
+}
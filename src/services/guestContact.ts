@@ -0,0 +1,51 @@
+import { encryptionConfig } from '../config/encryption';
+import { decryptField, encryptField, lookupHash } from '../utils/fieldEncryption';
+import { Guest } from '../types';
+
+// Guest emails and phones are stored encrypted, with the id of the key in the row's pii_key_id, and the email
+// also as a keyed hash (email_lookup) so guests can still be found, and kept unique, by email. Rows written
+// before encryption have no key id and are read as stored until the reencrypt-guests script has moved them.
+// The same applies to the contact details of waitlist entries.
+
+export interface SealedContact {
+  email: string;
+  phone: string;
+  emailLookup: string;
+  keyId: string;
+}
+
+export function sealContact(email: string, phone: string): SealedContact {
+  const keyId = encryptionConfig.currentKeyId;
+  return {
+    email: encryptField(email, 'email', keyId),
+    phone: encryptField(phone, 'phone', keyId),
+    emailLookup: lookupHash(email),
+    keyId
+  };
+}
+
+export function openContactField(value: string, field: 'email' | 'phone', keyId: string | null): string {
+  return keyId === null ? value : decryptField(value, field, keyId);
+}
+
+export function toGuest(row: any): Guest {
+  const { email_lookup: _lookup, pii_key_id: keyId, ...guest } = row;
+  return {
+    ...guest,
+    email: openContactField(row.email, 'email', keyId),
+    phone: openContactField(row.phone, 'phone', keyId)
+  };
+}
+
+// Booking rows joined with the guest's email and phone as guest_email and guest_phone, and g.pii_key_id as
+// guest_pii_key_id
+export function withGuestContact<T extends { guest_email: string; guest_phone: string; guest_pii_key_id: string | null }>(
+  row: T
+): Omit<T, 'guest_pii_key_id'> {
+  const { guest_pii_key_id: keyId, ...rest } = row;
+  return {
+    ...rest,
+    guest_email: openContactField(row.guest_email, 'email', keyId),
+    guest_phone: openContactField(row.guest_phone, 'phone', keyId)
+  };
+}
@@ -0,0 +1,189 @@
+import { getClient } from '../config/database';
+import { runInTransaction } from './transactionManager';
+import { sealContact, toGuest } from './guestContact';
+import { logger } from '../utils/logger';
+import { ConflictError, NotFoundError, ValidationError } from '../utils/errors';
+import { isUniqueViolation } from '../utils/pgErrors';
+import { nameError, normalizeName } from '../utils/names';
+import { Guest } from '../types';
+
+export interface GuestInput {
+  name?: unknown;
+  email?: unknown;
+  phone?: unknown;
+  documentId?: unknown;
+}
+
+const EMAIL_PATTERN = /^[^\s@]+@[^\s@]+\.[^\s@]+$/;
+
+const GUEST_FIELDS = ['name', 'email', 'phone', 'documentId'];
+
+type GuestValues = Partial<Record<'name' | 'email' | 'phone' | 'documentId', string | null>>;
+
+export class GuestService {
+  async createGuest(input: GuestInput): Promise<Guest> {
+    const values = this.validateGuest(input, false);
+    const client = await getClient();
+
+    try {
+      const contact = sealContact(values.email!, values.phone!);
+      const result = await client.query(
+        `INSERT INTO guests (name, email, phone, email_lookup, pii_key_id, document_id)
+         VALUES ($1, $2, $3, $4, $5, $6)
+         RETURNING *`,
+        [values.name, contact.email, contact.phone, contact.emailLookup, contact.keyId, values.documentId ?? null]
+      );
+
+      logger.info('Guest profile created', { guestId: result.rows[0].id });
+      return toGuest(result.rows[0]);
+    } catch (error) {
+      if (isUniqueViolation(error)) {
+        throw new ConflictError('A guest with this email already exists');
+      }
+      throw error;
+    } finally {
+      client.release();
+    }
+  }
+
+  async getGuest(guestId: number): Promise<Guest | null> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query('SELECT * FROM guests WHERE id = $1', [guestId]);
+      return result.rows[0] ? toGuest(result.rows[0]) : null;
+    } finally {
+      client.release();
+    }
+  }
+
+  // Merge-patch update: only the given fields change, and documentId may be cleared with null. Email and phone
+  // are encrypted together under the current key, so a changed contact detail moves the row to that key.
+  async updateGuest(guestId: number, patch: GuestInput): Promise<Guest> {
+    const values = this.validateGuest(patch, true);
+
+    try {
+      return await runInTransaction(async ({ client }) => {
+        const current = await client.query('SELECT * FROM guests WHERE id = $1 FOR UPDATE', [guestId]);
+        if (current.rows.length === 0) {
+          throw new NotFoundError('Guest not found');
+        }
+        const guest = toGuest(current.rows[0]);
+        const contactChanged = 'email' in values || 'phone' in values;
+        const contact = sealContact(values.email ?? guest.email, values.phone ?? guest.phone);
+
+        const result = await client.query(
+          `UPDATE guests
+           SET name = CASE WHEN $2 THEN $3 ELSE name END,
+               email = CASE WHEN $4 THEN $5 ELSE email END,
+               phone = CASE WHEN $4 THEN $6 ELSE phone END,
+               email_lookup = CASE WHEN $4 THEN $7 ELSE email_lookup END,
+               pii_key_id = CASE WHEN $4 THEN $8 ELSE pii_key_id END,
+               document_id = CASE WHEN $9 THEN $10 ELSE document_id END,
+               updated_at = CURRENT_TIMESTAMP
+           WHERE id = $1
+           RETURNING *`,
+          [
+            guestId,
+            'name' in values, values.name ?? null,
+            contactChanged, contact.email, contact.phone, contact.emailLookup, contact.keyId,
+            'documentId' in values, values.documentId ?? null
+          ]
+        );
+
+        logger.info('Guest profile updated', { guestId, fields: Object.keys(values) });
+        return toGuest(result.rows[0]);
+      }, { name: 'updateGuest' });
+    } catch (error) {
+      if (isUniqueViolation(error)) {
+        throw new ConflictError('A guest with this email already exists');
+      }
+      throw error;
+    }
+  }
+
+  // Guests with bookings are kept so booking history stays intact
+  async deleteGuest(guestId: number): Promise<void> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query(
+        `DELETE FROM guests g
+         WHERE g.id = $1 AND NOT EXISTS (SELECT 1 FROM bookings b WHERE b.guest_id = g.id)
+         RETURNING g.id`,
+        [guestId]
+      );
+
+      if (result.rows.length === 0) {
+        const exists = await client.query('SELECT 1 FROM guests WHERE id = $1', [guestId]);
+        if (exists.rows.length === 0) {
+          throw new NotFoundError('Guest not found');
+        }
+        throw new ConflictError('Guest has bookings and cannot be deleted');
+      }
+      logger.info('Guest profile deleted', { guestId });
+    } finally {
+      client.release();
+    }
+  }
+
+  private validateGuest(input: GuestInput, partial: boolean): GuestValues {
+    if (!input || typeof input !== 'object' || Array.isArray(input)) {
+      throw new ValidationError('Guest body must be a JSON object');
+    }
+
+    const fields: Record<string, string> = {};
+    const values: GuestValues = {};
+
+    for (const key of Object.keys(input)) {
+      if (!GUEST_FIELDS.includes(key)) {
+        fields[key] = 'unknown field';
+      }
+    }
+
+    if (input.name !== undefined || !partial) {
+      const error = nameError(input.name);
+      if (error) {
+        fields.name = error;
+      } else {
+        values.name = normalizeName(input.name as string);
+      }
+    }
+
+    for (const [key, maxLength] of [['email', 255], ['phone', 20]] as const) {
+      const value = input[key];
+      if (value === undefined && partial) {
+        continue;
+      }
+      if (typeof value !== 'string' || value.trim() === '') {
+        fields[key] = 'is required';
+      } else if (value.trim().length > maxLength) {
+        fields[key] = `must be at most ${maxLength} characters`;
+      } else {
+        values[key] = value.trim();
+      }
+    }
+
+    if (values.email && !EMAIL_PATTERN.test(values.email)) {
+      fields.email = 'must be a valid email address';
+    }
+
+    if (input.documentId === null) {
+      values.documentId = null;
+    } else if (input.documentId !== undefined) {
+      if (typeof input.documentId !== 'string' || input.documentId.trim() === '' || input.documentId.trim().length > 50) {
+        fields.documentId = 'must be a non-empty string of at most 50 characters';
+      } else {
+        values.documentId = input.documentId.trim();
+      }
+    }
+
+    if (partial && Object.keys(input).length === 0) {
+      throw new ValidationError('Patch body must contain at least one field');
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid guest', fields);
+    }
+    return values;
+  }
+}
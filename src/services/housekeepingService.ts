@@ -0,0 +1,105 @@
+import { getClient } from '../config/database';
+import { runInTransaction } from './transactionManager';
+import { logger } from '../utils/logger';
+import { currentActor } from '../utils/actor';
+import { ConflictError, NotFoundError, ValidationError } from '../utils/errors';
+import { isValidDateString, today } from '../utils/date';
+import { eventBus } from '../events/eventBus';
+import { HousekeepingStatus, HousekeepingTask, Room } from '../types';
+
+export const HOUSEKEEPING_STATUSES: HousekeepingStatus[] = ['dirty', 'clean', 'inspected'];
+
+// Called on check-out: the room needs cleaning before the next guest can check in. Runs in the check-out's
+// transaction, and announces the change once that has committed.
+export async function markRoomDirty(roomId: number): Promise<void> {
+  await runInTransaction(async ({ client, afterCommit }) => {
+    await client.query(
+      `UPDATE rooms SET housekeeping_status = 'dirty', housekeeping_updated_at = CURRENT_TIMESTAMP,
+                        housekeeping_updated_by = $2, updated_at = CURRENT_TIMESTAMP
+       WHERE id = $1`,
+      [roomId, currentActor()]
+    );
+    afterCommit(() => {
+      eventBus.publish('room.housekeeping_changed', { roomId, status: 'dirty' });
+    });
+  });
+}
+
+// Rooms go dirty at check-out, clean once housekeeping is done, and inspected once a supervisor has
+// checked the cleaning. Only a dirty room blocks check-in.
+export class HousekeepingService {
+  async setStatus(roomId: number, status: unknown): Promise<Room> {
+    if (typeof status !== 'string' || !HOUSEKEEPING_STATUSES.includes(status as HousekeepingStatus)) {
+      throw new ValidationError('Invalid housekeeping status', {
+        status: `must be one of: ${HOUSEKEEPING_STATUSES.join(', ')}`
+      });
+    }
+
+    const client = await getClient();
+
+    try {
+      // Inspection signs off a cleaning, so a dirty room can't skip straight to inspected
+      const result = await client.query(
+        `UPDATE rooms SET housekeeping_status = $2::varchar, housekeeping_updated_at = CURRENT_TIMESTAMP,
+                          housekeeping_updated_by = $3, updated_at = CURRENT_TIMESTAMP
+         WHERE id = $1 AND ($2::varchar <> 'inspected' OR housekeeping_status <> 'dirty')
+         RETURNING *`,
+        [roomId, status, currentActor()]
+      );
+      if (result.rows.length === 0) {
+        const room = await client.query('SELECT id FROM rooms WHERE id = $1', [roomId]);
+        if (room.rows.length === 0) {
+          throw new NotFoundError('Room not found');
+        }
+        throw new ConflictError('Room must be cleaned before it is inspected');
+      }
+
+      logger.info('Housekeeping status updated', { roomId, status });
+      eventBus.publish('room.housekeeping_changed', { roomId, status });
+      return result.rows[0];
+    } finally {
+      client.release();
+    }
+  }
+
+  // The day's work: dirty rooms and rooms whose guest is due to leave need cleaning, and cleaned rooms with
+  // an arrival need inspecting. Rooms with a guest arriving that day come first.
+  async taskList(date: unknown = today()): Promise<HousekeepingTask[]> {
+    if (!isValidDateString(date)) {
+      throw new ValidationError('Invalid housekeeping date', { date: 'must be a date in YYYY-MM-DD format' });
+    }
+
+    const client = await getClient();
+
+    try {
+      const result = await client.query(
+        `SELECT r.id AS room_id, r.room_number, r.room_type, r.housekeeping_status,
+                departing.id AS departing_booking_id, arriving.id AS arriving_booking_id
+         FROM rooms r
+         LEFT JOIN LATERAL (
+           SELECT id FROM bookings
+           WHERE room_id = r.id AND check_out_date = $1 AND status = 'checked_in'
+           ORDER BY id DESC LIMIT 1
+         ) departing ON TRUE
+         LEFT JOIN LATERAL (
+           SELECT id FROM bookings
+           WHERE room_id = r.id AND check_in_date = $1 AND status IN ('pending', 'confirmed')
+           ORDER BY id LIMIT 1
+         ) arriving ON TRUE
+         WHERE r.retired_at IS NULL AND NOT r.is_sandbox
+           AND (r.housekeeping_status = 'dirty' OR departing.id IS NOT NULL
+             OR (r.housekeeping_status = 'clean' AND arriving.id IS NOT NULL))
+         ORDER BY (arriving.id IS NULL), r.room_number`,
+        [date]
+      );
+
+      return result.rows.map(row => ({
+        ...row,
+        task: row.housekeeping_status === 'clean' && row.departing_booking_id === null ? 'inspect' : 'clean',
+        priority: row.arriving_booking_id === null ? 'normal' : 'high'
+      }));
+    } finally {
+      client.release();
+    }
+  }
+}
@@ -0,0 +1,111 @@
+import { getClient } from '../config/database';
+import { deadlockLog, DeadlockEvent } from '../utils/deadlockLog';
+
+export interface LockInfo {
+  locktype: string;
+  // What is locked, e.g. "rooms", "rooms (0,3)", "transaction 1234" or "room 3, bucket 2916"
+  target: string;
+  mode: string;
+}
+
+export interface LockSession {
+  pid: number;
+  state: string | null;
+  query: string | null;
+  transactionStartedAt: Date | null;
+}
+
+export interface LockDiagnostics {
+  holders: (LockSession & { locks: LockInfo[] })[];
+  waiters: (LockSession & { waitingFor: LockInfo; blockedBy: number[] })[];
+  // Sessions waiting on each other in a circle; Postgres fails one of them after deadlock_timeout
+  cycles: number[][];
+  recentDeadlocks: DeadlockEvent[];
+}
+
+// Every cycle in a wait-for graph (pid -> pids it waits for), each listed once starting from its lowest pid
+export function findWaitCycles(waitsFor: Map<number, number[]>): number[][] {
+  const cycles: number[][] = [];
+  const seen = new Set<string>();
+
+  const visit = (pid: number, path: number[]) => {
+    for (const next of waitsFor.get(pid) ?? []) {
+      const start = path.indexOf(next);
+      if (start >= 0) {
+        const cycle = path.slice(start);
+        const lowest = cycle.indexOf(Math.min(...cycle));
+        const rotated = [...cycle.slice(lowest), ...cycle.slice(0, lowest)];
+        if (!seen.has(rotated.join(','))) {
+          seen.add(rotated.join(','));
+          cycles.push(rotated);
+        }
+      } else {
+        visit(next, [...path, next]);
+      }
+    }
+  };
+  for (const pid of waitsFor.keys()) {
+    visit(pid, [pid]);
+  }
+  return cycles;
+}
+
+function lockTarget(row: any): string {
+  switch (row.locktype) {
+    case 'relation':
+      return row.relation;
+    case 'tuple':
+      return `${row.relation} (${row.page},${row.tuple})`;
+    case 'transactionid':
+      return `transaction ${row.transactionid}`;
+    case 'advisory':
+      // Two-key advisory locks are the room locks of the advisory strategy
+      return row.objsubid === 2 ? `room ${row.classid}, bucket ${row.objid}` : `advisory ${row.objid}`;
+    default:
+      return row.relation ?? row.locktype;
+  }
+}
+
+// Who holds and who waits for locks in this database right now, from pg_locks, plus the deadlocks this
+// process has lost lately. The snapshot is taken by a session of its own, which is left out.
+export class LockDiagnosticsService {
+  async snapshot(): Promise<LockDiagnostics> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query(
+        `SELECT l.pid, l.locktype, l.relation::regclass::text AS relation, l.page, l.tuple,
+                l.transactionid::text AS transactionid, l.classid, l.objid, l.objsubid, l.mode, l.granted,
+                a.state, left(a.query, 500) AS query, a.xact_start, pg_blocking_pids(l.pid) AS blocked_by
+         FROM pg_locks l
+         JOIN pg_stat_activity a ON a.pid = l.pid
+         WHERE a.datname = current_database() AND l.pid <> pg_backend_pid() AND l.locktype <> 'virtualxid'
+         ORDER BY l.pid, l.granted DESC`
+      );
+
+      const holders = new Map<number, LockSession & { locks: LockInfo[] }>();
+      const waiters: LockDiagnostics['waiters'] = [];
+      for (const row of result.rows) {
+        const session = { pid: row.pid, state: row.state, query: row.query, transactionStartedAt: row.xact_start };
+        const lock = { locktype: row.locktype, target: lockTarget(row), mode: row.mode };
+        if (row.granted) {
+          const holder = holders.get(row.pid) ?? { ...session, locks: [] };
+          holder.locks.push(lock);
+          holders.set(row.pid, holder);
+        } else {
+          waiters.push({ ...session, waitingFor: lock, blockedBy: row.blocked_by });
+        }
+      }
+
+      const waitsFor = new Map<number, number[]>(waiters.map(waiter => [waiter.pid, waiter.blockedBy]));
+      return {
+        holders: Array.from(holders.values()),
+        waiters,
+        cycles: findWaitCycles(waitsFor),
+        recentDeadlocks: deadlockLog.recent()
+      };
+    } finally {
+      client.release();
+    }
+  }
+}
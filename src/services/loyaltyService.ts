@@ -0,0 +1,135 @@
+import { PoolClient } from 'pg';
+import { getClient } from '../config/database';
+import { loyaltyConfig } from '../config/loyalty';
+import { logger } from '../utils/logger';
+import { ValidationError } from '../utils/errors';
+import { nightsBetween, formatDate } from '../utils/date';
+import { Booking, LoyaltyTransaction, Payment } from '../types';
+
+// Points spent on a stay are recorded as a payment with this method
+export const LOYALTY_PAYMENT_METHOD = 'loyalty_points';
+
+const roundMoney = (amount: number) => Math.round(amount * 100) / 100;
+
+// Every balance change is a ledger row written in the same transaction as the booking, payment or
+// receipt that caused it, and at most one of each kind per booking, so a retried or concurrent
+// request can neither spend the same points twice nor earn them twice
+export class LoyaltyService {
+  // The part of a stay the points would pay for; never more than the stay costs, so no points are wasted
+  redemptionValue(points: number, totalAmount: number): { points: number; amount: number } {
+    const amount = Math.min(roundMoney(points * loyaltyConfig.pointValue), totalAmount);
+    return { points: Math.ceil(roundMoney(amount / loyaltyConfig.pointValue)), amount };
+  }
+
+  // Takes the points off the guest's balance and records them as a completed payment on the booking.
+  // The balance check and the deduction are one UPDATE, so two bookings racing for the same points
+  // can't both have them.
+  async redeem(
+    client: PoolClient, guestId: number, bookingId: number, redemption: { points: number; amount: number }
+  ): Promise<Payment> {
+    const spent = await client.query(
+      `UPDATE guests SET loyalty_points = loyalty_points - $1, updated_at = CURRENT_TIMESTAMP
+       WHERE id = $2 AND loyalty_points >= $1
+       RETURNING loyalty_points`,
+      [redemption.points, guestId]
+    );
+    if (spent.rows.length === 0) {
+      const balance = await client.query('SELECT loyalty_points FROM guests WHERE id = $1', [guestId]);
+      throw new ValidationError('Invalid booking request', {
+        redeemPoints: `exceeds the guest's balance of ${balance.rows[0]?.loyalty_points ?? 0} points`
+      });
+    }
+
+    await client.query(
+      `INSERT INTO loyalty_transactions (guest_id, booking_id, kind, points) VALUES ($1, $2, 'redeemed', $3)`,
+      [guestId, bookingId, -redemption.points]
+    );
+    const payment = await client.query(
+      `INSERT INTO payments (booking_id, amount, payment_method, status, transaction_id)
+       VALUES ($1, $2, $3, 'completed', $4)
+       RETURNING *`,
+      [bookingId, redemption.amount, LOYALTY_PAYMENT_METHOD, `PTS_${Date.now()}_${Math.random().toString(36).slice(2, 11)}`]
+    );
+
+    logger.info('Loyalty points redeemed', { guestId, bookingId, points: redemption.points, amount: redemption.amount });
+    return payment.rows[0];
+  }
+
+  // Gives back the points a cancelled booking was paid with
+  async restoreRedemption(client: PoolClient, booking: Booking): Promise<number> {
+    const restored = await client.query(
+      `INSERT INTO loyalty_transactions (guest_id, booking_id, kind, points)
+       SELECT guest_id, booking_id, 'restored', -points FROM loyalty_transactions
+       WHERE booking_id = $1 AND kind = 'redeemed'
+       ON CONFLICT (booking_id, kind) DO NOTHING
+       RETURNING points`,
+      [booking.id]
+    );
+    const points = restored.rows[0]?.points ?? 0;
+    if (points > 0) {
+      await client.query(
+        'UPDATE guests SET loyalty_points = loyalty_points + $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2',
+        [points, booking.guest_id]
+      );
+      logger.info('Loyalty points restored', { guestId: booking.guest_id, bookingId: booking.id, points });
+    }
+    return points;
+  }
+
+  // Credits a finished stay: pointsPerNight for each night covered by money actually paid (points spent
+  // on the stay don't earn more points). Runs in the transaction that issues the final receipt.
+  async awardStay(client: PoolClient, bookingId: number): Promise<number> {
+    const stay = await client.query(
+      `SELECT b.guest_id, b.check_in_date, b.check_out_date, b.total_amount,
+              (SELECT COALESCE(SUM(p.amount), 0) FROM payments p
+                WHERE p.booking_id = b.id AND p.status = 'completed' AND p.payment_method <> $2) AS cash_paid
+       FROM bookings b WHERE b.id = $1`,
+      [bookingId, LOYALTY_PAYMENT_METHOD]
+    );
+    const row = stay.rows[0];
+    const nights = nightsBetween(formatDate(row.check_in_date), formatDate(row.check_out_date));
+    const total = Number(row.total_amount);
+    const paidShare = total > 0 ? Math.min(1, Number(row.cash_paid) / total) : 0;
+    const points = Math.floor(nights * paidShare) * loyaltyConfig.pointsPerNight;
+    if (points <= 0) {
+      return 0;
+    }
+
+    const earned = await client.query(
+      `INSERT INTO loyalty_transactions (guest_id, booking_id, kind, points) VALUES ($1, $2, 'earned', $3)
+       ON CONFLICT (booking_id, kind) DO NOTHING
+       RETURNING id`,
+      [row.guest_id, bookingId, points]
+    );
+    if (earned.rows.length === 0) {
+      return 0;
+    }
+    await client.query(
+      'UPDATE guests SET loyalty_points = loyalty_points + $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2',
+      [points, row.guest_id]
+    );
+
+    logger.info('Loyalty points earned', { guestId: row.guest_id, bookingId, points });
+    return points;
+  }
+
+  // Balance and ledger, newest first; null when the guest does not exist
+  async getAccount(guestId: number): Promise<{ balance: number; transactions: LoyaltyTransaction[] } | null> {
+    const client = await getClient();
+
+    try {
+      const guest = await client.query('SELECT loyalty_points FROM guests WHERE id = $1', [guestId]);
+      if (guest.rows.length === 0) {
+        return null;
+      }
+
+      const transactions = await client.query(
+        'SELECT * FROM loyalty_transactions WHERE guest_id = $1 ORDER BY id DESC',
+        [guestId]
+      );
+      return { balance: guest.rows[0].loyalty_points, transactions: transactions.rows };
+    } finally {
+      client.release();
+    }
+  }
+}
@@ -0,0 +1,142 @@
+import { PoolClient } from 'pg';
+import { getClient } from '../config/database';
+import { runInTransaction } from './transactionManager';
+import { ROOM_HOLDING_STATUSES } from './bookingStateService';
+import { recordRoomStatus } from './roomStatusHistoryService';
+import { logger } from '../utils/logger';
+import { currentActor } from '../utils/actor';
+import { ConflictError, NotFoundError, RoomOutOfServiceError, ValidationError } from '../utils/errors';
+import { formatDate, isValidDateString } from '../utils/date';
+import { MaintenanceBlock } from '../types';
+
+function toBlock(row: any): MaintenanceBlock {
+  return { ...row, start_date: formatDate(row.start_date), end_date: formatDate(row.end_date) };
+}
+
+// Throws when an active maintenance block overlaps the stay. Callers hold the room's row lock, which
+// MaintenanceService also takes before placing a block, so a block and a reservation can't both get in.
+export async function assertNotInMaintenance(
+  client: PoolClient, roomId: number, checkInDate: string, checkOutDate: string
+): Promise<void> {
+  const blocks = await client.query(
+    `SELECT start_date, end_date FROM room_maintenance_blocks
+     WHERE room_id = $1 AND status = 'active' AND start_date < $3 AND end_date > $2
+     ORDER BY start_date LIMIT 1`,
+    [roomId, checkInDate, checkOutDate]
+  );
+  if (blocks.rows.length > 0) {
+    const block = toBlock(blocks.rows[0]);
+    throw new RoomOutOfServiceError(`Room is out of service for maintenance from ${block.start_date} to ${block.end_date}`);
+  }
+}
+
+export class MaintenanceService {
+  // Takes the room out of service for [startDate, endDate). Refused while a booking or active hold overlaps
+  // the range: those guests have to be moved first.
+  async createBlock(roomId: number, input: { startDate?: unknown; endDate?: unknown; reason?: unknown }): Promise<MaintenanceBlock> {
+    const fields: Record<string, string> = {};
+    if (!isValidDateString(input?.startDate)) {
+      fields.startDate = 'must be a date in YYYY-MM-DD format';
+    }
+    if (!isValidDateString(input?.endDate)) {
+      fields.endDate = 'must be a date in YYYY-MM-DD format';
+    } else if (isValidDateString(input.startDate) && input.endDate <= input.startDate) {
+      fields.endDate = 'must be after startDate';
+    }
+    if (typeof input?.reason !== 'string' || input.reason.trim() === '') {
+      fields.reason = 'is required';
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid maintenance block', fields);
+    }
+    const startDate = input.startDate as string;
+    const endDate = input.endDate as string;
+
+    return runInTransaction(async ({ client }) => {
+      // Same lock as booking the room
+      const room = await client.query('SELECT id, retired_at FROM rooms WHERE id = $1 FOR UPDATE', [roomId]);
+      if (room.rows.length === 0) {
+        throw new NotFoundError('Room not found');
+      }
+      if (room.rows[0].retired_at !== null) {
+        throw new ConflictError('Room has been retired');
+      }
+
+      const bookings = await client.query(
+        `SELECT id FROM bookings
+         WHERE room_id = $1 AND status = ANY($2) AND check_in_date < $4 AND check_out_date > $3
+         ORDER BY id`,
+        [roomId, ROOM_HOLDING_STATUSES, startDate, endDate]
+      );
+      if (bookings.rows.length > 0) {
+        throw new ConflictError(
+          `Room is booked during the block (bookings ${bookings.rows.map(row => row.id).join(', ')})`
+        );
+      }
+      const holds = await client.query(
+        `SELECT 1 FROM room_holds
+         WHERE room_id = $1 AND status = 'active' AND expires_at > CURRENT_TIMESTAMP
+           AND check_in_date < $3 AND check_out_date > $2
+         LIMIT 1`,
+        [roomId, startDate, endDate]
+      );
+      if (holds.rows.length > 0) {
+        throw new ConflictError('Room is held for a guest during the block');
+      }
+      await assertNotInMaintenance(client, roomId, startDate, endDate);
+
+      const result = await client.query(
+        `INSERT INTO room_maintenance_blocks (room_id, start_date, end_date, reason, created_by)
+         VALUES ($1, $2, $3, $4, $5)
+         RETURNING *`,
+        [roomId, startDate, endDate, (input.reason as string).trim(), currentActor()]
+      );
+      await recordRoomStatus(client, roomId, 'maintenance_scheduled', {
+        maintenanceBlockId: result.rows[0].id, startDate, endDate
+      });
+
+      logger.info('Room maintenance block created', { roomId, blockId: result.rows[0].id, startDate, endDate });
+      return toBlock(result.rows[0]);
+    }, { name: 'createMaintenanceBlock' });
+  }
+
+  async listBlocks(roomId: number): Promise<MaintenanceBlock[] | null> {
+    const client = await getClient();
+
+    try {
+      const room = await client.query('SELECT id FROM rooms WHERE id = $1', [roomId]);
+      if (room.rows.length === 0) {
+        return null;
+      }
+      const result = await client.query(
+        'SELECT * FROM room_maintenance_blocks WHERE room_id = $1 ORDER BY start_date, id',
+        [roomId]
+      );
+      return result.rows.map(toBlock);
+    } finally {
+      client.release();
+    }
+  }
+
+  // Puts the room back in service for the block's dates
+  async cancelBlock(roomId: number, blockId: number): Promise<MaintenanceBlock> {
+    return runInTransaction(async ({ client }) => {
+      const result = await client.query(
+        `UPDATE room_maintenance_blocks SET status = 'cancelled', cancelled_at = CURRENT_TIMESTAMP
+         WHERE id = $1 AND room_id = $2 AND status = 'active'
+         RETURNING *`,
+        [blockId, roomId]
+      );
+      if (result.rows.length === 0) {
+        throw new NotFoundError('Active maintenance block not found');
+      }
+      const block = toBlock(result.rows[0]);
+      await recordRoomStatus(client, roomId, 'maintenance_cancelled', {
+        maintenanceBlockId: blockId, startDate: block.start_date, endDate: block.end_date
+      });
+
+      logger.info('Room maintenance block cancelled', { roomId, blockId });
+      return block;
+    }, { name: 'cancelMaintenanceBlock' });
+  }
+}
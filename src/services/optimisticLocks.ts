@@ -0,0 +1,14 @@
+import { QueryResult } from 'pg';
+import { StaleVersionError } from '../utils/errors';
+
+// Bookings and receipts carry a version that every update bumps (version = version + 1) and checks
+// (AND version = <the version read>). This returns the row such an update changed; when it changed none,
+// another transaction updated the row since it was read and the caller gets a StaleVersionError.
+export function versionedRow<T = any>(
+  result: QueryResult, entity: StaleVersionError['entity'], id: number, expectedVersion: number
+): T {
+  if (result.rows.length === 0) {
+    throw new StaleVersionError(entity, id, expectedVersion);
+  }
+  return result.rows[0];
+}
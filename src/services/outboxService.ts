@@ -0,0 +1,89 @@
+import { PoolClient } from 'pg';
+import { runInTransaction } from './transactionManager';
+import { sagaConfig } from '../config/saga';
+import { logger } from '../utils/logger';
+import { metrics } from '../utils/metrics';
+import { OutboxMessage } from '../types';
+
+export type OutboxHandler = (payload: any) => Promise<void>;
+
+// Queues a message on the caller's client, so it is sent only if the caller's transaction commits
+export async function enqueueOutbox(client: PoolClient, topic: string, payload: Record<string, unknown>): Promise<number> {
+  const result = await client.query(
+    'INSERT INTO outbox_messages (topic, payload) VALUES ($1, $2) RETURNING id',
+    [topic, JSON.stringify(payload)]
+  );
+  return result.rows[0].id;
+}
+
+// Hands queued messages to their topic's handler, oldest first. Each message is claimed in a transaction of
+// its own that the handler's writes join, so they commit together with the message being marked sent; a
+// failing handler is rolled back and its message tried again after a doubling delay, until it is marked
+// failed. Delivery is at least once: handlers must cope with seeing a message again.
+export class OutboxService {
+  async relay(
+    handlers: Record<string, OutboxHandler>, limit: number = sagaConfig.outboxBatchSize
+  ): Promise<{ sent: number; failed: number }> {
+    let sent = 0;
+    let failed = 0;
+
+    for (let i = 0; i < limit; i++) {
+      const outcome = await runInTransaction(async ({ client }) => {
+        const due = await client.query(
+          `SELECT * FROM outbox_messages
+           WHERE processed_at IS NULL AND failed_at IS NULL AND available_at <= CURRENT_TIMESTAMP
+           ORDER BY id
+           LIMIT 1
+           FOR UPDATE SKIP LOCKED`
+        );
+        if (due.rows.length === 0) {
+          return null;
+        }
+
+        const message: OutboxMessage = due.rows[0];
+        try {
+          const handler = handlers[message.topic];
+          if (!handler) {
+            throw new Error(`No handler for topic ${message.topic}`);
+          }
+          await runInTransaction(() => handler(message.payload));
+          await client.query('UPDATE outbox_messages SET processed_at = CURRENT_TIMESTAMP WHERE id = $1', [message.id]);
+          return 'sent';
+        } catch (error) {
+          const attempts = message.attempts + 1;
+          const giveUp = attempts >= sagaConfig.outboxMaxAttempts;
+          const errorMessage = error instanceof Error ? error.message : String(error);
+          await client.query(
+            `UPDATE outbox_messages
+             SET attempts = $2, last_error = $3,
+                 available_at = CURRENT_TIMESTAMP + make_interval(secs => $4),
+                 failed_at = CASE WHEN $5 THEN CURRENT_TIMESTAMP END
+             WHERE id = $1`,
+            [message.id, attempts, errorMessage, sagaConfig.outboxRetryDelayMs * 2 ** (attempts - 1) / 1000, giveUp]
+          );
+          logger.warn('Outbox message not sent', {
+            messageId: message.id, topic: message.topic, attempts, giveUp, error: errorMessage
+          });
+          return 'failed';
+        }
+      }, { name: 'relayOutbox' });
+
+      if (outcome === null) {
+        break;
+      }
+      if (outcome === 'sent') {
+        sent++;
+      } else {
+        failed++;
+      }
+    }
+
+    if (sent > 0) {
+      metrics.increment('outbox.sent', sent);
+    }
+    if (failed > 0) {
+      metrics.increment('outbox.failed', failed);
+    }
+    return { sent, failed };
+  }
+}
@@ -0,0 +1,53 @@
+import { sagaConfig } from '../config/saga';
+import { logger } from '../utils/logger';
+import { PaymentWebhookService } from './paymentWebhookService';
+
+export interface ChargeRequest {
+  // The caller's own id for the charge, recorded as the payment's transaction_id before charging; webhooks name
+  // the charge by it, and charging the same reference again returns the first charge
+  reference: string;
+  amount: number;
+  paymentMethod: string;
+}
+
+// Stands in for a real payment gateway: a charge is accepted at once and settled later by a payment.succeeded or
+// payment.failed webhook (SIMULATED_GATEWAY_OUTCOME), delivered in-process after SIMULATED_GATEWAY_WEBHOOK_DELAY_MS.
+// With none no webhook comes, as when the gateway never answers.
+class SimulatedPaymentGateway {
+  private charges = new Map<string, string>();
+
+  async charge(request: ChargeRequest): Promise<{ transactionId: string }> {
+    const existing = this.charges.get(request.reference);
+    if (existing) {
+      return { transactionId: existing };
+    }
+
+    const transactionId = `TXN_${Date.now()}_${Math.random().toString(36).slice(2, 11)}`;
+    this.charges.set(request.reference, transactionId);
+    logger.info('Gateway charge requested', { ...request, transactionId });
+
+    if (sagaConfig.simulatedOutcome !== 'none') {
+      this.deliverWebhook(request.reference, sagaConfig.simulatedOutcome === 'succeed');
+    }
+    return { transactionId };
+  }
+
+  private deliverWebhook(reference: string, succeeded: boolean): void {
+    setTimeout(async () => {
+      try {
+        await new PaymentWebhookService().handleEvent({
+          id: `evt_${reference}`,
+          type: succeeded ? 'payment.succeeded' : 'payment.failed',
+          created: Math.floor(Date.now() / 1000),
+          data: { transactionId: reference, ...(succeeded ? {} : { failureReason: 'card_declined' }) }
+        });
+      } catch (error) {
+        logger.error('Simulated gateway webhook failed', {
+          reference, error: error instanceof Error ? error.message : String(error)
+        });
+      }
+    }, sagaConfig.simulatedWebhookDelayMs).unref();
+  }
+}
+
+export const paymentGateway = new SimulatedPaymentGateway();
@@ -0,0 +1,116 @@
+import { getClient } from '../config/database';
+import { PaymentMethodConfig, paymentMethods } from '../config/paymentMethods';
+import { logger } from '../utils/logger';
+import { ValidationError } from '../utils/errors';
+
+const CODE_PATTERN = /^[a-z][a-z0-9_]{1,49}$/;
+
+function toConfig(row: any): PaymentMethodConfig {
+  return {
+    code: row.code,
+    displayName: row.display_name,
+    enabled: row.enabled,
+    requiresGateway: row.requires_gateway,
+    supportsRefund: row.supports_refund,
+    minAmount: row.min_amount === null ? undefined : Number(row.min_amount),
+    maxAmount: row.max_amount === null ? undefined : Number(row.max_amount),
+    surchargePercent: Number(row.surcharge_percent)
+  };
+}
+
+const isOptionalAmount = (value: unknown) =>
+  value === undefined || (typeof value === 'number' && Number.isFinite(value) && value >= 0);
+
+// Payment methods changed through the admin API are stored and override the file/default configuration,
+// in this process right away and in others when they next start
+export class PaymentMethodService {
+  async loadStored(): Promise<number> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query('SELECT * FROM payment_methods ORDER BY code');
+      result.rows.forEach(row => paymentMethods.set(toConfig(row)));
+      logger.info('Stored payment methods loaded', { count: result.rows.length });
+      return result.rows.length;
+    } finally {
+      client.release();
+    }
+  }
+
+  async saveMethod(code: string, input: any): Promise<PaymentMethodConfig> {
+    const method = this.validateMethod(code, input ?? {});
+    const client = await getClient();
+
+    try {
+      const result = await client.query(
+        `INSERT INTO payment_methods
+           (code, display_name, enabled, requires_gateway, supports_refund, min_amount, max_amount, surcharge_percent)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+         ON CONFLICT (code) DO UPDATE
+         SET display_name = EXCLUDED.display_name, enabled = EXCLUDED.enabled,
+             requires_gateway = EXCLUDED.requires_gateway, supports_refund = EXCLUDED.supports_refund,
+             min_amount = EXCLUDED.min_amount, max_amount = EXCLUDED.max_amount,
+             surcharge_percent = EXCLUDED.surcharge_percent, updated_at = CURRENT_TIMESTAMP
+         RETURNING *`,
+        [method.code, method.displayName, method.enabled, method.requiresGateway, method.supportsRefund,
+          method.minAmount ?? null, method.maxAmount ?? null, method.surchargePercent ?? 0]
+      );
+
+      const saved = toConfig(result.rows[0]);
+      paymentMethods.set(saved);
+      logger.info('Payment method saved', { code: saved.code, enabled: saved.enabled, surchargePercent: saved.surchargePercent });
+      return saved;
+    } finally {
+      client.release();
+    }
+  }
+
+  // Fields left out keep their current value; a new method needs at least a displayName
+  private validateMethod(code: string, input: Record<string, unknown>): PaymentMethodConfig {
+    const current = paymentMethods.get(code);
+    const fields: Record<string, string> = {};
+
+    if (!CODE_PATTERN.test(code)) {
+      fields.code = 'must be lowercase letters, digits and underscores, starting with a letter';
+    }
+    const displayName = input.displayName ?? current?.displayName;
+    if (typeof displayName !== 'string' || displayName.trim() === '') {
+      fields.displayName = 'is required';
+    }
+    for (const key of ['enabled', 'requiresGateway', 'supportsRefund'] as const) {
+      if (input[key] !== undefined && typeof input[key] !== 'boolean') {
+        fields[key] = 'must be true or false';
+      }
+    }
+    for (const key of ['minAmount', 'maxAmount'] as const) {
+      if (input[key] !== null && !isOptionalAmount(input[key])) {
+        fields[key] = 'must be a non-negative number, or null for no limit';
+      }
+    }
+    if (input.surchargePercent !== undefined && (typeof input.surchargePercent !== 'number' ||
+      !Number.isFinite(input.surchargePercent) || input.surchargePercent < 0 || input.surchargePercent > 100)) {
+      fields.surchargePercent = 'must be a number from 0 to 100';
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid payment method', fields);
+    }
+
+    // null clears a limit, undefined keeps the current one
+    const limit = (key: 'minAmount' | 'maxAmount') =>
+      input[key] === null ? undefined : (input[key] as number | undefined) ?? current?.[key];
+    const method: PaymentMethodConfig = {
+      code,
+      displayName: (displayName as string).trim(),
+      enabled: (input.enabled as boolean | undefined) ?? current?.enabled ?? true,
+      requiresGateway: (input.requiresGateway as boolean | undefined) ?? current?.requiresGateway ?? true,
+      supportsRefund: (input.supportsRefund as boolean | undefined) ?? current?.supportsRefund ?? true,
+      minAmount: limit('minAmount'),
+      maxAmount: limit('maxAmount'),
+      surchargePercent: (input.surchargePercent as number | undefined) ?? current?.surchargePercent ?? 0
+    };
+    if (method.minAmount !== undefined && method.maxAmount !== undefined && method.minAmount > method.maxAmount) {
+      throw new ValidationError('Invalid payment method', { minAmount: 'cannot be above maxAmount' });
+    }
+    return method;
+  }
+}
@@ -0,0 +1,189 @@
+import { PoolClient } from 'pg';
+import { getClient } from '../config/database';
+import { runInTransactionWithRetry } from './transactionManager';
+import { assertNotDisputed } from './disputeService';
+import { bookingConfig } from '../config/booking';
+import { paymentMethods } from '../config/paymentMethods';
+import { logger } from '../utils/logger';
+import { eventBus } from '../events/eventBus';
+import { BookingStateError, ConflictError, NotFoundError, ValidationError } from '../utils/errors';
+import { addDays, formatDate, today } from '../utils/date';
+import { Installment, Payment, PaymentPlan, Receipt } from '../types';
+
+const roundMoney = (amount: number) => Math.round(amount * 100) / 100;
+
+const toInstallment = (row: any): Installment => ({ ...row, amount: Number(row.amount) });
+
+// Splits what a booking owes into installments due every installmentIntervalDays, the first one today.
+// Each installment is paid like any other charge (a payment and its receipt); overdue ones are flagged
+// by the installment monitor, which can cancel the booking once the grace period is over.
+export class PaymentPlanService {
+  // Equal shares with the rounding remainder on the last; every due date must be on or before check-in
+  schedule(amount: number, count: number, checkInDate: string): { sequence: number; amount: number; dueDate: string }[] {
+    const share = Math.floor(amount / count * 100) / 100;
+    const lastDue = addDays(today(), (count - 1) * bookingConfig.installmentIntervalDays);
+    if (lastDue > checkInDate) {
+      throw new ValidationError('Invalid booking request', {
+        installments: `the last installment would be due ${lastDue}, after check-in; use fewer installments`
+      });
+    }
+
+    return Array.from({ length: count }, (_, i) => ({
+      sequence: i + 1,
+      amount: i === count - 1 ? roundMoney(amount - share * (count - 1)) : share,
+      dueDate: addDays(today(), i * bookingConfig.installmentIntervalDays)
+    }));
+  }
+
+  // Records the plan in the booking's transaction; the first installment is marked paid by firstPaymentId
+  async createPlan(
+    client: PoolClient, bookingId: number, schedule: { sequence: number; amount: number; dueDate: string }[],
+    firstPaymentId: number
+  ): Promise<void> {
+    for (const installment of schedule) {
+      const paid = installment.sequence === 1;
+      await client.query(
+        `INSERT INTO installments (booking_id, sequence, amount, due_date, status, payment_id, paid_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+        [bookingId, installment.sequence, installment.amount, installment.dueDate, paid ? 'paid' : 'due',
+          paid ? firstPaymentId : null, paid ? new Date() : null]
+      );
+    }
+    logger.info('Payment plan created', { bookingId, installments: schedule.length });
+  }
+
+  // Null when the booking does not exist; a booking paid in full up front has no installments
+  async getPlan(bookingId: number): Promise<PaymentPlan | null> {
+    const client = await getClient();
+
+    try {
+      const booking = await client.query('SELECT id, status, total_amount FROM bookings WHERE id = $1', [bookingId]);
+      if (booking.rows.length === 0) {
+        return null;
+      }
+      const installments = await client.query(
+        'SELECT * FROM installments WHERE booking_id = $1 ORDER BY sequence',
+        [bookingId]
+      );
+      const paid = await client.query(
+        `SELECT COALESCE(SUM(amount - surcharge_amount), 0) AS paid
+         FROM payments WHERE booking_id = $1 AND status = 'completed'`,
+        [bookingId]
+      );
+
+      const rows = installments.rows.map(toInstallment);
+      const total = Number(booking.rows[0].total_amount);
+      const paidAmount = Number(paid.rows[0].paid);
+      const next = rows.find(row => row.status === 'due' || row.status === 'overdue');
+      const status = booking.rows[0].status === 'cancelled' ? 'cancelled'
+        : rows.some(row => row.status === 'overdue') ? 'overdue'
+          : next ? 'active' : 'completed';
+
+      return {
+        bookingId,
+        status,
+        total,
+        paid: paidAmount,
+        outstanding: Math.max(0, roundMoney(total - paidAmount)),
+        nextDue: next ? { sequence: next.sequence, amount: next.amount, dueDate: formatDate(next.due_date) } : null,
+        installments: rows
+      };
+    } finally {
+      client.release();
+    }
+  }
+
+  // Pays the next open installment with the given method (payment and receipt in one transaction)
+  async payNextInstallment(bookingId: number, paymentMethod: unknown): Promise<{ installment: Installment; payment: Payment; receipt: Receipt }> {
+    if (typeof paymentMethod !== 'string' || paymentMethod.trim() === '') {
+      throw new ValidationError('Invalid installment payment', { paymentMethod: 'is required' });
+    }
+    const method: string = paymentMethod;
+
+    return runInTransactionWithRetry(async ({ client, afterCommit }) => {
+      const booking = await client.query('SELECT id, status FROM bookings WHERE id = $1 FOR UPDATE', [bookingId]);
+      if (booking.rows.length === 0) {
+        throw new NotFoundError('Booking not found');
+      }
+      if (booking.rows[0].status === 'cancelled') {
+        throw new BookingStateError('Cannot pay an installment of a cancelled booking', 'INVALID_TRANSITION', 'cancelled');
+      }
+      await assertNotDisputed(client, bookingId, booking.rows[0].status);
+
+      const open = await client.query(
+        `SELECT * FROM installments
+         WHERE booking_id = $1 AND status IN ('due', 'overdue')
+         ORDER BY sequence LIMIT 1`,
+        [bookingId]
+      );
+      if (open.rows.length === 0) {
+        throw new ConflictError('Booking has no open installments');
+      }
+      const installment = toInstallment(open.rows[0]);
+      const methodError = paymentMethods.validate(method, installment.amount);
+      if (methodError) {
+        throw new ValidationError('Invalid installment payment', { paymentMethod: methodError });
+      }
+
+      const surcharge = paymentMethods.surchargeFor(method, installment.amount);
+      const charged = roundMoney(installment.amount + surcharge);
+      const payment = await client.query(
+        `INSERT INTO payments (booking_id, amount, payment_method, status, transaction_id, surcharge_amount)
+         VALUES ($1, $2, $3, 'completed', $4, $5)
+         RETURNING *`,
+        [bookingId, charged, method, `TXN_${Date.now()}_${Math.random().toString(36).slice(2, 11)}`, surcharge]
+      );
+      const receipt = await client.query(
+        `INSERT INTO receipts
+           (booking_id, payment_id, receipt_number, total_amount, surcharge_amount, payment_method, gateway_reference, email_status)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, 'pending')
+         RETURNING *`,
+        [bookingId, payment.rows[0].id, `RCP_${Date.now()}_${Math.random().toString(36).slice(2, 8)}`, charged, surcharge,
+          method, payment.rows[0].transaction_id]
+      );
+      const paid = await client.query(
+        `UPDATE installments SET status = 'paid', payment_id = $1, paid_at = CURRENT_TIMESTAMP
+         WHERE id = $2
+         RETURNING *`,
+        [payment.rows[0].id, installment.id]
+      );
+
+      afterCommit(() => {
+        eventBus.publish('receipt.issued', { receiptId: receipt.rows[0].id, bookingId });
+      });
+      logger.info('Installment paid', { bookingId, sequence: installment.sequence, amount: installment.amount });
+      return { installment: toInstallment(paid.rows[0]), payment: payment.rows[0], receipt: receipt.rows[0] };
+    }, { name: 'payInstallment' });
+  }
+
+  // Open installments of a cancelled booking are not owed any more
+  async cancelOpenInstallments(client: PoolClient, bookingId: number): Promise<void> {
+    await client.query(
+      `UPDATE installments SET status = 'cancelled' WHERE booking_id = $1 AND status IN ('due', 'overdue')`,
+      [bookingId]
+    );
+  }
+
+  // Flags installments past their due date and returns the bookings whose oldest overdue installment
+  // is past the grace period (still active ones only)
+  async markOverdue(): Promise<{ overdue: number; pastGrace: number[] }> {
+    const client = await getClient();
+
+    try {
+      const overdue = await client.query(
+        `UPDATE installments SET status = 'overdue' WHERE status = 'due' AND due_date < CURRENT_DATE`
+      );
+      const pastGrace = await client.query(
+        `SELECT DISTINCT i.booking_id FROM installments i
+         JOIN bookings b ON b.id = i.booking_id
+         WHERE i.status = 'overdue' AND i.due_date < CURRENT_DATE - $1::int
+           AND b.status IN ('pending', 'confirmed')
+         ORDER BY i.booking_id`,
+        [bookingConfig.installmentGraceDays]
+      );
+      return { overdue: overdue.rowCount ?? 0, pastGrace: pastGrace.rows.map(row => row.booking_id) };
+    } finally {
+      client.release();
+    }
+  }
+}
@@ -0,0 +1,158 @@
+import { PoolClient } from 'pg';
+import { runInTransaction } from './transactionManager';
+import { logger } from '../utils/logger';
+import { metrics } from '../utils/metrics';
+import { ValidationError } from '../utils/errors';
+import { RefundService } from './refundService';
+import { settleSagaPayment } from './bookingSagaService';
+import { Payment, Refund } from '../types';
+
+export interface PaymentWebhookEvent {
+  id: string;
+  type: string;
+  // Unix seconds at which the gateway produced the event; used to order events that arrive out of order
+  created: number;
+  // For refund events transactionId is the refund's refund_reference
+  data: { transactionId: string; failureReason?: string };
+}
+
+export type WebhookOutcome = 'applied' | 'duplicate' | 'stale' | 'ignored' | 'unmatched';
+
+const EVENT_STATUSES: Record<string, Payment['status']> = {
+  'payment.succeeded': 'completed',
+  'payment.failed': 'failed',
+  'payment.refunded': 'refunded'
+};
+
+const REFUND_EVENT_STATUSES: Record<string, 'settled' | 'failed'> = {
+  'refund.settled': 'settled',
+  'refund.failed': 'failed'
+};
+
+// Moves a payment may make; refunded is final
+const PAYMENT_TRANSITIONS: Record<Payment['status'], Payment['status'][]> = {
+  pending: ['completed', 'failed'],
+  failed: ['completed'],
+  completed: ['refunded'],
+  refunded: []
+};
+
+export interface WebhookResult {
+  outcome: WebhookOutcome;
+  payment: Payment | null;
+  refund: Refund | null;
+}
+
+export class PaymentWebhookService {
+  private refundService = new RefundService();
+
+  // Each event id is applied at most once, and an event older than the last one applied to the payment (or
+  // refund) is dropped, so retried and reordered deliveries leave it in the state of the newest event. An event
+  // for a transaction not (yet) known is not recorded, so the gateway's retry of it is applied once it is.
+  async handleEvent(event: PaymentWebhookEvent): Promise<WebhookResult> {
+    this.validateEvent(event);
+    const to = EVENT_STATUSES[event.type];
+
+    const result = await runInTransaction(async ({ client }): Promise<WebhookResult> => {
+      const recorded = await client.query(
+        `INSERT INTO payment_webhook_events (event_id, type, transaction_id, event_created_at)
+         VALUES ($1, $2, $3, to_timestamp($4))
+         ON CONFLICT (event_id) DO NOTHING
+         RETURNING event_id`,
+        [event.id, event.type, event.data.transactionId, event.created]
+      );
+      if (recorded.rows.length === 0) {
+        return { outcome: 'duplicate' as WebhookOutcome, payment: null, refund: null };
+      }
+
+      const refundStatus = REFUND_EVENT_STATUSES[event.type];
+      if (refundStatus) {
+        const { outcome, refund } = await this.refundService.applyGatewayEvent(
+          client, event.data.transactionId, refundStatus, event.created, event.data.failureReason
+        );
+        if (outcome === 'unmatched') {
+          await this.forgetEvent(client, event.id);
+        } else {
+          await this.recordOutcome(client, event.id, null, outcome, refund?.id ?? null);
+        }
+        return { outcome, payment: null, refund };
+      }
+
+      // Compared in the database so both timestamps are read in the same time zone
+      const found = await client.query(
+        `SELECT *, (gateway_event_at >= to_timestamp($2)) IS TRUE AS superseded
+         FROM payments WHERE transaction_id = $1 FOR UPDATE`,
+        [event.data.transactionId, event.created]
+      );
+      if (found.rows.length === 0) {
+        await this.forgetEvent(client, event.id);
+        return { outcome: 'unmatched' as WebhookOutcome, payment: null, refund: null };
+      }
+
+      const { superseded, ...current } = found.rows[0];
+      let payment: Payment = current;
+      let outcome: WebhookOutcome;
+      if (superseded) {
+        outcome = 'stale';
+      } else if (!PAYMENT_TRANSITIONS[payment.status].includes(to)) {
+        outcome = 'ignored';
+      } else {
+        const updated = await client.query(
+          `UPDATE payments SET status = $1, gateway_event_at = to_timestamp($2), updated_at = CURRENT_TIMESTAMP
+           WHERE id = $3
+           RETURNING *`,
+          [to, event.created, payment.id]
+        );
+        payment = updated.rows[0];
+        outcome = 'applied';
+        await settleSagaPayment(payment, event.data.failureReason);
+      }
+
+      await this.recordOutcome(client, event.id, payment.id, outcome);
+      return { outcome, payment, refund: null };
+    }, { name: 'paymentWebhook' });
+
+    metrics.increment(`webhooks.payments.${result.outcome}`);
+    logger.info('Payment webhook handled', {
+      eventId: event.id, type: event.type, transactionId: event.data.transactionId, outcome: result.outcome
+    });
+    return result;
+  }
+
+  private async recordOutcome(
+    client: PoolClient, eventId: string, paymentId: number | null, outcome: WebhookOutcome, refundId: number | null = null
+  ) {
+    await client.query(
+      'UPDATE payment_webhook_events SET payment_id = $1, refund_id = $2, outcome = $3 WHERE event_id = $4',
+      [paymentId, refundId, outcome, eventId]
+    );
+  }
+
+  private async forgetEvent(client: PoolClient, eventId: string) {
+    await client.query('DELETE FROM payment_webhook_events WHERE event_id = $1', [eventId]);
+  }
+
+  private validateEvent(event: PaymentWebhookEvent): void {
+    const fields: Record<string, string> = {};
+
+    if (typeof event?.id !== 'string' || event.id.trim() === '') {
+      fields.id = 'is required';
+    }
+    if (!EVENT_STATUSES[event?.type] && !REFUND_EVENT_STATUSES[event?.type]) {
+      fields.type = `must be one of: ${[...Object.keys(EVENT_STATUSES), ...Object.keys(REFUND_EVENT_STATUSES)].join(', ')}`;
+    }
+    if (!Number.isInteger(event?.created) || event.created <= 0) {
+      fields.created = 'must be a unix timestamp in seconds';
+    }
+    if (typeof event?.data?.transactionId !== 'string' || event.data.transactionId.trim() === '') {
+      fields['data.transactionId'] = 'is required';
+    }
+    if (event?.data?.failureReason !== undefined && typeof event.data.failureReason !== 'string') {
+      fields['data.failureReason'] = 'must be a string';
+    }
+
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid webhook event', fields);
+    }
+  }
+}
@@ -0,0 +1,60 @@
+import { bookingConfig } from '../config/booking';
+import { addDays, nightsBetween } from '../utils/date';
+import { NightlyRate, PriceBreakdown, StayDiscount } from '../types';
+
+const roundMoney = (amount: number) => Math.round(amount * 100) / 100;
+
+// Rate plan adjustments to the base rate, keyed by night (see RatePlanService)
+export type RateAdjustments = Map<string, NightlyRate['adjustments']>;
+
+export class PricingService {
+  // Itemizes a stay night by night; the booking total is always the sum of these lines.
+  // Rate plan adjustments come first; a discount is then taken off the adjusted rate before tax: a percentage
+  // from every night, a fixed amount spread over the nights.
+  priceStay(
+    pricePerNight: number, checkInDate: string, checkOutDate: string, discount?: StayDiscount, rates?: RateAdjustments
+  ): PriceBreakdown {
+    const baseRate = Number(pricePerNight);
+    const nights: NightlyRate[] = [];
+    const nightCount = nightsBetween(checkInDate, checkOutDate);
+    let fixedDiscountLeft = discount?.type === 'fixed' ? discount.value : 0;
+
+    for (let i = 0; i < nightCount; i++) {
+      const date = addDays(checkInDate, i);
+      const adjustments: NightlyRate['adjustments'] = [...(rates?.get(date) ?? [])];
+      const rate = roundMoney(baseRate + adjustments.reduce((sum, adjustment) => sum + adjustment.amount, 0));
+      if (discount) {
+        let amount: number;
+        if (discount.type === 'percentage') {
+          amount = roundMoney(rate * discount.value / 100);
+        } else {
+          // Even shares with the rounding remainder on the last night, never more than what is left
+          const share = i === nightCount - 1 ? fixedDiscountLeft : roundMoney(discount.value / nightCount);
+          amount = Math.min(share, fixedDiscountLeft, rate);
+          fixedDiscountLeft = roundMoney(fixedDiscountLeft - amount);
+        }
+        adjustments.push({ reason: `promo:${discount.code}`, amount: -Math.min(amount, rate) });
+      }
+      const net = baseRate + adjustments.reduce((sum, adjustment) => sum + adjustment.amount, 0);
+      const taxes = roundMoney(net * bookingConfig.taxRate);
+
+      nights.push({
+        date,
+        baseRate,
+        adjustments,
+        taxes,
+        total: roundMoney(net + taxes)
+      });
+    }
+
+    const taxes = roundMoney(nights.reduce((sum, night) => sum + night.taxes, 0));
+    const total = roundMoney(nights.reduce((sum, night) => sum + night.total, 0));
+
+    return {
+      nights,
+      subtotal: roundMoney(total - taxes),
+      taxes,
+      total
+    };
+  }
+}
@@ -0,0 +1,166 @@
+import { PoolClient } from 'pg';
+import { getClient } from '../config/database';
+import { logger } from '../utils/logger';
+import { ConflictError, ValidationError } from '../utils/errors';
+import { isUniqueViolation } from '../utils/pgErrors';
+import { formatDate, isValidDateString } from '../utils/date';
+import { PromoCode, StayDiscount } from '../types';
+
+export interface PromoCodeInput {
+  code?: unknown;
+  discountType?: unknown;
+  discountValue?: unknown;
+  validFrom?: unknown;
+  validUntil?: unknown;
+  usageLimit?: unknown;
+  roomTypes?: unknown;
+}
+
+const CODE_PATTERN = /^[A-Z0-9_-]{3,30}$/;
+
+function toPromoCode(row: any): PromoCode {
+  return { ...row, discount_value: Number(row.discount_value) };
+}
+
+export function toStayDiscount(promo: PromoCode): StayDiscount {
+  return { code: promo.code, type: promo.discount_type, value: Number(promo.discount_value) };
+}
+
+export class PromoCodeService {
+  async createPromoCode(input: PromoCodeInput): Promise<PromoCode> {
+    const values = this.validatePromoCode(input);
+    const client = await getClient();
+
+    try {
+      const result = await client.query(
+        `INSERT INTO promo_codes (code, discount_type, discount_value, valid_from, valid_until, usage_limit, room_types)
+         VALUES ($1, $2, $3, $4, $5, $6, $7)
+         RETURNING *`,
+        [values.code, values.discountType, values.discountValue, values.validFrom, values.validUntil,
+          values.usageLimit, values.roomTypes]
+      );
+
+      logger.info('Promo code created', { code: values.code });
+      return toPromoCode(result.rows[0]);
+    } catch (error) {
+      if (isUniqueViolation(error)) {
+        throw new ConflictError('A promo code with this code already exists');
+      }
+      throw error;
+    } finally {
+      client.release();
+    }
+  }
+
+  async listPromoCodes(): Promise<PromoCode[]> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query('SELECT * FROM promo_codes ORDER BY created_at DESC, id DESC');
+      return result.rows.map(toPromoCode);
+    } finally {
+      client.release();
+    }
+  }
+
+  // Counts one use of the code inside the caller's transaction. The checks and the increment are a single
+  // UPDATE, so concurrent redemptions of a code with one use left cannot both succeed.
+  async redeem(client: PoolClient, code: string, roomType: string): Promise<PromoCode> {
+    const result = await client.query(
+      `UPDATE promo_codes SET times_used = times_used + 1
+       WHERE code = $1 AND active AND CURRENT_DATE BETWEEN valid_from AND valid_until
+         AND (usage_limit IS NULL OR times_used < usage_limit)
+         AND (room_types IS NULL OR $2 = ANY(room_types))
+       RETURNING *`,
+      [code.trim().toUpperCase(), roomType]
+    );
+
+    if (result.rows.length === 0) {
+      throw await this.rejection(client, code, roomType);
+    }
+    return toPromoCode(result.rows[0]);
+  }
+
+  // Same checks as redeem without using the code up (for quotes)
+  async check(client: PoolClient, code: string, roomType: string): Promise<PromoCode> {
+    const result = await client.query(
+      `SELECT * FROM promo_codes
+       WHERE code = $1 AND active AND CURRENT_DATE BETWEEN valid_from AND valid_until
+         AND (usage_limit IS NULL OR times_used < usage_limit)
+         AND (room_types IS NULL OR $2 = ANY(room_types))`,
+      [code.trim().toUpperCase(), roomType]
+    );
+
+    if (result.rows.length === 0) {
+      throw await this.rejection(client, code, roomType);
+    }
+    return toPromoCode(result.rows[0]);
+  }
+
+  // Says which rule the code failed, for the client
+  private async rejection(client: PoolClient, code: string, roomType: string): Promise<ValidationError> {
+    const result = await client.query(
+      `SELECT *, CURRENT_DATE BETWEEN valid_from AND valid_until AS in_window FROM promo_codes WHERE code = $1`,
+      [code.trim().toUpperCase()]
+    );
+    const promo = result.rows[0];
+
+    let reason = 'is not a valid promo code';
+    if (promo?.active && !promo.in_window) {
+      reason = `is only valid from ${formatDate(promo.valid_from)} to ${formatDate(promo.valid_until)}`;
+    } else if (promo?.active && promo.usage_limit !== null && promo.times_used >= promo.usage_limit) {
+      reason = 'has been fully redeemed';
+    } else if (promo?.active && promo.room_types && !promo.room_types.includes(roomType)) {
+      reason = `only applies to ${promo.room_types.join(', ')} rooms`;
+    }
+    return new ValidationError('Invalid promo code', { promoCode: reason });
+  }
+
+  private validatePromoCode(input: PromoCodeInput) {
+    const fields: Record<string, string> = {};
+    const code = typeof input?.code === 'string' ? input.code.trim().toUpperCase() : '';
+
+    if (!CODE_PATTERN.test(code)) {
+      fields.code = 'must be 3-30 letters, digits, dashes or underscores';
+    }
+    if (input?.discountType !== 'percentage' && input?.discountType !== 'fixed') {
+      fields.discountType = 'must be percentage or fixed';
+    }
+    const value = input?.discountValue;
+    if (typeof value !== 'number' || !(value > 0) || (input.discountType === 'percentage' && value > 100)) {
+      fields.discountValue = input?.discountType === 'percentage'
+        ? 'must be a number above 0 and at most 100'
+        : 'must be a positive number';
+    }
+    if (!isValidDateString(input?.validFrom)) {
+      fields.validFrom = 'must be a date in YYYY-MM-DD format';
+    }
+    if (!isValidDateString(input?.validUntil)) {
+      fields.validUntil = 'must be a date in YYYY-MM-DD format';
+    } else if (!fields.validFrom && (input.validUntil as string) < (input.validFrom as string)) {
+      fields.validUntil = 'must not be before validFrom';
+    }
+    if (input?.usageLimit !== undefined && input.usageLimit !== null &&
+      (!Number.isInteger(input.usageLimit) || (input.usageLimit as number) < 1)) {
+      fields.usageLimit = 'must be a positive integer or null';
+    }
+    if (input?.roomTypes !== undefined && input.roomTypes !== null &&
+      (!Array.isArray(input.roomTypes) || input.roomTypes.length === 0 ||
+        input.roomTypes.some(roomType => typeof roomType !== 'string' || roomType.trim() === ''))) {
+      fields.roomTypes = 'must be a non-empty list of room types or null';
+    }
+
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid promo code', fields);
+    }
+    return {
+      code,
+      discountType: input.discountType as 'percentage' | 'fixed',
+      discountValue: value as number,
+      validFrom: input.validFrom as string,
+      validUntil: input.validUntil as string,
+      usageLimit: (input.usageLimit as number | undefined) ?? null,
+      roomTypes: (input.roomTypes as string[] | undefined)?.map(roomType => roomType.trim()) ?? null
+    };
+  }
+}
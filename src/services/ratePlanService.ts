@@ -0,0 +1,258 @@
+import { PoolClient } from 'pg';
+import { getClient } from '../config/database';
+import { ROOM_HOLDING_STATUSES } from './bookingStateService';
+import { RateAdjustments } from './pricingService';
+import { logger } from '../utils/logger';
+import { NotFoundError, ValidationError } from '../utils/errors';
+import { addDays, formatDate, isValidDateString } from '../utils/date';
+import { NightlyRate, OccupancyTier, RatePlan, RateSeason } from '../types';
+
+const roundMoney = (amount: number) => Math.round(amount * 100) / 100;
+
+// Friday and Saturday nights
+const WEEKEND_DAYS = [5, 6];
+
+const isMultiplier = (value: unknown): value is number =>
+  typeof value === 'number' && Number.isFinite(value) && value > 0 && value <= 10;
+
+function toSeason(row: any): RateSeason {
+  return {
+    ...row,
+    start_date: formatDate(row.start_date),
+    end_date: formatDate(row.end_date),
+    price_per_night: row.price_per_night === null ? null : Number(row.price_per_night),
+    multiplier: row.multiplier === null ? null : Number(row.multiplier)
+  };
+}
+
+// Dynamic nightly rates per room type: seasonal date-range overrides, a weekend multiplier and occupancy tiers.
+// A room type without a plan is priced at its rooms' price_per_night as before.
+export class RatePlanService {
+  async listPlans(): Promise<RatePlan[]> {
+    const client = await getClient();
+
+    try {
+      const plans = await client.query('SELECT * FROM rate_plans ORDER BY room_type');
+      const seasons = await client.query('SELECT * FROM rate_seasons ORDER BY room_type, start_date, id');
+      const roomTypes = new Set<string>([
+        ...plans.rows.map(row => row.room_type), ...seasons.rows.map(row => row.room_type)
+      ]);
+
+      return Array.from(roomTypes).sort().map(roomType => this.toPlan(
+        roomType,
+        plans.rows.find(row => row.room_type === roomType),
+        seasons.rows.filter(row => row.room_type === roomType)
+      ));
+    } finally {
+      client.release();
+    }
+  }
+
+  // Fields left out keep their current value
+  async savePlan(roomType: string, input: { weekendMultiplier?: unknown; occupancyTiers?: unknown }): Promise<RatePlan> {
+    const fields: Record<string, string> = {};
+    if (input?.weekendMultiplier !== undefined && !isMultiplier(input.weekendMultiplier)) {
+      fields.weekendMultiplier = 'must be a number above 0 and at most 10';
+    }
+    if (input?.occupancyTiers !== undefined) {
+      const tiers = input.occupancyTiers;
+      if (!Array.isArray(tiers)) {
+        fields.occupancyTiers = 'must be an array of { minOccupancyPercent, multiplier }';
+      } else {
+        tiers.forEach((tier: any, index) => {
+          if (typeof tier?.minOccupancyPercent !== 'number' || tier.minOccupancyPercent < 0 || tier.minOccupancyPercent > 100) {
+            fields[`occupancyTiers[${index}].minOccupancyPercent`] = 'must be a number from 0 to 100';
+          }
+          if (!isMultiplier(tier?.multiplier)) {
+            fields[`occupancyTiers[${index}].multiplier`] = 'must be a number above 0 and at most 10';
+          }
+        });
+      }
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid rate plan', fields);
+    }
+
+    const client = await getClient();
+
+    try {
+      await this.assertRoomType(client, roomType);
+      const tiers = (input.occupancyTiers as OccupancyTier[] | undefined)
+        ?.map(tier => ({ minOccupancyPercent: tier.minOccupancyPercent, multiplier: tier.multiplier }))
+        .sort((a, b) => a.minOccupancyPercent - b.minOccupancyPercent);
+
+      await client.query(
+        `INSERT INTO rate_plans (room_type, weekend_multiplier, occupancy_tiers)
+         VALUES ($1, COALESCE($2, 1), COALESCE($3::jsonb, '[]'::jsonb))
+         ON CONFLICT (room_type) DO UPDATE
+         SET weekend_multiplier = COALESCE($2, rate_plans.weekend_multiplier),
+             occupancy_tiers = COALESCE($3::jsonb, rate_plans.occupancy_tiers),
+             updated_at = CURRENT_TIMESTAMP`,
+        [roomType, input.weekendMultiplier ?? null, tiers ? JSON.stringify(tiers) : null]
+      );
+
+      const plan = await this.loadPlan(client, roomType);
+      logger.info('Rate plan saved', { roomType, weekendMultiplier: plan.weekendMultiplier, tiers: plan.occupancyTiers.length });
+      return plan;
+    } finally {
+      client.release();
+    }
+  }
+
+  // A season sets either a fixed nightly price or a multiplier of the base rate for the nights it covers
+  async addSeason(roomType: string, input: {
+    name?: unknown; startDate?: unknown; endDate?: unknown; pricePerNight?: unknown; multiplier?: unknown
+  }): Promise<RateSeason> {
+    const fields: Record<string, string> = {};
+    if (typeof input?.name !== 'string' || input.name.trim() === '' || input.name.trim().length > 100) {
+      fields.name = 'is required (at most 100 characters)';
+    }
+    if (!isValidDateString(input?.startDate)) {
+      fields.startDate = 'must be a date in YYYY-MM-DD format';
+    }
+    if (!isValidDateString(input?.endDate)) {
+      fields.endDate = 'must be a date in YYYY-MM-DD format';
+    } else if (isValidDateString(input.startDate) && input.endDate < input.startDate) {
+      fields.endDate = 'must not be before startDate';
+    }
+    if ((input?.pricePerNight === undefined) === (input?.multiplier === undefined)) {
+      fields.pricePerNight = 'give either pricePerNight or multiplier';
+    } else if (input.pricePerNight !== undefined &&
+      (typeof input.pricePerNight !== 'number' || !Number.isFinite(input.pricePerNight) || input.pricePerNight <= 0)) {
+      fields.pricePerNight = 'must be a positive number';
+    } else if (input.multiplier !== undefined && !isMultiplier(input.multiplier)) {
+      fields.multiplier = 'must be a number above 0 and at most 10';
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid rate season', fields);
+    }
+
+    const client = await getClient();
+
+    try {
+      await this.assertRoomType(client, roomType);
+      const result = await client.query(
+        `INSERT INTO rate_seasons (room_type, name, start_date, end_date, price_per_night, multiplier)
+         VALUES ($1, $2, $3, $4, $5, $6)
+         RETURNING *`,
+        [roomType, (input.name as string).trim(), input.startDate, input.endDate,
+          input.pricePerNight === undefined ? null : roundMoney(input.pricePerNight as number), input.multiplier ?? null]
+      );
+
+      logger.info('Rate season added', { roomType, seasonId: result.rows[0].id, startDate: input.startDate, endDate: input.endDate });
+      return toSeason(result.rows[0]);
+    } finally {
+      client.release();
+    }
+  }
+
+  async removeSeason(seasonId: number): Promise<void> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query('DELETE FROM rate_seasons WHERE id = $1', [seasonId]);
+      if (result.rowCount === 0) {
+        throw new NotFoundError('Rate season not found');
+      }
+      logger.info('Rate season removed', { seasonId });
+    } finally {
+      client.release();
+    }
+  }
+
+  // The plan's adjustments for each night of a stay, to pass to PricingService.priceStay. Occupancy counts
+  // the room type's other bookings that night; excludeBookingId leaves out the booking being repriced.
+  async adjustmentsFor(
+    client: PoolClient, roomType: string, pricePerNight: number, checkInDate: string, checkOutDate: string,
+    excludeBookingId?: number
+  ): Promise<RateAdjustments> {
+    const plan = await this.loadPlan(client, roomType);
+    const adjustments: RateAdjustments = new Map();
+    if (plan.seasons.length === 0 && plan.weekendMultiplier === 1 && plan.occupancyTiers.length === 0) {
+      return adjustments;
+    }
+
+    const occupancy = plan.occupancyTiers.length > 0
+      ? await this.occupancyByNight(client, roomType, checkInDate, checkOutDate, excludeBookingId ?? null)
+      : new Map<string, number>();
+    const baseRate = Number(pricePerNight);
+
+    for (let date = checkInDate; date < checkOutDate; date = addDays(date, 1)) {
+      const night: NightlyRate['adjustments'] = [];
+      let rate = baseRate;
+      const adjust = (reason: string, newRate: number) => {
+        const amount = roundMoney(newRate - rate);
+        if (amount !== 0) {
+          night.push({ reason, amount });
+          rate = roundMoney(rate + amount);
+        }
+      };
+
+      // Seasons are listed latest start first, so an event inside a longer season wins
+      const season = plan.seasons.find(season => season.start_date <= date && season.end_date >= date);
+      if (season) {
+        adjust(`season:${season.name}`, season.price_per_night ?? rate * season.multiplier!);
+      }
+      if (WEEKEND_DAYS.includes(new Date(`${date}T00:00:00Z`).getUTCDay())) {
+        adjust('weekend', rate * plan.weekendMultiplier);
+      }
+      const percent = occupancy.get(date) ?? 0;
+      const tier = plan.occupancyTiers.filter(tier => tier.minOccupancyPercent <= percent).pop();
+      if (tier) {
+        adjust(`occupancy:${tier.minOccupancyPercent}%`, rate * tier.multiplier);
+      }
+
+      if (night.length > 0) {
+        adjustments.set(date, night);
+      }
+    }
+    return adjustments;
+  }
+
+  private async loadPlan(client: PoolClient, roomType: string): Promise<RatePlan> {
+    const plan = await client.query('SELECT * FROM rate_plans WHERE room_type = $1', [roomType]);
+    const seasons = await client.query(
+      'SELECT * FROM rate_seasons WHERE room_type = $1 ORDER BY start_date DESC, id DESC',
+      [roomType]
+    );
+    return this.toPlan(roomType, plan.rows[0], seasons.rows);
+  }
+
+  private toPlan(roomType: string, row: any | undefined, seasonRows: any[]): RatePlan {
+    return {
+      roomType,
+      weekendMultiplier: row ? Number(row.weekend_multiplier) : 1,
+      occupancyTiers: row?.occupancy_tiers ?? [],
+      seasons: seasonRows.map(toSeason)
+    };
+  }
+
+  // Percentage of the room type's bookable rooms held by bookings on each night of the stay
+  private async occupancyByNight(
+    client: PoolClient, roomType: string, checkInDate: string, checkOutDate: string, excludeBookingId: number | null
+  ): Promise<Map<string, number>> {
+    const result = await client.query(
+      `SELECT to_char(n.night, 'YYYY-MM-DD') AS night,
+              COUNT(b.id) AS booked,
+              (SELECT COUNT(*) FROM rooms WHERE room_type = $1 AND retired_at IS NULL AND NOT is_sandbox) AS rooms
+       FROM generate_series($2::date, $3::date - 1, interval '1 day') AS n(night)
+       LEFT JOIN bookings b
+         ON b.check_in_date <= n.night AND b.check_out_date > n.night
+        AND b.status = ANY($4) AND b.id IS DISTINCT FROM $5
+        AND b.room_id IN (SELECT id FROM rooms WHERE room_type = $1 AND NOT is_sandbox)
+       GROUP BY n.night
+       ORDER BY n.night`,
+      [roomType, checkInDate, checkOutDate, ROOM_HOLDING_STATUSES, excludeBookingId]
+    );
+    return new Map(result.rows.map(row => [
+      row.night, Number(row.rooms) === 0 ? 0 : Number(row.booked) * 100 / Number(row.rooms)
+    ]));
+  }
+
+  private async assertRoomType(client: PoolClient, roomType: string): Promise<void> {
+    const rooms = await client.query('SELECT 1 FROM rooms WHERE room_type = $1 LIMIT 1', [roomType]);
+    if (rooms.rows.length === 0) {
+      throw new ValidationError('Invalid rate plan', { roomType: 'no rooms of this type exist' });
+    }
+  }
+}
@@ -0,0 +1,145 @@
+import { getClient } from '../config/database';
+import { mailConfig } from '../config/mail';
+import { Mailer } from '../mail/mailer';
+import { logger } from '../utils/logger';
+import { metrics } from '../utils/metrics';
+import { formatDate } from '../utils/date';
+import { StaleVersionError } from '../utils/errors';
+import { versionedRow } from './optimisticLocks';
+import { openContactField } from './guestContact';
+
+// How long a claimed email may stay in 'sending' before a sweep assumes the sender died and retries it
+const SEND_LEASE_MS = 10 * 60 * 1000;
+
+export type ReceiptEmailOutcome = 'sent' | 'retrying' | 'failed' | 'skipped';
+
+// Emails the guest a booking summary with each payment receipt. Delivery state lives on the receipt
+// (email_status pending → sending → sent, or failed after mailConfig.maxAttempts), so retries survive restarts.
+export class ReceiptEmailService {
+  constructor(private mailer: Mailer) {}
+
+  // Sends one receipt's email if it is due; 'skipped' when it is not (already sent, failed, not yet due, or
+  // claimed by another sender)
+  async deliver(receiptId: number): Promise<ReceiptEmailOutcome> {
+    const client = await getClient();
+
+    try {
+      const claimed = await client.query(
+        `UPDATE receipts
+         SET email_status = 'sending', email_attempts = email_attempts + 1,
+             email_next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2::float / 1000),
+             version = version + 1
+         WHERE id = $1 AND email_status IN ('pending', 'sending') AND email_next_attempt_at <= CURRENT_TIMESTAMP
+         RETURNING email_attempts, version`,
+        [receiptId, SEND_LEASE_MS]
+      );
+      if (claimed.rows.length === 0) {
+        return 'skipped';
+      }
+      const attempts: number = claimed.rows[0].email_attempts;
+      // A sweep that took the email over after the lease ran out bumps the version, so this sender's outcome
+      // is then dropped instead of overwriting the newer attempt's
+      const version: number = claimed.rows[0].version;
+
+      const details = await client.query(
+        `SELECT rec.receipt_number, rec.total_amount, rec.surcharge_amount, rec.generated_at,
+                b.id AS booking_id, b.check_in_date, b.check_out_date, b.total_amount AS booking_total,
+                b.guest_name, g.email AS guest_email, g.pii_key_id, r.room_number, r.room_type, p.payment_method
+         FROM receipts rec
+         JOIN bookings b ON b.id = rec.booking_id
+         JOIN guests g ON g.id = b.guest_id
+         JOIN rooms r ON r.id = b.room_id
+         LEFT JOIN payments p ON p.id = rec.payment_id
+         WHERE rec.id = $1`,
+        [receiptId]
+      );
+      const receipt = details.rows[0];
+
+      try {
+        await this.mailer.send({
+          to: openContactField(receipt.guest_email, 'email', receipt.pii_key_id),
+          subject: `Booking #${receipt.booking_id} confirmed - receipt ${receipt.receipt_number}`,
+          text: this.render(receipt)
+        });
+      } catch (error) {
+        const errorMessage = error instanceof Error ? error.message : String(error);
+        const failed = attempts >= mailConfig.maxAttempts;
+        versionedRow(await client.query(
+          `UPDATE receipts
+           SET email_status = $2, email_last_error = $3,
+               email_next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $4::float / 1000),
+               version = version + 1
+           WHERE id = $1 AND version = $5
+           RETURNING id`,
+          [receiptId, failed ? 'failed' : 'pending', errorMessage.slice(0, 500), mailConfig.retryDelayMs * attempts, version]
+        ), 'receipt', receiptId, version);
+        metrics.increment(failed ? 'receipt_emails.failed' : 'receipt_emails.retried');
+        logger.warn('Receipt email not delivered', { receiptId, attempts, failed, error: errorMessage });
+        return failed ? 'failed' : 'retrying';
+      }
+
+      versionedRow(await client.query(
+        `UPDATE receipts
+         SET email_status = 'sent', email_sent_at = CURRENT_TIMESTAMP, email_last_error = NULL, version = version + 1
+         WHERE id = $1 AND version = $2
+         RETURNING id`,
+        [receiptId, version]
+      ), 'receipt', receiptId, version);
+      metrics.increment('receipt_emails.sent');
+      logger.info('Receipt email sent', { receiptId, attempts });
+      return 'sent';
+    } catch (error) {
+      if (error instanceof StaleVersionError) {
+        logger.warn('Receipt email outcome dropped; another sender took the email over', { receiptId });
+        return 'skipped';
+      }
+      throw error;
+    } finally {
+      client.release();
+    }
+  }
+
+  // Retries every receipt email that is due, oldest first
+  async deliverDue(limit: number = 50): Promise<Record<ReceiptEmailOutcome, number>> {
+    const client = await getClient();
+    let due: number[];
+    try {
+      const result = await client.query(
+        `SELECT id FROM receipts
+         WHERE email_status IN ('pending', 'sending') AND email_next_attempt_at <= CURRENT_TIMESTAMP
+         ORDER BY email_next_attempt_at, id
+         LIMIT $1`,
+        [limit]
+      );
+      due = result.rows.map(row => row.id);
+    } finally {
+      client.release();
+    }
+
+    const outcomes: Record<ReceiptEmailOutcome, number> = { sent: 0, retrying: 0, failed: 0, skipped: 0 };
+    for (const receiptId of due) {
+      outcomes[await this.deliver(receiptId)]++;
+    }
+    return outcomes;
+  }
+
+  private render(receipt: any): string {
+    const surcharge = Number(receipt.surcharge_amount);
+    return [
+      `Dear ${receipt.guest_name},`,
+      '',
+      `Thank you for your payment. Your booking #${receipt.booking_id} is confirmed.`,
+      '',
+      `Room:      ${receipt.room_number} (${receipt.room_type})`,
+      `Check-in:  ${formatDate(receipt.check_in_date)}`,
+      `Check-out: ${formatDate(receipt.check_out_date)}`,
+      `Stay total: ${Number(receipt.booking_total).toFixed(2)}`,
+      '',
+      `Receipt ${receipt.receipt_number} (${new Date(receipt.generated_at).toISOString().slice(0, 10)})`,
+      `Paid:      ${Number(receipt.total_amount).toFixed(2)}${receipt.payment_method ? ` by ${receipt.payment_method}` : ''}`,
+      ...(surcharge > 0 ? [`Includes a payment method surcharge of ${surcharge.toFixed(2)}`] : []),
+      '',
+      'We look forward to welcoming you.'
+    ].join('\n');
+  }
+}
@@ -0,0 +1,34 @@
+import { getClient } from '../config/database';
+import { Receipt } from '../types';
+
+export class ReceiptService {
+  async getReceipt(receiptId: number): Promise<Receipt | null> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query('SELECT * FROM receipts WHERE id = $1', [receiptId]);
+      return result.rows[0] || null;
+    } finally {
+      client.release();
+    }
+  }
+
+  async getReceiptsByIds(receiptIds: number[]): Promise<{ found: Receipt[]; missing: number[] }> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query(
+        'SELECT * FROM receipts WHERE id = ANY($1::int[]) ORDER BY id',
+        [receiptIds]
+      );
+
+      const foundIds = new Set(result.rows.map(row => row.id));
+      return {
+        found: result.rows,
+        missing: receiptIds.filter(id => !foundIds.has(id))
+      };
+    } finally {
+      client.release();
+    }
+  }
+}
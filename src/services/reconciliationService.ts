@@ -0,0 +1,141 @@
+import { runInTransaction } from './transactionManager';
+import { addDays } from '../utils/date';
+
+export type ReconciliationMismatchKind = 'paid_without_receipt' | 'receipt_without_booking' | 'amount_drift';
+
+export interface ReconciliationMismatch {
+  kind: ReconciliationMismatchKind;
+  bookingId: number | null;
+  receiptId: number | null;
+  detail: string;
+}
+
+export interface ReconciliationDay {
+  date: string;
+  receipts: any[];
+  payments: any[];
+  refunds: any[];
+  mismatches: ReconciliationMismatch[];
+  totals: { receipts: number; payments: number; refundable: number };
+}
+
+// Longest from/to range one request may stream
+export const MAX_RECONCILIATION_DAYS = 366;
+
+// Money movements of one day, side by side: receipts issued, payments taken (with what the gateway
+// last said about each) and refunds owed by cancellations, plus the places where they don't agree
+export class ReconciliationService {
+  async reconcileDay(date: string): Promise<ReconciliationDay> {
+    const next = addDays(date, 1);
+
+    return runInTransaction(async ({ client }) => {
+      const receipts = await client.query(
+        `SELECT rec.id, rec.receipt_number, rec.kind, rec.booking_id, rec.payment_id, rec.total_amount, rec.generated_at
+         FROM receipts rec
+         WHERE rec.generated_at >= $1 AND rec.generated_at < $2
+         ORDER BY rec.id`,
+        [date, next]
+      );
+      const payments = await client.query(
+        `SELECT p.id, p.booking_id, p.amount, p.payment_method, p.status, p.transaction_id, p.created_at,
+                ev.type AS gateway_event, ev.event_created_at AS gateway_event_at
+         FROM payments p
+         LEFT JOIN LATERAL (
+           SELECT type, event_created_at FROM payment_webhook_events
+           WHERE payment_id = p.id AND outcome = 'applied'
+           ORDER BY event_created_at DESC LIMIT 1
+         ) ev ON TRUE
+         WHERE p.created_at >= $1 AND p.created_at < $2
+         ORDER BY p.id`,
+        [date, next]
+      );
+      const refunds = await client.query(
+        `SELECT cr.booking_id, cr.paid_amount, cr.fee_amount, cr.refundable_amount, cr.created_at,
+                EXISTS (SELECT 1 FROM payments p WHERE p.booking_id = cr.booking_id AND p.status = 'refunded')
+                  AS gateway_refunded,
+                rf.pending AS refund_pending, rf.settled AS refund_settled, rf.failed AS refund_failed
+         FROM cancellation_records cr
+         CROSS JOIN LATERAL (
+           SELECT COALESCE(SUM(amount) FILTER (WHERE status = 'pending'), 0) AS pending,
+                  COALESCE(SUM(amount) FILTER (WHERE status = 'settled'), 0) AS settled,
+                  COALESCE(SUM(amount) FILTER (WHERE status = 'failed'), 0) AS failed
+           FROM refunds WHERE booking_id = cr.booking_id
+         ) rf
+         WHERE cr.created_at >= $1 AND cr.created_at < $2 AND cr.refundable_amount > 0
+         ORDER BY cr.booking_id`,
+        [date, next]
+      );
+
+      // Bookings paid that day without a payment receipt, or whose payment receipts (one per installment
+      // on a payment plan, less chargebacks) don't add up to what was paid
+      const bookingGaps = await client.query(
+        `SELECT b.id AS booking_id, rec.receipt_id, rec.receipt_total,
+                (SELECT COALESCE(SUM(p.amount), 0) FROM payments p
+                  WHERE p.booking_id = b.id AND p.status = 'completed') AS paid_total
+         FROM bookings b
+         CROSS JOIN LATERAL (
+           SELECT MIN(id) FILTER (WHERE kind = 'payment') AS receipt_id, SUM(total_amount) AS receipt_total FROM receipts
+           WHERE booking_id = b.id AND kind IN ('payment', 'chargeback')
+         ) rec
+         WHERE EXISTS (SELECT 1 FROM payments p
+                       WHERE p.booking_id = b.id AND p.status = 'completed'
+                         AND p.created_at >= $1 AND p.created_at < $2)
+         ORDER BY b.id`,
+        [date, next]
+      );
+      const orphanReceipts = await client.query(
+        `SELECT rec.id, rec.booking_id FROM receipts rec
+         WHERE rec.generated_at >= $1 AND rec.generated_at < $2
+           AND NOT EXISTS (SELECT 1 FROM bookings b WHERE b.id = rec.booking_id)
+         ORDER BY rec.id`,
+        [date, next]
+      );
+
+      const mismatches: ReconciliationMismatch[] = [];
+      for (const gap of bookingGaps.rows) {
+        const paidTotal = Number(gap.paid_total);
+        if (gap.receipt_id === null) {
+          mismatches.push({
+            kind: 'paid_without_receipt', bookingId: gap.booking_id, receiptId: null, detail: `paid ${paidTotal} with no receipt`
+          });
+        } else if (Number(gap.receipt_total) !== paidTotal) {
+          mismatches.push({
+            kind: 'amount_drift',
+            bookingId: gap.booking_id,
+            receiptId: gap.receipt_id,
+            detail: `receipt says ${Number(gap.receipt_total)}, completed payments total ${paidTotal}`
+          });
+        }
+      }
+      for (const receipt of orphanReceipts.rows) {
+        mismatches.push({
+          kind: 'receipt_without_booking',
+          bookingId: receipt.booking_id,
+          receiptId: receipt.id,
+          detail: receipt.booking_id === null ? 'receipt has no booking' : `booking ${receipt.booking_id} does not exist`
+        });
+      }
+
+      const sum = (rows: any[], field: string) => Math.round(rows.reduce((total, row) => total + Number(row[field]), 0) * 100) / 100;
+      return {
+        date,
+        receipts: receipts.rows,
+        payments: payments.rows,
+        refunds: refunds.rows,
+        mismatches,
+        totals: {
+          receipts: sum(receipts.rows, 'total_amount'),
+          payments: sum(payments.rows.filter(payment => payment.status === 'completed'), 'amount'),
+          refundable: sum(refunds.rows, 'refundable_amount')
+        }
+      };
+    }, { name: 'reconcileDay', isolationLevel: 'REPEATABLE READ', readOnly: true });
+  }
+
+  // One day at a time, so a long range never holds more than a day's rows in memory
+  async *reconcileRange(from: string, to: string): AsyncGenerator<ReconciliationDay> {
+    for (let date = from; date <= to; date = addDays(date, 1)) {
+      yield await this.reconcileDay(date);
+    }
+  }
+}
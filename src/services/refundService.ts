@@ -0,0 +1,217 @@
+import { PoolClient } from 'pg';
+import { getClient } from '../config/database';
+import { runInTransaction } from './transactionManager';
+import { LOYALTY_PAYMENT_METHOD } from './loyaltyService';
+import { assertNotDisputed } from './disputeService';
+import { paymentMethods } from '../config/paymentMethods';
+import { logger } from '../utils/logger';
+import { metrics } from '../utils/metrics';
+import { ConflictError, NotFoundError, ValidationError } from '../utils/errors';
+import { Refund } from '../types';
+
+const roundMoney = (amount: number) => Math.round(amount * 100) / 100;
+
+const toRefund = (row: any): Refund => ({ ...row, amount: Number(row.amount) });
+
+// Moves a refund may make; settled is final, and a failed refund may still settle if the gateway retried it
+const REFUND_TRANSITIONS: Record<Refund['status'], Refund['status'][]> = {
+  pending: ['settled', 'failed'],
+  failed: ['settled'],
+  settled: []
+};
+
+export type RefundEventOutcome = 'applied' | 'stale' | 'ignored' | 'unmatched';
+
+interface RefundablePayment {
+  id: number;
+  payment_method: string;
+  receipt_id: number | null;
+  refundable: number;
+}
+
+// Refunds always go back to the method (and gateway transaction) a payment was made with. They are started
+// here and settled asynchronously: the gateway reports the outcome through the payment webhook.
+export class RefundService {
+  // Spreads amount over the booking's money payments, newest first, never refunding more than a payment
+  // has left; called under the booking's lock
+  async refundPayments(client: PoolClient, bookingId: number, amount: number): Promise<Refund[]> {
+    const refunds: Refund[] = [];
+    let remaining = roundMoney(amount);
+
+    for (const payment of await this.refundablePayments(client, bookingId, null)) {
+      if (remaining <= 0) {
+        break;
+      }
+      if (payment.refundable <= 0) {
+        continue;
+      }
+      const share = Math.min(remaining, payment.refundable);
+      refunds.push(await this.startRefund(client, bookingId, payment, share));
+      remaining = roundMoney(remaining - share);
+    }
+
+    if (remaining > 0) {
+      logger.warn('Refund exceeds what the booking\'s payments can return', { bookingId, unrefunded: remaining });
+    }
+    return refunds;
+  }
+
+  // A refund of one payment receipt, e.g. after a stay was shortened. paymentMethod is optional; when given it
+  // must be the receipt's own method, since money is never refunded to a different one.
+  async requestRefund(
+    bookingId: number, input: { receiptId?: unknown; amount?: unknown; paymentMethod?: unknown }
+  ): Promise<Refund> {
+    const fields: Record<string, string> = {};
+    if (!Number.isInteger(input?.receiptId) || (input.receiptId as number) <= 0) {
+      fields.receiptId = 'must be a receipt id';
+    }
+    if (input?.amount !== undefined &&
+      (typeof input.amount !== 'number' || !Number.isFinite(input.amount) || input.amount <= 0)) {
+      fields.amount = 'must be a positive number';
+    }
+    if (input?.paymentMethod !== undefined && typeof input.paymentMethod !== 'string') {
+      fields.paymentMethod = 'must be a string';
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid refund', fields);
+    }
+
+    return runInTransaction(async ({ client }) => {
+      const booking = await client.query('SELECT id, status FROM bookings WHERE id = $1 FOR UPDATE', [bookingId]);
+      if (booking.rows.length === 0) {
+        throw new NotFoundError('Booking not found');
+      }
+      await assertNotDisputed(client, bookingId, booking.rows[0].status);
+
+      const receipt = await client.query(
+        `SELECT rec.kind, rec.payment_id, COALESCE(rec.payment_method, p.payment_method) AS payment_method
+         FROM receipts rec
+         LEFT JOIN payments p ON p.id = rec.payment_id
+         WHERE rec.id = $1 AND rec.booking_id = $2`,
+        [input.receiptId, bookingId]
+      );
+      if (receipt.rows.length === 0) {
+        throw new NotFoundError('Receipt not found');
+      }
+      const { kind, payment_id: paymentId, payment_method: paymentMethod } = receipt.rows[0];
+      if (kind !== 'payment' || paymentId === null) {
+        throw new ValidationError('Invalid refund', { receiptId: 'only payment receipts can be refunded' });
+      }
+      if (paymentMethod === LOYALTY_PAYMENT_METHOD) {
+        throw new ValidationError('Invalid refund', { receiptId: 'loyalty points are restored on cancellation, not refunded' });
+      }
+      if (input.paymentMethod !== undefined && input.paymentMethod !== paymentMethod) {
+        throw new ValidationError('Invalid refund', {
+          paymentMethod: `refunds go back to the original payment method (${paymentMethod})`
+        });
+      }
+
+      const [payment] = await this.refundablePayments(client, bookingId, paymentId);
+      if (payment.refundable <= 0) {
+        throw new ConflictError('Nothing is left to refund on this payment');
+      }
+      const amount = roundMoney((input.amount as number | undefined) ?? payment.refundable);
+      if (amount > payment.refundable) {
+        throw new ValidationError('Invalid refund', {
+          amount: `cannot exceed the ${payment.refundable} still refundable on this payment`
+        });
+      }
+
+      return this.startRefund(client, bookingId, payment, amount);
+    }, { name: 'requestRefund' });
+  }
+
+  async getRefunds(bookingId: number): Promise<Refund[] | null> {
+    const client = await getClient();
+
+    try {
+      const booking = await client.query('SELECT id FROM bookings WHERE id = $1', [bookingId]);
+      if (booking.rows.length === 0) {
+        return null;
+      }
+      const result = await client.query('SELECT * FROM refunds WHERE booking_id = $1 ORDER BY id', [bookingId]);
+      return result.rows.map(toRefund);
+    } finally {
+      client.release();
+    }
+  }
+
+  // Applies the gateway's word on a refund. Like payment events, one older than the last applied is dropped.
+  async applyGatewayEvent(
+    client: PoolClient, refundReference: string, to: 'settled' | 'failed', created: number, failureReason?: string
+  ): Promise<{ outcome: RefundEventOutcome; refund: Refund | null }> {
+    const found = await client.query(
+      `SELECT *, (gateway_event_at >= to_timestamp($2)) IS TRUE AS superseded
+       FROM refunds WHERE refund_reference = $1 FOR UPDATE`,
+      [refundReference, created]
+    );
+    if (found.rows.length === 0) {
+      return { outcome: 'unmatched', refund: null };
+    }
+
+    const { superseded, ...current } = found.rows[0];
+    if (superseded) {
+      return { outcome: 'stale', refund: toRefund(current) };
+    }
+    if (!REFUND_TRANSITIONS[current.status as Refund['status']].includes(to)) {
+      return { outcome: 'ignored', refund: toRefund(current) };
+    }
+
+    const updated = await client.query(
+      `UPDATE refunds
+       SET status = $2::varchar, failure_reason = $3, gateway_event_at = to_timestamp($4),
+           settled_at = CASE WHEN $2::varchar = 'settled' THEN CURRENT_TIMESTAMP END, updated_at = CURRENT_TIMESTAMP
+       WHERE id = $1
+       RETURNING *`,
+      [current.id, to, to === 'failed' ? failureReason ?? 'declined by the gateway' : null, created]
+    );
+    metrics.increment(`refunds.${to}`);
+    logger.info('Refund updated by the gateway', { refundId: current.id, bookingId: current.booking_id, status: to });
+    return { outcome: 'applied', refund: toRefund(updated.rows[0]) };
+  }
+
+  // Money payments towards the stay, newest first, each with what is left to refund: the amount paid
+  // less its surcharge (kept by the hotel) and less refunds not known to have failed
+  private async refundablePayments(
+    client: PoolClient, bookingId: number, paymentId: number | null
+  ): Promise<RefundablePayment[]> {
+    const result = await client.query(
+      `SELECT p.id, p.payment_method,
+              (SELECT rec.id FROM receipts rec
+                WHERE rec.payment_id = p.id AND rec.kind = 'payment' ORDER BY rec.id LIMIT 1) AS receipt_id,
+              p.amount - p.surcharge_amount - (SELECT COALESCE(SUM(rf.amount), 0) FROM refunds rf
+                WHERE rf.payment_id = p.id AND rf.status IN ('pending', 'settled')) AS refundable
+       FROM payments p
+       WHERE p.booking_id = $1 AND ($2::int IS NULL OR p.id = $2)
+         AND p.status = 'completed' AND p.amount > 0 AND p.payment_method <> $3
+       ORDER BY p.id DESC
+       FOR UPDATE`,
+      [bookingId, paymentId, LOYALTY_PAYMENT_METHOD]
+    );
+    return result.rows.map(row => ({ ...row, refundable: roundMoney(Number(row.refundable)) }));
+  }
+
+  // Sends the refund to the gateway against the original payment; it stays pending until the gateway reports
+  // back. A method that can't be refunded fails at once, for the front desk to settle with the guest.
+  private async startRefund(
+    client: PoolClient, bookingId: number, payment: RefundablePayment, amount: number
+  ): Promise<Refund> {
+    const method = paymentMethods.get(payment.payment_method);
+    const failureReason = method?.supportsRefund
+      ? null
+      : `${method?.displayName ?? payment.payment_method} payments cannot be refunded through the gateway; refund the guest directly`;
+
+    const result = await client.query(
+      `INSERT INTO refunds (booking_id, payment_id, receipt_id, amount, payment_method, refund_reference, status, failure_reason)
+       VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+       RETURNING *`,
+      [bookingId, payment.id, payment.receipt_id, amount, payment.payment_method,
+        `RFD_${Date.now()}_${Math.random().toString(36).slice(2, 11)}`, failureReason ? 'failed' : 'pending', failureReason]
+    );
+
+    const refund = toRefund(result.rows[0]);
+    metrics.increment(`refunds.${refund.status === 'failed' ? 'failed' : 'requested'}`);
+    logger.info('Refund started', { refundId: refund.id, bookingId, paymentId: payment.id, amount, status: refund.status });
+    return refund;
+  }
+}
@@ -0,0 +1,124 @@
+import { getClient } from '../config/database';
+
+export const MAX_REPORT_DAYS = 366;
+
+const roundMoney = (amount: number) => Math.round(amount * 100) / 100;
+
+interface RoomTypeNights {
+  date: string | null;
+  room_type: string;
+  rooms_available: number;
+  rooms_sold: number;
+  room_revenue: number;
+}
+
+export interface OccupancyRow {
+  room_type: string;
+  rooms_available: number;
+  rooms_sold: number;
+  occupancy_rate: number;
+}
+
+export interface RevenueRow {
+  room_type: string;
+  rooms_sold: number;
+  room_revenue: number;
+  adr: number;
+  revpar: number;
+}
+
+// Per-day, per-room-type hotel KPIs over from..to (inclusive). Everything is aggregated in the database, one
+// row per night and room type plus one total per room type, so the range's bookings never reach the process.
+export class ReportService {
+  async getOccupancyReport(from: string, to: string) {
+    const rows = await this.roomTypeNights(from, to);
+    const toOccupancy = (row: RoomTypeNights): OccupancyRow => ({
+      room_type: row.room_type,
+      rooms_available: row.rooms_available,
+      rooms_sold: row.rooms_sold,
+      occupancy_rate: row.rooms_available === 0 ? 0 : Math.round(row.rooms_sold / row.rooms_available * 10000) / 10000
+    });
+
+    return {
+      from,
+      to,
+      days: rows.filter(row => row.date !== null).map(row => ({ date: row.date!, ...toOccupancy(row) })),
+      totals: rows.filter(row => row.date === null).map(toOccupancy)
+    };
+  }
+
+  // ADR is room revenue per room sold and RevPAR room revenue per room available; both leave out taxes
+  async getRevenueReport(from: string, to: string) {
+    const rows = await this.roomTypeNights(from, to);
+    const toRevenue = (row: RoomTypeNights): RevenueRow => ({
+      room_type: row.room_type,
+      rooms_sold: row.rooms_sold,
+      room_revenue: roundMoney(row.room_revenue),
+      adr: row.rooms_sold === 0 ? 0 : roundMoney(row.room_revenue / row.rooms_sold),
+      revpar: row.rooms_available === 0 ? 0 : roundMoney(row.room_revenue / row.rooms_available)
+    });
+
+    return {
+      from,
+      to,
+      days: rows.filter(row => row.date !== null).map(row => ({ date: row.date!, ...toRevenue(row) })),
+      totals: rows.filter(row => row.date === null).map(toRevenue)
+    };
+  }
+
+  // Rooms available (not retired, not blocked for maintenance) and sold each night, with the room revenue of
+  // the nights sold: the night's price less taxes from the booking's price breakdown, or an even share of the
+  // booking total for bookings priced before breakdowns were kept. Totals come from the same grouping.
+  private async roomTypeNights(from: string, to: string): Promise<RoomTypeNights[]> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query(`
+        WITH days AS (
+          SELECT d::date AS day FROM generate_series($1::date, $2::date, interval '1 day') AS d
+        ),
+        grid AS (
+          SELECT days.day, types.room_type
+          FROM days CROSS JOIN (SELECT DISTINCT room_type FROM rooms WHERE NOT is_sandbox) AS types
+        ),
+        inventory AS (
+          SELECT days.day, r.room_type, COUNT(*) AS rooms_available
+          FROM days
+          JOIN rooms r ON r.retired_at IS NULL OR r.retired_at::date > days.day
+          WHERE NOT r.is_sandbox AND NOT EXISTS (
+            SELECT 1 FROM room_maintenance_blocks m
+            WHERE m.room_id = r.id AND m.status = 'active' AND m.start_date <= days.day AND m.end_date > days.day
+          )
+          GROUP BY days.day, r.room_type
+        ),
+        sold AS (
+          SELECT days.day, r.room_type, COUNT(*) AS rooms_sold,
+                 SUM(COALESCE(night.amount, b.total_amount / (b.check_out_date - b.check_in_date))) AS room_revenue
+          FROM days
+          JOIN bookings b ON b.check_in_date <= days.day AND b.check_out_date > days.day
+           AND b.status NOT IN ('cancelled', 'no_show')
+          JOIN rooms r ON r.id = b.room_id AND NOT r.is_sandbox
+          LEFT JOIN LATERAL (
+            SELECT (n->>'total')::numeric - (n->>'taxes')::numeric AS amount
+            FROM jsonb_array_elements(b.price_breakdown->'nights') AS n
+            WHERE n->>'date' = to_char(days.day, 'YYYY-MM-DD')
+          ) night ON TRUE
+          GROUP BY days.day, r.room_type
+        )
+        SELECT to_char(g.day, 'YYYY-MM-DD') AS date, g.room_type,
+               COALESCE(SUM(i.rooms_available), 0)::int AS rooms_available,
+               COALESCE(SUM(s.rooms_sold), 0)::int AS rooms_sold,
+               COALESCE(SUM(s.room_revenue), 0)::float AS room_revenue
+        FROM grid g
+        LEFT JOIN inventory i ON i.day = g.day AND i.room_type = g.room_type
+        LEFT JOIN sold s ON s.day = g.day AND s.room_type = g.room_type
+        GROUP BY GROUPING SETS ((g.room_type, g.day), (g.room_type))
+        ORDER BY g.room_type, g.day NULLS LAST
+      `, [from, to]);
+
+      return result.rows;
+    } finally {
+      client.release();
+    }
+  }
+}
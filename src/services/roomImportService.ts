@@ -0,0 +1,218 @@
+import { runInTransaction } from './transactionManager';
+import { SANDBOX_ROOM_PREFIX } from './demoService';
+import { logger } from '../utils/logger';
+import { parseCsv } from '../utils/csv';
+import { isFloor, MAX_FLOOR, MIN_FLOOR, ROOM_VIEWS } from '../utils/roomAttributes';
+import { ValidationError } from '../utils/errors';
+import { RoomView } from '../types';
+
+// Rows inserted per transaction; a failing batch doesn't undo the ones before it
+export const ROOM_IMPORT_BATCH_SIZE = 200;
+
+const REQUIRED_COLUMNS = ['room_number', 'floor', 'room_type'];
+const OPTIONAL_COLUMNS = ['price_per_night', 'view', 'smoking', 'accessible'];
+
+const BOOLEANS: Record<string, boolean> = { true: true, yes: true, '1': true, false: false, no: false, '0': false };
+
+interface ImportRow {
+  line: number;
+  roomNumber: string;
+  floor: number;
+  roomType: string;
+  pricePerNight: number | null;
+  view: RoomView | null;
+  smoking: boolean;
+  accessible: boolean;
+}
+
+export interface RoomImportError {
+  line: number;
+  roomNumber: string;
+  messages: string[];
+}
+
+export interface RoomImportReport {
+  rows: number;
+  created: number;
+  // Already in the rooms table; left as they are
+  existing: string[];
+  errors: RoomImportError[];
+  dryRun: boolean;
+}
+
+// Onboards a property's rooms from a CSV with a header row of room_number, floor, room_type and optionally
+// price_per_night, view, smoking and accessible (blank means no view, non-smoking, not accessible). Rows that fail validation are reported by line and skipped; the rest are inserted in batches.
+export class RoomImportService {
+  async importCsv(csv: string, options: { dryRun: boolean }): Promise<RoomImportReport> {
+    let records: { line: number; fields: string[] }[];
+    try {
+      records = parseCsv(csv);
+    } catch (error) {
+      throw new ValidationError('Invalid room import', { csv: error instanceof Error ? error.message : String(error) });
+    }
+    if (records.length < 2) {
+      throw new ValidationError('Invalid room import', { csv: 'must have a header row and at least one room' });
+    }
+
+    const header = records[0].fields.map(name => name.trim().toLowerCase());
+    const missing = REQUIRED_COLUMNS.filter(column => !header.includes(column));
+    const unknown = header.filter(column => !REQUIRED_COLUMNS.includes(column) && !OPTIONAL_COLUMNS.includes(column));
+    if (missing.length > 0 || unknown.length > 0) {
+      throw new ValidationError('Invalid room import', {
+        header: [
+          missing.length > 0 ? `missing ${missing.join(', ')}` : '',
+          unknown.length > 0 ? `unknown ${unknown.join(', ')}` : ''
+        ].filter(Boolean).join('; ')
+      });
+    }
+
+    const errors: RoomImportError[] = [];
+    const valid = this.validateRows(records.slice(1), header, errors);
+    const existing: string[] = [];
+    let created = 0;
+
+    for (let start = 0; start < valid.length; start += ROOM_IMPORT_BATCH_SIZE) {
+      const batch = valid.slice(start, start + ROOM_IMPORT_BATCH_SIZE);
+      try {
+        const result = await this.insertBatch(batch, options.dryRun);
+        created += result.created;
+        existing.push(...result.existing);
+        errors.push(...result.errors);
+      } catch (error) {
+        const message = `not imported: ${error instanceof Error ? error.message : String(error)}`;
+        batch.forEach(row => errors.push({ line: row.line, roomNumber: row.roomNumber, messages: [message] }));
+        logger.error('Room import batch failed', { firstLine: batch[0].line, rows: batch.length, error: message });
+      }
+    }
+
+    errors.sort((a, b) => a.line - b.line);
+    logger.info(options.dryRun ? 'Room import checked (dry run)' : 'Rooms imported', {
+      rows: records.length - 1, created, existing: existing.length, errors: errors.length
+    });
+    return { rows: records.length - 1, created, existing, errors, dryRun: options.dryRun };
+  }
+
+  private validateRows(records: { line: number; fields: string[] }[], header: string[], errors: RoomImportError[]): ImportRow[] {
+    const seen = new Map<string, number>();
+    const rows: ImportRow[] = [];
+
+    for (const record of records) {
+      const value = (column: string) => (record.fields[header.indexOf(column)] ?? '').trim();
+      const messages: string[] = [];
+
+      const roomNumber = value('room_number');
+      if (roomNumber === '' || roomNumber.length > 10) {
+        messages.push('room_number must be 1 to 10 characters');
+      } else if (roomNumber.startsWith(SANDBOX_ROOM_PREFIX)) {
+        messages.push(`room_number: ${SANDBOX_ROOM_PREFIX} numbers are reserved for sandbox rooms`);
+      } else if (seen.has(roomNumber)) {
+        messages.push(`room_number is already listed on line ${seen.get(roomNumber)}`);
+      }
+      const floor = Number(value('floor'));
+      if (value('floor') === '' || !isFloor(floor)) {
+        messages.push(`floor must be a whole number from ${MIN_FLOOR} to ${MAX_FLOOR}`);
+      }
+      const roomType = value('room_type');
+      if (roomType === '' || roomType.length > 50) {
+        messages.push('room_type must be 1 to 50 characters');
+      }
+      const price = header.includes('price_per_night') && value('price_per_night') !== '' ? Number(value('price_per_night')) : null;
+      if (price !== null && (!Number.isFinite(price) || price <= 0)) {
+        messages.push('price_per_night must be a positive number');
+      }
+      const view = value('view').toLowerCase();
+      if (view !== '' && !ROOM_VIEWS.includes(view as RoomView)) {
+        messages.push(`view must be one of: ${ROOM_VIEWS.join(', ')}`);
+      }
+      const flag = (column: string) => {
+        const text = value(column).toLowerCase();
+        if (text !== '' && !(text in BOOLEANS)) {
+          messages.push(`${column} must be yes or no`);
+        }
+        return BOOLEANS[text] ?? false;
+      };
+      const smoking = flag('smoking');
+      const accessible = flag('accessible');
+      if (record.fields.length > header.length) {
+        messages.push(`has ${record.fields.length} fields for ${header.length} columns`);
+      }
+
+      if (!seen.has(roomNumber)) {
+        seen.set(roomNumber, record.line);
+      }
+      if (messages.length > 0) {
+        errors.push({ line: record.line, roomNumber, messages });
+      } else {
+        rows.push({
+          line: record.line, roomNumber, floor, roomType,
+          pricePerNight: price === null ? null : Math.round(price * 100) / 100,
+          view: view === '' ? null : view as RoomView, smoking, accessible
+        });
+      }
+    }
+    return rows;
+  }
+
+  // Rows without a price take the room type's current price; a new room type needs one. Room numbers already
+  // taken are skipped through ON CONFLICT, so a concurrent import can't fail the batch.
+  private async insertBatch(
+    batch: ImportRow[], dryRun: boolean
+  ): Promise<{ created: number; existing: string[]; errors: RoomImportError[] }> {
+    return runInTransaction(async ({ client }) => {
+      const errors: RoomImportError[] = [];
+      const prices = await client.query(
+        `SELECT room_type, MIN(price_per_night) AS price_per_night FROM rooms
+         WHERE room_type = ANY($1) AND NOT is_sandbox
+         GROUP BY room_type`,
+        [Array.from(new Set(batch.map(row => row.roomType)))]
+      );
+      const typePrice = new Map<string, number>(prices.rows.map(row => [row.room_type, Number(row.price_per_night)]));
+
+      const priced = batch.filter(row => {
+        if (row.pricePerNight === null && !typePrice.has(row.roomType)) {
+          errors.push({ line: row.line, roomNumber: row.roomNumber, messages: [`price_per_night is required for the new room type ${row.roomType}`] });
+          return false;
+        }
+        return true;
+      });
+      if (priced.length === 0) {
+        return { created: 0, existing: [], errors };
+      }
+
+      if (dryRun) {
+        const taken = await client.query(
+          'SELECT room_number FROM rooms WHERE room_number = ANY($1)',
+          [priced.map(row => row.roomNumber)]
+        );
+        const takenNumbers = new Set(taken.rows.map(row => row.room_number));
+        return {
+          created: priced.length - takenNumbers.size,
+          existing: priced.filter(row => takenNumbers.has(row.roomNumber)).map(row => row.roomNumber),
+          errors
+        };
+      }
+
+      const inserted = await client.query(
+        `INSERT INTO rooms (room_number, floor, room_type, price_per_night, view_type, smoking_allowed, accessible)
+         SELECT * FROM unnest($1::varchar[], $2::int[], $3::varchar[], $4::numeric[], $5::varchar[], $6::boolean[], $7::boolean[])
+         ON CONFLICT (room_number) DO NOTHING
+         RETURNING room_number`,
+        [
+          priced.map(row => row.roomNumber),
+          priced.map(row => row.floor),
+          priced.map(row => row.roomType),
+          priced.map(row => row.pricePerNight ?? typePrice.get(row.roomType)),
+          priced.map(row => row.view),
+          priced.map(row => row.smoking),
+          priced.map(row => row.accessible)
+        ]
+      );
+      const insertedNumbers = new Set(inserted.rows.map(row => row.room_number));
+      return {
+        created: inserted.rows.length,
+        existing: priced.filter(row => !insertedNumbers.has(row.roomNumber)).map(row => row.roomNumber),
+        errors
+      };
+    }, { name: 'importRooms' });
+  }
+}
@@ -0,0 +1,211 @@
+import { createHash } from 'crypto';
+import { PoolClient } from 'pg';
+import { runInTransaction } from './transactionManager';
+import { ROOM_HOLDING_STATUSES } from './bookingStateService';
+import { SANDBOX_ROOM_PREFIX } from './demoService';
+import { recordRoomStatus } from './roomStatusHistoryService';
+import { logger } from '../utils/logger';
+import { PreconditionFailedError, ValidationError } from '../utils/errors';
+
+// One room as listed by the property-management system
+export interface PmsRoom {
+  roomNumber: string;
+  roomType: string;
+  pricePerNight?: number;
+}
+
+export type InventoryAction =
+  | { action: 'create'; roomNumber: string; roomType: string; pricePerNight: number }
+  | { action: 'change_type'; roomNumber: string; fromType: string; roomType: string; pricePerNight?: number }
+  | { action: 'reinstate'; roomNumber: string; roomType: string }
+  | { action: 'retire'; roomNumber: string };
+
+// Differences the plan cannot fix on its own; applying leaves these rooms as they are
+export type InventoryBlocker =
+  | { kind: 'retired_with_future_bookings'; roomNumber: string; bookingIds: number[] }
+  | { kind: 'unknown_price'; roomNumber: string; roomType: string };
+
+export interface InventoryPlan {
+  // Fingerprint of the actions; pass it back when applying to make sure nothing changed since review
+  planHash: string;
+  actions: InventoryAction[];
+  blockers: InventoryBlocker[];
+  unchanged: number;
+}
+
+export interface InventoryReconciliation extends InventoryPlan {
+  applied: boolean;
+}
+
+const roundMoney = (amount: number) => Math.round(amount * 100) / 100;
+
+// Compares the local rooms with a PMS room export and brings them in line: rooms only the PMS has are created,
+// rooms whose type differs take the PMS type, and rooms the PMS no longer lists are retired (kept for history
+// but never booked again) unless guests are still booked into them. Sandbox rooms are not physical and are ignored.
+export class RoomInventoryService {
+  parseExport(body: unknown): PmsRoom[] {
+    const rooms = (body as { rooms?: unknown } | undefined)?.rooms;
+    if (!Array.isArray(rooms) || rooms.length === 0) {
+      throw new ValidationError('Invalid PMS export', { rooms: 'must be a non-empty array of rooms' });
+    }
+
+    const fields: Record<string, string> = {};
+    const seen = new Set<string>();
+    const parsed = rooms.map((room: any, index): PmsRoom => {
+      const roomNumber = typeof room?.roomNumber === 'string' ? room.roomNumber.trim() : '';
+      const roomType = typeof room?.roomType === 'string' ? room.roomType.trim() : '';
+      if (roomNumber === '' || roomNumber.length > 10) {
+        fields[`rooms[${index}].roomNumber`] = 'must be a room number of up to 10 characters';
+      } else if (roomNumber.startsWith(SANDBOX_ROOM_PREFIX)) {
+        fields[`rooms[${index}].roomNumber`] = `${SANDBOX_ROOM_PREFIX} numbers are reserved for sandbox rooms`;
+      } else if (seen.has(roomNumber)) {
+        fields[`rooms[${index}].roomNumber`] = 'is listed more than once';
+      }
+      seen.add(roomNumber);
+      if (roomType === '' || roomType.length > 50) {
+        fields[`rooms[${index}].roomType`] = 'must be a room type of up to 50 characters';
+      }
+      if (room?.pricePerNight !== undefined &&
+        (typeof room.pricePerNight !== 'number' || !Number.isFinite(room.pricePerNight) || room.pricePerNight <= 0)) {
+        fields[`rooms[${index}].pricePerNight`] = 'must be a positive number';
+      }
+      return { roomNumber, roomType, pricePerNight: room?.pricePerNight };
+    });
+
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid PMS export', fields);
+    }
+    return parsed;
+  }
+
+  // Without apply nothing is changed and the plan is only reported. With apply the plan is recomputed with the
+  // rooms locked and carried out in the same transaction; a planHash that no longer matches is rejected.
+  async reconcile(pmsRooms: PmsRoom[], options: { apply: boolean; planHash?: string }): Promise<InventoryReconciliation> {
+    const result = await runInTransaction(async ({ client }) => {
+      const plan = await this.buildPlan(client, pmsRooms, options.apply);
+      if (!options.apply) {
+        return { ...plan, applied: false };
+      }
+      if (options.planHash !== undefined && options.planHash !== plan.planHash) {
+        throw new PreconditionFailedError('Room inventory changed since the plan was generated; review the new plan');
+      }
+
+      for (const action of plan.actions) {
+        await this.applyAction(client, action);
+      }
+      return { ...plan, applied: true };
+    }, { name: 'reconcileRoomInventory' });
+
+    logger.info('Room inventory reconciled', {
+      applied: result.applied, actions: result.actions.length, blockers: result.blockers.length
+    });
+    return result;
+  }
+
+  private async buildPlan(client: PoolClient, pmsRooms: PmsRoom[], lock: boolean): Promise<InventoryPlan> {
+    const lockClause = lock ? 'FOR UPDATE' : '';
+    const localRooms = await client.query(
+      `SELECT id, room_number, room_type, price_per_night, retired_at FROM rooms
+       WHERE NOT is_sandbox
+       ORDER BY room_number
+       ${lockClause}`
+    );
+    const futureBookings = await client.query(
+      `SELECT room_id, array_agg(id ORDER BY id) AS booking_ids FROM bookings
+       WHERE status = ANY($1) AND check_out_date > CURRENT_DATE
+       GROUP BY room_id`,
+      [ROOM_HOLDING_STATUSES]
+    );
+
+    const local = new Map<string, any>(localRooms.rows.map(row => [row.room_number, row]));
+    const bookingsByRoom = new Map<number, number[]>(futureBookings.rows.map(row => [row.room_id, row.booking_ids]));
+    const typePrices = new Map<string, number>();
+    for (const row of localRooms.rows) {
+      if (!typePrices.has(row.room_type)) {
+        typePrices.set(row.room_type, Number(row.price_per_night));
+      }
+    }
+
+    const actions: InventoryAction[] = [];
+    const blockers: InventoryBlocker[] = [];
+    let unchanged = 0;
+
+    for (const pmsRoom of pmsRooms) {
+      const room = local.get(pmsRoom.roomNumber);
+      if (!room) {
+        const pricePerNight = pmsRoom.pricePerNight ?? typePrices.get(pmsRoom.roomType);
+        if (pricePerNight === undefined) {
+          blockers.push({ kind: 'unknown_price', roomNumber: pmsRoom.roomNumber, roomType: pmsRoom.roomType });
+        } else {
+          actions.push({ action: 'create', roomNumber: pmsRoom.roomNumber, roomType: pmsRoom.roomType, pricePerNight: roundMoney(pricePerNight) });
+        }
+        continue;
+      }
+
+      if (room.retired_at !== null) {
+        actions.push({ action: 'reinstate', roomNumber: room.room_number, roomType: pmsRoom.roomType });
+      }
+      if (room.room_type !== pmsRoom.roomType) {
+        actions.push({
+          action: 'change_type',
+          roomNumber: room.room_number,
+          fromType: room.room_type,
+          roomType: pmsRoom.roomType,
+          pricePerNight: pmsRoom.pricePerNight === undefined ? undefined : roundMoney(pmsRoom.pricePerNight)
+        });
+      } else if (room.retired_at === null) {
+        unchanged++;
+      }
+    }
+
+    const listed = new Set(pmsRooms.map(room => room.roomNumber));
+    for (const room of localRooms.rows) {
+      if (listed.has(room.room_number) || room.retired_at !== null) {
+        continue;
+      }
+      const bookingIds = bookingsByRoom.get(room.id);
+      if (bookingIds) {
+        blockers.push({ kind: 'retired_with_future_bookings', roomNumber: room.room_number, bookingIds });
+      } else {
+        actions.push({ action: 'retire', roomNumber: room.room_number });
+      }
+    }
+
+    const planHash = createHash('sha256').update(JSON.stringify(actions)).digest('hex');
+    return { planHash, actions, blockers, unchanged };
+  }
+
+  private async applyAction(client: PoolClient, action: InventoryAction): Promise<void> {
+    switch (action.action) {
+      case 'create':
+        await client.query(
+          'INSERT INTO rooms (room_number, room_type, price_per_night) VALUES ($1, $2, $3)',
+          [action.roomNumber, action.roomType, action.pricePerNight]
+        );
+        break;
+      case 'change_type':
+        await client.query(
+          `UPDATE rooms SET room_type = $1, price_per_night = COALESCE($2, price_per_night), updated_at = CURRENT_TIMESTAMP
+           WHERE room_number = $3`,
+          [action.roomType, action.pricePerNight ?? null, action.roomNumber]
+        );
+        break;
+      case 'reinstate': {
+        const reinstated = await client.query(
+          'UPDATE rooms SET retired_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE room_number = $1 RETURNING id',
+          [action.roomNumber]
+        );
+        await recordRoomStatus(client, reinstated.rows[0].id, 'reinstated');
+        break;
+      }
+      case 'retire': {
+        const retired = await client.query(
+          'UPDATE rooms SET retired_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE room_number = $1 RETURNING id',
+          [action.roomNumber]
+        );
+        await recordRoomStatus(client, retired.rows[0].id, 'retired');
+        break;
+      }
+    }
+  }
+}
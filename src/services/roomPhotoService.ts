@@ -0,0 +1,152 @@
+import { randomUUID } from 'crypto';
+import { getClient } from '../config/database';
+import { runInTransaction } from './transactionManager';
+import { mediaConfig } from '../config/media';
+import { createStorage, Storage } from '../media/storage';
+import { logger } from '../utils/logger';
+import { MultipartPart } from '../utils/multipart';
+import { NotFoundError, ValidationError } from '../utils/errors';
+import { RoomTypePhoto } from '../types';
+
+const EXTENSIONS: Record<string, string> = { 'image/jpeg': 'jpg', 'image/png': 'png', 'image/webp': 'webp' };
+
+// The declared content type has to match the file's leading bytes, so a script can't be uploaded as a photo
+function looksLike(contentType: string, data: Buffer): boolean {
+  switch (contentType) {
+    case 'image/jpeg':
+      return data.subarray(0, 3).equals(Buffer.from([0xff, 0xd8, 0xff]));
+    case 'image/png':
+      return data.subarray(0, 8).equals(Buffer.from([0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a]));
+    case 'image/webp':
+      return data.subarray(0, 4).toString('latin1') === 'RIFF' && data.subarray(8, 12).toString('latin1') === 'WEBP';
+    default:
+      return false;
+  }
+}
+
+// Photos of a room type, shown in the order of their position (1 first)
+export class RoomPhotoService {
+  constructor(private storage: Storage = createStorage()) {}
+
+  // Takes the parsed form: a "photo" file plus optional "caption" and "position" fields. Without a position
+  // the photo goes last; with one, the photos from that position on move down one place.
+  async addPhoto(roomType: string, parts: MultipartPart[]): Promise<RoomTypePhoto> {
+    const photo = parts.find(part => part.name === 'photo' && part.filename !== null);
+    const caption = parts.find(part => part.name === 'caption')?.data.toString('utf8').trim() || null;
+    const positionField = parts.find(part => part.name === 'position')?.data.toString('utf8').trim();
+    const position = positionField === undefined ? null : Number(positionField);
+
+    const fields: Record<string, string> = {};
+    if (!photo) {
+      fields.photo = 'is required';
+    } else if (!photo.contentType || !mediaConfig.contentTypes.includes(photo.contentType)) {
+      fields.photo = `must be one of: ${mediaConfig.contentTypes.join(', ')}`;
+    } else if (photo.data.length === 0 || photo.data.length > mediaConfig.maxBytes) {
+      fields.photo = `must be between 1 byte and ${mediaConfig.maxBytes} bytes`;
+    } else if (!looksLike(photo.contentType, photo.data)) {
+      fields.photo = `is not a valid ${photo.contentType} file`;
+    }
+    if (caption !== null && caption.length > 200) {
+      fields.caption = 'must be at most 200 characters';
+    }
+    if (position !== null && (!Number.isInteger(position) || position < 1)) {
+      fields.position = 'must be a positive integer';
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid photo', fields);
+    }
+
+    await this.assertRoomType(roomType);
+    const { contentType, data } = photo!;
+    const key = `room-types/${roomType.replace(/[^A-Za-z0-9_-]/g, '_')}/${randomUUID()}.${EXTENSIONS[contentType!]}`;
+    await this.storage.put(key, data, contentType!);
+
+    try {
+      return await runInTransaction(async ({ client }) => {
+        // Locking the room type's photos keeps concurrent uploads from renumbering them at the same time;
+        // two first photos may still share a position, which id then orders
+        const existing = await client.query(
+          'SELECT position FROM room_type_photos WHERE room_type = $1 ORDER BY position DESC, id FOR UPDATE',
+          [roomType]
+        );
+        const placeAt = Math.min(position ?? Infinity, (existing.rows[0]?.position ?? 0) + 1);
+        await client.query(
+          'UPDATE room_type_photos SET position = position + 1 WHERE room_type = $1 AND position >= $2',
+          [roomType, placeAt]
+        );
+
+        const result = await client.query(
+          `INSERT INTO room_type_photos (room_type, storage_key, content_type, size_bytes, caption, position)
+           VALUES ($1, $2, $3, $4, $5, $6)
+           RETURNING *`,
+          [roomType, key, contentType, data.length, caption, placeAt]
+        );
+
+        logger.info('Room type photo added', { roomType, photoId: result.rows[0].id, position: placeAt, bytes: data.length });
+        return this.toPhoto(result.rows[0]);
+      }, { name: 'addRoomTypePhoto' });
+    } catch (error) {
+      // Don't leave a file behind that no row points at
+      await this.storage.delete(key).catch(() => undefined);
+      throw error;
+    }
+  }
+
+  async listPhotos(roomType: string): Promise<RoomTypePhoto[]> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query(
+        'SELECT * FROM room_type_photos WHERE room_type = $1 ORDER BY position, id',
+        [roomType]
+      );
+      return result.rows.map(row => this.toPhoto(row));
+    } finally {
+      client.release();
+    }
+  }
+
+  // The photos after it move up one place. The file is removed after the row; failing that only leaves an
+  // unreferenced file behind.
+  async deletePhoto(roomType: string, photoId: number): Promise<void> {
+    const key = await runInTransaction(async ({ client }) => {
+      await client.query('SELECT id FROM room_type_photos WHERE room_type = $1 ORDER BY id FOR UPDATE', [roomType]);
+      const deleted = await client.query(
+        'DELETE FROM room_type_photos WHERE id = $1 AND room_type = $2 RETURNING storage_key, position',
+        [photoId, roomType]
+      );
+      if (deleted.rows.length === 0) {
+        throw new NotFoundError('Photo not found');
+      }
+      await client.query(
+        'UPDATE room_type_photos SET position = position - 1 WHERE room_type = $1 AND position > $2',
+        [roomType, deleted.rows[0].position]
+      );
+      return deleted.rows[0].storage_key as string;
+    }, { name: 'deleteRoomTypePhoto' });
+
+    try {
+      await this.storage.delete(key);
+    } catch (error) {
+      logger.warn('Failed to delete photo file', { key, error: error instanceof Error ? error.message : String(error) });
+    }
+    logger.info('Room type photo deleted', { roomType, photoId });
+  }
+
+  private toPhoto(row: any): RoomTypePhoto {
+    return { ...row, url: this.storage.url(row.storage_key) };
+  }
+
+  private async assertRoomType(roomType: string): Promise<void> {
+    const client = await getClient();
+
+    try {
+      const rooms = await client.query('SELECT 1 FROM rooms WHERE room_type = $1 LIMIT 1', [roomType]);
+      if (rooms.rows.length === 0) {
+        throw new NotFoundError('Room type not found');
+      }
+    } finally {
+      client.release();
+    }
+  }
+}
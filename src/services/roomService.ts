@@ -0,0 +1,136 @@
+import { getClient } from '../config/database';
+import { createStorage, Storage } from '../media/storage';
+import { logger } from '../utils/logger';
+import { isFloor, MAX_FLOOR, MIN_FLOOR, ROOM_VIEWS } from '../utils/roomAttributes';
+import { NotFoundError, ValidationError } from '../utils/errors';
+import { Room, RoomView } from '../types';
+
+export interface RoomTypeSummary {
+  roomType: string;
+  roomCount: number;
+  availableRooms: number;
+  // Out of service for maintenance today
+  maintenanceRooms: number;
+  minPricePerNight: number;
+  maxPricePerNight: number;
+  facilities: string[];
+  // Photo URLs in display order
+  photos: string[];
+}
+
+export class RoomService {
+  constructor(private storage: Storage = createStorage()) {}
+
+  async listRoomTypes(): Promise<RoomTypeSummary[]> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query(`
+        SELECT room_type,
+               COUNT(*) AS room_count,
+               COUNT(*) FILTER (WHERE is_available AND NOT in_maintenance) AS available_rooms,
+               COUNT(*) FILTER (WHERE in_maintenance) AS maintenance_rooms,
+               MIN(price_per_night) AS min_price,
+               MAX(price_per_night) AS max_price,
+               (SELECT COALESCE(array_agg(f.name ORDER BY f.name), '{}')
+                  FROM room_type_facilities rtf JOIN facilities f ON f.id = rtf.facility_id
+                 WHERE rtf.room_type = rooms.room_type) AS facilities,
+               (SELECT COALESCE(array_agg(p.storage_key ORDER BY p.position, p.id), '{}')
+                  FROM room_type_photos p WHERE p.room_type = rooms.room_type) AS photo_keys
+        FROM (
+          SELECT r.*, EXISTS (SELECT 1 FROM room_maintenance_blocks m
+                              WHERE m.room_id = r.id AND m.status = 'active'
+                                AND m.start_date <= CURRENT_DATE AND m.end_date > CURRENT_DATE) AS in_maintenance
+          FROM rooms r
+          WHERE r.retired_at IS NULL AND NOT r.is_sandbox
+        ) rooms
+        GROUP BY room_type
+        ORDER BY MIN(price_per_night), room_type
+      `);
+
+      return result.rows.map(row => ({
+        roomType: row.room_type,
+        roomCount: Number(row.room_count),
+        availableRooms: Number(row.available_rooms),
+        maintenanceRooms: Number(row.maintenance_rooms),
+        minPricePerNight: Number(row.min_price),
+        maxPricePerNight: Number(row.max_price),
+        facilities: row.facilities,
+        photos: row.photo_keys.map((key: string) => this.storage.url(key))
+      }));
+    } finally {
+      client.release();
+    }
+  }
+
+  // Side-by-side view of the requested types, with prices relative to the cheapest one; any unknown type
+  // fails the whole comparison
+  async compareRoomTypes(roomTypes: string[]) {
+    const summaries = await this.listRoomTypes();
+    const find = (roomType: string) =>
+      summaries.find(summary => summary.roomType.toLowerCase() === roomType.toLowerCase());
+
+    const unknown = roomTypes.filter(roomType => find(roomType) === undefined);
+    if (unknown.length > 0) {
+      throw new NotFoundError(`Room type not found: ${unknown.join(', ')}`);
+    }
+
+    const compared = roomTypes.map(roomType => find(roomType)!);
+    const cheapest = Math.min(...compared.map(summary => summary.minPricePerNight));
+
+    return {
+      roomTypes: compared.map(summary => ({
+        ...summary,
+        priceDifferenceFromCheapest: summary.minPricePerNight - cheapest
+      }))
+    };
+  }
+
+  // Sets the attributes present in the patch; floor and view can be cleared with null
+  async updateAttributes(roomId: number, patch: Record<string, unknown>): Promise<Room> {
+    const fields: Record<string, string> = {};
+    const { floor, view, smoking, accessible, ...unknown } = patch ?? {};
+    if (floor !== undefined && floor !== null && !isFloor(floor)) {
+      fields.floor = `must be a whole number from ${MIN_FLOOR} to ${MAX_FLOOR}, or null`;
+    }
+    if (view !== undefined && view !== null && !ROOM_VIEWS.includes(view as RoomView)) {
+      fields.view = `must be one of: ${ROOM_VIEWS.join(', ')}, or null`;
+    }
+    if (smoking !== undefined && typeof smoking !== 'boolean') {
+      fields.smoking = 'must be true or false';
+    }
+    if (accessible !== undefined && typeof accessible !== 'boolean') {
+      fields.accessible = 'must be true or false';
+    }
+    for (const name of Object.keys(unknown)) {
+      fields[name] = 'is not a room attribute';
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid room attributes', fields);
+    }
+
+    const client = await getClient();
+
+    try {
+      const result = await client.query(
+        `UPDATE rooms
+         SET floor = CASE WHEN $2 THEN $3::int ELSE floor END,
+             view_type = CASE WHEN $4 THEN $5::varchar ELSE view_type END,
+             smoking_allowed = COALESCE($6::boolean, smoking_allowed),
+             accessible = COALESCE($7::boolean, accessible),
+             updated_at = CURRENT_TIMESTAMP
+         WHERE id = $1
+         RETURNING *`,
+        [roomId, floor !== undefined, floor ?? null, view !== undefined, view ?? null, smoking ?? null, accessible ?? null]
+      );
+      if (result.rows.length === 0) {
+        throw new NotFoundError('Room not found');
+      }
+
+      logger.info('Room attributes updated', { roomId, floor, view, smoking, accessible });
+      return result.rows[0];
+    } finally {
+      client.release();
+    }
+  }
+}
@@ -0,0 +1,89 @@
+import { PoolClient } from 'pg';
+import { getClient } from '../config/database';
+import { currentActor } from '../utils/actor';
+import { logger } from '../utils/logger';
+import { ConflictError } from '../utils/errors';
+import { formatDate } from '../utils/date';
+import { keysetPage, PageQuery, parseIdPage } from '../utils/query';
+import { RoomStatusEntry, RoomStatusEvent } from '../types';
+
+export interface RoomStatusCause {
+  bookingId?: number;
+  holdId?: number;
+  maintenanceBlockId?: number;
+  startDate?: string | Date;
+  endDate?: string | Date;
+}
+
+const toDate = (value: string | Date | undefined) => value instanceof Date ? formatDate(value) : value ?? null;
+
+// Appends a history row after the room's status has changed. Runs on the caller's client, so the row shares
+// the change's transaction id and goes away with it on rollback.
+export async function recordRoomStatus(
+  client: PoolClient, roomId: number, event: RoomStatusEvent, cause: RoomStatusCause = {}
+): Promise<void> {
+  await client.query(
+    `INSERT INTO room_status_history
+       (room_id, event, is_available, booking_id, hold_id, maintenance_block_id, start_date, end_date, actor)
+     SELECT id, $2, is_available, $3, $4, $5, $6, $7, $8 FROM rooms WHERE id = $1`,
+    [
+      roomId, event, cause.bookingId ?? null, cause.holdId ?? null, cause.maintenanceBlockId ?? null,
+      toDate(cause.startDate), toDate(cause.endDate), currentActor()
+    ]
+  );
+}
+
+// Takes a free room for a booking, hold or upgrade. Advisory locks only cover the stay's date buckets, so a
+// booking of the same room in other buckets may have taken it since the availability check; the update then
+// finds the room taken and the request fails instead of double booking it.
+export async function claimRoom(
+  client: PoolClient, roomId: number, event: RoomStatusEvent, cause: RoomStatusCause = {}
+): Promise<void> {
+  const claimed = await client.query(
+    'UPDATE rooms SET is_available = false, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND is_available',
+    [roomId]
+  );
+  if (claimed.rowCount === 0) {
+    throw new ConflictError('Room is not available');
+  }
+  await recordRoomStatus(client, roomId, event, cause);
+
+  logger.info('Room availability updated', { roomId, isAvailable: false, event });
+}
+
+export class RoomStatusHistoryService {
+  // Oldest first; null when the room does not exist
+  async getHistory(
+    roomId: number, query: PageQuery = {}
+  ): Promise<{ entries: RoomStatusEntry[]; nextCursor: string | null } | null> {
+    const scope = ['room-status', roomId];
+    const { limit, afterId } = parseIdPage(query, 'roomStatusHistory', scope);
+    const client = await getClient();
+
+    try {
+      const room = await client.query('SELECT id FROM rooms WHERE id = $1', [roomId]);
+      if (room.rows.length === 0) {
+        return null;
+      }
+
+      const result = await client.query(
+        `SELECT id, event, is_available, booking_id, hold_id, maintenance_block_id, start_date, end_date,
+                actor, transaction_id, created_at
+         FROM room_status_history
+         WHERE room_id = $1 AND ($2::int IS NULL OR id > $2)
+         ORDER BY id
+         LIMIT $3`,
+        [roomId, afterId, limit + 1]
+      );
+      const entries = result.rows.map(row => ({
+        ...row,
+        start_date: row.start_date && formatDate(row.start_date),
+        end_date: row.end_date && formatDate(row.end_date)
+      }));
+      const { items, nextCursor } = keysetPage(entries, limit, row => [...scope, row.id]);
+      return { entries: items, nextCursor };
+    } finally {
+      client.release();
+    }
+  }
+}
@@ -0,0 +1,175 @@
+import { getClient } from '../config/database';
+import { ValidationError } from '../utils/errors';
+
+export interface SchemaColumn {
+  name: string;
+  type: string;
+  nullable: boolean;
+  default: string | null;
+  primaryKey: boolean;
+  references: { table: string; column: string } | null;
+  comment: string | null;
+}
+
+export interface SchemaTable {
+  name: string;
+  comment: string | null;
+  columns: SchemaColumn[];
+  indexes: { name: string; definition: string }[];
+}
+
+export const SCHEMA_DOC_FORMATS = ['json', 'markdown', 'mermaid', 'dot'] as const;
+export type SchemaDocFormat = typeof SCHEMA_DOC_FORMATS[number];
+
+// Documents the live database rather than initDb, so the docs can't drift from what is deployed
+export class SchemaService {
+  async describe(): Promise<SchemaTable[]> {
+    const client = await getClient();
+
+    try {
+      const tables = await client.query(`
+        SELECT t.table_name AS name, obj_description(c.oid, 'pg_class') AS comment
+        FROM information_schema.tables t
+        JOIN pg_class c ON c.relname = t.table_name
+        JOIN pg_namespace n ON n.oid = c.relnamespace AND n.nspname = t.table_schema
+        WHERE t.table_schema = 'public' AND t.table_type = 'BASE TABLE'
+        ORDER BY t.table_name
+      `);
+      const columns = await client.query(`
+        SELECT col.table_name, col.column_name AS name, col.data_type AS type, col.is_nullable = 'YES' AS nullable,
+               col.column_default AS default,
+               col_description(format('%I.%I', col.table_schema, col.table_name)::regclass, col.ordinal_position) AS comment
+        FROM information_schema.columns col
+        JOIN information_schema.tables t
+          ON t.table_schema = col.table_schema AND t.table_name = col.table_name AND t.table_type = 'BASE TABLE'
+        WHERE col.table_schema = 'public'
+        ORDER BY col.table_name, col.ordinal_position
+      `);
+      // One row per key column; a null confkey (primary keys) pads the referenced side with nulls
+      const keys = await client.query(`
+        SELECT rel.relname AS table_name, a.attname AS column_name, con.contype AS kind,
+               frel.relname AS references_table, fa.attname AS references_column
+        FROM pg_constraint con
+        JOIN pg_namespace n ON n.oid = con.connamespace AND n.nspname = 'public'
+        JOIN pg_class rel ON rel.oid = con.conrelid
+        CROSS JOIN LATERAL unnest(con.conkey, con.confkey) AS k(attnum, fattnum)
+        JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+        LEFT JOIN pg_class frel ON frel.oid = con.confrelid
+        LEFT JOIN pg_attribute fa ON fa.attrelid = con.confrelid AND fa.attnum = k.fattnum
+        WHERE con.contype IN ('p', 'f')
+      `);
+      const indexes = await client.query(`
+        SELECT tablename AS table_name, indexname AS name, indexdef AS definition
+        FROM pg_indexes
+        WHERE schemaname = 'public'
+        ORDER BY tablename, indexname
+      `);
+
+      return tables.rows.map(table => ({
+        name: table.name,
+        comment: table.comment,
+        columns: columns.rows.filter(column => column.table_name === table.name).map(column => {
+          const columnKeys = keys.rows.filter(key => key.table_name === table.name && key.column_name === column.name);
+          const foreignKey = columnKeys.find(key => key.kind === 'f');
+          return {
+            name: column.name,
+            type: column.type,
+            nullable: column.nullable,
+            default: column.default,
+            primaryKey: columnKeys.some(key => key.kind === 'p'),
+            references: foreignKey ? { table: foreignKey.references_table, column: foreignKey.references_column } : null,
+            comment: column.comment
+          };
+        }),
+        indexes: indexes.rows
+          .filter(index => index.table_name === table.name)
+          .map(({ name, definition }) => ({ name, definition }))
+      }));
+    } finally {
+      client.release();
+    }
+  }
+
+  parseFormat(value: unknown): SchemaDocFormat {
+    if (value === undefined) {
+      return 'json';
+    }
+    if (!SCHEMA_DOC_FORMATS.includes(value as SchemaDocFormat)) {
+      throw new ValidationError('Invalid schema docs request', { format: `must be one of: ${SCHEMA_DOC_FORMATS.join(', ')}` });
+    }
+    return value as SchemaDocFormat;
+  }
+
+  render(tables: SchemaTable[], format: Exclude<SchemaDocFormat, 'json'>): string {
+    switch (format) {
+      case 'markdown':
+        return toMarkdown(tables);
+      case 'mermaid':
+        return toMermaid(tables);
+      case 'dot':
+        return toDot(tables);
+    }
+  }
+}
+
+function toMarkdown(tables: SchemaTable[]): string {
+  const cell = (value: string) => value.replace(/\|/g, '\\|').replace(/\n/g, ' ');
+  const sections = tables.map(table => {
+    const lines = [`## ${table.name}`, ''];
+    if (table.comment) {
+      lines.push(table.comment, '');
+    }
+    lines.push('| Column | Type | Nullable | Default | Key | Notes |', '| --- | --- | --- | --- | --- | --- |');
+    for (const column of table.columns) {
+      const key = [
+        column.primaryKey ? 'PK' : '',
+        column.references ? `FK → ${column.references.table}.${column.references.column}` : ''
+      ].filter(Boolean).join(', ');
+      lines.push(`| ${column.name} | ${column.type} | ${column.nullable ? 'yes' : 'no'} | ` +
+        `${cell(column.default ?? '')} | ${key} | ${cell(column.comment ?? '')} |`);
+    }
+    if (table.indexes.length > 0) {
+      lines.push('', 'Indexes:', '');
+      table.indexes.forEach(index => lines.push(`- \`${index.name}\`: \`${index.definition}\``));
+    }
+    return lines.join('\n');
+  });
+  return ['# Database Schema', '', ...sections.flatMap(section => [section, ''])].join('\n');
+}
+
+// Mermaid attribute types are single words
+function toMermaid(tables: SchemaTable[]): string {
+  const lines = ['erDiagram'];
+  for (const table of tables) {
+    lines.push(`  ${table.name} {`);
+    for (const column of table.columns) {
+      const keys = [column.primaryKey ? 'PK' : '', column.references ? 'FK' : ''].filter(Boolean).join(',');
+      lines.push(`    ${column.type.replace(/\W+/g, '_')} ${column.name}${keys ? ` ${keys}` : ''}`);
+    }
+    lines.push('  }');
+  }
+  for (const table of tables) {
+    for (const column of table.columns.filter(column => column.references)) {
+      lines.push(`  ${column.references!.table} ||--o{ ${table.name} : ${column.name}`);
+    }
+  }
+  return lines.join('\n') + '\n';
+}
+
+function toDot(tables: SchemaTable[]): string {
+  const escape = (value: string) => value.replace(/([{}|<>"\\])/g, '\\$1');
+  const lines = ['digraph schema {', '  rankdir=LR;', '  node [shape=record, fontsize=10];'];
+  for (const table of tables) {
+    const fields = table.columns
+      .map(column => escape(`${column.name}: ${column.type}${column.primaryKey ? ' (PK)' : ''}`) + '\\l')
+      .join('');
+    lines.push(`  "${table.name}" [label="{${escape(table.name)}|${fields}}"];`);
+  }
+  for (const table of tables) {
+    for (const column of table.columns.filter(column => column.references)) {
+      lines.push(`  "${table.name}" -> "${column.references!.table}" [label="${escape(column.name)}"];`);
+    }
+  }
+  lines.push('}');
+  return lines.join('\n') + '\n';
+}
@@ -0,0 +1,180 @@
+import { PoolClient } from 'pg';
+import { runInTransactionWithRetry } from './transactionManager';
+import { LoyaltyService } from './loyaltyService';
+import { getClient } from '../config/database';
+import { logger } from '../utils/logger';
+import { metrics } from '../utils/metrics';
+import { NotFoundError, ValidationError } from '../utils/errors';
+import { keysetPage, PageQuery, parseIdPage } from '../utils/query';
+import { Receipt, SettlementIssue } from '../types';
+
+export interface StayFinalization {
+  receipt: Receipt;
+  issue: SettlementIssue | null;
+}
+
+const ISSUE_STATUSES = ['open', 'resolved'];
+
+function toIssue(row: any): SettlementIssue {
+  return {
+    ...row,
+    folio_total: Number(row.folio_total),
+    paid_total: Number(row.paid_total),
+    difference: Number(row.difference)
+  };
+}
+
+// Closes the books on checked-out stays: one final receipt per stay, and a work-queue entry for staff
+// whenever the completed payments don't cover (or exceed) the booking total
+export class SettlementService {
+  private loyaltyService = new LoyaltyService();
+
+  // Idempotent: a stay that already has its final receipt is returned as is. Null if the stay isn't checked out.
+  async finalizeStay(bookingId: number): Promise<StayFinalization | null> {
+    const finalization = await runInTransactionWithRetry(async ({ client }) => {
+      const booking = await client.query(
+        'SELECT id, status, total_amount FROM bookings WHERE id = $1 FOR UPDATE',
+        [bookingId]
+      );
+      if (booking.rows.length === 0 || booking.rows[0].status !== 'checked_out') {
+        return null;
+      }
+
+      const existing = await client.query(
+        `SELECT * FROM receipts WHERE booking_id = $1 AND kind = 'final'`,
+        [bookingId]
+      );
+      if (existing.rows.length > 0) {
+        return { receipt: existing.rows[0], issue: await this.findIssue(client, bookingId), created: false };
+      }
+
+      const folioTotal = Number(booking.rows[0].total_amount);
+      // Refunds not known to have failed have left (or are leaving) the hotel, so they don't count as paid
+      const paid = await client.query(
+        `SELECT (SELECT COALESCE(SUM(amount - surcharge_amount), 0)
+                  FROM payments WHERE booking_id = $1 AND status = 'completed')
+              - (SELECT COALESCE(SUM(amount), 0)
+                  FROM refunds WHERE booking_id = $1 AND status IN ('pending', 'settled')) AS paid_total`,
+        [bookingId]
+      );
+      const paidTotal = Number(paid.rows[0].paid_total);
+
+      const receipt = await client.query(
+        `INSERT INTO receipts (booking_id, payment_id, kind, receipt_number, total_amount)
+         VALUES ($1, NULL, 'final', $2, $3)
+         RETURNING *`,
+        [bookingId, `FIN_${Date.now()}_${Math.random().toString(36).slice(2, 8)}`, folioTotal]
+      );
+      await this.loyaltyService.awardStay(client, bookingId);
+
+      let issue: SettlementIssue | null = null;
+      const difference = Math.round((paidTotal - folioTotal) * 100) / 100;
+      if (difference !== 0) {
+        const inserted = await client.query(
+          `INSERT INTO settlement_issues (booking_id, kind, folio_total, paid_total, difference)
+           VALUES ($1, $2, $3, $4, $5)
+           RETURNING *`,
+          [bookingId, difference < 0 ? 'underpaid' : 'overpaid', folioTotal, paidTotal, difference]
+        );
+        issue = toIssue(inserted.rows[0]);
+      }
+
+      return { receipt: receipt.rows[0], issue, created: true };
+    }, { name: 'finalizeStay' });
+
+    if (!finalization) {
+      return null;
+    }
+
+    if (finalization.created) {
+      metrics.increment('settlement.finalized');
+      if (finalization.issue) {
+        metrics.increment(`settlement.${finalization.issue.kind}`);
+        logger.warn('Stay settled with a payment gap', {
+          bookingId, kind: finalization.issue.kind, difference: finalization.issue.difference
+        });
+      } else {
+        logger.info('Stay finalized', { bookingId, receiptId: finalization.receipt.id });
+      }
+    }
+    return { receipt: finalization.receipt, issue: finalization.issue };
+  }
+
+  // Catches stays whose check-out event was missed (restart, dropped event); returns how many were finalized
+  async finalizePendingStays(): Promise<number> {
+    const client = await getClient();
+    let pending: number[];
+    try {
+      const result = await client.query(
+        `SELECT b.id FROM bookings b
+         WHERE b.status = 'checked_out'
+           AND NOT EXISTS (SELECT 1 FROM receipts rec WHERE rec.booking_id = b.id AND rec.kind = 'final')
+         ORDER BY b.id`
+      );
+      pending = result.rows.map(row => row.id);
+    } finally {
+      client.release();
+    }
+
+    for (const bookingId of pending) {
+      await this.finalizeStay(bookingId);
+    }
+    return pending.length;
+  }
+
+  // Oldest first, a page at a time
+  async listIssues(
+    status: unknown = 'open', query: PageQuery = {}
+  ): Promise<{ issues: SettlementIssue[]; nextCursor: string | null }> {
+    if (typeof status !== 'string' || !ISSUE_STATUSES.includes(status)) {
+      throw new ValidationError('Invalid settlement issue query', { status: `must be one of: ${ISSUE_STATUSES.join(', ')}` });
+    }
+    const scope = ['settlement_issues', status];
+    const { limit, afterId } = parseIdPage(query, 'settlementIssues', scope);
+
+    const client = await getClient();
+    try {
+      const result = await client.query(
+        `SELECT * FROM settlement_issues
+         WHERE status = $1 AND ($2::int IS NULL OR id > $2)
+         ORDER BY id
+         LIMIT $3`,
+        [status, afterId, limit + 1]
+      );
+      const { items, nextCursor } = keysetPage(result.rows, limit, row => [...scope, row.id]);
+      return { issues: items.map(toIssue), nextCursor };
+    } finally {
+      client.release();
+    }
+  }
+
+  async resolveIssue(issueId: number, note: unknown): Promise<SettlementIssue> {
+    if (note !== undefined && typeof note !== 'string') {
+      throw new ValidationError('Invalid resolution', { note: 'must be a string' });
+    }
+
+    const client = await getClient();
+    try {
+      const result = await client.query(
+        `UPDATE settlement_issues
+         SET status = 'resolved', resolution_note = $2, resolved_at = CURRENT_TIMESTAMP
+         WHERE id = $1 AND status = 'open'
+         RETURNING *`,
+        [issueId, note?.trim() || null]
+      );
+      if (result.rows.length === 0) {
+        throw new NotFoundError('Open settlement issue not found');
+      }
+
+      logger.info('Settlement issue resolved', { issueId, bookingId: result.rows[0].booking_id });
+      return toIssue(result.rows[0]);
+    } finally {
+      client.release();
+    }
+  }
+
+  private async findIssue(client: PoolClient, bookingId: number): Promise<SettlementIssue | null> {
+    const result = await client.query('SELECT * FROM settlement_issues WHERE booking_id = $1', [bookingId]);
+    return result.rows[0] ? toIssue(result.rows[0]) : null;
+  }
+}
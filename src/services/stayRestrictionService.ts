@@ -0,0 +1,154 @@
+import { PoolClient } from 'pg';
+import { getClient } from '../config/database';
+import { logger } from '../utils/logger';
+import { NotFoundError, StayRestrictionError, ValidationError } from '../utils/errors';
+import { isCheckViolation } from '../utils/pgErrors';
+import { addDays, nightsBetween, today } from '../utils/date';
+import { StayRestrictions, StayRestrictionViolation } from '../types';
+
+const WEEKDAYS = ['Sunday', 'Monday', 'Tuesday', 'Wednesday', 'Thursday', 'Friday', 'Saturday'];
+
+const isCount = (value: unknown, min: number): value is number =>
+  Number.isInteger(value) && (value as number) >= min && (value as number) <= 3650;
+
+function toRestrictions(row: any): StayRestrictions {
+  return {
+    roomType: row.room_type,
+    minNights: row.min_nights,
+    maxNights: row.max_nights,
+    maxAdvanceDays: row.max_advance_days,
+    closedToArrivalDays: row.closed_to_arrival_days
+  };
+}
+
+// Which stays a room type takes: minimum and maximum nights, how far ahead it can be booked and the weekdays
+// guests can't arrive on. Room types without restrictions take any stay the booking horizon allows.
+export class StayRestrictionService {
+  async listRestrictions(): Promise<StayRestrictions[]> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query('SELECT * FROM stay_restrictions ORDER BY room_type');
+      return result.rows.map(toRestrictions);
+    } finally {
+      client.release();
+    }
+  }
+
+  // Fields left out keep their current value; maxNights and maxAdvanceDays can be lifted with null
+  async saveRestrictions(roomType: string, input: {
+    minNights?: unknown; maxNights?: unknown; maxAdvanceDays?: unknown; closedToArrivalDays?: unknown
+  }): Promise<StayRestrictions> {
+    const fields: Record<string, string> = {};
+    if (input?.minNights !== undefined && !isCount(input.minNights, 1)) {
+      fields.minNights = 'must be a whole number from 1 to 3650';
+    }
+    if (input?.maxNights !== undefined && input.maxNights !== null && !isCount(input.maxNights, 1)) {
+      fields.maxNights = 'must be a whole number from 1 to 3650, or null';
+    }
+    if (input?.maxAdvanceDays !== undefined && input.maxAdvanceDays !== null && !isCount(input.maxAdvanceDays, 0)) {
+      fields.maxAdvanceDays = 'must be a whole number from 0 to 3650, or null';
+    }
+    if (input?.closedToArrivalDays !== undefined && (!Array.isArray(input.closedToArrivalDays) ||
+      input.closedToArrivalDays.some(day => !Number.isInteger(day) || day < 0 || day > 6))) {
+      fields.closedToArrivalDays = 'must be an array of weekdays from 0 (Sunday) to 6 (Saturday)';
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid stay restrictions', fields);
+    }
+
+    const client = await getClient();
+
+    try {
+      const rooms = await client.query('SELECT 1 FROM rooms WHERE room_type = $1 LIMIT 1', [roomType]);
+      if (rooms.rows.length === 0) {
+        throw new NotFoundError('Room type not found');
+      }
+
+      const days = (input.closedToArrivalDays as number[] | undefined)?.filter((day, i, all) => all.indexOf(day) === i).sort((a, b) => a - b);
+      const result = await client.query(
+        `INSERT INTO stay_restrictions AS s (room_type, min_nights, max_nights, max_advance_days, closed_to_arrival_days)
+         VALUES ($1, COALESCE($2, 1), $4, $6, COALESCE($7::smallint[], '{}'))
+         ON CONFLICT (room_type) DO UPDATE
+         SET min_nights = COALESCE($2, s.min_nights),
+             max_nights = CASE WHEN $3 THEN $4 ELSE s.max_nights END,
+             max_advance_days = CASE WHEN $5 THEN $6 ELSE s.max_advance_days END,
+             closed_to_arrival_days = COALESCE($7::smallint[], s.closed_to_arrival_days),
+             updated_at = CURRENT_TIMESTAMP
+         RETURNING *`,
+        [
+          roomType, input.minNights ?? null, input.maxNights !== undefined, input.maxNights ?? null,
+          input.maxAdvanceDays !== undefined, input.maxAdvanceDays ?? null, days ?? null
+        ]
+      );
+
+      const restrictions = toRestrictions(result.rows[0]);
+      logger.info('Stay restrictions saved', { ...restrictions });
+      return restrictions;
+    } catch (error) {
+      // The table's check constraint catches a maximum below the (possibly unchanged) minimum
+      if (isCheckViolation(error)) {
+        throw new ValidationError('Invalid stay restrictions', { maxNights: 'must not be less than minNights' });
+      }
+      throw error;
+    } finally {
+      client.release();
+    }
+  }
+
+  async removeRestrictions(roomType: string): Promise<void> {
+    const client = await getClient();
+
+    try {
+      const result = await client.query('DELETE FROM stay_restrictions WHERE room_type = $1', [roomType]);
+      if (result.rowCount === 0) {
+        throw new NotFoundError('Room type has no stay restrictions');
+      }
+      logger.info('Stay restrictions removed', { roomType });
+    } finally {
+      client.release();
+    }
+  }
+
+  // Every rule of the room type the stay breaks, in a fixed order; empty when it may be booked
+  async violationsFor(
+    client: PoolClient, roomType: string, checkInDate: string, checkOutDate: string
+  ): Promise<StayRestrictionViolation[]> {
+    const result = await client.query('SELECT * FROM stay_restrictions WHERE room_type = $1', [roomType]);
+    if (result.rows.length === 0) {
+      return [];
+    }
+
+    const restrictions = toRestrictions(result.rows[0]);
+    const nights = nightsBetween(checkInDate, checkOutDate);
+    const violations: StayRestrictionViolation[] = [];
+    if (nights < restrictions.minNights) {
+      violations.push({ code: 'MIN_STAY', message: `${roomType} stays are at least ${restrictions.minNights} nights` });
+    }
+    if (restrictions.maxNights !== null && nights > restrictions.maxNights) {
+      violations.push({ code: 'MAX_STAY', message: `${roomType} stays are at most ${restrictions.maxNights} nights` });
+    }
+    if (restrictions.maxAdvanceDays !== null && checkInDate > addDays(today(), restrictions.maxAdvanceDays)) {
+      violations.push({
+        code: 'BEYOND_BOOKING_WINDOW',
+        message: `${roomType} stays can start at most ${restrictions.maxAdvanceDays} days ahead (${addDays(today(), restrictions.maxAdvanceDays)})`
+      });
+    }
+    const weekday = new Date(`${checkInDate}T00:00:00Z`).getUTCDay();
+    if (restrictions.closedToArrivalDays.includes(weekday)) {
+      violations.push({ code: 'CLOSED_TO_ARRIVAL', message: `${roomType} is closed to arrivals on ${WEEKDAYS[weekday]}s` });
+    }
+    return violations;
+  }
+
+  // Throws a StayRestrictionError listing every rule the stay breaks. Every path that books a stay or changes its
+  // dates or room goes through this.
+  async assertAllowed(client: PoolClient, roomType: string, checkInDate: string, checkOutDate: string): Promise<void> {
+    const violations = await this.violationsFor(client, roomType, checkInDate, checkOutDate);
+    if (violations.length > 0) {
+      throw new StayRestrictionError(violations, Object.fromEntries(violations.map(violation => [
+        violation.code === 'MIN_STAY' || violation.code === 'MAX_STAY' ? 'checkOutDate' : 'checkInDate', violation.message
+      ])));
+    }
+  }
+}
@@ -0,0 +1,204 @@
+import { AsyncLocalStorage } from 'async_hooks';
+import { PoolClient } from 'pg';
+import { getClient } from '../config/database';
+import { logger } from '../utils/logger';
+import { markStage, recordTransactionOutcome } from '../utils/stageTiming';
+import { metrics } from '../utils/metrics';
+import { deadlockLog } from '../utils/deadlockLog';
+import { isolationConfig } from '../config/isolation';
+import { ConflictError } from '../utils/errors';
+
+export type IsolationLevel = 'READ COMMITTED' | 'REPEATABLE READ' | 'SERIALIZABLE';
+
+export interface TransactionOptions {
+  name?: string;
+  isolationLevel?: IsolationLevel;
+  readOnly?: boolean;
+  deferrable?: boolean;
+}
+
+export type AfterCommitHook = () => void | Promise<void>;
+
+export interface Transaction {
+  client: PoolClient;
+  // Runs only once the outermost transaction has committed
+  afterCommit(hook: AfterCommitHook): void;
+}
+
+interface TransactionState {
+  client: PoolClient;
+  hooks: AfterCommitHook[];
+  savepoints: number;
+}
+
+const currentTransaction = new AsyncLocalStorage<TransactionState>();
+
+function beginStatement(options: TransactionOptions): string {
+  const modes: string[] = [];
+  if (options.isolationLevel) {
+    modes.push(`ISOLATION LEVEL ${options.isolationLevel}`);
+  }
+  if (options.readOnly) {
+    modes.push('READ ONLY');
+  }
+  if (options.deferrable) {
+    modes.push('DEFERRABLE');
+  }
+  return modes.length > 0 ? `BEGIN ${modes.join(' ')}` : 'BEGIN';
+}
+
+// Whether the caller is running inside runInTransaction
+export function inTransaction(): boolean {
+  return currentTransaction.getStore() !== undefined;
+}
+
+const SERIALIZATION_FAILURE = '40001';
+const DEADLOCK_DETECTED = '40P01';
+
+const errorCode = (error: unknown) => (error as { code?: unknown } | null)?.code;
+
+// Random between half and all of the doubled delay, so transactions that collided don't rerun in lockstep
+export function retryDelayMs(attempt: number): number {
+  const ceiling = Math.min(isolationConfig.retryMaxDelayMs, isolationConfig.retryBaseDelayMs * 2 ** (attempt - 1));
+  return Math.round(ceiling / 2 + Math.random() * ceiling / 2);
+}
+
+// Runs fn inside a transaction. Calls made while another transaction is active in the same
+// async context join it through a savepoint, so only the failing inner block is rolled back.
+// Nested calls must be awaited one at a time: they share the outer connection.
+// A level configured for the transaction's name in TX_ISOLATION_LEVELS replaces the one asked for, and a
+// serialization failure reruns fn from the start in a new transaction, up to TX_SERIALIZATION_RETRIES times.
+export async function runInTransaction<T>(
+  fn: (tx: Transaction) => Promise<T>,
+  options: TransactionOptions = {}
+): Promise<T> {
+  const outer = currentTransaction.getStore();
+  if (outer) {
+    return runInSavepoint(outer, fn);
+  }
+  return runWithRetries(fn, options, [SERIALIZATION_FAILURE], isolationConfig.serializationRetries + 1);
+}
+
+// Like runInTransaction, for writes that can deadlock with each other under load: deadlocks are rerun as
+// well, up to TX_RETRY_MAX_ATTEMPTS attempts in all. When they run out the caller gets a ConflictError asking
+// the client to try again rather than the raw database error. Nested calls join the outer transaction, which
+// decides whether to rerun.
+export async function runInTransactionWithRetry<T>(
+  fn: (tx: Transaction) => Promise<T>,
+  options: TransactionOptions & { maxAttempts?: number } = {}
+): Promise<T> {
+  const outer = currentTransaction.getStore();
+  if (outer) {
+    return runInSavepoint(outer, fn);
+  }
+
+  try {
+    return await runWithRetries(
+      fn, options, [SERIALIZATION_FAILURE, DEADLOCK_DETECTED], options.maxAttempts ?? isolationConfig.retryMaxAttempts
+    );
+  } catch (error) {
+    const code = errorCode(error);
+    if (code === SERIALIZATION_FAILURE || code === DEADLOCK_DETECTED) {
+      throw new ConflictError('The request clashed with concurrent changes; please try again');
+    }
+    throw error;
+  }
+}
+
+async function runWithRetries<T>(
+  fn: (tx: Transaction) => Promise<T>, options: TransactionOptions, retryCodes: string[], maxAttempts: number
+): Promise<T> {
+  const name = options.name || 'transaction';
+  const configured = { ...options, isolationLevel: isolationConfig.levels[name] ?? options.isolationLevel };
+  for (let attempt = 1; ; attempt++) {
+    try {
+      return await runOnce(fn, configured, name);
+    } catch (error) {
+      const code = errorCode(error);
+      const retry = typeof code === 'string' && retryCodes.includes(code) && attempt < maxAttempts;
+      if (code === DEADLOCK_DETECTED) {
+        const detail = (error as { detail?: unknown }).detail;
+        deadlockLog.record({ transaction: name, attempt, retried: retry, detail: typeof detail === 'string' ? detail : null });
+      }
+      if (!retry) {
+        throw error;
+      }
+      const delayMs = retryDelayMs(attempt);
+      metrics.increment(code === DEADLOCK_DETECTED ? 'transactions.deadlock_retries' : 'transactions.serialization_retries');
+      logger.warn('Retrying transaction', {
+        transaction: name, attempt, code, delayMs, isolationLevel: configured.isolationLevel
+      });
+      await new Promise(resolve => setTimeout(resolve, delayMs));
+    }
+  }
+}
+
+async function runOnce<T>(fn: (tx: Transaction) => Promise<T>, options: TransactionOptions, name: string): Promise<T> {
+  const client = await getClient();
+  const state: TransactionState = { client, hooks: [], savepoints: 0 };
+  let releaseError: Error | undefined;
+  let result: T;
+
+  try {
+    await client.query(beginStatement(options));
+    result = await currentTransaction.run(state, () => fn({
+      client,
+      afterCommit: hook => state.hooks.push(hook)
+    }));
+    await client.query('COMMIT');
+    markStage('commit');
+    recordTransactionOutcome('committed');
+
+  } catch (error) {
+    markStage('rollback');
+    recordTransactionOutcome('rolled_back');
+    try {
+      await client.query('ROLLBACK');
+    } catch (rollbackError) {
+      // Connection is unusable; make the pool discard it instead of reusing it
+      releaseError = rollbackError instanceof Error ? rollbackError : new Error(String(rollbackError));
+      logger.error('Rollback failed', { transaction: name, error: releaseError.message });
+    }
+    logger.error('Transaction rolled back', {
+      transaction: name,
+      error: error instanceof Error ? error.message : String(error)
+    });
+    throw error;
+  } finally {
+    client.release(releaseError);
+  }
+
+  for (const hook of state.hooks) {
+    try {
+      await hook();
+    } catch (error) {
+      logger.error('After-commit hook failed', {
+        transaction: name,
+        error: error instanceof Error ? error.message : String(error)
+      });
+    }
+  }
+
+  return result;
+}
+
+async function runInSavepoint<T>(state: TransactionState, fn: (tx: Transaction) => Promise<T>): Promise<T> {
+  const savepoint = `sp_${++state.savepoints}`;
+  const hookCount = state.hooks.length;
+
+  await state.client.query(`SAVEPOINT ${savepoint}`);
+
+  try {
+    const result = await fn({
+      client: state.client,
+      afterCommit: hook => state.hooks.push(hook)
+    });
+    await state.client.query(`RELEASE SAVEPOINT ${savepoint}`);
+    return result;
+  } catch (error) {
+    await state.client.query(`ROLLBACK TO SAVEPOINT ${savepoint}`);
+    // Hooks registered by the rolled-back block must not fire
+    state.hooks.length = hookCount;
+    throw error;
+  }
+}
@@ -0,0 +1,296 @@
+import { PoolClient } from 'pg';
+import { getClient } from '../config/database';
+import { runInTransaction } from './transactionManager';
+import { PricingService } from './pricingService';
+import { RatePlanService } from './ratePlanService';
+import { AuditService } from './auditService';
+import { StayRestrictionService } from './stayRestrictionService';
+import { toStayDiscount } from './promoCodeService';
+import { LOYALTY_PAYMENT_METHOD } from './loyaltyService';
+import { claimRoom, recordRoomStatus } from './roomStatusHistoryService';
+import { assertNotInMaintenance } from './maintenanceService';
+import { assertNotDisputed } from './disputeService';
+import { tryLockRoomStay } from './advisoryLocks';
+import { usesAdvisoryRoomLocks } from './bookingService';
+import { versionedRow } from './optimisticLocks';
+import { logger } from '../utils/logger';
+import { BookingStateError, ConflictError, NotFoundError, StayRestrictionError, ValidationError } from '../utils/errors';
+import { formatDate } from '../utils/date';
+import { eventBus } from '../events/eventBus';
+import { Booking, PriceBreakdown, Room, UpgradeBid } from '../types';
+
+export interface UpgradeBidInput {
+  roomType?: unknown;
+  maxAmount?: unknown;
+}
+
+const roundMoney = (amount: number) => Math.round(amount * 100) / 100;
+
+const toUpgradeBid = (row: any): UpgradeBid => ({
+  ...row,
+  max_amount: Number(row.max_amount),
+  charged_amount: row.charged_amount === null ? null : Number(row.charged_amount)
+});
+
+// Guests of a sold-out room type bid the most they would pay on top of their stay to move up to it.
+// When a room of the type frees up the highest bid whose price difference fits is awarded.
+export class UpgradeBidService {
+  private pricingService = new PricingService();
+  private ratePlanService = new RatePlanService();
+  private auditService = new AuditService();
+  private stayRestrictionService = new StayRestrictionService();
+
+  async placeBid(bookingId: number, input: UpgradeBidInput): Promise<UpgradeBid> {
+    const fields: Record<string, string> = {};
+    if (typeof input?.roomType !== 'string' || input.roomType.trim() === '') {
+      fields.roomType = 'must be a room type';
+    }
+    if (typeof input?.maxAmount !== 'number' || !(input.maxAmount > 0)) {
+      fields.maxAmount = 'must be a positive number';
+    }
+    if (Object.keys(fields).length > 0) {
+      throw new ValidationError('Invalid upgrade bid', fields);
+    }
+    const roomType = (input.roomType as string).trim();
+
+    return runInTransaction(async ({ client }) => {
+      const bookingResult = await client.query(
+        `SELECT b.*, r.room_type AS current_room_type, r.price_per_night AS current_price
+         FROM bookings b JOIN rooms r ON r.id = b.room_id
+         WHERE b.id = $1
+         FOR UPDATE OF b`,
+        [bookingId]
+      );
+      const booking = bookingResult.rows[0];
+      if (!booking) {
+        throw new NotFoundError('Booking not found');
+      }
+      if (booking.status !== 'pending' && booking.status !== 'confirmed') {
+        throw new ConflictError(`Cannot bid for an upgrade on a ${booking.status} booking`);
+      }
+      await assertNotDisputed(client, bookingId, booking.status);
+
+      const target = await client.query(
+        `SELECT MIN(price_per_night) AS price_per_night, BOOL_OR(is_available) AS any_available
+         FROM rooms WHERE room_type = $1 AND retired_at IS NULL AND NOT is_sandbox`,
+        [roomType]
+      );
+      const { price_per_night: targetPrice, any_available: anyAvailable } = target.rows[0];
+      if (targetPrice === null) {
+        throw new ValidationError('Invalid upgrade bid', { roomType: 'no rooms of this type exist' });
+      }
+      if (Number(targetPrice) <= Number(booking.current_price)) {
+        throw new ValidationError('Invalid upgrade bid', {
+          roomType: `must be a higher category than the booked ${booking.current_room_type} room`
+        });
+      }
+      if (anyAvailable) {
+        throw new ConflictError(`${roomType} rooms are not sold out; bids are only taken for sold-out room types`);
+      }
+
+      const existing = await client.query(
+        `SELECT id FROM upgrade_bids WHERE booking_id = $1 AND status = 'open'`,
+        [bookingId]
+      );
+      if (existing.rows.length > 0) {
+        throw new ConflictError('Booking already has an open upgrade bid');
+      }
+
+      const result = await client.query(
+        `INSERT INTO upgrade_bids (booking_id, room_type, max_amount)
+         VALUES ($1, $2, $3)
+         RETURNING *`,
+        [bookingId, roomType, input.maxAmount]
+      );
+
+      logger.info('Upgrade bid placed', { bookingId, bidId: result.rows[0].id, roomType });
+      return toUpgradeBid(result.rows[0]);
+    }, { name: 'placeUpgradeBid' });
+  }
+
+  // Newest first; null when the booking does not exist
+  async getBids(bookingId: number): Promise<UpgradeBid[] | null> {
+    const client = await getClient();
+
+    try {
+      const booking = await client.query('SELECT id FROM bookings WHERE id = $1', [bookingId]);
+      if (booking.rows.length === 0) {
+        return null;
+      }
+
+      const result = await client.query(
+        'SELECT * FROM upgrade_bids WHERE booking_id = $1 ORDER BY created_at DESC, id DESC',
+        [bookingId]
+      );
+      return result.rows.map(toUpgradeBid);
+    } finally {
+      client.release();
+    }
+  }
+
+  // Awards a freed room to the best open bid for its type. Bids that can't take the room (price difference
+  // above the bid, or a booking no longer upcoming) are declined and the next best is tried. The move,
+  // the repricing and the charge for the difference commit together or not at all.
+  async processRoom(roomId: number): Promise<UpgradeBid | null> {
+    for (;;) {
+      const outcome = await runInTransaction(async ({ client, afterCommit }) => {
+        const roomResult = await client.query('SELECT * FROM rooms WHERE id = $1 FOR UPDATE', [roomId]);
+        const room: Room | undefined = roomResult.rows[0];
+        if (!room || !room.is_available || room.retired_at !== null) {
+          return { bid: null, done: true };
+        }
+
+        const bidResult = await client.query(
+          `SELECT * FROM upgrade_bids
+           WHERE room_type = $1 AND status = 'open'
+           ORDER BY max_amount DESC, created_at, id
+           LIMIT 1
+           FOR UPDATE SKIP LOCKED`,
+          [room.room_type]
+        );
+        const bid: UpgradeBid | undefined = bidResult.rows[0] && toUpgradeBid(bidResult.rows[0]);
+        if (!bid) {
+          return { bid: null, done: true };
+        }
+
+        const bookingResult = await client.query('SELECT * FROM bookings WHERE id = $1 FOR UPDATE', [bid.booking_id]);
+        const booking: Booking = bookingResult.rows[0];
+        if (booking.status !== 'pending' && booking.status !== 'confirmed') {
+          await this.decline(client, bid.id, `booking is ${booking.status}`);
+          return { bid: null, done: false };
+        }
+
+        const checkInDate = formatDate(booking.check_in_date);
+        const checkOutDate = formatDate(booking.check_out_date);
+        const priceBreakdown = this.pricingService.priceStay(
+          room.price_per_night,
+          checkInDate,
+          checkOutDate,
+          await this.stayDiscount(client, booking),
+          await this.ratePlanService.adjustmentsFor(client, room.room_type, room.price_per_night, checkInDate, checkOutDate)
+        );
+        const delta = roundMoney(priceBreakdown.total - Number(booking.total_amount));
+        if (delta > bid.max_amount) {
+          await this.decline(client, bid.id, `price difference ${delta} is above the bid`);
+          return { bid: null, done: false };
+        }
+
+        try {
+          await this.assertRelocatable(client, booking, room);
+        } catch (error) {
+          // A disputed booking, or a stay the room type's restrictions forbid, declines the bid; a room that is
+          // in maintenance or being booked right now leaves the bids open for the next time it frees up
+          if (error instanceof StayRestrictionError) {
+            await this.decline(client, bid.id, error.violations.map(violation => violation.message).join('; '));
+            return { bid: null, done: false };
+          }
+          if (error instanceof BookingStateError) {
+            await this.decline(client, bid.id, error.message);
+            return { bid: null, done: false };
+          }
+          if (error instanceof ConflictError) {
+            logger.info('Upgrade room not awarded', { roomId, bidId: bid.id, reason: error.message });
+            return { bid: null, done: true };
+          }
+          throw error;
+        }
+
+        const awarded = await this.relocate(client, booking, room, priceBreakdown, delta, bid);
+        afterCommit(() => {
+          eventBus.publish('upgrade.awarded', {
+            bidId: bid.id, bookingId: booking.id, fromRoomId: booking.room_id, toRoomId: room.id
+          });
+        });
+        return { bid: awarded, done: true };
+      }, { name: 'awardUpgrade' });
+
+      if (outcome.done) {
+        if (outcome.bid) {
+          logger.info('Upgrade awarded', { bidId: outcome.bid.id, bookingId: outcome.bid.booking_id, roomId });
+        }
+        return outcome.bid;
+      }
+    }
+  }
+
+  // Everything that can stop the move, checked before relocate writes anything
+  private async assertRelocatable(client: PoolClient, booking: Booking, room: Room): Promise<void> {
+    const checkInDate = formatDate(booking.check_in_date);
+    const checkOutDate = formatDate(booking.check_out_date);
+    await assertNotDisputed(client, booking.id, booking.status);
+    await this.stayRestrictionService.assertAllowed(client, room.room_type, checkInDate, checkOutDate);
+    await assertNotInMaintenance(client, room.id, checkInDate, checkOutDate);
+    // Bookings under the advisory strategy don't take the room's row lock. The row lock held here makes them
+    // wait, so waiting for their stay lock in turn could deadlock; a busy stay counts as a taken room instead.
+    if (usesAdvisoryRoomLocks() && !await tryLockRoomStay(client, room.id, checkInDate, checkOutDate)) {
+      throw new ConflictError('Room is being booked');
+    }
+  }
+
+  private async relocate(
+    client: PoolClient, booking: Booking, room: Room, priceBreakdown: PriceBreakdown,
+    delta: number, bid: UpgradeBid
+  ): Promise<UpgradeBid> {
+    const moved = versionedRow<Booking>(await client.query(
+      `UPDATE bookings
+       SET room_id = $1, total_amount = $2, price_breakdown = $3, version = version + 1, updated_at = CURRENT_TIMESTAMP
+       WHERE id = $4 AND version = $5
+       RETURNING *`,
+      [room.id, priceBreakdown.total, JSON.stringify(priceBreakdown), booking.id, booking.version]
+    ), 'booking', booking.id, booking.version);
+    const stay = { bookingId: booking.id, startDate: booking.check_in_date, endDate: booking.check_out_date };
+    await claimRoom(client, room.id, 'upgraded_in', stay);
+    await client.query(
+      'UPDATE rooms SET is_available = TRUE, updated_at = CURRENT_TIMESTAMP WHERE id = $1',
+      [booking.room_id]
+    );
+    await recordRoomStatus(client, booking.room_id, 'upgraded_out', stay);
+
+    if (delta !== 0) {
+      await client.query(
+        `INSERT INTO price_adjustments (booking_id, previous_amount, new_amount, delta, reason)
+         VALUES ($1, $2, $3, $4, 'upgrade')`,
+        [booking.id, booking.total_amount, priceBreakdown.total, delta]
+      );
+    }
+    if (delta > 0) {
+      // Charged with the method the stay was paid with (a stay paid only in points is left to settlement)
+      const transactionId = `TXN_${Date.now()}_${Math.random().toString(36).substr(2, 9)}`;
+      await client.query(
+        `INSERT INTO payments (booking_id, amount, payment_method, status, transaction_id)
+         SELECT $1, $2, payment_method, 'completed', $3
+         FROM payments WHERE booking_id = $1 AND payment_method <> $4
+         ORDER BY id LIMIT 1`,
+        [booking.id, delta, transactionId, LOYALTY_PAYMENT_METHOD]
+      );
+    }
+
+    await this.auditService.recordBookingChange(client, 'upgraded', booking, moved);
+
+    const awarded = await client.query(
+      `UPDATE upgrade_bids SET status = 'awarded', charged_amount = $1, processed_at = CURRENT_TIMESTAMP
+       WHERE id = $2
+       RETURNING *`,
+      [delta, bid.id]
+    );
+    return toUpgradeBid(awarded.rows[0]);
+  }
+
+  private async decline(client: PoolClient, bidId: number, reason: string): Promise<void> {
+    await client.query(
+      `UPDATE upgrade_bids SET status = 'declined', decline_reason = $1, processed_at = CURRENT_TIMESTAMP
+       WHERE id = $2`,
+      [reason, bidId]
+    );
+    logger.info('Upgrade bid declined', { bidId, reason });
+  }
+
+  // The booking's promo code carries over to the new room, as it does when the dates change
+  private async stayDiscount(client: PoolClient, booking: Booking) {
+    if (booking.promo_code_id === null) {
+      return undefined;
+    }
+    const promo = await client.query('SELECT * FROM promo_codes WHERE id = $1', [booking.promo_code_id]);
+    return toStayDiscount(promo.rows[0]);
+  }
+}
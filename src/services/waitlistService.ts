@@ -0,0 +1,158 @@
+import { BookingRequest, BookingService } from './bookingService';
+import { runInTransaction } from './transactionManager';
+import { openContactField, sealContact } from './guestContact';
+import { assertNotInMaintenance } from './maintenanceService';
+import { getClient } from '../config/database';
+import { logger } from '../utils/logger';
+import { ConflictError, RoomOutOfServiceError, ValidationError } from '../utils/errors';
+import { formatDate } from '../utils/date';
+import { normalizeName } from '../utils/names';
+import { eventBus } from '../events/eventBus';
+import { WaitlistEntry } from '../types';
+
+export interface WaitlistRequest extends BookingRequest {
+  autoBook?: boolean;
+}
+
+// Contact details are stored encrypted like a guest's; see guestContact.ts
+function toEntry(row: any): WaitlistEntry {
+  const { pii_key_id: keyId, ...entry } = row;
+  return {
+    ...entry,
+    guest_email: openContactField(row.guest_email, 'email', keyId),
+    guest_phone: openContactField(row.guest_phone, 'phone', keyId)
+  };
+}
+
+export class WaitlistService {
+  constructor(private bookingService: BookingService = new BookingService()) {}
+
+  // Queues a guest for a room that is taken; entries are served first come, first served when the room frees up.
+  // A free room should be booked instead, and a retired room or one in maintenance during the stay won't free up.
+  async join(request: WaitlistRequest): Promise<WaitlistEntry> {
+    if (request.roomType !== undefined) {
+      throw new ValidationError('Invalid waitlist request', { roomType: 'the waitlist is per room; pass roomId' });
+    }
+    this.bookingService.validateBookingRequest({ ...request, holdToken: undefined });
+    if (request.autoBook !== undefined && typeof request.autoBook !== 'boolean') {
+      throw new ValidationError('Invalid waitlist request', { autoBook: 'must be a boolean' });
+    }
+
+    const client = await getClient();
+    try {
+      const room = await client.query('SELECT id, is_available, retired_at FROM rooms WHERE id = $1', [request.roomId]);
+      if (room.rows.length === 0) {
+        throw new ValidationError('Invalid waitlist request', { roomId: 'room does not exist' });
+      }
+      if (room.rows[0].retired_at !== null) {
+        throw new RoomOutOfServiceError('Room has been retired');
+      }
+      await assertNotInMaintenance(client, request.roomId!, request.checkInDate, request.checkOutDate);
+      if (room.rows[0].is_available) {
+        throw new ConflictError('Room is available for these dates; book it instead');
+      }
+
+      const contact = sealContact(request.guestEmail, request.guestPhone);
+      const result = await client.query(
+        `INSERT INTO booking_waitlist
+           (room_id, check_in_date, check_out_date, guest_name, guest_email, guest_phone, pii_key_id, payment_method, auto_book)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+         RETURNING *`,
+        [request.roomId, request.checkInDate, request.checkOutDate, normalizeName(request.guestName), contact.email,
+          contact.phone, contact.keyId, request.paymentMethod, request.autoBook ?? false]
+      );
+
+      logger.info('Guest joined waitlist', { entryId: result.rows[0].id, roomId: request.roomId });
+      return toEntry(result.rows[0]);
+    } finally {
+      client.release();
+    }
+  }
+
+  async getEntry(entryId: number): Promise<WaitlistEntry | null> {
+    const client = await getClient();
+    try {
+      const result = await client.query('SELECT * FROM booking_waitlist WHERE id = $1', [entryId]);
+      return result.rows[0] ? toEntry(result.rows[0]) : null;
+    } finally {
+      client.release();
+    }
+  }
+
+  // Serves the oldest waiting entry for a freed room: auto-book entries are booked on the spot,
+  // the rest are marked notified. An auto-book that fails for any reason other than the room
+  // being taken again (a retired room, maintenance, invalid details) marks the entry failed and moves on to the next one.
+  async processRoom(roomId: number): Promise<WaitlistEntry | null> {
+    for (;;) {
+      const outcome = await this.bookingService.queueForRoom({ roomId }, () => runInTransaction(async ({ client, afterCommit }) => {
+        const result = await client.query(
+          `SELECT * FROM booking_waitlist
+           WHERE room_id = $1 AND status = 'waiting'
+           ORDER BY created_at, id
+           LIMIT 1
+           FOR UPDATE SKIP LOCKED`,
+          [roomId]
+        );
+        const entry: WaitlistEntry | undefined = result.rows[0] && toEntry(result.rows[0]);
+        if (!entry) {
+          return { entry: null, done: true };
+        }
+
+        if (!entry.auto_book) {
+          const notified = await client.query(
+            `UPDATE booking_waitlist SET status = 'notified', processed_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING *`,
+            [entry.id]
+          );
+          afterCommit(() => {
+            eventBus.publish('waitlist.notified', { entryId: entry.id, roomId, guestEmail: entry.guest_email });
+          });
+          return { entry: toEntry(notified.rows[0]), done: true };
+        }
+
+        try {
+          // Nested transaction: a failed booking only rolls back its own savepoint
+          const booking = await this.bookingService.createBooking({
+            guestName: entry.guest_name,
+            guestEmail: entry.guest_email,
+            guestPhone: entry.guest_phone,
+            roomId,
+            checkInDate: formatDate(entry.check_in_date),
+            checkOutDate: formatDate(entry.check_out_date),
+            paymentMethod: entry.payment_method
+          });
+
+          const promoted = await client.query(
+            `UPDATE booking_waitlist SET status = 'promoted', booking_id = $1, processed_at = CURRENT_TIMESTAMP
+             WHERE id = $2 RETURNING *`,
+            [booking.booking.id, entry.id]
+          );
+          afterCommit(() => {
+            eventBus.publish('waitlist.promoted', { entryId: entry.id, roomId, bookingId: booking.booking.id });
+          });
+          return { entry: toEntry(promoted.rows[0]), done: true };
+        } catch (error) {
+          const errorMessage = error instanceof Error ? error.message : String(error);
+          if (error instanceof ConflictError && !(error instanceof RoomOutOfServiceError)) {
+            // Someone else got the room first; the entry keeps its place in line
+            return { entry: null, done: true };
+          }
+
+          await client.query(
+            `UPDATE booking_waitlist SET status = 'failed', failure_reason = $1, processed_at = CURRENT_TIMESTAMP
+             WHERE id = $2`,
+            [errorMessage, entry.id]
+          );
+          logger.warn('Waitlist auto-booking failed', { entryId: entry.id, roomId, error: errorMessage });
+          return { entry: null, done: false };
+        }
+      }, { name: 'processWaitlist' }));
+
+      if (outcome.done) {
+        if (outcome.entry) {
+          logger.info('Waitlist entry served', { entryId: outcome.entry.id, roomId, status: outcome.entry.status });
+        }
+        return outcome.entry;
+      }
+    }
+  }
+}
@@ -1,30 +1,98 @@
+export const BOOKING_STATUSES = ['pending', 'confirmed', 'checked_in', 'checked_out', 'cancelled', 'no_show'] as const;
+export type BookingStatus = typeof BOOKING_STATUSES[number];
+
 export interface Room {
   id: number;
   room_number: string;
   room_type: string;
   price_per_night: number;
+  floor: number | null;
+  view_type: RoomView | null;
+  smoking_allowed: boolean;
+  accessible: boolean;
   is_available: boolean;
+  retired_at: Date | null;
+  is_sandbox: boolean;
+  housekeeping_status: HousekeepingStatus;
+  housekeeping_updated_at: Date | null;
+  housekeeping_updated_by: string | null;
   created_at: Date;
   updated_at: Date;
 }
 
+export type RoomView = 'city' | 'garden' | 'pool' | 'sea';
+
+// Attributes a room picked by type must have; unset ones don't matter
+export interface RoomPreferences {
+  floor?: number;
+  view?: RoomView;
+  smoking?: boolean;
+  accessible?: boolean;
+}
+
+// Free rooms joined by connecting doors, for a party that wants to stay together
+export interface AdjoiningRoomSet {
+  roomIds: number[];
+  roomNumbers: string[];
+  roomTypes: string[];
+}
+
+export type HousekeepingStatus = 'dirty' | 'clean' | 'inspected';
+
+export interface HousekeepingTask {
+  room_id: number;
+  room_number: string;
+  room_type: string;
+  housekeeping_status: HousekeepingStatus;
+  task: 'clean' | 'inspect';
+  priority: 'high' | 'normal';
+  departing_booking_id: number | null;
+  arriving_booking_id: number | null;
+}
+
 export interface Guest {
   id: number;
   name: string;
   email: string;
   phone: string;
+  document_id: string | null;
+  booking_count: number;
+  loyalty_points: number;
   created_at: Date;
   updated_at: Date;
 }
 
+// One change to a guest's points balance; redeemed points are negative
+export interface LoyaltyTransaction {
+  id: number;
+  guest_id: number;
+  booking_id: number;
+  kind: 'earned' | 'redeemed' | 'restored';
+  points: number;
+  created_at: Date;
+}
+
 export interface Booking {
   id: number;
   guest_id: number;
+  // The name the stay is booked under; changing it leaves the guest's profile and other bookings alone
+  guest_name: string;
   room_id: number;
   check_in_date: Date;
   check_out_date: Date;
   total_amount: number;
-  status: 'pending' | 'confirmed' | 'cancelled';
+  price_breakdown: PriceBreakdown | null;
+  channel: string;
+  promo_code_id: number | null;
+  // Taken off the stay by the promo code, before tax
+  discount_amount: number;
+  // Shared by the bookings of adjoining rooms booked together
+  group_id: string | null;
+  status: BookingStatus;
+  cancellation_reason_code: CancellationReasonCode | null;
+  cancellation_reason_text: string | null;
+  cancelled_at: Date | null;
+  version: number;
   created_at: Date;
   updated_at: Date;
 }
@@ -34,8 +102,12 @@ export interface Payment {
   booking_id: number;
   amount: number;
   payment_method: string;
-  status: 'pending' | 'completed' | 'failed';
+  status: 'pending' | 'completed' | 'failed' | 'refunded';
   transaction_id: string;
+  // Creation time of the last gateway webhook applied to this payment
+  gateway_event_at: Date | null;
+  // Payment method surcharge included in amount
+  surcharge_amount: number;
   created_at: Date;
   updated_at: Date;
 }
@@ -43,8 +115,406 @@ export interface Payment {
 export interface Receipt {
   id: number;
   booking_id: number;
-  payment_id: number;
+  // null for a final receipt, which covers the whole stay rather than one payment
+  payment_id: number | null;
+  kind: 'payment' | 'final' | 'chargeback';
   receipt_number: string;
   total_amount: number;
+  // Payment method surcharge included in total_amount
+  surcharge_amount: number;
+  // Method and gateway transaction of the payment; refunds of it go back the same way. null for final receipts
+  payment_method: string | null;
+  gateway_reference: string | null;
+  // Emailing the receipt to the guest; null for receipts that are not mailed
+  email_status: 'pending' | 'sending' | 'sent' | 'failed' | null;
+  email_attempts: number;
+  email_last_error: string | null;
+  email_sent_at: Date | null;
+  // Bumped by every update, which only applies if the version is still the one it read
+  version: number;
   generated_at: Date;
-}
\ No newline at end of file
+}
+
+// A checked-out stay whose completed payments don't add up to the booking total; difference is paid minus folio
+export interface SettlementIssue {
+  id: number;
+  booking_id: number;
+  kind: 'underpaid' | 'overpaid';
+  folio_total: number;
+  paid_total: number;
+  difference: number;
+  status: 'open' | 'resolved';
+  resolution_note: string | null;
+  created_at: Date;
+  resolved_at: Date | null;
+}
+
+// A cardholder's challenge of a payment; while open the booking is frozen, and a lost dispute is charged back
+export interface PaymentDispute {
+  id: number;
+  receipt_id: number;
+  payment_id: number;
+  booking_id: number;
+  amount: number;
+  reason: string;
+  status: 'open' | 'won' | 'lost';
+  chargeback_payment_id: number | null;
+  resolution_note: string | null;
+  opened_at: Date;
+  resolved_at: Date | null;
+}
+
+export interface RoomHold {
+  id: number;
+  token: string;
+  room_id: number;
+  check_in_date: Date;
+  check_out_date: Date;
+  status: 'active' | 'converted' | 'released';
+  booking_id: number | null;
+  expires_at: Date;
+  created_at: Date;
+}
+
+// A room taken out of service for a date range. Like a stay, end_date is the day the room is back in service.
+export interface MaintenanceBlock {
+  id: number;
+  room_id: number;
+  start_date: string;
+  end_date: string;
+  reason: string;
+  status: 'active' | 'cancelled';
+  created_by: string;
+  created_at: Date;
+  cancelled_at: Date | null;
+}
+
+export interface Facility {
+  id: number;
+  name: string;
+  description: string | null;
+  // Room types the facility is attached to
+  room_types: string[];
+  created_at: Date;
+  updated_at: Date;
+}
+
+export interface RoomTypePhoto {
+  id: number;
+  room_type: string;
+  storage_key: string;
+  content_type: string;
+  size_bytes: number;
+  caption: string | null;
+  position: number;
+  url: string;
+  created_at: Date;
+}
+
+export interface WaitlistEntry {
+  id: number;
+  room_id: number;
+  check_in_date: Date;
+  check_out_date: Date;
+  guest_name: string;
+  guest_email: string;
+  guest_phone: string;
+  payment_method: string;
+  auto_book: boolean;
+  status: 'waiting' | 'notified' | 'promoted' | 'failed';
+  booking_id: number | null;
+  failure_reason: string | null;
+  created_at: Date;
+  processed_at: Date | null;
+}
+
+export const CANCELLATION_REASON_CODES = [
+  'guest_request',
+  'change_of_plans',
+  'found_alternative',
+  'payment_issue',
+  'duplicate_booking',
+  'hotel_initiated',
+  'other'
+] as const;
+
+export type CancellationReasonCode = typeof CANCELLATION_REASON_CODES[number];
+
+export interface CancellationReason {
+  code: CancellationReasonCode;
+  text?: string;
+}
+
+export interface NightlyRate {
+  date: string;
+  baseRate: number;
+  adjustments: { reason: string; amount: number }[];
+  taxes: number;
+  total: number;
+}
+
+export interface StayDiscount {
+  code: string;
+  type: 'percentage' | 'fixed';
+  value: number;
+}
+
+export interface PromoCode {
+  id: number;
+  code: string;
+  discount_type: 'percentage' | 'fixed';
+  discount_value: number;
+  valid_from: Date;
+  valid_until: Date;
+  // null means unlimited
+  usage_limit: number | null;
+  times_used: number;
+  // null means every room type
+  room_types: string[] | null;
+  active: boolean;
+  created_at: Date;
+}
+
+export interface Installment {
+  id: number;
+  booking_id: number;
+  sequence: number;
+  amount: number;
+  due_date: Date;
+  status: 'due' | 'paid' | 'overdue' | 'cancelled';
+  payment_id: number | null;
+  paid_at: Date | null;
+}
+
+export interface PaymentPlan {
+  bookingId: number;
+  status: 'active' | 'completed' | 'overdue' | 'cancelled';
+  total: number;
+  paid: number;
+  outstanding: number;
+  nextDue: { sequence: number; amount: number; dueDate: string } | null;
+  installments: Installment[];
+}
+
+// A guest's offer to move to a sold-out room type, paying up to max_amount on top of the stay
+export interface UpgradeBid {
+  id: number;
+  booking_id: number;
+  room_type: string;
+  max_amount: number;
+  status: 'open' | 'awarded' | 'declined';
+  // What the move actually cost the guest; set once awarded
+  charged_amount: number | null;
+  decline_reason: string | null;
+  created_at: Date;
+  processed_at: Date | null;
+}
+
+// A room type's nightly rate rules on top of the rooms' price_per_night. Each night takes, in order: the latest
+// starting season covering it (a fixed price or a multiplier), the weekend multiplier on Friday and Saturday
+// nights, and the multiplier of the highest occupancy tier the room type has reached that night.
+export interface RatePlan {
+  roomType: string;
+  weekendMultiplier: number;
+  occupancyTiers: OccupancyTier[];
+  seasons: RateSeason[];
+}
+
+// Per room type; null means no limit
+export interface StayRestrictions {
+  roomType: string;
+  minNights: number;
+  maxNights: number | null;
+  // Furthest ahead a stay may start, in days from today
+  maxAdvanceDays: number | null;
+  // Weekdays (0 Sunday to 6 Saturday) on which stays can't start
+  closedToArrivalDays: number[];
+}
+
+export type StayRestrictionCode = 'MIN_STAY' | 'MAX_STAY' | 'BEYOND_BOOKING_WINDOW' | 'CLOSED_TO_ARRIVAL';
+
+export interface StayRestrictionViolation {
+  code: StayRestrictionCode;
+  message: string;
+}
+
+export interface OccupancyTier {
+  // Share of the room type's rooms already booked that night, 0-100
+  minOccupancyPercent: number;
+  multiplier: number;
+}
+
+// Dates are inclusive and name nights, so a season ending on the 31st still prices the night of the 31st
+export interface RateSeason {
+  id: number;
+  room_type: string;
+  name: string;
+  start_date: string;
+  end_date: string;
+  price_per_night: number | null;
+  multiplier: number | null;
+  created_at: Date;
+}
+
+export interface PriceBreakdown {
+  nights: NightlyRate[];
+  subtotal: number;
+  taxes: number;
+  total: number;
+}
+
+// Outcome of cancelling a booking under its room type's cancellation policy
+export interface CancellationRecord {
+  id: number;
+  booking_id: number;
+  policy_code: string;
+  days_before_check_in: number;
+  paid_amount: number;
+  fee_amount: number;
+  refundable_amount: number;
+  fee_waived: boolean;
+  created_at: Date;
+  // Refunds started for refundable_amount, back to the methods the booking was paid with
+  refunds: Refund[];
+}
+
+// Money returned to the method a payment was made with. The gateway settles it later: pending until its
+// webhook says settled or failed. A method that can't be refunded fails straight away and needs manual handling.
+export interface Refund {
+  id: number;
+  booking_id: number;
+  payment_id: number;
+  receipt_id: number | null;
+  amount: number;
+  payment_method: string;
+  refund_reference: string;
+  status: 'pending' | 'settled' | 'failed';
+  failure_reason: string | null;
+  gateway_event_at: Date | null;
+  requested_at: Date;
+  settled_at: Date | null;
+  updated_at: Date;
+}
+
+// One change to a booking; changes maps each changed field to its old and new value
+export interface BookingAuditEntry {
+  id: number;
+  action: 'created' | 'updated' | 'cancelled' | 'status_changed' | 'upgraded';
+  actor: string;
+  changes: Record<string, { old: unknown; new: unknown }>;
+  transaction_id: string;
+  created_at: Date;
+}
+
+export type RoomStatusEvent =
+  | 'booked' | 'cancelled' | 'checked_out' | 'no_show' | 'held' | 'hold_released'
+  | 'upgraded_in' | 'upgraded_out' | 'orphan_released'
+  | 'maintenance_scheduled' | 'maintenance_cancelled' | 'retired' | 'reinstated';
+
+// What changed a room's status, with the booking, hold or maintenance block (and its dates) behind it
+export interface RoomStatusEntry {
+  id: number;
+  event: RoomStatusEvent;
+  // Whether the room was bookable right after the change
+  is_available: boolean;
+  booking_id: number | null;
+  hold_id: number | null;
+  maintenance_block_id: number | null;
+  start_date: string | null;
+  end_date: string | null;
+  actor: string;
+  transaction_id: string;
+  created_at: Date;
+}
+
+export type NoteVisibility = 'internal' | 'guest';
+
+// Staff comment on a booking; internal notes are never shown to the guest
+export interface BookingNote {
+  id: number;
+  booking_id: number;
+  author: string;
+  body: string;
+  visibility: NoteVisibility;
+  created_at: Date;
+}
+
+// Price preview for a stay; nothing is reserved, so available may change before the booking is made
+export interface BookingQuote {
+  roomId: number;
+  roomNumber: string;
+  roomType: string;
+  available: boolean;
+  checkInDate: string;
+  checkOutDate: string;
+  priceBreakdown: PriceBreakdown;
+  total: number;
+  taxes: number;
+  // Added to the total when paying with the quoted paymentMethod (0 without one)
+  surcharge: number;
+  amountDue: number;
+  cancellation: {
+    policyCode: string;
+    displayName: string;
+    // Last day a cancellation is free; null for non-refundable stays
+    freeUntil: string | null;
+    lateFeePercent: number;
+    lateFeeAmount: number;
+  };
+  // Rules of the room type the stay breaks; a booking for it would be refused
+  restrictionViolations: StayRestrictionViolation[];
+  // Only when upgrades were asked for and the room is not available
+  upgrades?: UpgradeCandidate[];
+}
+
+export interface UpgradeCandidate {
+  roomId: number;
+  roomNumber: string;
+  roomType: string;
+  pricePerNight: number;
+  total: number;
+  // More than the quoted total
+  priceDifference: number;
+}
+
+// Price change caused by modifying a stay; a positive delta is owed by the guest, a negative one is refunded
+export interface PriceAdjustment {
+  id: number;
+  booking_id: number;
+  previous_amount: number;
+  new_amount: number;
+  delta: number;
+  reason: string;
+  created_at: Date;
+}
+
+export type BookingSagaStatus = 'awaiting_payment' | 'completed' | 'compensated';
+
+// A booking made before it was paid; completed once the gateway confirms the payment, compensated (the booking
+// cancelled) when the payment fails or doesn't arrive in time
+export interface BookingSaga {
+  id: number;
+  booking_id: number;
+  status: BookingSagaStatus;
+  // Booking total plus the payment method's surcharge
+  amount: number;
+  payment_method: string;
+  payment_id: number | null;
+  receipt_id: number | null;
+  failure_reason: string | null;
+  expires_at: Date;
+  created_at: Date;
+  updated_at: Date;
+}
+
+export interface OutboxMessage {
+  id: number;
+  topic: string;
+  payload: Record<string, unknown>;
+  attempts: number;
+  available_at: Date;
+  processed_at: Date | null;
+  failed_at: Date | null;
+  last_error: string | null;
+  created_at: Date;
+}
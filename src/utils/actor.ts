@@ -0,0 +1,12 @@
+import { AsyncLocalStorage } from 'async_hooks';
+
+const storage = new AsyncLocalStorage<string>();
+
+export function runAsActor<T>(actor: string, fn: () => T): T {
+  return storage.run(actor, fn);
+}
+
+// Who is making the current change, for the audit trail; background workers act as "system"
+export function currentActor(): string {
+  return storage.getStore() ?? 'system';
+}
@@ -0,0 +1,59 @@
+// Parses RFC 4180 CSV: fields may be quoted, quoted fields may hold commas, line breaks and "" for a quote.
+// Returns the records with the line each starts on; blank lines are skipped.
+export function parseCsv(text: string): { line: number; fields: string[] }[] {
+  const records: { line: number; fields: string[] }[] = [];
+  let fields: string[] = [];
+  let field = '';
+  let quoted = false;
+  let line = 1;
+  let recordLine = 1;
+
+  const endRecord = () => {
+    fields.push(field);
+    if (fields.length > 1 || fields[0].trim() !== '') {
+      records.push({ line: recordLine, fields });
+    }
+    fields = [];
+    field = '';
+  };
+
+  // A byte order mark from a spreadsheet export is not part of the first header
+  const input = text.replace(/^\uFEFF/, '');
+  for (let i = 0; i < input.length; i++) {
+    const char = input[i];
+    if (quoted) {
+      if (char === '"' && input[i + 1] === '"') {
+        field += '"';
+        i++;
+      } else if (char === '"') {
+        quoted = false;
+      } else {
+        if (char === '\n') {
+          line++;
+        }
+        field += char;
+      }
+    } else if (char === '"' && field === '') {
+      quoted = true;
+    } else if (char === ',') {
+      fields.push(field);
+      field = '';
+    } else if (char === '\n' || char === '\r') {
+      if (char === '\r' && input[i + 1] === '\n') {
+        i++;
+      }
+      endRecord();
+      line++;
+      recordLine = line;
+    } else {
+      field += char;
+    }
+  }
+  if (quoted) {
+    throw new Error(`Unterminated quoted field starting on line ${recordLine}`);
+  }
+  if (field !== '' || fields.length > 0) {
+    endRecord();
+  }
+  return records;
+}
@@ -0,0 +1,37 @@
+const DATE_PATTERN = /^\d{4}-\d{2}-\d{2}$/;
+const MS_PER_DAY = 1000 * 60 * 60 * 24;
+
+// Accepts only real calendar dates in YYYY-MM-DD form (rejects 2024-02-30 etc.)
+export function isValidDateString(value: unknown): value is string {
+  if (typeof value !== 'string' || !DATE_PATTERN.test(value)) {
+    return false;
+  }
+  const date = new Date(`${value}T00:00:00Z`);
+  return !isNaN(date.getTime()) && date.toISOString().slice(0, 10) === value;
+}
+
+// pg returns DATE columns as local-midnight Date objects
+export function formatDate(date: Date | string): string {
+  if (typeof date === 'string') {
+    return date.slice(0, 10);
+  }
+  const year = date.getFullYear();
+  const month = String(date.getMonth() + 1).padStart(2, '0');
+  const day = String(date.getDate()).padStart(2, '0');
+  return `${year}-${month}-${day}`;
+}
+
+export function nightsBetween(checkInDate: string, checkOutDate: string): number {
+  const diff = Date.parse(`${checkOutDate}T00:00:00Z`) - Date.parse(`${checkInDate}T00:00:00Z`);
+  return Math.round(diff / MS_PER_DAY);
+}
+
+export function addDays(date: string, days: number): string {
+  const result = new Date(`${date}T00:00:00Z`);
+  result.setUTCDate(result.getUTCDate() + days);
+  return result.toISOString().slice(0, 10);
+}
+
+export function today(): string {
+  return formatDate(new Date());
+}
@@ -0,0 +1,41 @@
+// Deadlocks kept for GET /api/debug/locks; older ones drop off
+const MAX_EVENTS = 50;
+
+export interface DeadlockEvent {
+  transaction: string;
+  attempt: number;
+  // Whether the transaction was rerun after Postgres picked it as the victim
+  retried: boolean;
+  // Postgres' account of the cycle: which process waited for which lock, held by whom
+  detail: string | null;
+  at: string;
+}
+
+// The deadlocks this process' transactions lost, newest last. Postgres breaks a deadlock by failing one of its
+// transactions, so this is the only trace left once the other one has gone on.
+class DeadlockLog {
+  private static instance: DeadlockLog;
+  private events: DeadlockEvent[] = [];
+
+  private constructor() {}
+
+  static getInstance(): DeadlockLog {
+    if (!DeadlockLog.instance) {
+      DeadlockLog.instance = new DeadlockLog();
+    }
+    return DeadlockLog.instance;
+  }
+
+  record(event: Omit<DeadlockEvent, 'at'>) {
+    this.events.push({ ...event, at: new Date().toISOString() });
+    if (this.events.length > MAX_EVENTS) {
+      this.events.shift();
+    }
+  }
+
+  recent(): DeadlockEvent[] {
+    return [...this.events];
+  }
+}
+
+export const deadlockLog = DeadlockLog.getInstance();
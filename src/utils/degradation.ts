@@ -0,0 +1,76 @@
+import { degradationConfig } from '../config/degradation';
+import { logger } from './logger';
+
+export interface DegradedComponent {
+  component: string;
+  reason: string;
+  since: string;
+}
+
+// Returns why the component is degraded right now, or null when it is fine. Checks run on every
+// response, so they must only look at in-process state.
+type DegradationCheck = () => string | null;
+
+// Tracks which dependencies are running degraded, either from a live check or because code that talks
+// to them reported a problem (which then lasts reportTtlMs)
+class Degradation {
+  private static instance: Degradation;
+  private checks = new Map<string, DegradationCheck>();
+  private reports = new Map<string, { reason: string; until: number }>();
+  private since = new Map<string, Date>();
+
+  private constructor() {}
+
+  static getInstance(): Degradation {
+    if (!Degradation.instance) {
+      Degradation.instance = new Degradation();
+    }
+    return Degradation.instance;
+  }
+
+  registerCheck(component: string, check: DegradationCheck) {
+    this.checks.set(component, check);
+  }
+
+  report(component: string, reason: string, forMs: number = degradationConfig.reportTtlMs) {
+    this.reports.set(component, { reason, until: Date.now() + forMs });
+  }
+
+  degradedComponents(): DegradedComponent[] {
+    const reasons = new Map<string, string>();
+    this.checks.forEach((check, component) => {
+      try {
+        const reason = check();
+        if (reason) {
+          reasons.set(component, reason);
+        }
+      } catch (error) {
+        reasons.set(component, `health check failed: ${error instanceof Error ? error.message : String(error)}`);
+      }
+    });
+    this.reports.forEach((report, component) => {
+      if (report.until <= Date.now()) {
+        this.reports.delete(component);
+      } else if (!reasons.has(component)) {
+        reasons.set(component, report.reason);
+      }
+    });
+
+    // Remember when each component went degraded; one that recovered starts over next time
+    this.since.forEach((_, component) => {
+      if (!reasons.has(component)) {
+        this.since.delete(component);
+        logger.info('Component recovered', { component });
+      }
+    });
+    return [...reasons].sort(([a], [b]) => a.localeCompare(b)).map(([component, reason]) => {
+      if (!this.since.has(component)) {
+        this.since.set(component, new Date());
+        logger.warn('Component degraded', { component, reason });
+      }
+      return { component, reason, since: this.since.get(component)!.toISOString() };
+    });
+  }
+}
+
+export const degradation = Degradation.getInstance();
@@ -0,0 +1,73 @@
+export class ValidationError extends Error {
+  constructor(message: string, public readonly fields: Record<string, string> = {}) {
+    super(message);
+    this.name = 'ValidationError';
+  }
+}
+
+export class NotFoundError extends Error {
+  constructor(message: string) {
+    super(message);
+    this.name = 'NotFoundError';
+  }
+}
+
+// The client's copy (If-Match version) no longer matches the stored one
+export class PreconditionFailedError extends Error {
+  constructor(message: string, public readonly currentVersion?: number) {
+    super(message);
+    this.name = 'PreconditionFailedError';
+  }
+}
+
+// A lifecycle rule was broken; code tells clients which one (INVALID_TRANSITION, BOOKING_NOT_MODIFIABLE)
+export class BookingStateError extends Error {
+  constructor(
+    message: string,
+    public readonly code: string,
+    public readonly status: string,
+    public readonly requestedStatus?: string,
+    public readonly allowedStatuses?: string[]
+  ) {
+    super(message);
+    this.name = 'BookingStateError';
+  }
+}
+
+// The stay breaks its room type's restrictions; violations carries a code per broken rule for clients to act on
+export class StayRestrictionError extends ValidationError {
+  constructor(public readonly violations: { code: string; message: string }[], fields: Record<string, string>) {
+    super('Stay is not allowed for this room type', fields);
+    this.name = 'StayRestrictionError';
+  }
+}
+
+// The request clashes with existing data (duplicate email, guest that still has bookings, ...)
+export class ConflictError extends Error {
+  constructor(message: string) {
+    super(message);
+    this.name = 'ConflictError';
+  }
+}
+
+// The room can't be had for the stay at all (retired, or out of service for maintenance), as opposed to another
+// guest having taken it for now
+export class RoomOutOfServiceError extends ConflictError {
+  constructor(message: string) {
+    super(message);
+    this.name = 'RoomOutOfServiceError';
+  }
+}
+
+// A versioned update found the row already past the version it was read at: another request changed it first.
+// A conflict, so handlers answer 409; unlike PreconditionFailedError the client's copy wasn't the problem.
+export class StaleVersionError extends ConflictError {
+  constructor(
+    public readonly entity: 'booking' | 'receipt',
+    public readonly id: number,
+    public readonly expectedVersion: number
+  ) {
+    super(`${entity === 'booking' ? 'Booking' : 'Receipt'} ${id} was modified by another request; reload it and try again`);
+    this.name = 'StaleVersionError';
+  }
+}
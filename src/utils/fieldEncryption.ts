@@ -0,0 +1,34 @@
+import { createCipheriv, createDecipheriv, createHmac, randomBytes } from 'crypto';
+import { encryptionConfig } from '../config/encryption';
+
+const IV_BYTES = 12;
+const TAG_BYTES = 16;
+
+const keyFor = (keyId: string): Buffer => {
+  const key = encryptionConfig.keys.get(keyId);
+  if (!key) {
+    throw new Error(`Encryption key ${keyId} is not configured`);
+  }
+  return key;
+};
+
+// AES-256-GCM; the result is base64 of IV | auth tag | ciphertext. context (the column) is authenticated with
+// it, so a value copied into another column fails to decrypt.
+export function encryptField(plaintext: string, context: string, keyId: string = encryptionConfig.currentKeyId): string {
+  const iv = randomBytes(IV_BYTES);
+  const cipher = createCipheriv('aes-256-gcm', keyFor(keyId), iv).setAAD(Buffer.from(context));
+  const ciphertext = Buffer.concat([cipher.update(plaintext, 'utf8'), cipher.final()]);
+  return Buffer.concat([iv, cipher.getAuthTag(), ciphertext]).toString('base64');
+}
+
+export function decryptField(sealed: string, context: string, keyId: string): string {
+  const data = Buffer.from(sealed, 'base64');
+  const decipher = createDecipheriv('aes-256-gcm', keyFor(keyId), data.subarray(0, IV_BYTES)).setAAD(Buffer.from(context));
+  decipher.setAuthTag(data.subarray(IV_BYTES, IV_BYTES + TAG_BYTES));
+  return Buffer.concat([decipher.update(data.subarray(IV_BYTES + TAG_BYTES)), decipher.final()]).toString('utf8');
+}
+
+// Keyed hash of a value, for exact-match lookups and unique indexes on an encrypted column
+export function lookupHash(value: string): string {
+  return createHmac('sha256', encryptionConfig.lookupKey).update(value).digest('hex');
+}
@@ -0,0 +1,60 @@
+import { ConflictError } from './errors';
+
+interface KeyState {
+  tail: Promise<void>;
+  // Tasks queued or running under the key
+  size: number;
+}
+
+// Runs tasks one at a time per key, in the order they arrive; tasks under different keys run concurrently.
+// Only orders work within this process: other instances of the API still meet at the database's locks.
+export class KeyedQueue {
+  private keys = new Map<string, KeyState>();
+
+  constructor(private readonly options: { maxWaiting: number; timeoutMs: number }) {}
+
+  // Tasks queued or running under the key
+  size(key: string): number {
+    return this.keys.get(key)?.size ?? 0;
+  }
+
+  // Rejects with a ConflictError when maxWaiting tasks are already ahead, or when the task's turn hasn't come
+  // within timeoutMs
+  async run<T>(key: string, task: () => Promise<T>): Promise<T> {
+    const state = this.keys.get(key) ?? { tail: Promise.resolve(), size: 0 };
+    if (state.size > this.options.maxWaiting) {
+      throw new ConflictError('Too many requests are waiting for this room; please try again');
+    }
+
+    const previous = state.tail;
+    let done!: () => void;
+    state.tail = new Promise<void>(resolve => { done = resolve; });
+    state.size++;
+    this.keys.set(key, state);
+
+    let turn = false;
+    try {
+      let timer: NodeJS.Timeout | undefined;
+      turn = await Promise.race([
+        previous.then(() => true),
+        new Promise<boolean>(resolve => { timer = setTimeout(() => resolve(false), this.options.timeoutMs); })
+      ]);
+      clearTimeout(timer);
+      if (!turn) {
+        throw new ConflictError('Timed out waiting for other requests for this room; please try again');
+      }
+      return await task();
+    } finally {
+      // A task that gave up waiting still hands over only once the one ahead of it is done
+      if (turn) {
+        done();
+      } else {
+        previous.then(done);
+      }
+      state.size--;
+      if (state.size === 0 && this.keys.get(key) === state) {
+        this.keys.delete(key);
+      }
+    }
+  }
+}
@@ -5,9 +5,27 @@ export enum LogLevel {
   DEBUG = 'DEBUG'
 }
 
+// Guest contact details are masked in log output unless LOG_PII=true
+const PII_KEYS = ['email', 'phone', 'guestEmail', 'guestPhone', 'guest_email', 'guest_phone'];
+
+function redact(value: any): any {
+  if (Array.isArray(value)) {
+    return value.map(redact);
+  }
+  if (value && typeof value === 'object' && !(value instanceof Date)) {
+    const result: Record<string, any> = {};
+    for (const [key, entry] of Object.entries(value)) {
+      result[key] = PII_KEYS.includes(key) && entry != null ? '[REDACTED]' : redact(entry);
+    }
+    return result;
+  }
+  return value;
+}
+
 class Logger {
   private static instance: Logger;
   private logLevel: LogLevel = LogLevel.INFO;
+  private redactPii: boolean = process.env.LOG_PII !== 'true';
 
   private constructor() {}
 
@@ -29,7 +47,7 @@ class Logger {
 
   private formatMessage(level: LogLevel, message: string, meta?: any): string {
     const timestamp = new Date().toISOString();
-    const metaStr = meta ? ` | ${JSON.stringify(meta)}` : '';
+    const metaStr = meta ? ` | ${JSON.stringify(this.redactPii ? redact(meta) : meta)}` : '';
     return `[${timestamp}] ${level}: ${message}${metaStr}`;
   }
 
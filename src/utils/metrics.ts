@@ -0,0 +1,46 @@
+interface TimingSummary {
+  count: number;
+  totalMs: number;
+  maxMs: number;
+}
+
+class Metrics {
+  private static instance: Metrics;
+  private counters = new Map<string, number>();
+  private timings = new Map<string, TimingSummary>();
+
+  private constructor() {}
+
+  static getInstance(): Metrics {
+    if (!Metrics.instance) {
+      Metrics.instance = new Metrics();
+    }
+    return Metrics.instance;
+  }
+
+  increment(name: string, value: number = 1) {
+    this.counters.set(name, (this.counters.get(name) || 0) + value);
+  }
+
+  observe(name: string, durationMs: number) {
+    const summary = this.timings.get(name) || { count: 0, totalMs: 0, maxMs: 0 };
+    summary.count++;
+    summary.totalMs += durationMs;
+    summary.maxMs = Math.max(summary.maxMs, durationMs);
+    this.timings.set(name, summary);
+  }
+
+  snapshot() {
+    const timings: Record<string, TimingSummary & { avgMs: number }> = {};
+    this.timings.forEach((summary, name) => {
+      timings[name] = { ...summary, avgMs: summary.totalMs / summary.count };
+    });
+
+    return {
+      counters: Object.fromEntries(this.counters),
+      timings
+    };
+  }
+}
+
+export const metrics = Metrics.getInstance();
@@ -0,0 +1,44 @@
+import busboy from 'busboy';
+import { ValidationError } from './errors';
+
+export interface MultipartPart {
+  name: string;
+  filename: string | null;
+  contentType: string | null;
+  data: Buffer;
+}
+
+const invalid = (reason: string) => new ValidationError('Invalid upload', { body: reason });
+
+// Splits a buffered multipart/form-data body into its parts, in the order they were sent. Bodies are
+// size-capped before they get here, so holding the whole upload in memory is fine.
+export function parseMultipart(body: Buffer, contentType: string | undefined): Promise<MultipartPart[]> {
+  let parser: busboy.Busboy;
+  try {
+    parser = busboy({ headers: { 'content-type': contentType }, defParamCharset: 'utf8' });
+  } catch {
+    return Promise.reject(invalid('must be multipart/form-data with a boundary'));
+  }
+
+  return new Promise((resolve, reject) => {
+    const parts: MultipartPart[] = [];
+
+    parser.on('field', (name, value) => {
+      parts.push({ name, filename: null, contentType: null, data: Buffer.from(value, 'utf8') });
+    });
+    parser.on('file', (name, stream, info) => {
+      const part: MultipartPart = {
+        name, filename: info.filename ?? '', contentType: info.mimeType.toLowerCase(), data: Buffer.alloc(0)
+      };
+      const chunks: Buffer[] = [];
+      parts.push(part);
+      stream.on('data', (chunk: Buffer) => chunks.push(chunk));
+      stream.on('end', () => { part.data = Buffer.concat(chunks); });
+    });
+    // Emitted once every part, files included, has been read
+    parser.on('close', () => resolve(parts));
+    parser.on('error', error => reject(invalid(error instanceof Error ? error.message : String(error))));
+
+    parser.end(body);
+  });
+}
@@ -0,0 +1,28 @@
+import { guestNameConfig } from '../config/guestNames';
+
+const NAME_CHARSET_ERRORS: Record<string, string> = {
+  printable: 'must not contain control or formatting characters',
+  letters: 'may only contain letters, spaces, apostrophes, hyphens and periods',
+  latin: 'may only contain Latin letters, spaces, apostrophes, hyphens and periods'
+};
+
+// Canonical form for storing a name: NFC, trimmed, with runs of whitespace collapsed to one space
+export function normalizeName(name: string): string {
+  return name.normalize('NFC').trim().replace(/\s+/g, ' ');
+}
+
+// Returns why a (normalized) name is not acceptable, or null if it is
+export function nameError(name: unknown): string | null {
+  if (typeof name !== 'string' || normalizeName(name) === '') {
+    return 'is required';
+  }
+
+  const normalized = normalizeName(name);
+  if (normalized.length > guestNameConfig.maxLength) {
+    return `must be at most ${guestNameConfig.maxLength} characters`;
+  }
+  if (!guestNameConfig.pattern.test(normalized)) {
+    return NAME_CHARSET_ERRORS[guestNameConfig.charset];
+  }
+  return null;
+}
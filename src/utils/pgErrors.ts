@@ -0,0 +1,26 @@
+// SQLSTATE codes for failures that can succeed if the same work is simply tried again
+const TRANSIENT_ERROR_CODES = [
+  '40001', // serialization_failure
+  '40P01', // deadlock_detected
+  '55P03', // lock_not_available
+];
+
+export function isTransientError(error: unknown): boolean {
+  const code = (error as { code?: unknown } | null)?.code;
+  return typeof code === 'string' && TRANSIENT_ERROR_CODES.includes(code);
+}
+
+// Serialization failures and deadlocks conflict with work done earlier in the transaction too, so rolling
+// back to a savepoint doesn't get past them: only the outermost transaction can rerun
+export function requiresTransactionRerun(error: unknown): boolean {
+  const code = (error as { code?: unknown } | null)?.code;
+  return code === '40001' || code === '40P01';
+}
+
+export function isUniqueViolation(error: unknown): boolean {
+  return (error as { code?: unknown } | null)?.code === '23505';
+}
+
+export function isCheckViolation(error: unknown): boolean {
+  return (error as { code?: unknown } | null)?.code === '23514';
+}
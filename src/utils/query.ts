@@ -0,0 +1,115 @@
+import { createHmac, timingSafeEqual } from 'crypto';
+import { ValidationError } from './errors';
+import { paginationConfig } from '../config/pagination';
+
+export const MAX_BATCH_IDS = 100;
+
+// Parses "1,2,3" into a de-duplicated list of positive integer ids
+export function parseIdList(value: unknown, field: string = 'ids'): number[] {
+  if (typeof value !== 'string' || value.trim() === '') {
+    throw new ValidationError('Invalid id list', { [field]: 'must be a comma-separated list of ids' });
+  }
+
+  const ids: number[] = [];
+  for (const part of value.split(',')) {
+    const id = Number(part.trim());
+    if (!Number.isInteger(id) || id <= 0) {
+      throw new ValidationError('Invalid id list', { [field]: `"${part.trim()}" is not a valid id` });
+    }
+    if (!ids.includes(id)) {
+      ids.push(id);
+    }
+  }
+
+  if (ids.length > MAX_BATCH_IDS) {
+    throw new ValidationError('Invalid id list', { [field]: `at most ${MAX_BATCH_IDS} ids per request` });
+  }
+
+  return ids;
+}
+
+// Parses an optional page size, falling back to the listing's default; the listing's maximum is the most
+// one page can hold (see PAGE_SIZES)
+export function parsePageSize(value: unknown, listing: string, field: string = 'limit'): number {
+  const sizes = paginationConfig.pageSizes[listing];
+  if (value === undefined) {
+    return sizes.default;
+  }
+
+  const size = Number(value);
+  if (typeof value !== 'string' || !Number.isInteger(size) || size <= 0 || size > sizes.max) {
+    throw new ValidationError('Invalid page size', { [field]: `must be an integer between 1 and ${sizes.max}` });
+  }
+  return size;
+}
+
+// Cursors are opaque to clients: base64url-encoded JSON of the keyset position, followed by an HMAC of it
+// so a client can't edit the position (or reuse a cursor from another listing) and be served rows it shouldn't
+function signCursor(payload: string): string {
+  return createHmac('sha256', paginationConfig.cursorSecret).update(payload).digest('base64url');
+}
+
+export function encodeCursor(position: unknown[]): string {
+  const payload = Buffer.from(JSON.stringify(position)).toString('base64url');
+  return `${payload}.${signCursor(payload)}`;
+}
+
+export function decodeCursor(value: unknown, field: string = 'cursor'): unknown[] {
+  const [payload, signature, ...rest] = String(value).split('.');
+  const expected = Buffer.from(signCursor(payload ?? ''));
+  const given = Buffer.from(signature ?? '');
+
+  if (rest.length === 0 && given.length === expected.length && timingSafeEqual(given, expected)) {
+    try {
+      const position = JSON.parse(Buffer.from(payload, 'base64url').toString('utf8'));
+      if (Array.isArray(position)) {
+        return position;
+      }
+    } catch {
+      // fall through to the validation error
+    }
+  }
+  throw new ValidationError('Invalid cursor', { [field]: 'must be a cursor returned by a previous page' });
+}
+
+// Decodes a cursor that starts with the listing's scope (e.g. its name and filters) and returns the rest
+// of the position; a cursor from a different listing is rejected
+export function decodeScopedCursor(value: unknown, scope: unknown[], field: string = 'cursor'): unknown[] {
+  const position = decodeCursor(value, field);
+  if (JSON.stringify(position.slice(0, scope.length)) !== JSON.stringify(scope)) {
+    throw new ValidationError('Invalid cursor', { [field]: 'belongs to a different listing' });
+  }
+  return position.slice(scope.length);
+}
+
+// Callers fetch limit + 1 rows; the extra row only says whether there is a next page
+export function keysetPage<T>(
+  rows: T[], limit: number, positionOf: (row: T) => unknown[]
+): { items: T[]; nextCursor: string | null } {
+  const items = rows.slice(0, limit);
+  return {
+    items,
+    nextCursor: rows.length > limit ? encodeCursor(positionOf(items[items.length - 1])) : null
+  };
+}
+
+export interface PageQuery {
+  limit?: unknown;
+  cursor?: unknown;
+}
+
+// Page parameters for listings ordered by id alone: the page size and the id the previous page ended at
+export function parseIdPage(
+  query: PageQuery, listing: string, scope: unknown[]
+): { limit: number; afterId: number | null } {
+  const limit = parsePageSize(query.limit, listing);
+  if (query.cursor === undefined) {
+    return { limit, afterId: null };
+  }
+
+  const [afterId] = decodeScopedCursor(query.cursor, scope);
+  if (!Number.isInteger(afterId)) {
+    throw new ValidationError('Invalid cursor', { cursor: 'must be a cursor returned by a previous page' });
+  }
+  return { limit, afterId: afterId as number };
+}
@@ -0,0 +1,16 @@
+import { AsyncLocalStorage } from 'async_hooks';
+
+const storage = new AsyncLocalStorage<string[]>();
+
+export function runWithResponseWarnings<T>(fn: () => T): T {
+  return storage.run([], fn);
+}
+
+// Non-fatal notes for the client (e.g. a fee or extra payment that applies); no-op outside a request
+export function addResponseWarning(warning: string) {
+  storage.getStore()?.push(warning);
+}
+
+export function responseWarnings(): string[] {
+  return [...(storage.getStore() || [])];
+}
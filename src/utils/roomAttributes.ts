@@ -0,0 +1,47 @@
+import { RoomPreferences, RoomView } from '../types';
+
+export const ROOM_VIEWS: RoomView[] = ['city', 'garden', 'pool', 'sea'];
+
+// Floors run from the basement levels up; anything outside is a typo
+export const MIN_FLOOR = -10;
+export const MAX_FLOOR = 300;
+
+export function isFloor(value: unknown): value is number {
+  return Number.isInteger(value) && (value as number) >= MIN_FLOOR && (value as number) <= MAX_FLOOR;
+}
+
+// Field errors for a request's roomPreferences, keyed like roomPreferences.view
+export function roomPreferenceErrors(preferences: unknown): Record<string, string> {
+  if (typeof preferences !== 'object' || preferences === null || Array.isArray(preferences)) {
+    return { roomPreferences: 'must be an object of floor, view, smoking and accessible' };
+  }
+
+  const fields: Record<string, string> = {};
+  const { floor, view, smoking, accessible, ...unknown } = preferences as Record<string, unknown>;
+  if (floor !== undefined && !isFloor(floor)) {
+    fields['roomPreferences.floor'] = `must be a whole number from ${MIN_FLOOR} to ${MAX_FLOOR}`;
+  }
+  if (view !== undefined && !ROOM_VIEWS.includes(view as RoomView)) {
+    fields['roomPreferences.view'] = `must be one of: ${ROOM_VIEWS.join(', ')}`;
+  }
+  if (smoking !== undefined && typeof smoking !== 'boolean') {
+    fields['roomPreferences.smoking'] = 'must be true or false';
+  }
+  if (accessible !== undefined && typeof accessible !== 'boolean') {
+    fields['roomPreferences.accessible'] = 'must be true or false';
+  }
+  for (const name of Object.keys(unknown)) {
+    fields[`roomPreferences.${name}`] = 'is not a room attribute';
+  }
+  return fields;
+}
+
+// Query parameters for the "($n::type IS NULL OR column = $n)" filters; null matches any room
+export function preferenceParams(preferences: RoomPreferences | undefined): [number | null, string | null, boolean | null, boolean | null] {
+  return [
+    preferences?.floor ?? null,
+    preferences?.view ?? null,
+    preferences?.smoking ?? null,
+    preferences?.accessible ?? null
+  ];
+}
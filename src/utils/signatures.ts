@@ -0,0 +1,39 @@
+import { createHash, createHmac, timingSafeEqual } from 'crypto';
+
+// Signature header format: "t=<unix seconds>,v1=<hex HMAC-SHA256 of `${t}.${body}`>"
+export function signPayload(secret: string, timestamp: number, body: string | Buffer): string {
+  const digest = createHmac('sha256', secret).update(`${timestamp}.`).update(body).digest('hex');
+  return `t=${timestamp},v1=${digest}`;
+}
+
+// Checks the HMAC and that the signed timestamp is within toleranceSeconds of now
+export function verifySignature(
+  header: string | undefined,
+  body: string | Buffer,
+  secret: string,
+  toleranceSeconds: number,
+  now: number = Math.floor(Date.now() / 1000)
+): boolean {
+  if (!header) {
+    return false;
+  }
+
+  const parts = Object.fromEntries(header.split(',').map(part => {
+    const [key, ...value] = part.trim().split('=');
+    return [key, value.join('=')];
+  }));
+  const timestamp = Number(parts.t);
+  if (!Number.isInteger(timestamp) || !parts.v1 || Math.abs(now - timestamp) > toleranceSeconds) {
+    return false;
+  }
+
+  const expected = Buffer.from(signPayload(secret, timestamp, body).split('v1=')[1], 'hex');
+  const given = Buffer.from(parts.v1, 'hex');
+  return given.length === expected.length && timingSafeEqual(given, expected);
+}
+
+// Compares a secret given by a caller with the expected one in constant time
+export function secretsMatch(given: string, expected: string): boolean {
+  const digest = (value: string) => createHash('sha256').update(value).digest();
+  return timingSafeEqual(digest(given), digest(expected));
+}
@@ -0,0 +1,54 @@
+import { AsyncLocalStorage } from 'async_hooks';
+import { performance } from 'perf_hooks';
+
+export type TransactionOutcome = 'committed' | 'rolled_back';
+
+interface StageTimings {
+  startedAt: number;
+  marks: { stage: string; at: number }[];
+  // Every top-level transaction the request ran, in order (retries included)
+  outcomes: TransactionOutcome[];
+}
+
+const storage = new AsyncLocalStorage<StageTimings>();
+
+export function runWithStageTiming<T>(fn: () => T): T {
+  return storage.run({ startedAt: performance.now(), marks: [], outcomes: [] }, fn);
+}
+
+// Records the first time a request reaches a stage; no-op outside a timed request
+export function markStage(stage: string) {
+  const timings = storage.getStore();
+  if (timings && !timings.marks.some(mark => mark.stage === stage)) {
+    timings.marks.push({ stage, at: performance.now() - timings.startedAt });
+  }
+}
+
+// Time spent in each stage, measured from the previous mark
+export function stageDurations(): { stage: string; durationMs: number }[] {
+  const timings = storage.getStore();
+  if (!timings) {
+    return [];
+  }
+
+  let previous = 0;
+  return timings.marks.map(mark => {
+    const durationMs = mark.at - previous;
+    previous = mark.at;
+    return { stage: mark.stage, durationMs };
+  });
+}
+
+export function recordTransactionOutcome(outcome: TransactionOutcome) {
+  storage.getStore()?.outcomes.push(outcome);
+}
+
+// How the request's transactions ended: 'mixed' when some committed and others rolled back (a retried
+// deadlock, or a failure after an earlier write committed), 'none' when it ran none
+export function transactionOutcome(): TransactionOutcome | 'mixed' | 'none' {
+  const outcomes = new Set(storage.getStore()?.outcomes ?? []);
+  if (outcomes.size === 0) {
+    return 'none';
+  }
+  return outcomes.size > 1 ? 'mixed' : outcomes.values().next().value!;
+}
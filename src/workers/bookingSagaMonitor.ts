@@ -0,0 +1,26 @@
+import { BookingSagaService } from '../services/bookingSagaService';
+import { sagaConfig } from '../config/saga';
+import { logger } from '../utils/logger';
+
+const bookingSagaService = new BookingSagaService();
+
+// Cancels the bookings of sagas whose payment wasn't confirmed within the timeout
+export async function runBookingSagaMonitor(): Promise<number[]> {
+  const expired = await bookingSagaService.expireOverdue();
+  if (expired.length > 0) {
+    logger.info('Overdue booking sagas compensated', { expired });
+  }
+  return expired;
+}
+
+export function startBookingSagaMonitor(intervalMs: number = sagaConfig.monitorIntervalMs): NodeJS.Timeout {
+  const timer = setInterval(() => {
+    runBookingSagaMonitor().catch(error => {
+      logger.error('Booking saga monitor run failed', { error: error instanceof Error ? error.message : String(error) });
+    });
+  }, intervalMs);
+
+  timer.unref();
+  logger.info('Booking saga monitor started', { intervalMs, timeoutMinutes: sagaConfig.paymentTimeoutMinutes });
+  return timer;
+}
@@ -0,0 +1,18 @@
+import { BookingService } from '../services/bookingService';
+import { bookingConfig } from '../config/booking';
+import { logger } from '../utils/logger';
+
+const bookingService = new BookingService();
+
+// Periodically returns rooms from expired holds to inventory
+export function startHoldReaper(intervalMs: number = bookingConfig.holdReaperIntervalMs): NodeJS.Timeout {
+  const timer = setInterval(() => {
+    bookingService.releaseExpiredHolds().catch(error => {
+      logger.error('Hold reaper run failed', { error: error instanceof Error ? error.message : String(error) });
+    });
+  }, intervalMs);
+
+  timer.unref();
+  logger.info('Hold reaper started', { intervalMs });
+  return timer;
+}
@@ -0,0 +1,43 @@
+import { BookingService } from '../services/bookingService';
+import { PaymentPlanService } from '../services/paymentPlanService';
+import { bookingConfig } from '../config/booking';
+import { logger } from '../utils/logger';
+
+const bookingService = new BookingService();
+const paymentPlanService = new PaymentPlanService();
+
+// Flags overdue installments and, with auto-cancel on, cancels bookings left unpaid past the grace period
+export async function runInstallmentMonitor(): Promise<{ overdue: number; cancelled: number[] }> {
+  const { overdue, pastGrace } = await paymentPlanService.markOverdue();
+  const cancelled: number[] = [];
+
+  if (bookingConfig.installmentAutoCancel) {
+    for (const bookingId of pastGrace) {
+      try {
+        await bookingService.cancelBooking(bookingId, { code: 'payment_issue', text: 'Installment unpaid after the grace period' });
+        cancelled.push(bookingId);
+      } catch (error) {
+        logger.error('Failed to cancel booking with an overdue installment', {
+          bookingId, error: error instanceof Error ? error.message : String(error)
+        });
+      }
+    }
+  }
+
+  if (overdue > 0 || cancelled.length > 0) {
+    logger.info('Installment monitor run', { overdue, cancelled });
+  }
+  return { overdue, cancelled };
+}
+
+export function startInstallmentMonitor(intervalMs: number = bookingConfig.installmentMonitorIntervalMs): NodeJS.Timeout {
+  const timer = setInterval(() => {
+    runInstallmentMonitor().catch(error => {
+      logger.error('Installment monitor run failed', { error: error instanceof Error ? error.message : String(error) });
+    });
+  }, intervalMs);
+
+  timer.unref();
+  logger.info('Installment monitor started', { intervalMs });
+  return timer;
+}
@@ -0,0 +1,21 @@
+import { AdminService } from '../services/adminService';
+import { bookingConfig } from '../config/booking';
+import { logger } from '../utils/logger';
+
+const adminService = new AdminService();
+
+// Periodically recomputes per-day money and occupancy aggregates and reports drift from their checkpoints
+export function startIntegrityChecker(
+  intervalMs: number = bookingConfig.integrityCheckIntervalMs,
+  days: number = bookingConfig.integrityCheckDays
+): NodeJS.Timeout {
+  const timer = setInterval(() => {
+    adminService.checkIntegrity(days).catch(error => {
+      logger.error('Integrity check failed', { error: error instanceof Error ? error.message : String(error) });
+    });
+  }, intervalMs);
+
+  timer.unref();
+  logger.info('Integrity checker started', { intervalMs, days });
+  return timer;
+}
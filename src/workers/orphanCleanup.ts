@@ -0,0 +1,21 @@
+import { AdminService } from '../services/adminService';
+import { bookingConfig } from '../config/booking';
+import { logger } from '../utils/logger';
+
+const adminService = new AdminService();
+
+// Periodically reports (or, with dry run off, removes) rows left behind by failed operations
+export function startOrphanCleanup(
+  intervalMs: number = bookingConfig.orphanCleanupIntervalMs,
+  dryRun: boolean = bookingConfig.orphanCleanupDryRun
+): NodeJS.Timeout {
+  const timer = setInterval(() => {
+    adminService.cleanupOrphans(dryRun).catch(error => {
+      logger.error('Orphan cleanup run failed', { error: error instanceof Error ? error.message : String(error) });
+    });
+  }, intervalMs);
+
+  timer.unref();
+  logger.info('Orphan cleanup started', { intervalMs, dryRun });
+  return timer;
+}
@@ -0,0 +1,37 @@
+import { OutboxHandler, OutboxService } from '../services/outboxService';
+import { BookingSagaService } from '../services/bookingSagaService';
+import { sagaConfig } from '../config/saga';
+import { logger } from '../utils/logger';
+
+const outboxService = new OutboxService();
+const bookingSagaService = new BookingSagaService();
+
+const handlers: Record<string, OutboxHandler> = {
+  'payment.requested': payload => bookingSagaService.requestPayment(payload),
+  'payment.charge': payload => bookingSagaService.chargePayment(payload)
+};
+
+// Sends the outbox messages that are due to their handlers
+export async function runOutboxRelay(): Promise<{ sent: number; failed: number }> {
+  return outboxService.relay(handlers);
+}
+
+export function startOutboxRelay(intervalMs: number = sagaConfig.outboxRelayIntervalMs): NodeJS.Timeout {
+  // A run can outlast the interval while the gateway is slow; skip ticks rather than stack runs
+  let running = false;
+  const timer = setInterval(() => {
+    if (running) {
+      return;
+    }
+    running = true;
+    runOutboxRelay()
+      .catch(error => {
+        logger.error('Outbox relay run failed', { error: error instanceof Error ? error.message : String(error) });
+      })
+      .finally(() => { running = false; });
+  }, intervalMs);
+
+  timer.unref();
+  logger.info('Outbox relay started', { intervalMs });
+  return timer;
+}
@@ -0,0 +1,54 @@
+import { BookingService } from '../services/bookingService';
+import { bookingConfig } from '../config/booking';
+import { logger } from '../utils/logger';
+import { metrics } from '../utils/metrics';
+
+const bookingService = new BookingService();
+
+// Cancels pending bookings left unpaid past the TTL, giving their rooms back to inventory. Nights reclaimed only
+// count the part of the stay that hasn't passed yet.
+export async function runPendingBookingReaper(
+  ttlHours: number = bookingConfig.pendingBookingTtlHours
+): Promise<{ cancelled: number[]; nightsReclaimed: number }> {
+  const cancelled: number[] = [];
+  let nightsReclaimed = 0;
+
+  for (const { id, nights } of await bookingService.findUnpaidPendingBookings(ttlHours)) {
+    try {
+      await bookingService.cancelBooking(id, { code: 'payment_issue', text: `Unpaid ${ttlHours} hours after booking` });
+      cancelled.push(id);
+      nightsReclaimed += nights;
+    } catch (error) {
+      // Paid or moved on since it was found; the next run looks again if it is still pending
+      logger.error('Failed to cancel unpaid pending booking', {
+        bookingId: id, error: error instanceof Error ? error.message : String(error)
+      });
+    }
+  }
+
+  if (cancelled.length > 0) {
+    metrics.increment('pending_bookings.reaped', cancelled.length);
+    metrics.increment('pending_bookings.nights_reclaimed', nightsReclaimed);
+    logger.info('Unpaid pending bookings cancelled', { cancelled, nightsReclaimed });
+  }
+  return { cancelled, nightsReclaimed };
+}
+
+export function startPendingBookingReaper(
+  intervalMs: number = bookingConfig.pendingBookingReaperIntervalMs
+): NodeJS.Timeout | null {
+  if (bookingConfig.pendingBookingTtlHours <= 0) {
+    logger.info('Pending booking reaper disabled');
+    return null;
+  }
+
+  const timer = setInterval(() => {
+    runPendingBookingReaper().catch(error => {
+      logger.error('Pending booking reaper run failed', { error: error instanceof Error ? error.message : String(error) });
+    });
+  }, intervalMs);
+
+  timer.unref();
+  logger.info('Pending booking reaper started', { intervalMs, ttlHours: bookingConfig.pendingBookingTtlHours });
+  return timer;
+}
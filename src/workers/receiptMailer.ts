@@ -0,0 +1,29 @@
+import { ReceiptEmailService } from '../services/receiptEmailService';
+import { createMailer, Mailer } from '../mail/mailer';
+import { mailConfig } from '../config/mail';
+import { eventBus } from '../events/eventBus';
+import { logger } from '../utils/logger';
+
+// Emails each receipt as soon as it is issued, and periodically retries the ones that could not be sent;
+// returns a function that stops both
+export function startReceiptMailer(
+  mailer: Mailer = createMailer(), intervalMs: number = mailConfig.sweepIntervalMs
+): () => void {
+  const receiptEmailService = new ReceiptEmailService(mailer);
+
+  const unsubscribe = eventBus.subscribe('receipt.issued', event => receiptEmailService.deliver(event.receiptId).then(() => undefined), {
+    name: 'receiptMailer'
+  });
+  const timer = setInterval(() => {
+    receiptEmailService.deliverDue().catch(error => {
+      logger.error('Receipt email sweep failed', { error: error instanceof Error ? error.message : String(error) });
+    });
+  }, intervalMs);
+
+  timer.unref();
+  logger.info('Receipt mailer started', { transport: mailConfig.transport, intervalMs });
+  return () => {
+    unsubscribe();
+    clearInterval(timer);
+  };
+}
@@ -0,0 +1,18 @@
+import { DemoService } from '../services/demoService';
+import { bookingConfig } from '../config/booking';
+import { logger } from '../utils/logger';
+
+const demoService = new DemoService();
+
+// Periodically retires sandbox rooms left behind by the demo endpoints once their TTL has passed
+export function startSandboxCleanup(intervalMs: number = bookingConfig.sandboxCleanupIntervalMs): NodeJS.Timeout {
+  const timer = setInterval(() => {
+    demoService.cleanupSandboxRooms().catch(error => {
+      logger.error('Sandbox cleanup run failed', { error: error instanceof Error ? error.message : String(error) });
+    });
+  }, intervalMs);
+
+  timer.unref();
+  logger.info('Sandbox cleanup started', { intervalMs, ttlMinutes: bookingConfig.sandboxRoomTtlMinutes });
+  return timer;
+}
@@ -0,0 +1,29 @@
+import { SettlementService } from '../services/settlementService';
+import { bookingConfig } from '../config/booking';
+import { eventBus } from '../events/eventBus';
+import { logger } from '../utils/logger';
+
+const settlementService = new SettlementService();
+
+// Finalizes each stay as it checks out, with a periodic sweep for check-outs whose event was missed;
+// returns a function that stops both
+export function startStayFinalizer(intervalMs: number = bookingConfig.stayFinalizerIntervalMs): () => void {
+  const unsubscribe = eventBus.subscribe('booking.status_changed', event => {
+    if (event.to === 'checked_out') {
+      return settlementService.finalizeStay(event.bookingId).then(() => undefined);
+    }
+  }, { name: 'stayFinalizer' });
+
+  const timer = setInterval(() => {
+    settlementService.finalizePendingStays().catch(error => {
+      logger.error('Stay finalizer sweep failed', { error: error instanceof Error ? error.message : String(error) });
+    });
+  }, intervalMs);
+  timer.unref();
+
+  logger.info('Stay finalizer started', { intervalMs });
+  return () => {
+    unsubscribe();
+    clearInterval(timer);
+  };
+}
@@ -0,0 +1,24 @@
+import { UpgradeBidService } from '../services/upgradeBidService';
+import { eventBus } from '../events/eventBus';
+import { logger } from '../utils/logger';
+
+const upgradeBidService = new UpgradeBidService();
+
+// Offers every room that frees up to the upgrade bids for its type, including the room an upgraded
+// guest just left; returns a function that stops listening
+export function startUpgradeMatcher(): () => void {
+  const serve = (roomId: number) => upgradeBidService.processRoom(roomId).then(() => undefined);
+
+  const unsubscribers = [
+    eventBus.subscribe('booking.cancelled', event => serve(event.roomId), { name: 'upgradeMatcher' }),
+    eventBus.subscribe('booking.status_changed', event => {
+      if (event.to === 'checked_out' || event.to === 'no_show') {
+        return serve(event.roomId);
+      }
+    }, { name: 'upgradeMatcher' }),
+    eventBus.subscribe('upgrade.awarded', event => serve(event.fromRoomId), { name: 'upgradeMatcher' })
+  ];
+
+  logger.info('Upgrade matcher started');
+  return () => unsubscribers.forEach(unsubscribe => unsubscribe());
+}
@@ -0,0 +1,24 @@
+import { WaitlistService } from '../services/waitlistService';
+import { eventBus } from '../events/eventBus';
+import { logger } from '../utils/logger';
+
+const waitlistService = new WaitlistService();
+
+// Serves the waitlist whenever a booking gives its room back; returns a function that stops listening
+export function startWaitlistPromoter(): () => void {
+  const serve = (roomId: number) => waitlistService.processRoom(roomId).then(() => undefined);
+
+  const unsubscribers = [
+    eventBus.subscribe('booking.cancelled', event => serve(event.roomId), { name: 'waitlistPromoter' }),
+    eventBus.subscribe('booking.status_changed', event => {
+      if (event.to === 'checked_out' || event.to === 'no_show') {
+        return serve(event.roomId);
+      }
+    }, { name: 'waitlistPromoter' }),
+    // An upgraded guest's old room is free too
+    eventBus.subscribe('upgrade.awarded', event => serve(event.fromRoomId), { name: 'waitlistPromoter' })
+  ];
+
+  logger.info('Waitlist promoter started');
+  return () => unsubscribers.forEach(unsubscribe => unsubscribe());
+}
@@ -1,6 +1,87 @@
+import fs from 'fs';
+import os from 'os';
+import path from 'path';
+import crypto from 'crypto';
+import { EventEmitter } from 'events';
+import { Client } from 'pg';
 import { BookingService } from '../src/services/bookingService';
 import { pool } from '../src/config/database';
 import { createTables } from '../src/scripts/initDb';
+import { AdminService } from '../src/services/adminService';
+import { retryDelayMs, runInTransaction, runInTransactionWithRetry } from '../src/services/transactionManager';
+import { isolationConfig } from '../src/config/isolation';
+import { lockingConfig } from '../src/config/locking';
+import { bookingConfig } from '../src/config/booking';
+import { paginationConfig } from '../src/config/pagination';
+import { encryptionConfig } from '../src/config/encryption';
+import { parseIdList } from '../src/utils/query';
+import { addDays, today } from '../src/utils/date';
+import {
+  BookingStateError, ConflictError, NotFoundError, PreconditionFailedError, StaleVersionError, StayRestrictionError,
+  ValidationError
+} from '../src/utils/errors';
+import { idempotency } from '../src/middleware/idempotency';
+import { responseEnvelope } from '../src/middleware/responseEnvelope';
+import { degradedComponents } from '../src/middleware/degradedComponents';
+import { degradation } from '../src/utils/degradation';
+import { runWithStageTiming } from '../src/utils/stageTiming';
+import { stageTiming } from '../src/middleware/stageTiming';
+import { eventBus } from '../src/events/eventBus';
+import { WaitlistService } from '../src/services/waitlistService';
+import { GuestService } from '../src/services/guestService';
+import { DemoService } from '../src/services/demoService';
+import { AuditService } from '../src/services/auditService';
+import { BookingNoteService } from '../src/services/bookingNoteService';
+import { SettlementService } from '../src/services/settlementService';
+import { PromoCodeService } from '../src/services/promoCodeService';
+import { UpgradeBidService } from '../src/services/upgradeBidService';
+import { SchemaService } from '../src/services/schemaService';
+import { LoyaltyService } from '../src/services/loyaltyService';
+import { ReconciliationService } from '../src/services/reconciliationService';
+import { RoomInventoryService } from '../src/services/roomInventoryService';
+import { RoomImportService } from '../src/services/roomImportService';
+import { DisputeService } from '../src/services/disputeService';
+import { PaymentMethodService } from '../src/services/paymentMethodService';
+import { paymentMethods } from '../src/config/paymentMethods';
+import { PaymentPlanService } from '../src/services/paymentPlanService';
+import { runInstallmentMonitor } from '../src/workers/installmentMonitor';
+import { runPendingBookingReaper } from '../src/workers/pendingBookingReaper';
+import { stayBuckets } from '../src/services/advisoryLocks';
+import { findWaitCycles, LockDiagnosticsService } from '../src/services/lockDiagnosticsService';
+import { KeyedQueue } from '../src/utils/keyedQueue';
+import { versionedRow } from '../src/services/optimisticLocks';
+import { BookingSagaService } from '../src/services/bookingSagaService';
+import { OutboxService } from '../src/services/outboxService';
+import { runOutboxRelay } from '../src/workers/outboxRelay';
+import { runBookingSagaMonitor } from '../src/workers/bookingSagaMonitor';
+import { sagaConfig } from '../src/config/saga';
+import { metrics } from '../src/utils/metrics';
+import { ReceiptEmailService } from '../src/services/receiptEmailService';
+import { NoopMailer } from '../src/mail/mailer';
+import { mailConfig } from '../src/config/mail';
+import { runAsActor } from '../src/utils/actor';
+import { PaymentWebhookService } from '../src/services/paymentWebhookService';
+import { RefundService } from '../src/services/refundService';
+import { RatePlanService } from '../src/services/ratePlanService';
+import { StayRestrictionService } from '../src/services/stayRestrictionService';
+import { MaintenanceService } from '../src/services/maintenanceService';
+import { HousekeepingService } from '../src/services/housekeepingService';
+import { ReportService } from '../src/services/reportService';
+import { FacilityService } from '../src/services/facilityService';
+import { RoomService } from '../src/services/roomService';
+import { RoomPhotoService } from '../src/services/roomPhotoService';
+import { AdjoiningRoomService } from '../src/services/adjoiningRoomService';
+import { RoomStatusHistoryService } from '../src/services/roomStatusHistoryService';
+import { DiskStorage } from '../src/media/storage';
+import { parseMultipart } from '../src/utils/multipart';
+import { parseCsv } from '../src/utils/csv';
+import { signPayload, verifySignature } from '../src/utils/signatures';
+import { nameError, normalizeName } from '../src/utils/names';
+import { loadFixture, readFixture, runConflicts } from '../src/scripts/loadFixtures';
+import { reencryptGuests } from '../src/scripts/reencryptGuests';
+import { streamOccupancyBoard } from '../src/controllers/adminController';
+import { cancelBooking, getBookings } from '../src/controllers/bookingController';
+import { compareRoomTypes } from '../src/controllers/roomController';
 
 describe('Hotel Booking System', () => {
   let bookingService: BookingService;
@@ -19,11 +100,45 @@ describe('Hotel Booking System', () => {
     const client = await pool.connect();
     try {
       await client.query('BEGIN');
+      await client.query('DELETE FROM idempotency_keys');
+      await client.query('DELETE FROM outbox_messages');
+      await client.query('DELETE FROM integrity_checkpoints');
+      // The audit trail refuses deletes; the trigger is off only for this transaction's reset
+      await client.query('ALTER TABLE booking_audit DISABLE TRIGGER booking_audit_immutable');
+      await client.query('DELETE FROM booking_audit');
+      await client.query('ALTER TABLE booking_audit ENABLE TRIGGER booking_audit_immutable');
+      await client.query('DELETE FROM booking_notes');
+      await client.query('DELETE FROM upgrade_bids');
+      await client.query('DELETE FROM loyalty_transactions');
+      await client.query('DELETE FROM settlement_issues');
+      await client.query('DELETE FROM cancellation_records');
+      await client.query('DELETE FROM price_adjustments');
+      await client.query('DELETE FROM booking_waitlist');
+      await client.query('DELETE FROM room_holds');
+      await client.query('DELETE FROM refunds');
+      await client.query('DELETE FROM payment_webhook_events');
+      await client.query('DELETE FROM payment_disputes');
+      await client.query('DELETE FROM booking_sagas');
       await client.query('DELETE FROM receipts');
+      await client.query('DELETE FROM installments');
       await client.query('DELETE FROM payments');
       await client.query('DELETE FROM bookings');
+      await client.query('DELETE FROM promo_codes');
+      await client.query('DELETE FROM rate_seasons');
+      await client.query('DELETE FROM rate_plans');
+      await client.query('DELETE FROM stay_restrictions');
       await client.query('DELETE FROM guests');
-      await client.query('UPDATE rooms SET is_available = TRUE');
+      await client.query('DELETE FROM room_maintenance_blocks');
+      await client.query('DELETE FROM room_type_facilities');
+      await client.query('DELETE FROM facilities');
+      await client.query('DELETE FROM room_type_photos');
+      await client.query('DELETE FROM adjoining_rooms');
+      await client.query('DELETE FROM room_status_history');
+      await client.query('DELETE FROM rooms WHERE is_sandbox');
+      await client.query(
+        "UPDATE rooms SET is_available = TRUE, retired_at = NULL, housekeeping_status = 'clean', " +
+        'floor = NULL, view_type = NULL, smoking_allowed = FALSE, accessible = FALSE'
+      );
       await client.query('COMMIT');
     } catch (error) {
       await client.query('ROLLBACK');
@@ -54,6 +169,45 @@ describe('Hotel Booking System', () => {
       expect(result.payment.status).toBe('completed');
     });
 
+    test('should store a nightly price breakdown that adds up to the total', async () => {
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-30',
+        checkOutDate: '2025-01-02',
+        paymentMethod: 'credit_card'
+      });
+
+      const breakdown = result.booking.price_breakdown!;
+      expect(breakdown.nights.map(night => night.date)).toEqual(['2024-12-30', '2024-12-31', '2025-01-01']);
+      expect(breakdown.total).toBe(Number(result.booking.total_amount));
+      expect(Number(result.payment.amount)).toBe(breakdown.total);
+    });
+
+    test('should accept a stay ending exactly at the booking horizon and reject one a day past it', async () => {
+      const horizon = addDays(today(), bookingConfig.horizonDays);
+      const stay = (checkOutDate: string) => ({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: addDays(checkOutDate, -2),
+        checkOutDate,
+        paymentMethod: 'credit_card'
+      });
+
+      const atHorizon = await bookingService.createBooking(stay(horizon));
+      expect(atHorizon.booking.status).toBe('pending');
+
+      const pastHorizon = bookingService.createBooking({ ...stay(addDays(horizon, 1)), roomId: 2 });
+      await expect(pastHorizon).rejects.toBeInstanceOf(ValidationError);
+      await expect(pastHorizon).rejects.toMatchObject({
+        fields: { checkOutDate: `must not be later than ${horizon} (${bookingConfig.horizonDays} days ahead)` }
+      });
+    });
+
     test('should fail when room is not available', async () => {
       // First booking
       const bookingRequest = {
@@ -166,7 +320,7 @@ describe('Hotel Booking System', () => {
       const bookingId = result.booking.id;
 
       // Cancel the booking
-      await bookingService.cancelBooking(bookingId);
+      await bookingService.cancelBooking(bookingId, { code: 'guest_request' });
 
       // Check if room is available again
       const client = await pool.connect();
@@ -181,6 +335,15 @@ describe('Hotel Booking System', () => {
       }
     });
 
+    test('should answer 404 when cancelling a booking that does not exist', async () => {
+      await expect(bookingService.cancelBooking(999999, { code: 'guest_request' })).rejects.toBeInstanceOf(NotFoundError);
+
+      const res: any = { statusCode: 200, status(code: number) { this.statusCode = code; return this; }, json(body: unknown) { this.body = body; return this; } };
+      await cancelBooking({ params: { id: '999999' }, body: { reasonCode: 'guest_request' } } as any, res);
+      expect(res.statusCode).toBe(404);
+      expect(res.body).toEqual({ success: false, message: 'Booking not found' });
+    });
+
     test('should get booking details', async () => {
       const bookingRequest = {
         guestName: 'John Doe',
@@ -201,5 +364,2676 @@ describe('Hotel Booking System', () => {
       expect(bookingDetails.room_number).toBe('101');
       expect(bookingDetails.receipt_number).toBeDefined();
     });
+
+    test('should patch only the check-out date', async () => {
+      const bookingRequest = {
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      };
+
+      const result = await bookingService.createBooking(bookingRequest);
+      const updated = await bookingService.updateBooking(result.booking.id, { checkOutDate: '2024-12-07' });
+
+      expect(updated.guest_name).toBe('John Doe');
+      expect(updated.check_out_date.getDate()).toBe(7);
+
+      await expect(bookingService.updateBooking(result.booking.id, { checkInDate: null }))
+        .rejects.toThrow('Invalid booking patch');
+    });
+
+    test('should reprice a modified stay and report the delta', async () => {
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+
+      const extended = await bookingService.updateBooking(result.booking.id, { checkOutDate: '2024-12-07' });
+      expect(Number(extended.total_amount)).toBe(600);
+      expect(extended.price_adjustment).toMatchObject({ previous_amount: 400, new_amount: 600, delta: 200 });
+
+      const renamed = await bookingService.updateBooking(result.booking.id, { guestName: 'John Smith' });
+      expect(renamed.price_adjustment).toBeNull();
+    });
+
+    test('should reject a patch based on a stale version', async () => {
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+      const version = result.booking.version;
+
+      const updated = await bookingService.updateBooking(result.booking.id, { guestName: 'John Smith' }, version);
+      expect(updated.version).toBe(version + 1);
+
+      await expect(bookingService.updateBooking(result.booking.id, { guestName: 'Johnny' }, version))
+        .rejects.toBeInstanceOf(PreconditionFailedError);
+    });
+  });
+
+  describe('Consistency Snapshot', () => {
+    test('should report matching totals and no orphans after a booking', async () => {
+      await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+
+      const snapshot = await new AdminService().getConsistencySnapshot();
+
+      expect(snapshot.activeBookings).toBe(1);
+      expect(snapshot.occupiedRoomNights).toBe(4);
+      expect(snapshot.receiptsTotal).toBe(snapshot.bookingsTotal);
+      expect(snapshot.overlappingBookings).toBe(0);
+      expect(Object.values(snapshot.orphans).every(count => count === 0)).toBe(true);
+    });
+
+    test('should not count a held room as unavailable without a booking', async () => {
+      await bookingService.createHold({ roomId: 2, checkInDate: '2024-12-01', checkOutDate: '2024-12-05' });
+
+      const snapshot = await new AdminService().getConsistencySnapshot();
+
+      expect(snapshot.roomsUnavailableWithoutBooking).toBe(0);
+    });
+  });
+
+  describe('Occupancy Stream', () => {
+    test('should cover a burst of changes on several topics with one extra push', async () => {
+      const writes: string[] = [];
+      const req = new EventEmitter();
+      const res: any = { writeHead() { return this; }, write(chunk: string) { writes.push(chunk); return true; } };
+
+      streamOccupancyBoard(req as any, res);
+      eventBus.publish('booking.created', { bookingId: 1, roomId: 1, guestId: 1 });
+      eventBus.publish('booking.updated', { bookingId: 1, fields: ['guestName'] });
+      eventBus.publish('hold.created', { holdId: 1, roomId: 2 });
+      eventBus.publish('hold.released', { count: 1 });
+
+      await new Promise(resolve => setTimeout(resolve, 200));
+      req.emit('close');
+      expect(writes.filter(chunk => chunk.startsWith('event: occupancy'))).toHaveLength(2);
+    });
+  });
+
+  describe('Transaction Manager', () => {
+    test('should roll back only the nested savepoint and skip its hooks', async () => {
+      const hooks: string[] = [];
+
+      await runInTransaction(async ({ client, afterCommit }) => {
+        await client.query(
+          `INSERT INTO guests (name, email, phone) VALUES ('Outer', 'outer@example.com', '1')`
+        );
+        afterCommit(() => { hooks.push('outer'); });
+
+        await expect(runInTransaction(async (inner) => {
+          await inner.client.query(
+            `INSERT INTO guests (name, email, phone) VALUES ('Inner', 'inner@example.com', '2')`
+          );
+          inner.afterCommit(() => { hooks.push('inner'); });
+          throw new Error('inner failure');
+        })).rejects.toThrow('inner failure');
+      });
+
+      const result = await pool.query('SELECT email FROM guests ORDER BY email');
+      expect(result.rows.map(row => row.email)).toEqual(['outer@example.com']);
+      expect(hooks).toEqual(['outer']);
+    });
+
+    test('should run at the configured isolation level and rerun serialization failures', async () => {
+      isolationConfig.levels.isolationProbe = 'SERIALIZABLE';
+      try {
+        const level = await runInTransaction(async ({ client }) => {
+          const result = await client.query('SHOW transaction_isolation');
+          return result.rows[0].transaction_isolation;
+        }, { name: 'isolationProbe', isolationLevel: 'REPEATABLE READ' });
+        expect(level).toBe('serializable');
+      } finally {
+        delete isolationConfig.levels.isolationProbe;
+      }
+
+      const hooks: number[] = [];
+      let attempts = 0;
+      const result = await runInTransaction(async ({ afterCommit }) => {
+        attempts++;
+        afterCommit(() => { hooks.push(attempts); });
+        if (attempts === 1) {
+          throw Object.assign(new Error('could not serialize access'), { code: '40001' });
+        }
+        return 'done';
+      }, { name: 'retryProbe' });
+      expect(result).toBe('done');
+      expect(attempts).toBe(2);
+      expect(hooks).toEqual([2]);
+
+      let failures = 0;
+      await expect(runInTransaction(async () => {
+        failures++;
+        throw Object.assign(new Error('duplicate key'), { code: '23505' });
+      })).rejects.toThrow('duplicate key');
+      expect(failures).toBe(1);
+    });
+
+    test('should rerun deadlock victims with backoff and report a conflict once out of attempts', async () => {
+      const guests = await pool.query(
+        `INSERT INTO guests (name, email, phone) VALUES ('A', 'a@example.com', '1'), ('B', 'b@example.com', '2') RETURNING id`
+      );
+      const [first, second] = guests.rows.map(row => row.id);
+      let locked = 0;
+      let release: () => void;
+      const bothLocked = new Promise<void>(resolve => { release = resolve; });
+      const attempts: Record<string, number> = { forward: 0, backward: 0 };
+
+      // Each locks one guest, waits until the other has locked the second, then reaches for it: a deadlock
+      const lockInOrder = (label: string, ids: number[]) => runInTransactionWithRetry(async ({ client }) => {
+        attempts[label]++;
+        await client.query('SELECT id FROM guests WHERE id = $1 FOR UPDATE', [ids[0]]);
+        if (++locked === 2) {
+          release();
+        }
+        await bothLocked;
+        await client.query('SELECT id FROM guests WHERE id = $1 FOR UPDATE', [ids[1]]);
+        return label;
+      }, { name: label });
+
+      expect(await Promise.all([lockInOrder('forward', [first, second]), lockInOrder('backward', [second, first])]))
+        .toEqual(['forward', 'backward']);
+      expect(attempts.forward + attempts.backward).toBe(3);
+
+      let tries = 0;
+      await expect(runInTransactionWithRetry(async () => {
+        tries++;
+        throw Object.assign(new Error('deadlock detected'), { code: '40P01' });
+      }, { maxAttempts: 2 })).rejects.toBeInstanceOf(ConflictError);
+      expect(tries).toBe(2);
+
+      for (let attempt = 1; attempt <= 10; attempt++) {
+        const ceiling = Math.min(isolationConfig.retryMaxDelayMs, isolationConfig.retryBaseDelayMs * 2 ** (attempt - 1));
+        const delay = retryDelayMs(attempt);
+        expect(delay).toBeGreaterThanOrEqual(ceiling / 2 - 1);
+        expect(delay).toBeLessThanOrEqual(ceiling);
+      }
+    });
+
+    test('should rerun deadlocks in a savepoint from the outermost transaction', async () => {
+      const attempts = { outer: 0, inner: 0 };
+      const result = await runInTransactionWithRetry(async () => {
+        attempts.outer++;
+        return runInTransactionWithRetry(async () => {
+          attempts.inner++;
+          if (attempts.inner === 1) {
+            throw Object.assign(new Error('deadlock detected'), { code: '40P01' });
+          }
+          return 'done';
+        });
+      });
+      expect(result).toBe('done');
+      expect(attempts).toEqual({ outer: 2, inner: 2 });
+
+      const before = await pool.query('SELECT id, price_per_night FROM rooms WHERE id IN (1, 2) ORDER BY id');
+      const original = Client.prototype.query;
+      let deadlocked = false;
+      const query = jest.spyOn(Client.prototype, 'query').mockImplementation(function (this: Client, ...args: any[]) {
+        if (!deadlocked && typeof args[0] === 'string' && args[0].startsWith('UPDATE rooms SET price_per_night') && args[1][1] === 2) {
+          deadlocked = true;
+          return Promise.reject(Object.assign(new Error('deadlock detected'), { code: '40P01' }));
+        }
+        return (original as any).apply(this, args);
+      });
+      try {
+        const outcomes = await bookingService.bulkUpdateRoomPricing([1, 2], 10);
+        expect(outcomes.map(outcome => [outcome.roomId, outcome.status, outcome.attempts]).sort())
+          .toEqual([[1, 'updated', 1], [2, 'updated', 1]]);
+      } finally {
+        query.mockRestore();
+      }
+
+      // Whatever the deadlocked run had changed was rolled back with it, not applied twice
+      const after = await pool.query('SELECT id, price_per_night FROM rooms WHERE id IN (1, 2) ORDER BY id');
+      expect(after.rows.map(row => Number(row.price_per_night)))
+        .toEqual(before.rows.map(row => Number(row.price_per_night) + 10));
+    });
+  });
+
+  describe('Input Sanitation', () => {
+    const payloads = [
+      "'; DROP TABLE bookings; --",
+      '" OR 1=1 --',
+      "Robert'); DELETE FROM guests; --",
+      "%' UNION SELECT * FROM payments --",
+      '\\x00; SELECT pg_sleep(5)'
+    ];
+
+    test.each(payloads)('should store %p verbatim without executing it', async payload => {
+      const result = await bookingService.createBooking({
+        guestName: payload,
+        guestEmail: 'fuzz@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+
+      const renamed = await bookingService.updateBooking(result.booking.id, { guestName: `${payload} II` });
+      expect(renamed.guest_name).toBe(`${payload} II`.trim());
+
+      const tables = await pool.query(
+        "SELECT to_regclass('bookings') AS bookings, to_regclass('guests') AS guests, to_regclass('payments') AS payments"
+      );
+      expect(Object.values(tables.rows[0]).every(table => table !== null)).toBe(true);
+
+      const guests = await pool.query('SELECT COUNT(*) FROM guests');
+      expect(Number(guests.rows[0].count)).toBe(1);
+    });
+
+    test.each(payloads)('should reject %p as an id list or payment method', async payload => {
+      expect(() => parseIdList(payload)).toThrow(ValidationError);
+
+      await expect(bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: payload
+      })).rejects.toThrow('Invalid booking request');
+    });
+  });
+
+  describe('Room Holds', () => {
+    const stay = { roomId: 1, checkInDate: '2024-12-01', checkOutDate: '2024-12-05' };
+
+    test('should reserve the room for the hold token only', async () => {
+      const hold = await bookingService.createHold(stay);
+
+      await expect(bookingService.createBooking({
+        ...stay,
+        guestName: 'Jane Smith',
+        guestEmail: 'jane@example.com',
+        guestPhone: '+1234567891',
+        paymentMethod: 'credit_card'
+      })).rejects.toThrow('Room is not available');
+
+      const result = await bookingService.createBooking({
+        ...stay,
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        paymentMethod: 'credit_card',
+        holdToken: hold.token
+      });
+
+      const holdRow = await pool.query('SELECT status, booking_id FROM room_holds WHERE id = $1', [hold.id]);
+      expect(holdRow.rows[0]).toEqual({ status: 'converted', booking_id: result.booking.id });
+    });
+
+    test('should release expired holds and free the room', async () => {
+      const hold = await bookingService.createHold({ ...stay, minutes: 1 });
+      await pool.query(`UPDATE room_holds SET expires_at = CURRENT_TIMESTAMP - INTERVAL '1 second' WHERE id = $1`, [hold.id]);
+
+      expect(await bookingService.releaseExpiredHolds()).toBe(1);
+
+      const room = await pool.query('SELECT is_available FROM rooms WHERE id = $1', [1]);
+      expect(room.rows[0].is_available).toBe(true);
+    });
+  });
+
+  describe('Idempotency Keys', () => {
+    // Drives the middleware with minimal request/response stand-ins and resolves with what was sent
+    const send = (key: string, body: object, handler: (res: any) => void) => new Promise<{ status: number; body: any; headers: Record<string, string> }>((resolve, reject) => {
+      const headers: Record<string, string> = {};
+      const req: any = { method: 'POST', baseUrl: '/api', path: '/bookings', body, header: () => key };
+      const res: any = {
+        statusCode: 200,
+        status(code: number) { this.statusCode = code; return this; },
+        setHeader(name: string, value: string) { headers[name] = value; },
+        json(payload: any) { resolve({ status: this.statusCode, body: payload, headers }); return this; }
+      };
+      idempotency(req, res, () => handler(res)).catch(reject);
+    });
+
+    test('should replay the first response for a retried key', async () => {
+      let calls = 0;
+      const handler = (res: any) => { calls++; res.status(201).json({ success: true, data: { id: calls } }); };
+
+      const first = await send('key-1', { roomId: 1 }, handler);
+      const retry = await send('key-1', { roomId: 1 }, handler);
+
+      expect(calls).toBe(1);
+      expect(retry.status).toBe(201);
+      expect(retry.body).toEqual(first.body);
+      expect(retry.headers['Idempotent-Replayed']).toBe('true');
+    });
+
+    test('should reject a reused key with a different body', async () => {
+      const handler = (res: any) => res.status(201).json({ success: true });
+
+      await send('key-2', { roomId: 1 }, handler);
+      const reused = await send('key-2', { roomId: 2 }, handler);
+
+      expect(reused.status).toBe(422);
+    });
+
+    test('should rerun a key whose first attempt conflicted or was abandoned', async () => {
+      let calls = 0;
+      const handler = (res: any) => {
+        calls++;
+        return calls === 1 ? res.status(409).json({ success: false }) : res.status(201).json({ success: true });
+      };
+
+      expect((await send('key-3', { roomId: 1 }, handler)).status).toBe(409);
+      expect((await send('key-3', { roomId: 1 }, handler)).status).toBe(201);
+      expect(calls).toBe(2);
+
+      // A request that never answered leaves its key in progress; once the lease is up a retry runs again
+      await pool.query(
+        `INSERT INTO idempotency_keys (key, method, path, request_hash, status, created_at)
+         VALUES ('key-4', 'POST', '/api/bookings', $1, 'in_progress', CURRENT_TIMESTAMP - INTERVAL '10 minutes')`,
+        [crypto.createHash('sha256').update(JSON.stringify({ roomId: 1 })).digest('hex')]
+      );
+      expect((await send('key-4', { roomId: 1 }, handler)).status).toBe(201);
+      expect(calls).toBe(3);
+    });
+  });
+
+  describe('Orphan Cleanup', () => {
+    test('should report orphans on dry run and remove them otherwise', async () => {
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+      await pool.query('UPDATE receipts SET booking_id = NULL WHERE id = $1', [result.receipt.id]);
+      await pool.query('UPDATE rooms SET is_available = FALSE WHERE id = $1', [2]);
+
+      const adminService = new AdminService();
+      const dryRun = await adminService.cleanupOrphans(true);
+      expect(dryRun.receiptIds).toEqual([result.receipt.id]);
+      expect(dryRun.roomIds).toEqual([2]);
+      expect(dryRun.paymentIds).toEqual([]);
+
+      await adminService.cleanupOrphans(false);
+      const receipts = await pool.query('SELECT id FROM receipts WHERE id = $1', [result.receipt.id]);
+      const room = await pool.query('SELECT is_available FROM rooms WHERE id = $1', [2]);
+      expect(receipts.rows).toHaveLength(0);
+      expect(room.rows[0].is_available).toBe(true);
+    });
+  });
+
+  describe('Event Bus', () => {
+    const flush = () => new Promise(resolve => setTimeout(resolve, 50));
+
+    test('should publish booking.created after the booking commits', async () => {
+      const received: number[] = [];
+      const unsubscribe = eventBus.subscribe('booking.created', event => { received.push(event.bookingId); }, { name: 'test' });
+
+      try {
+        const result = await bookingService.createBooking({
+          guestName: 'John Doe',
+          guestEmail: 'john@example.com',
+          guestPhone: '+1234567890',
+          roomId: 1,
+          checkInDate: '2024-12-01',
+          checkOutDate: '2024-12-05',
+          paymentMethod: 'credit_card'
+        });
+        await flush();
+        expect(received).toEqual([result.booking.id]);
+      } finally {
+        unsubscribe();
+      }
+    });
+
+    test('should retry a failing handler', async () => {
+      let attempts = 0;
+      const unsubscribe = eventBus.subscribe('hold.released', () => {
+        if (++attempts < 3) {
+          throw new Error('transient');
+        }
+      }, { name: 'test', maxAttempts: 3, retryDelayMs: 1 });
+
+      eventBus.publish('hold.released', { count: 1 });
+      await flush();
+      unsubscribe();
+
+      expect(attempts).toBe(3);
+    });
+
+    test('should drop new events when a drop_newest buffer is full', async () => {
+      let release!: () => void;
+      const blocked = new Promise<void>(resolve => { release = resolve; });
+      const unsubscribe = eventBus.subscribe('hold.released', () => blocked, {
+        name: 'test', bufferSize: 1, overflow: 'drop_newest'
+      });
+
+      // The first event is taken by the worker, the second fills the buffer, the third is dropped
+      expect(eventBus.publish('hold.released', { count: 1 })).toBe(1);
+      expect(eventBus.publish('hold.released', { count: 2 })).toBe(1);
+      expect(eventBus.publish('hold.released', { count: 3 })).toBe(0);
+
+      release();
+      unsubscribe();
+    });
+  });
+
+  describe('Booking Lifecycle', () => {
+    const createBooking = () => bookingService.createBooking({
+      guestName: 'John Doe',
+      guestEmail: 'john@example.com',
+      guestPhone: '+1234567890',
+      roomId: 1,
+      checkInDate: '2024-12-01',
+      checkOutDate: '2024-12-05',
+      paymentMethod: 'credit_card'
+    });
+
+    test('should walk a stay from pending to checked_out and free the room', async () => {
+      const result = await createBooking();
+
+      await bookingService.changeStatus(result.booking.id, 'confirmed');
+      await bookingService.changeStatus(result.booking.id, 'checked_in');
+      const checkedOut = await bookingService.changeStatus(result.booking.id, 'checked_out');
+
+      expect(checkedOut.status).toBe('checked_out');
+      const room = await pool.query('SELECT is_available FROM rooms WHERE id = $1', [1]);
+      expect(room.rows[0].is_available).toBe(true);
+    });
+
+    test('should reject illegal transitions with a code', async () => {
+      const result = await createBooking();
+      await bookingService.cancelBooking(result.booking.id, { code: 'guest_request' });
+
+      const error = await bookingService.changeStatus(result.booking.id, 'confirmed').catch(e => e);
+      expect(error).toBeInstanceOf(BookingStateError);
+      expect(error.code).toBe('INVALID_TRANSITION');
+
+      await expect(bookingService.cancelBooking(result.booking.id, { code: 'guest_request' }))
+        .rejects.toBeInstanceOf(BookingStateError);
+      await expect(bookingService.updateBooking(result.booking.id, { guestName: 'Jane Doe' }))
+        .rejects.toThrow('Cannot modify a cancelled booking');
+    });
+  });
+
+  describe('Waitlist', () => {
+    const stay = { roomId: 1, checkInDate: '2024-12-01', checkOutDate: '2024-12-05', paymentMethod: 'credit_card' };
+
+    test('should auto-book the first waiting guest when the room is cancelled', async () => {
+      const waitlistService = new WaitlistService(bookingService);
+      const original = await bookingService.createBooking({
+        ...stay, guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890'
+      });
+
+      const first = await waitlistService.join({
+        ...stay, guestName: 'Jane Smith', guestEmail: 'jane@example.com', guestPhone: '+1234567891', autoBook: true
+      });
+      const second = await waitlistService.join({
+        ...stay, guestName: 'Bob Jones', guestEmail: 'bob@example.com', guestPhone: '+1234567892', autoBook: true
+      });
+
+      await bookingService.cancelBooking(original.booking.id, { code: 'guest_request' });
+      const served = await waitlistService.processRoom(1);
+
+      expect(served?.id).toBe(first.id);
+      expect(served?.status).toBe('promoted');
+      expect((await waitlistService.getEntry(second.id))?.status).toBe('waiting');
+    });
+
+    test('should only queue for a taken room and fail entries whose room was retired', async () => {
+      const waitlistService = new WaitlistService(bookingService);
+      await expect(waitlistService.join({
+        ...stay, guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890'
+      })).rejects.toThrow('book it instead');
+
+      const original = await bookingService.createBooking({
+        ...stay, guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890'
+      });
+      const entry = await waitlistService.join({
+        ...stay, guestName: 'Jane Smith', guestEmail: 'jane@example.com', guestPhone: '+1234567891', autoBook: true
+      });
+
+      await bookingService.cancelBooking(original.booking.id, { code: 'guest_request' });
+      await pool.query('UPDATE rooms SET retired_at = CURRENT_TIMESTAMP WHERE id = 1');
+      expect(await waitlistService.processRoom(1)).toBeNull();
+      expect(await waitlistService.getEntry(entry.id)).toMatchObject({ status: 'failed', failure_reason: 'Room has been retired' });
+
+      await expect(waitlistService.join({
+        ...stay, guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890'
+      })).rejects.toBeInstanceOf(ConflictError);
+    });
+  });
+
+  describe('Booking Search', () => {
+    test('should filter and page through bookings with a cursor', async () => {
+      for (const roomId of [1, 2, 3]) {
+        await bookingService.createBooking({
+          guestName: `Guest ${roomId}`,
+          guestEmail: `guest${roomId}@example.com`,
+          guestPhone: '+1234567890',
+          roomId,
+          checkInDate: '2024-12-01',
+          checkOutDate: '2024-12-05',
+          paymentMethod: 'credit_card'
+        });
+      }
+
+      const first = await bookingService.searchBookings({ guestName: 'guest', sort: 'created_at', order: 'asc', limit: '2' });
+      expect(first.bookings.map(b => b.room_id)).toEqual([1, 2]);
+      expect(first.nextCursor).not.toBeNull();
+
+      const second = await bookingService.searchBookings({ guestName: 'guest', sort: 'created_at', order: 'asc', limit: '2', cursor: first.nextCursor! });
+      expect(second.bookings.map(b => b.room_id)).toEqual([3]);
+      expect(second.nextCursor).toBeNull();
+
+      const byRoom = await bookingService.searchBookings({ roomId: '2', paymentStatus: 'completed' });
+      expect(byRoom.bookings).toHaveLength(1);
+
+      await expect(bookingService.searchBookings({ sort: 'guest_email' })).rejects.toThrow(ValidationError);
+
+      // Cursors are signed and tied to the listing they came from
+      const [payload, signature] = first.nextCursor!.split('.');
+      const forged = Buffer.from(JSON.stringify(['bookings', 'created_at', 'asc', '1970-01-01', 0])).toString('base64url');
+      await expect(bookingService.searchBookings({ guestName: 'guest', sort: 'created_at', order: 'asc', cursor: `${forged}.${signature}` }))
+        .rejects.toThrow(ValidationError);
+      await expect(bookingService.searchBookings({ guestName: 'guest', sort: 'created_at', order: 'desc', cursor: `${payload}.${signature}` }))
+        .rejects.toThrow(ValidationError);
+      await expect(new AuditService().getBookingHistory(first.bookings[0].id, { cursor: first.nextCursor! }))
+        .rejects.toThrow(ValidationError);
+    });
+
+    test('should list a booking with several matching payments once', async () => {
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+      await pool.query(
+        `INSERT INTO payments (booking_id, amount, payment_method, status, transaction_id)
+         VALUES ($1, 50, 'credit_card', 'completed', 'TXN_EXTRA')`,
+        [result.booking.id]
+      );
+
+      const found = await bookingService.searchBookings({ paymentStatus: 'completed', limit: '1' });
+      expect(found.bookings.map(b => b.id)).toEqual([result.booking.id]);
+      expect(found.nextCursor).toBeNull();
+    });
+
+    test('should use the page sizes configured for the booking search', async () => {
+      for (const roomId of [1, 2, 3]) {
+        await bookingService.createBooking({
+          guestName: `Guest ${roomId}`,
+          guestEmail: `guest${roomId}@example.com`,
+          guestPhone: '+1234567890',
+          roomId,
+          checkInDate: '2024-12-01',
+          checkOutDate: '2024-12-05',
+          paymentMethod: 'credit_card'
+        });
+      }
+      await expect(bookingService.searchBookings({ limit: '101' })).rejects.toThrow(ValidationError);
+
+      const sizes = paginationConfig.pageSizes.bookings;
+      paginationConfig.pageSizes.bookings = { default: 2, max: 2 };
+      try {
+        const page = await bookingService.searchBookings({});
+        expect(page.bookings).toHaveLength(2);
+        expect(page.nextCursor).not.toBeNull();
+        await expect(bookingService.searchBookings({ limit: '3' })).rejects.toThrow(ValidationError);
+      } finally {
+        paginationConfig.pageSizes.bookings = sizes;
+      }
+    });
+
+    test('should fetch bookings by id and report the ids that were not found', async () => {
+      const respond = async (query: Record<string, string>) => {
+        const res: any = { statusCode: 200, status(code: number) { this.statusCode = code; return this; }, json(body: unknown) { this.body = body; return this; } };
+        await getBookings({ query } as any, res);
+        return res;
+      };
+      const first = await bookingService.createBooking({
+        guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890',
+        roomId: 1, checkInDate: '2024-12-01', checkOutDate: '2024-12-05', paymentMethod: 'credit_card'
+      });
+      const second = await bookingService.createBooking({
+        guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890',
+        roomId: 2, checkInDate: '2024-12-01', checkOutDate: '2024-12-05', paymentMethod: 'credit_card'
+      });
+      const unknownId = second.booking.id + 1000;
+
+      const mixed = await respond({ ids: `${second.booking.id},${unknownId},${first.booking.id},${second.booking.id}` });
+      expect(mixed.statusCode).toBe(200);
+      expect(mixed.body.data.found.map((b: { id: number }) => b.id)).toEqual([first.booking.id, second.booking.id]);
+      expect(mixed.body.data.missing).toEqual([unknownId]);
+
+      for (const ids of ['', '1,abc', '1,,2', '0', '-3', '1.5']) {
+        const malformed = await respond({ ids });
+        expect(malformed.statusCode).toBe(400);
+        expect(malformed.body.errors).toHaveProperty('ids');
+      }
+
+      const combined = await respond({ ids: String(first.booking.id), roomId: '1', status: 'pending' });
+      expect(combined.statusCode).toBe(400);
+      expect(combined.body.errors).toEqual({ ids: 'cannot be combined with roomId, status' });
+    });
+  });
+
+  describe('Channel Attribution', () => {
+    test('should record the channel and report revenue per channel', async () => {
+      const stay = { checkInDate: '2024-12-01', checkOutDate: '2024-12-05', paymentMethod: 'credit_card', guestPhone: '+1234567890' };
+      await bookingService.createBooking({ ...stay, roomId: 1, guestName: 'John Doe', guestEmail: 'john@example.com' });
+      const ota = await bookingService.createBooking({
+        ...stay, roomId: 3, guestName: 'Jane Smith', guestEmail: 'jane@example.com', channel: 'ota:booking_com'
+      });
+      expect(ota.booking.channel).toBe('ota:booking_com');
+
+      await expect(bookingService.createBooking({
+        ...stay, roomId: 2, guestName: 'Bob Jones', guestEmail: 'bob@example.com', channel: 'fax'
+      })).rejects.toThrow(ValidationError);
+
+      const report = await new AdminService().getChannelReport('2024-12-01', '2024-12-31');
+      expect(report.channels).toEqual([
+        { channel: 'ota:booking_com', bookings: 1, cancellations: 0, room_nights: 4, revenue: 600 },
+        { channel: 'direct', bookings: 1, cancellations: 0, room_nights: 4, revenue: 400 }
+      ]);
+    });
+  });
+
+  describe('Guest Profiles', () => {
+    const guestService = new GuestService();
+
+    test('should link bookings to an existing profile and list its history', async () => {
+      const guest = await guestService.createGuest({
+        name: 'John Doe', email: 'john@example.com', phone: '+1234567890', documentId: 'P1234567'
+      });
+      await expect(guestService.createGuest({ name: 'John', email: 'john@example.com', phone: '+1' }))
+        .rejects.toBeInstanceOf(ConflictError);
+
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+      expect(result.booking.guest_id).toBe(guest.id);
+
+      const history = await bookingService.getBookingsForGuest(guest.id);
+      expect(history.map(booking => booking.id)).toEqual([result.booking.id]);
+
+      const updated = await guestService.updateGuest(guest.id, { documentId: null });
+      expect(updated.document_id).toBeNull();
+      expect(updated.name).toBe('John Doe');
+
+      await expect(guestService.deleteGuest(guest.id)).rejects.toBeInstanceOf(ConflictError);
+    });
+
+    test('should rename a booking without renaming the guest or their other bookings', async () => {
+      const guest = await guestService.createGuest({ name: 'John Doe', email: 'john@example.com', phone: '+1234567890' });
+      const bookingRequest = {
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      };
+      const first = await bookingService.createBooking(bookingRequest);
+      const second = await bookingService.createBooking({ ...bookingRequest, checkInDate: '2024-12-10', checkOutDate: '2024-12-12' });
+
+      const renamed = await bookingService.updateBooking(first.booking.id, { guestName: 'Jane Doe' });
+      expect(renamed.guest_name).toBe('Jane Doe');
+      expect(renamed.guest_id).toBe(guest.id);
+
+      expect((await bookingService.getBookingDetails(second.booking.id)).guest_name).toBe('John Doe');
+      expect((await guestService.getGuest(guest.id))!.name).toBe('John Doe');
+    });
+
+    test('should store contact details encrypted and move plain rows onto the current key', async () => {
+      const guest = await guestService.createGuest({ name: 'John Doe', email: 'john@example.com', phone: '+1234567890' });
+      const stored = await pool.query('SELECT email, phone, pii_key_id FROM guests WHERE id = $1', [guest.id]);
+      expect(stored.rows[0].email).not.toContain('john');
+      expect(stored.rows[0].phone).not.toContain('1234567890');
+      expect(stored.rows[0].pii_key_id).toBe(encryptionConfig.currentKeyId);
+      expect(await guestService.updateGuest(guest.id, { phone: '+1987654321' }))
+        .toMatchObject({ email: 'john@example.com', phone: '+1987654321' });
+
+      // A guest stored before encryption is still found by email, until the script encrypts it
+      const legacy = await pool.query(
+        `INSERT INTO guests (name, email, phone) VALUES ('Jane Doe', 'jane@example.com', '+1234567891') RETURNING id`
+      );
+      const legacyId = legacy.rows[0].id;
+      const booked = await bookingService.createBooking({
+        guestName: 'Jane Doe',
+        guestEmail: 'jane@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+      expect(booked.booking.guest_id).toBe(legacyId);
+
+      expect(await reencryptGuests({ batchSize: 1, all: false, dryRun: false })).toEqual({ guests: 1, booking_waitlist: 0 });
+      expect((await pool.query('SELECT email FROM guests WHERE id = $1', [legacyId])).rows[0].email).not.toContain('jane');
+      expect(await guestService.getGuest(legacyId)).toMatchObject({ email: 'jane@example.com', phone: '+1234567891' });
+      expect((await bookingService.getBookingDetails(booked.booking.id)).guest_email).toBe('jane@example.com');
+    });
+  });
+
+  describe('Cancellation Policies', () => {
+    const book = (checkInDate: string, checkOutDate: string) => bookingService.createBooking({
+      guestName: 'John Doe',
+      guestEmail: 'john@example.com',
+      guestPhone: '+1234567890',
+      roomId: 1,
+      checkInDate,
+      checkOutDate,
+      paymentMethod: 'credit_card'
+    });
+
+    test('should refund in full inside the free window', async () => {
+      const result = await book(addDays(today(), 30), addDays(today(), 34));
+      const record = await bookingService.cancelBooking(result.booking.id, { code: 'guest_request' });
+
+      expect(record).toMatchObject({ policy_code: 'flexible', paid_amount: 400, fee_amount: 0, refundable_amount: 400 });
+    });
+
+    test('should keep the late fee after the free window unless the hotel cancelled', async () => {
+      const late = await book('2024-12-01', '2024-12-05');
+      const record = await bookingService.cancelBooking(late.booking.id, { code: 'change_of_plans' });
+      expect(record).toMatchObject({ fee_amount: 200, refundable_amount: 200, fee_waived: false });
+
+      const hotel = await book('2024-12-01', '2024-12-05');
+      const waived = await bookingService.cancelBooking(hotel.booking.id, { code: 'hotel_initiated' });
+      expect(waived).toMatchObject({ fee_amount: 0, refundable_amount: 400, fee_waived: true });
+    });
+  });
+
+  describe('Fixtures', () => {
+    test('should load the double-booking fixture and reproduce its conflicts', async () => {
+      const fixture = readFixture('fixtures/double-booking.json');
+      const loaded = await loadFixture(fixture);
+
+      const booking = await bookingService.getBookingDetails(loaded.bookingIds['owner-stay']);
+      expect(booking.status).toBe('confirmed');
+
+      const outcomes = await runConflicts(fixture, loaded);
+      expect(outcomes.filter(outcome => !outcome.passed)).toEqual([]);
+      expect(outcomes).toHaveLength(2);
+    });
+  });
+
+  describe('Response Envelope', () => {
+    const send = (envelope: string | undefined, handler: (res: any) => Promise<void>) => new Promise<{ body: any; headers: Record<string, string> }>((resolve, reject) => {
+      const headers: Record<string, string> = {};
+      const req: any = { header: (name: string) => (name === 'X-Response-Envelope' ? envelope : undefined) };
+      const res: any = {
+        setHeader(name: string, value: string) { headers[name] = value; },
+        json(payload: any) { resolve({ body: payload, headers }); return this; }
+      };
+      runWithStageTiming(() => responseEnvelope(req, res, () => handler(res).catch(reject)));
+    });
+
+    test('should add request metadata and warnings when asked for', async () => {
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+
+      const { body, headers } = await send('true', async res => {
+        const record = await bookingService.cancelBooking(result.booking.id, { code: 'change_of_plans' });
+        res.json({ success: true, data: record });
+      });
+
+      expect(body.success).toBe(true);
+      expect(body.meta).toMatchObject({ request_id: headers['X-Request-Id'], tx_outcome: 'committed' });
+      expect(body.meta.warnings).toEqual([expect.stringContaining('cancellation fee of 200')]);
+    });
+
+    test('should report mixed transaction outcomes', async () => {
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+
+      const { body } = await send('true', async res => {
+        await bookingService.cancelBooking(result.booking.id, { code: 'change_of_plans' });
+        await bookingService.cancelBooking(result.booking.id, { code: 'change_of_plans' }).catch(() => undefined);
+        res.json({ success: true });
+      });
+
+      expect(body.meta.tx_outcome).toBe('mixed');
+    });
+
+    test('should leave the body alone unless asked for', async () => {
+      const { body, headers } = await send(undefined, async res => { res.json({ success: true }); });
+
+      expect(body).toEqual({ success: true });
+      expect(headers['X-Request-Id']).toBeDefined();
+    });
+  });
+
+  describe('Stage Timing', () => {
+    test('should label timings by route pattern and pool requests no route matched', () => {
+      const send = (req: any) => {
+        const res: any = { setHeader() {}, json() { return this; } };
+        stageTiming({ method: 'GET', baseUrl: '/api', ...req }, res, () => res.json({}));
+      };
+
+      send({ path: '/bookings/7', route: { path: '/bookings/:id' } });
+      send({ path: '/wp-login.php' });
+      send({ path: '/.env' });
+
+      const stages = Object.keys(metrics.snapshot().timings).filter(name => name.startsWith('stage.response '));
+      expect(stages).toEqual(expect.arrayContaining(['stage.response GET /api/bookings/:id', 'stage.response unmatched']));
+      expect(stages.some(name => name.includes('wp-login') || name.includes('.env'))).toBe(false);
+    });
+  });
+
+  describe('Conflict Simulation', () => {
+    test('should book a sandbox room so the returned request conflicts', async () => {
+      const simulation = await new DemoService(bookingService).simulateConflict();
+
+      expect(simulation.room.room_number).toMatch(/^SBX-/);
+      expect(simulation.booking.room_id).toBe(simulation.room.id);
+      await expect(bookingService.createBooking(simulation.conflictingRequest.body))
+        .rejects.toBeInstanceOf(ConflictError);
+    });
+
+    test('should keep sandbox rooms out of assignment and retire them after their TTL', async () => {
+      const demoService = new DemoService(bookingService);
+      const simulation = await demoService.simulateConflict();
+      await bookingService.cancelBooking(simulation.booking.id, { code: 'guest_request' });
+      await pool.query('UPDATE rooms SET is_available = FALSE WHERE room_type = $1 AND NOT is_sandbox', ['Standard']);
+
+      await expect(bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomType: 'Standard',
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      })).rejects.toBeInstanceOf(ConflictError);
+
+      expect(await demoService.cleanupSandboxRooms(60)).toEqual([]);
+      const again = await demoService.simulateConflict();
+      await pool.query("UPDATE rooms SET created_at = CURRENT_TIMESTAMP - interval '2 hours' WHERE id = $1", [again.room.id]);
+      expect(await demoService.cleanupSandboxRooms(60)).toEqual([again.room.id]);
+
+      const booking = await pool.query('SELECT status FROM bookings WHERE id = $1', [again.booking.id]);
+      const room = await pool.query('SELECT retired_at FROM rooms WHERE id = $1', [again.room.id]);
+      expect(booking.rows[0].status).toBe('cancelled');
+      expect(room.rows[0].retired_at).not.toBeNull();
+    });
+  });
+
+  describe('Audit Trail', () => {
+    test('should record who changed which fields, oldest first', async () => {
+      const result = await runAsActor('front-desk', () => bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: addDays(today(), 30),
+        checkOutDate: addDays(today(), 32),
+        paymentMethod: 'credit_card'
+      }));
+      const bookingId = result.booking.id;
+      await bookingService.updateBooking(bookingId, { checkOutDate: addDays(today(), 33), guestName: 'John Smith' });
+      await bookingService.changeStatus(bookingId, 'confirmed');
+
+      const history = (await new AuditService().getBookingHistory(bookingId))!.entries;
+
+      expect(history.map(entry => entry.action)).toEqual(['created', 'updated', 'status_changed']);
+      expect(history[0].actor).toBe('front-desk');
+      expect(history[1]).toMatchObject({
+        actor: 'system',
+        changes: {
+          check_out_date: { old: addDays(today(), 32), new: addDays(today(), 33) },
+          guest_name: { old: 'John Doe', new: 'John Smith' }
+        }
+      });
+      expect(history[2].changes.status).toEqual({ old: 'pending', new: 'confirmed' });
+      await expect(pool.query('UPDATE booking_audit SET actor = $1 WHERE id = $2', ['someone', history[0].id]))
+        .rejects.toThrow('immutable');
+      await expect(pool.query('DELETE FROM booking_audit WHERE id = $1', [history[0].id])).rejects.toThrow('immutable');
+      await expect(pool.query('TRUNCATE booking_audit')).rejects.toThrow('immutable');
+    });
+  });
+
+  describe('Booking Notes', () => {
+    test('should keep every concurrent note and filter by visibility', async () => {
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+      const noteService = new BookingNoteService();
+
+      await Promise.all([
+        runAsActor('reception', () => noteService.addNote(result.booking.id, { body: 'Arriving after midnight' })),
+        runAsActor('kitchen', () => noteService.addNote(result.booking.id, { body: 'Nut allergy', visibility: 'internal' })),
+        noteService.addNote(result.booking.id, { body: 'Welcome back!', visibility: 'guest' })
+      ]);
+
+      expect(await noteService.getNotes(result.booking.id)).toHaveLength(3);
+      const guestNotes = await noteService.getNotes(result.booking.id, 'guest');
+      expect(guestNotes!.map(note => note.body)).toEqual(['Welcome back!']);
+      await expect(noteService.addNote(999999, { body: 'Lost' })).rejects.toBeInstanceOf(NotFoundError);
+    });
+  });
+
+  describe('Room Assignment', () => {
+    const bookType = (guestEmail: string) => bookingService.createBooking({
+      guestName: 'John Doe',
+      guestEmail,
+      guestPhone: '+1234567890',
+      roomType: 'Standard',
+      checkInDate: '2024-12-01',
+      checkOutDate: '2024-12-05',
+      paymentMethod: 'credit_card'
+    });
+
+    test('should give concurrent requests for a room type different rooms', async () => {
+      const [first, second] = await Promise.all([bookType('one@example.com'), bookType('two@example.com')]);
+
+      expect(first.booking.room_id).not.toBe(second.booking.room_id);
+      await expect(bookType('three@example.com')).rejects.toBeInstanceOf(ConflictError);
+    });
+
+    test('should reject unknown room types and mixing roomType with roomId', async () => {
+      await expect(bookingService.createBooking({
+        guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890',
+        roomType: 'Penthouse', checkInDate: '2024-12-01', checkOutDate: '2024-12-05', paymentMethod: 'credit_card'
+      })).rejects.toBeInstanceOf(ValidationError);
+      await expect(bookingService.createBooking({
+        guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890',
+        roomId: 1, roomType: 'Standard', checkInDate: '2024-12-01', checkOutDate: '2024-12-05', paymentMethod: 'credit_card'
+      })).rejects.toBeInstanceOf(ValidationError);
+    });
+
+    test('should only assign rooms with the requested attributes', async () => {
+      const roomService = new RoomService();
+      const room = await roomService.updateAttributes(2, { floor: 1, view: 'sea', accessible: true });
+      expect(room).toMatchObject({ floor: 1, view_type: 'sea', smoking_allowed: false, accessible: true });
+      await expect(roomService.updateAttributes(2, { view: 'ocean', balcony: true })).rejects.toThrow(ValidationError);
+      await expect(roomService.updateAttributes(999999, { smoking: true })).rejects.toThrow(NotFoundError);
+
+      const request = {
+        guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890', roomType: 'Standard',
+        roomPreferences: { accessible: true }, checkInDate: '2024-12-01', checkOutDate: '2024-12-05', paymentMethod: 'credit_card'
+      };
+      const quote = await bookingService.quoteStay({ ...request, roomPreferences: { view: 'sea' } });
+      expect(quote.roomId).toBe(2);
+
+      // Room 1 is free and has the lower number, but isn't accessible
+      const booked = await bookingService.createBooking(request);
+      expect(booked.booking.room_id).toBe(2);
+      await expect(bookingService.createBooking({ ...request, guestEmail: 'jane@example.com' })).rejects.toThrow(
+        'No room of this type with the requested attributes is available'
+      );
+
+      await expect(bookingService.quoteStay({ ...request, roomPreferences: { view: 'garden' } })).rejects.toThrow(ValidationError);
+      await expect(bookingService.createBooking({ ...request, roomType: undefined, roomId: 1 })).rejects.toThrow(ValidationError);
+    });
+  });
+
+  describe('Stay Finalization', () => {
+    test('should issue one final receipt and queue an underpaid stay', async () => {
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: addDays(today(), 30),
+        checkOutDate: addDays(today(), 32),
+        paymentMethod: 'credit_card'
+      });
+      const bookingId = result.booking.id;
+      await bookingService.changeStatus(bookingId, 'confirmed');
+      // One extra night that is never paid for
+      await bookingService.updateBooking(bookingId, { checkOutDate: addDays(today(), 33) });
+      await bookingService.changeStatus(bookingId, 'checked_in');
+      await bookingService.changeStatus(bookingId, 'checked_out');
+
+      const settlementService = new SettlementService();
+      const finalization = (await settlementService.finalizeStay(bookingId))!;
+      const again = (await settlementService.finalizeStay(bookingId))!;
+
+      expect(finalization.receipt).toMatchObject({ kind: 'final', payment_id: null });
+      expect(finalization.issue).toMatchObject({ kind: 'underpaid', folio_total: 300, paid_total: 200, difference: -100 });
+      expect(again.receipt.id).toBe(finalization.receipt.id);
+      expect((await settlementService.listIssues()).issues).toHaveLength(1);
+
+      await settlementService.resolveIssue(finalization.issue!.id, 'Charged card on file');
+      expect((await settlementService.listIssues()).issues).toHaveLength(0);
+    });
+
+    test('should not count refunded money as paid', async () => {
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: addDays(today(), 30),
+        checkOutDate: addDays(today(), 32),
+        paymentMethod: 'credit_card'
+      });
+      const bookingId = result.booking.id;
+      await new RefundService().requestRefund(bookingId, { receiptId: result.receipt.id, amount: 50 });
+      await bookingService.changeStatus(bookingId, 'confirmed');
+      await bookingService.changeStatus(bookingId, 'checked_in');
+      await bookingService.changeStatus(bookingId, 'checked_out');
+
+      const finalization = (await new SettlementService().finalizeStay(bookingId))!;
+
+      expect(finalization.issue).toMatchObject({ kind: 'underpaid', folio_total: 200, paid_total: 150, difference: -50 });
+    });
+  });
+
+  describe('Quotes', () => {
+    test('should price a stay and show cancellation terms without reserving the room', async () => {
+      const quote = await bookingService.quoteStay({ roomId: 1, checkInDate: '2024-12-01', checkOutDate: '2024-12-05' });
+
+      expect(quote).toMatchObject({ roomId: 1, available: true, total: 400 });
+      expect(quote.cancellation).toMatchObject({ policyCode: 'flexible', freeUntil: '2024-11-30', lateFeeAmount: 200 });
+
+      const booking = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+      expect(Number(booking.booking.total_amount)).toBe(quote.total);
+    });
+
+    test('should suggest pricier room types when the requested type is sold out', async () => {
+      const stay = { checkInDate: addDays(today(), 30), checkOutDate: addDays(today(), 32) };
+      const guest = { guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890', paymentMethod: 'credit_card' };
+      expect((await bookingService.quoteStay({ ...stay, roomType: 'Standard', includeUpgrades: true })).upgrades).toBeUndefined();
+
+      const rooms = await pool.query("SELECT id, room_type FROM rooms WHERE room_type IN ('Standard', 'Suite') AND retired_at IS NULL");
+      for (const room of rooms.rows) {
+        if (room.room_type === 'Standard') {
+          await bookingService.createBooking({ ...guest, ...stay, roomId: room.id });
+        } else {
+          await new MaintenanceService().createBlock(room.id, { startDate: stay.checkInDate, endDate: stay.checkOutDate, reason: 'Repainting' });
+        }
+      }
+
+      const quote = await bookingService.quoteStay({ ...stay, roomType: 'Standard', includeUpgrades: true });
+      expect(quote).toMatchObject({ available: false, total: 200 });
+      // The suites are in maintenance, so only a Deluxe room is offered
+      expect(quote.upgrades).toEqual([
+        { roomId: expect.any(Number), roomNumber: expect.any(String), roomType: 'Deluxe', pricePerNight: 150, total: 300, priceDifference: 100 }
+      ]);
+    });
+  });
+
+  describe('Payment Webhooks', () => {
+    test('should apply each event once and skip events older than the last applied', async () => {
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+      const webhooks = new PaymentWebhookService();
+      const event = (id: string, type: string, created: number) => ({
+        id, type, created, data: { transactionId: result.payment.transaction_id }
+      });
+
+      const refund = await webhooks.handleEvent(event('evt_2', 'payment.refunded', 2000));
+      const retried = await webhooks.handleEvent(event('evt_2', 'payment.refunded', 2000));
+      const late = await webhooks.handleEvent(event('evt_1', 'payment.succeeded', 1000));
+
+      expect(refund).toMatchObject({ outcome: 'applied', payment: { status: 'refunded' } });
+      expect(retried.outcome).toBe('duplicate');
+      expect(late.outcome).toBe('stale');
+    });
+
+    test('should not record an event for an unknown transaction, so its retry is applied', async () => {
+      const webhooks = new PaymentWebhookService();
+      const event = { id: 'evt_early', type: 'payment.succeeded', created: 1000, data: { transactionId: 'TXN_LATER' } };
+
+      expect((await webhooks.handleEvent(event)).outcome).toBe('unmatched');
+      const recorded = await pool.query('SELECT 1 FROM payment_webhook_events WHERE event_id = $1', [event.id]);
+      expect(recorded.rows).toHaveLength(0);
+
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+      await pool.query(
+        "UPDATE payments SET status = 'pending', transaction_id = $2 WHERE id = $1", [result.payment.id, 'TXN_LATER']
+      );
+      expect(await webhooks.handleEvent(event)).toMatchObject({ outcome: 'applied', payment: { status: 'completed' } });
+    });
+
+    test('should only accept fresh signatures made with the secret', () => {
+      const body = JSON.stringify({ id: 'evt_1' });
+      const header = signPayload('secret', 1000, body);
+
+      expect(verifySignature(header, body, 'secret', 300, 1100)).toBe(true);
+      expect(verifySignature(header, body, 'other', 300, 1100)).toBe(false);
+      expect(verifySignature(header, body + ' ', 'secret', 300, 1100)).toBe(false);
+      expect(verifySignature(header, body, 'secret', 300, 2000)).toBe(false);
+    });
+  });
+
+  describe('Integrity Checks', () => {
+    test('should checkpoint finished days and report later drift', async () => {
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+      await pool.query('UPDATE receipts SET generated_at = CURRENT_DATE - 1 WHERE id = $1', [result.receipt.id]);
+      const adminService = new AdminService();
+
+      const first = await adminService.checkIntegrity(2);
+      expect(first.checkpointsRecorded).toBe(6);
+      expect(first.drifts).toEqual([]);
+
+      await pool.query('UPDATE receipts SET total_amount = total_amount + 1 WHERE id = $1', [result.receipt.id]);
+      const second = await adminService.checkIntegrity(2);
+
+      expect(second.drifts).toEqual([expect.objectContaining({
+        day: addDays(today(), -1),
+        metric: 'receipts',
+        recorded: expect.objectContaining({ total: 400 }),
+        current: expect.objectContaining({ total: 401 })
+      })]);
+    });
+  });
+
+  describe('Guest Name Rules', () => {
+    test('should normalize whitespace and reject control characters and overlong names', async () => {
+      expect(normalizeName('  Zoë \t  Ångström\n')).toBe('Zoë Ångström');
+      expect(nameError('José María Núñez')).toBeNull();
+      expect(nameError('Bell\u0007')).toMatch(/control/);
+      expect(nameError('x'.repeat(101))).toMatch(/at most 100/);
+
+      const result = await bookingService.createBooking({
+        guestName: '  Mary   Ann  ',
+        guestEmail: 'mary@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+      const details = await bookingService.getBookingDetails(result.booking.id);
+      expect(details.guest_name).toBe('Mary Ann');
+    });
+  });
+
+  describe('Promo Codes', () => {
+    const promoCodeService = new PromoCodeService();
+    const bookWithCode = (roomId: number, promoCode: string) => bookingService.createBooking({
+      guestName: 'John Doe',
+      guestEmail: `room${roomId}@example.com`,
+      guestPhone: '+1234567890',
+      roomId,
+      checkInDate: '2024-12-01',
+      checkOutDate: '2024-12-05',
+      paymentMethod: 'credit_card',
+      promoCode
+    });
+
+    test('should never redeem a code more often than its usage limit', async () => {
+      await promoCodeService.createPromoCode({
+        code: 'TWICE', discountType: 'percentage', discountValue: 10,
+        validFrom: addDays(today(), -1), validUntil: addDays(today(), 1), usageLimit: 2
+      });
+
+      const results = await Promise.allSettled([1, 2, 3, 4].map(roomId => bookWithCode(roomId, 'twice')));
+      const booked = results.filter(result => result.status === 'fulfilled');
+      const rejected = results.filter(result => result.status === 'rejected') as PromiseRejectedResult[];
+
+      expect(booked).toHaveLength(2);
+      expect(rejected.map(result => result.reason)).toEqual([expect.any(ValidationError), expect.any(ValidationError)]);
+      expect(rejected[0].reason.fields.promoCode).toBe('has been fully redeemed');
+      expect((await promoCodeService.listPromoCodes())[0].times_used).toBe(2);
+    });
+
+    test('should discount the stay and respect room type restrictions', async () => {
+      await promoCodeService.createPromoCode({
+        code: 'SUITE50', discountType: 'fixed', discountValue: 50,
+        validFrom: addDays(today(), -1), validUntil: addDays(today(), 1), roomTypes: ['Suite']
+      });
+
+      await expect(bookWithCode(1, 'SUITE50')).rejects.toBeInstanceOf(ValidationError);
+
+      const result = await bookWithCode(5, 'SUITE50');
+      expect(Number(result.booking.total_amount)).toBe(950);
+      expect(Number(result.booking.discount_amount)).toBe(50);
+    });
+  });
+
+  describe('Upgrade Bids', () => {
+    const upgradeBidService = new UpgradeBidService();
+    const book = (roomId: number, guestEmail: string) => bookingService.createBooking({
+      guestName: 'John Doe',
+      guestEmail,
+      guestPhone: '+1234567890',
+      roomId,
+      checkInDate: '2024-12-01',
+      checkOutDate: '2024-12-03',
+      paymentMethod: 'credit_card'
+    });
+
+    test('should award a freed room to the best bid that covers the price difference', async () => {
+      const suite = await book(5, 'suite@example.com');
+      const standard = await book(1, 'standard@example.com');
+      const deluxe = await book(3, 'deluxe@example.com');
+
+      // The highest bid, but a suite costs 300 more than a Standard room for the two nights
+      await upgradeBidService.placeBid(standard.booking.id, { roomType: 'Suite', maxAmount: 280 });
+      await upgradeBidService.placeBid(deluxe.booking.id, { roomType: 'Suite', maxAmount: 250 });
+      await expect(upgradeBidService.placeBid(suite.booking.id, { roomType: 'Deluxe', maxAmount: 100 }))
+        .rejects.toBeInstanceOf(ValidationError);
+
+      await bookingService.cancelBooking(suite.booking.id, { code: 'guest_request' });
+      const awarded = await upgradeBidService.processRoom(5);
+
+      expect(awarded).toMatchObject({ booking_id: deluxe.booking.id, status: 'awarded', charged_amount: 200 });
+      expect(await upgradeBidService.getBids(standard.booking.id)).toEqual([expect.objectContaining({ status: 'declined' })]);
+
+      const moved = await bookingService.getBookingDetails(deluxe.booking.id);
+      expect(moved).toMatchObject({ room_id: 5 });
+      expect(Number(moved.total_amount)).toBe(500);
+
+      // The Deluxe room given up is free again, and nobody bid for one
+      expect(await upgradeBidService.processRoom(3)).toBeNull();
+    });
+
+    test('should refuse bids from a disputed booking and decline them at award time', async () => {
+      const suite = await book(5, 'suite@example.com');
+      const standard = await book(1, 'standard@example.com');
+      const deluxe = await book(3, 'deluxe@example.com');
+      await upgradeBidService.placeBid(standard.booking.id, { roomType: 'Suite', maxAmount: 400 });
+      const disputeService = new DisputeService();
+      await disputeService.openDispute(standard.receipt.id, { reason: 'Chargeback' });
+      await disputeService.openDispute(deluxe.receipt.id, { reason: 'Chargeback' });
+
+      await expect(upgradeBidService.placeBid(deluxe.booking.id, { roomType: 'Suite', maxAmount: 400 }))
+        .rejects.toMatchObject({ code: 'BOOKING_DISPUTED' });
+      await bookingService.cancelBooking(suite.booking.id, { code: 'guest_request' });
+
+      expect(await upgradeBidService.processRoom(5)).toBeNull();
+      expect(await upgradeBidService.getBids(standard.booking.id)).toEqual([expect.objectContaining({
+        status: 'declined', decline_reason: 'Booking has an open payment dispute'
+      })]);
+      expect(await bookingService.getBookingDetails(standard.booking.id)).toMatchObject({ room_id: 1 });
+    });
+
+    test('should leave the bids open when the freed room is in maintenance during the stay', async () => {
+      const suite = await book(5, 'suite@example.com');
+      const standard = await book(1, 'standard@example.com');
+      await upgradeBidService.placeBid(standard.booking.id, { roomType: 'Suite', maxAmount: 400 });
+      await bookingService.cancelBooking(suite.booking.id, { code: 'guest_request' });
+      await new MaintenanceService().createBlock(5, { startDate: '2024-12-02', endDate: '2024-12-04', reason: 'Leak' });
+
+      expect(await upgradeBidService.processRoom(5)).toBeNull();
+
+      expect(await upgradeBidService.getBids(standard.booking.id)).toEqual([expect.objectContaining({ status: 'open' })]);
+      expect(await bookingService.getBookingDetails(standard.booking.id)).toMatchObject({ room_id: 1 });
+      expect((await pool.query('SELECT is_available FROM rooms WHERE id = 5')).rows[0].is_available).toBe(true);
+    });
+
+    test('should leave the bids open while a booking under the advisory strategy holds the freed room', async () => {
+      const suite = await book(5, 'suite@example.com');
+      const standard = await book(1, 'standard@example.com');
+      await upgradeBidService.placeBid(standard.booking.id, { roomType: 'Suite', maxAmount: 400 });
+      await bookingService.cancelBooking(suite.booking.id, { code: 'guest_request' });
+
+      bookingService.setLockStrategy('advisory');
+      const [first, last] = stayBuckets('2024-12-01', '2024-12-03');
+      const blocker = await pool.connect();
+      try {
+        await blocker.query('BEGIN');
+        await blocker.query('SELECT pg_advisory_xact_lock(5, bucket) FROM generate_series($1::int, $2::int) AS bucket', [first, last]);
+        expect(await upgradeBidService.processRoom(5)).toBeNull();
+      } finally {
+        await blocker.query('ROLLBACK');
+        blocker.release();
+        bookingService.setLockStrategy(lockingConfig.strategy);
+      }
+
+      expect(await upgradeBidService.getBids(standard.booking.id)).toEqual([expect.objectContaining({ status: 'open' })]);
+      expect(await bookingService.getBookingDetails(standard.booking.id)).toMatchObject({ room_id: 1 });
+    });
+  });
+
+  describe('Degradation Signals', () => {
+    const send = () => {
+      const headers: Record<string, string> = {};
+      const res: any = {
+        setHeader(name: string, value: string) { headers[name] = value; },
+        json() { return this; }
+      };
+      degradedComponents({} as any, res, () => res.json({ success: true }));
+      return headers;
+    };
+
+    test('should name reported components until the report expires', async () => {
+      expect(send()['X-Degraded-Components']).toBeUndefined();
+
+      degradation.report('payment_gateway', 'last payment took 2500ms', 50);
+      expect(send()['X-Degraded-Components']).toBe('payment_gateway');
+      expect(degradation.degradedComponents()).toEqual([
+        expect.objectContaining({ component: 'payment_gateway', reason: 'last payment took 2500ms' })
+      ]);
+
+      await new Promise(resolve => setTimeout(resolve, 60));
+      expect(send()['X-Degraded-Components']).toBeUndefined();
+    });
+  });
+
+  describe('Schema Docs', () => {
+    test('should describe tables with keys and render an ER diagram', async () => {
+      const schemaService = new SchemaService();
+      const tables = await schemaService.describe();
+      const bookings = tables.find(table => table.name === 'bookings')!;
+
+      expect(bookings.columns.find(column => column.name === 'id')).toMatchObject({ primaryKey: true, nullable: false });
+      expect(bookings.columns.find(column => column.name === 'guest_id')!.references).toEqual({ table: 'guests', column: 'id' });
+      expect(schemaService.render(tables, 'mermaid')).toContain('guests ||--o{ bookings : guest_id');
+      expect(() => schemaService.parseFormat('pdf')).toThrow(ValidationError);
+    });
+  });
+
+  describe('Loyalty Points', () => {
+    const book = (roomId: number, redeemPoints?: number) => bookingService.createBooking({
+      guestName: 'John Doe',
+      guestEmail: 'john@example.com',
+      guestPhone: '+1234567890',
+      roomId,
+      checkInDate: addDays(today(), 30),
+      checkOutDate: addDays(today(), 32),
+      paymentMethod: 'credit_card',
+      redeemPoints
+    });
+
+    test('should earn points at check-out and spend them only once under concurrency', async () => {
+      const first = await book(1);
+      await bookingService.changeStatus(first.booking.id, 'confirmed');
+      await bookingService.changeStatus(first.booking.id, 'checked_in');
+      await bookingService.changeStatus(first.booking.id, 'checked_out');
+      await new SettlementService().finalizeStay(first.booking.id);
+      await new SettlementService().finalizeStay(first.booking.id);
+
+      const loyaltyService = new LoyaltyService();
+      expect((await loyaltyService.getAccount(first.booking.guest_id))!.balance).toBe(20);
+
+      // Both bookings want all 20 points; only one may have them
+      const results = await Promise.allSettled([book(2, 20), book(3, 20)]);
+      const booked = results.filter(result => result.status === 'fulfilled') as PromiseFulfilledResult<any>[];
+      expect(booked).toHaveLength(1);
+      expect(results.find(result => result.status === 'rejected')).toMatchObject({ reason: expect.any(ValidationError) });
+      expect(Number(booked[0].value.payment.amount)).toBe(190);
+      expect((await loyaltyService.getAccount(first.booking.guest_id))!.balance).toBe(0);
+
+      // Cancelling gives the points back
+      await bookingService.cancelBooking(booked[0].value.booking.id, { code: 'guest_request' });
+      expect((await loyaltyService.getAccount(first.booking.guest_id))!.balance).toBe(20);
+    });
+  });
+
+  describe('Reconciliation', () => {
+    test('should list the day and flag a paid booking that lost its receipt', async () => {
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      });
+      const reconciliationService = new ReconciliationService();
+
+      const clean = await reconciliationService.reconcileDay(today());
+      expect(clean.payments.map(payment => payment.booking_id)).toEqual([result.booking.id]);
+      expect(clean.totals).toMatchObject({ receipts: 400, payments: 400 });
+      expect(clean.mismatches).toEqual([]);
+
+      await pool.query('DELETE FROM receipts WHERE booking_id = $1', [result.booking.id]);
+      const days = [];
+      for await (const day of reconciliationService.reconcileRange(addDays(today(), -1), today())) {
+        days.push(day);
+      }
+
+      expect(days.map(day => day.date)).toEqual([addDays(today(), -1), today()]);
+      expect(days[1].mismatches).toEqual([expect.objectContaining({ kind: 'paid_without_receipt', bookingId: result.booking.id })]);
+    });
+  });
+
+  describe('Payment Plans', () => {
+    const book = (checkInDate: string, installments: number) => bookingService.createBooking({
+      guestName: 'John Doe',
+      guestEmail: 'john@example.com',
+      guestPhone: '+1234567890',
+      roomId: 1,
+      checkInDate,
+      checkOutDate: addDays(checkInDate, 2),
+      paymentMethod: 'credit_card',
+      installments
+    });
+
+    test('should charge the first installment, take the rest when due and cancel once one is overdue', async () => {
+      const result = await book(addDays(today(), 90), 3);
+      const paymentPlanService = new PaymentPlanService();
+      expect(Number(result.payment.amount)).toBe(66.66);
+      expect(Number(result.receipt.total_amount)).toBe(66.66);
+
+      const paid = await paymentPlanService.payNextInstallment(result.booking.id, 'credit_card');
+      expect(paid.installment).toMatchObject({ sequence: 2, status: 'paid', amount: 66.66 });
+      const plan = (await paymentPlanService.getPlan(result.booking.id))!;
+      expect(plan).toMatchObject({ status: 'active', total: 200, paid: 133.32, outstanding: 66.68 });
+      expect(plan.nextDue).toEqual({ sequence: 3, amount: 66.68, dueDate: addDays(today(), 60) });
+      expect((await new ReconciliationService().reconcileDay(today())).mismatches).toEqual([]);
+
+      await pool.query(
+        `UPDATE installments SET due_date = CURRENT_DATE - 10 WHERE booking_id = $1 AND sequence = 3`,
+        [result.booking.id]
+      );
+      expect(await runInstallmentMonitor()).toEqual({ overdue: 1, cancelled: [result.booking.id] });
+
+      const cancelled = (await paymentPlanService.getPlan(result.booking.id))!;
+      expect(cancelled.status).toBe('cancelled');
+      expect(cancelled.installments.map(installment => installment.status)).toEqual(['paid', 'paid', 'cancelled']);
+      await expect(paymentPlanService.payNextInstallment(result.booking.id, 'credit_card')).rejects.toThrow(BookingStateError);
+    });
+
+    test('should reject a plan whose last installment falls after check-in', async () => {
+      await expect(book(addDays(today(), 20), 2)).rejects.toMatchObject({
+        fields: { installments: expect.stringContaining('after check-in') }
+      });
+    });
+  });
+
+  describe('Room Inventory Reconciliation', () => {
+    test('should plan against a PMS export and apply it, keeping rooms with future bookings', async () => {
+      const local = await pool.query('SELECT id, room_number, room_type FROM rooms WHERE NOT is_sandbox ORDER BY room_number');
+      const roomId = (roomNumber: string) => local.rows.find(row => row.room_number === roomNumber).id;
+      const booked = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: roomId('302'),
+        checkInDate: addDays(today(), 30),
+        checkOutDate: addDays(today(), 32),
+        paymentMethod: 'credit_card'
+      });
+      const roomInventoryService = new RoomInventoryService();
+      const pmsRooms = roomInventoryService.parseExport({
+        rooms: [
+          ...local.rows
+            .filter(row => row.room_number !== '302' && row.room_number !== '303')
+            .map(row => ({ roomNumber: row.room_number, roomType: row.room_number === '104' ? 'Deluxe' : row.room_type })),
+          { roomNumber: '999', roomType: 'Standard' }
+        ]
+      });
+
+      try {
+        const plan = await roomInventoryService.reconcile(pmsRooms, { apply: false });
+        expect(plan.applied).toBe(false);
+        expect(plan.actions).toEqual([
+          { action: 'change_type', roomNumber: '104', fromType: 'Standard', roomType: 'Deluxe' },
+          { action: 'create', roomNumber: '999', roomType: 'Standard', pricePerNight: 100 },
+          { action: 'retire', roomNumber: '303' }
+        ]);
+        expect(plan.blockers).toEqual([
+          { kind: 'retired_with_future_bookings', roomNumber: '302', bookingIds: [booked.booking.id] }
+        ]);
+
+        await expect(roomInventoryService.reconcile(pmsRooms, { apply: true, planHash: 'stale' }))
+          .rejects.toThrow(PreconditionFailedError);
+        const applied = await roomInventoryService.reconcile(pmsRooms, { apply: true, planHash: plan.planHash });
+        expect(applied.applied).toBe(true);
+
+        const rooms = await pool.query(
+          "SELECT room_number, room_type, retired_at IS NOT NULL AS retired FROM rooms WHERE room_number IN ('104', '302', '303', '999') ORDER BY room_number"
+        );
+        expect(rooms.rows).toEqual([
+          { room_number: '104', room_type: 'Deluxe', retired: false },
+          { room_number: '302', room_type: 'Suite', retired: false },
+          { room_number: '303', room_type: 'Suite', retired: true },
+          { room_number: '999', room_type: 'Standard', retired: false }
+        ]);
+        await expect(bookingService.createBooking({
+          guestName: 'Jane Doe',
+          guestEmail: 'jane@example.com',
+          guestPhone: '+1234567891',
+          roomId: roomId('303'),
+          checkInDate: addDays(today(), 30),
+          checkOutDate: addDays(today(), 32),
+          paymentMethod: 'credit_card'
+        })).rejects.toThrow('Room has been retired');
+      } finally {
+        await pool.query("UPDATE rooms SET room_type = 'Standard' WHERE room_number = '104'");
+        await pool.query("UPDATE rooms SET retired_at = NULL WHERE room_number = '303'");
+        await pool.query("DELETE FROM rooms WHERE room_number = '999'");
+      }
+    });
+  });
+
+  describe('Payment Disputes', () => {
+    test('should freeze the booking while open and charge back a lost dispute', async () => {
+      const result = await bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: addDays(today(), 30),
+        checkOutDate: addDays(today(), 32),
+        paymentMethod: 'credit_card'
+      });
+      const disputeService = new DisputeService();
+
+      const dispute = await disputeService.openDispute(result.receipt.id, { reason: 'Guest does not recognize the charge', amount: 150 });
+      expect(dispute).toMatchObject({ status: 'open', amount: 150, booking_id: result.booking.id });
+      await expect(disputeService.openDispute(result.receipt.id, { reason: 'Again' })).rejects.toThrow(ConflictError);
+      await expect(bookingService.updateBooking(result.booking.id, { checkOutDate: addDays(today(), 33) }))
+        .rejects.toMatchObject({ code: 'BOOKING_DISPUTED' });
+      await expect(bookingService.cancelBooking(result.booking.id, { code: 'guest_request' }))
+        .rejects.toMatchObject({ code: 'BOOKING_DISPUTED' });
+      await expect(new PaymentPlanService().payNextInstallment(result.booking.id, 'credit_card'))
+        .rejects.toMatchObject({ code: 'BOOKING_DISPUTED' });
+
+      const lost = await disputeService.resolveDispute(dispute.id, { outcome: 'lost', note: 'Issuer sided with the cardholder' });
+      expect(lost.status).toBe('lost');
+      const paid = await pool.query(
+        `SELECT SUM(amount) AS total FROM payments WHERE booking_id = $1 AND status = 'completed'`,
+        [result.booking.id]
+      );
+      expect(Number(paid.rows[0].total)).toBe(50);
+      expect((await new ReconciliationService().reconcileDay(today())).mismatches).toEqual([]);
+      await expect(disputeService.resolveDispute(dispute.id, { outcome: 'won' })).rejects.toThrow(NotFoundError);
+      await expect(disputeService.openDispute(result.receipt.id, { reason: 'Again' })).rejects.toThrow(ConflictError);
+
+      const record = await bookingService.cancelBooking(result.booking.id, { code: 'guest_request' });
+      expect(record.booking_id).toBe(result.booking.id);
+    });
+  });
+
+  describe('Payment Method Surcharges', () => {
+    test('should quote, charge and receipt the surcharge without counting it towards the stay', async () => {
+      const paymentMethodService = new PaymentMethodService();
+      await expect(paymentMethodService.saveMethod('credit_card', { surchargePercent: 150 })).rejects.toThrow(ValidationError);
+      await paymentMethodService.saveMethod('credit_card', { surchargePercent: 2.5 });
+
+      try {
+        const checkInDate = addDays(today(), 30);
+        const quote = await bookingService.quoteStay({
+          roomId: 1, checkInDate, checkOutDate: addDays(checkInDate, 2), paymentMethod: 'credit_card'
+        });
+        expect(quote).toMatchObject({ total: 200, surcharge: 5, amountDue: 205 });
+
+        const result = await bookingService.createBooking({
+          guestName: 'John Doe',
+          guestEmail: 'john@example.com',
+          guestPhone: '+1234567890',
+          roomId: 1,
+          checkInDate,
+          checkOutDate: addDays(checkInDate, 2),
+          paymentMethod: 'credit_card'
+        });
+        expect(Number(result.payment.amount)).toBe(205);
+        expect(Number(result.receipt.total_amount)).toBe(205);
+        expect(Number(result.receipt.surcharge_amount)).toBe(5);
+        expect(Number(result.booking.total_amount)).toBe(200);
+        expect((await new ReconciliationService().reconcileDay(today())).mismatches).toEqual([]);
+        expect(await new AdminService().getConsistencySnapshot())
+          .toMatchObject({ bookingsTotal: 200, paymentsTotal: 200, receiptsTotal: 200 });
+
+        const record = await bookingService.cancelBooking(result.booking.id, { code: 'guest_request' });
+        expect(Number(record.paid_amount)).toBe(200);
+      } finally {
+        await paymentMethodService.saveMethod('credit_card', { surchargePercent: 0 });
+      }
+    });
+  });
+
+  describe('Payment Method Limits', () => {
+    test('should apply no amount limits until one is configured', async () => {
+      expect(paymentMethods.validate('bank_transfer', 50)).toBeNull();
+      expect(paymentMethods.validate('cash', 10000)).toBeNull();
+
+      const paymentMethodService = new PaymentMethodService();
+      await paymentMethodService.saveMethod('bank_transfer', { minAmount: 100 });
+      try {
+        expect(paymentMethods.validate('bank_transfer', 50)).toMatch(/at least 100/);
+      } finally {
+        await paymentMethodService.saveMethod('bank_transfer', { minAmount: null });
+      }
+      expect(paymentMethods.validate('bank_transfer', 50)).toBeNull();
+    });
+  });
+
+  describe('Receipt Emails', () => {
+    const createPaidBooking = () => {
+      const checkInDate = addDays(today(), 30);
+      return bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate,
+        checkOutDate: addDays(checkInDate, 2),
+        paymentMethod: 'credit_card'
+      });
+    };
+
+    test('should email the receipt with a booking summary once', async () => {
+      const result = await createPaidBooking();
+      expect(result.receipt.email_status).toBe('pending');
+
+      const mailer = new NoopMailer();
+      const receiptEmailService = new ReceiptEmailService(mailer);
+      expect(await receiptEmailService.deliver(result.receipt.id)).toBe('sent');
+      expect(await receiptEmailService.deliver(result.receipt.id)).toBe('skipped');
+
+      expect(mailer.sent).toHaveLength(1);
+      expect(mailer.sent[0].to).toBe('john@example.com');
+      expect(mailer.sent[0].text).toContain(result.receipt.receipt_number);
+      expect(mailer.sent[0].text).toContain(`booking #${result.booking.id}`);
+
+      const receipt = await pool.query('SELECT email_status, email_attempts, email_sent_at FROM receipts WHERE id = $1', [result.receipt.id]);
+      expect(receipt.rows[0]).toMatchObject({ email_status: 'sent', email_attempts: 1 });
+      expect(receipt.rows[0].email_sent_at).not.toBeNull();
+    });
+
+    test('should retry a failed email and give up after the last attempt', async () => {
+      const result = await createPaidBooking();
+      const receiptEmailService = new ReceiptEmailService({
+        send: async () => { throw new Error('SMTP connection refused'); }
+      });
+
+      expect(await receiptEmailService.deliver(result.receipt.id)).toBe('retrying');
+      // Not due again until the retry delay has passed
+      expect(await receiptEmailService.deliver(result.receipt.id)).toBe('skipped');
+
+      await pool.query(
+        'UPDATE receipts SET email_attempts = $2, email_next_attempt_at = CURRENT_TIMESTAMP WHERE id = $1',
+        [result.receipt.id, mailConfig.maxAttempts - 1]
+      );
+      expect(await receiptEmailService.deliverDue()).toMatchObject({ failed: 1, sent: 0 });
+
+      const receipt = await pool.query('SELECT email_status, email_last_error FROM receipts WHERE id = $1', [result.receipt.id]);
+      expect(receipt.rows[0]).toEqual({ email_status: 'failed', email_last_error: 'SMTP connection refused' });
+    });
+  });
+
+  describe('Refunds', () => {
+    const book = (paymentMethod: string) => {
+      const checkInDate = addDays(today(), 30);
+      return bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate,
+        checkOutDate: addDays(checkInDate, 4),
+        paymentMethod
+      });
+    };
+
+    test('should refund a cancellation to the original payment and settle it from the gateway', async () => {
+      const result = await book('credit_card');
+      expect(result.receipt).toMatchObject({
+        payment_method: 'credit_card', gateway_reference: result.payment.transaction_id
+      });
+
+      const record = await bookingService.cancelBooking(result.booking.id, { code: 'guest_request' });
+      expect(record.refunds).toHaveLength(1);
+      expect(record.refunds[0]).toMatchObject({
+        payment_id: result.payment.id, receipt_id: result.receipt.id, amount: 400, payment_method: 'credit_card', status: 'pending'
+      });
+
+      const webhooks = new PaymentWebhookService();
+      const event = (id: string, type: string, created: number) => ({
+        id, type, created, data: { transactionId: record.refunds[0].refund_reference }
+      });
+      const settled = await webhooks.handleEvent(event('evt_rf_2', 'refund.settled', 2000));
+      expect(settled).toMatchObject({ outcome: 'applied', payment: null, refund: { status: 'settled' } });
+      expect((await webhooks.handleEvent(event('evt_rf_2', 'refund.settled', 2000))).outcome).toBe('duplicate');
+      expect((await webhooks.handleEvent(event('evt_rf_1', 'refund.failed', 1000))).outcome).toBe('stale');
+
+      const refunds = await new RefundService().getRefunds(result.booking.id);
+      expect(refunds).toHaveLength(1);
+      expect(refunds![0].status).toBe('settled');
+      expect(refunds![0].settled_at).not.toBeNull();
+    });
+
+    test('should only refund a payment to its own method and never beyond what is left', async () => {
+      const result = await book('credit_card');
+      const refundService = new RefundService();
+
+      await expect(refundService.requestRefund(result.booking.id, { receiptId: result.receipt.id, paymentMethod: 'bank_transfer' }))
+        .rejects.toThrow(ValidationError);
+      await expect(refundService.requestRefund(result.booking.id, { receiptId: result.receipt.id, amount: 500 }))
+        .rejects.toThrow(ValidationError);
+
+      const partial = await refundService.requestRefund(result.booking.id, { receiptId: result.receipt.id, amount: 100 });
+      expect(partial).toMatchObject({ amount: 100, payment_method: 'credit_card', status: 'pending' });
+      const rest = await refundService.requestRefund(result.booking.id, { receiptId: result.receipt.id, paymentMethod: 'credit_card' });
+      expect(rest.amount).toBe(300);
+      await expect(refundService.requestRefund(result.booking.id, { receiptId: result.receipt.id }))
+        .rejects.toThrow(ConflictError);
+    });
+
+    test('should fail at once a refund the payment method cannot take', async () => {
+      const result = await book('cash');
+      const record = await bookingService.cancelBooking(result.booking.id, { code: 'guest_request' });
+
+      expect(record.refunds).toHaveLength(1);
+      expect(record.refunds[0]).toMatchObject({ amount: 400, payment_method: 'cash', status: 'failed' });
+      expect(record.refunds[0].failure_reason).toContain('refund the guest directly');
+    });
+  });
+
+  describe('Rate Plans', () => {
+    // A Wednesday at least 30 days out, so a three-night stay covers Wednesday, Thursday and Friday nights
+    const nextWednesday = () => {
+      let date = addDays(today(), 30);
+      while (new Date(`${date}T00:00:00Z`).getUTCDay() !== 3) {
+        date = addDays(date, 1);
+      }
+      return date;
+    };
+
+    test('should price seasons and weekend nights in the quote and the booking', async () => {
+      const ratePlanService = new RatePlanService();
+      const wednesday = nextWednesday();
+      await ratePlanService.savePlan('Standard', { weekendMultiplier: 1.5 });
+      await ratePlanService.addSeason('Standard', {
+        name: 'Festival', startDate: addDays(wednesday, 1), endDate: addDays(wednesday, 1), pricePerNight: 120
+      });
+      await expect(ratePlanService.addSeason('Standard', { name: 'Neither', startDate: wednesday, endDate: wednesday }))
+        .rejects.toThrow(ValidationError);
+
+      const stay = { roomId: 1, checkInDate: wednesday, checkOutDate: addDays(wednesday, 3) };
+      const quote = await bookingService.quoteStay(stay);
+      expect(quote.priceBreakdown.nights.map(night => night.total)).toEqual([100, 120, 150]);
+      expect(quote.priceBreakdown.nights[1].adjustments).toEqual([{ reason: 'season:Festival', amount: 20 }]);
+      expect(quote.priceBreakdown.nights[2].adjustments).toEqual([{ reason: 'weekend', amount: 50 }]);
+
+      const result = await bookingService.createBooking({
+        ...stay, guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890', paymentMethod: 'credit_card'
+      });
+      expect(Number(result.booking.total_amount)).toBe(370);
+    });
+
+    test('should raise the rate once the room type is booked past an occupancy tier', async () => {
+      const suites = await pool.query(
+        "SELECT id, price_per_night FROM rooms WHERE room_type = 'Suite' AND retired_at IS NULL ORDER BY id LIMIT 2"
+      );
+      const [first, second] = suites.rows;
+      await new RatePlanService().savePlan('Suite', { occupancyTiers: [{ minOccupancyPercent: 1, multiplier: 2 }] });
+      const checkInDate = addDays(today(), 40);
+      const checkOutDate = addDays(checkInDate, 1);
+
+      const before = await bookingService.quoteStay({ roomId: second.id, checkInDate, checkOutDate });
+      expect(before.total).toBe(Number(second.price_per_night));
+
+      await bookingService.createBooking({
+        guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890',
+        roomId: first.id, checkInDate, checkOutDate, paymentMethod: 'credit_card'
+      });
+      const after = await bookingService.quoteStay({ roomId: second.id, checkInDate, checkOutDate });
+      expect(after.total).toBe(Number(second.price_per_night) * 2);
+      expect(after.priceBreakdown.nights[0].adjustments[0].reason).toBe('occupancy:1%');
+    });
+  });
+
+  describe('Room Maintenance', () => {
+    const guest = { guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890', paymentMethod: 'credit_card' };
+
+    test('should keep bookings out of a room while it is blocked for maintenance', async () => {
+      const maintenanceService = new MaintenanceService();
+      const startDate = addDays(today(), 30);
+      const block = await maintenanceService.createBlock(1, { startDate, endDate: addDays(startDate, 3), reason: 'Bathroom refit' });
+      expect(block).toMatchObject({ room_id: 1, status: 'active', start_date: startDate });
+
+      const stay = { checkInDate: addDays(startDate, 1), checkOutDate: addDays(startDate, 2) };
+      await expect(bookingService.createBooking({ ...guest, ...stay, roomId: 1 })).rejects.toThrow(ConflictError);
+      expect((await bookingService.quoteStay({ ...stay, roomId: 1 })).available).toBe(false);
+
+      // Room type assignment passes over the blocked room
+      const assigned = await bookingService.createBooking({ ...guest, ...stay, roomType: 'Standard' });
+      expect(assigned.booking.room_id).not.toBe(1);
+
+      // Blocks of the same room don't overlap either
+      await expect(maintenanceService.createBlock(1, { startDate, endDate: addDays(startDate, 1), reason: 'Again' }))
+        .rejects.toThrow(ConflictError);
+      await maintenanceService.cancelBlock(1, block.id);
+      const booked = await bookingService.createBooking({ ...guest, ...stay, roomId: 1 });
+      expect(booked.booking.room_id).toBe(1);
+    });
+
+    test('should refuse a block over an existing booking', async () => {
+      const checkInDate = addDays(today(), 30);
+      const result = await bookingService.createBooking({ ...guest, roomId: 2, checkInDate, checkOutDate: addDays(checkInDate, 2) });
+
+      await expect(new MaintenanceService().createBlock(2, {
+        startDate: addDays(checkInDate, 1), endDate: addDays(checkInDate, 5), reason: 'Painting'
+      })).rejects.toThrow(`bookings ${result.booking.id}`);
+      const afterStay = await new MaintenanceService().createBlock(2, {
+        startDate: addDays(checkInDate, 2), endDate: addDays(checkInDate, 5), reason: 'Painting'
+      });
+      expect(afterStay.status).toBe('active');
+    });
+  });
+
+  describe('Housekeeping', () => {
+    const guest = { guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890', paymentMethod: 'credit_card' };
+
+    test('should hold check-in until the last guest\'s room has been cleaned', async () => {
+      const housekeepingService = new HousekeepingService();
+      const first = await bookingService.createBooking({
+        ...guest, roomId: 1, checkInDate: addDays(today(), 30), checkOutDate: addDays(today(), 32)
+      });
+      await bookingService.changeStatus(first.booking.id, 'confirmed');
+      await bookingService.changeStatus(first.booking.id, 'checked_in');
+      await bookingService.changeStatus(first.booking.id, 'checked_out');
+
+      const arrivalDate = addDays(today(), 40);
+      const next = await bookingService.createBooking({
+        ...guest, roomId: 1, checkInDate: arrivalDate, checkOutDate: addDays(arrivalDate, 2)
+      });
+      await bookingService.changeStatus(next.booking.id, 'confirmed');
+      await expect(bookingService.changeStatus(next.booking.id, 'checked_in'))
+        .rejects.toMatchObject({ code: 'ROOM_NOT_READY' });
+
+      expect(await housekeepingService.taskList(arrivalDate)).toEqual([expect.objectContaining({
+        room_id: 1, housekeeping_status: 'dirty', task: 'clean', priority: 'high', arriving_booking_id: next.booking.id
+      })]);
+
+      // Inspection comes after cleaning
+      await expect(housekeepingService.setStatus(1, 'inspected')).rejects.toThrow(ConflictError);
+      await expect(housekeepingService.setStatus(1, 'vacuumed')).rejects.toThrow(ValidationError);
+      const room = await runAsActor('housekeeper', () => housekeepingService.setStatus(1, 'clean'));
+      expect(room).toMatchObject({ housekeeping_status: 'clean', housekeeping_updated_by: 'housekeeper' });
+      expect(await housekeepingService.taskList(arrivalDate)).toEqual([
+        expect.objectContaining({ room_id: 1, task: 'inspect', priority: 'high' })
+      ]);
+
+      const checkedIn = await bookingService.changeStatus(next.booking.id, 'checked_in');
+      expect(checkedIn.status).toBe('checked_in');
+    });
+
+    test('should announce housekeeping changes and show them on the occupancy board', async () => {
+      const received: unknown[] = [];
+      const unsubscribe = eventBus.subscribe('room.housekeeping_changed', event => { received.push(event); }, { name: 'test' });
+
+      try {
+        const stay = await bookingService.createBooking({
+          ...guest, roomId: 1, checkInDate: addDays(today(), 30), checkOutDate: addDays(today(), 32)
+        });
+        await bookingService.changeStatus(stay.booking.id, 'confirmed');
+        await bookingService.changeStatus(stay.booking.id, 'checked_in');
+        await bookingService.changeStatus(stay.booking.id, 'checked_out');
+        expect((await new AdminService().getOccupancyBoard(today())).rooms)
+          .toContainEqual(expect.objectContaining({ room_id: 1, housekeeping_status: 'dirty' }));
+
+        await new HousekeepingService().setStatus(1, 'clean');
+        await new Promise(resolve => setTimeout(resolve, 50));
+        expect(received).toEqual([{ roomId: 1, status: 'dirty' }, { roomId: 1, status: 'clean' }]);
+      } finally {
+        unsubscribe();
+      }
+    });
+  });
+
+  describe('Reports', () => {
+    const guest = { guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890', paymentMethod: 'credit_card' };
+
+    test('should report occupancy, ADR and RevPAR per day and room type', async () => {
+      const from = addDays(today(), 30);
+      await bookingService.createBooking({ ...guest, roomId: 5, checkInDate: from, checkOutDate: addDays(from, 2) });
+      const cancelled = await bookingService.createBooking({ ...guest, roomId: 1, checkInDate: from, checkOutDate: addDays(from, 1) });
+      await bookingService.cancelBooking(cancelled.booking.id, { code: 'guest_request' });
+
+      const reportService = new ReportService();
+      const occupancy = await reportService.getOccupancyReport(from, addDays(from, 2));
+      const suiteNights = occupancy.days.filter(day => day.room_type === 'Suite');
+      expect(suiteNights.map(day => day.rooms_sold)).toEqual([1, 1, 0]);
+      const suites = suiteNights[0].rooms_available;
+      expect(suiteNights[0].occupancy_rate).toBeCloseTo(1 / suites, 4);
+      expect(occupancy.totals.find(total => total.room_type === 'Standard')).toMatchObject({ rooms_sold: 0, occupancy_rate: 0 });
+
+      const revenue = await reportService.getRevenueReport(from, addDays(from, 2));
+      expect(revenue.days.find(day => day.room_type === 'Suite' && day.date === from))
+        .toMatchObject({ rooms_sold: 1, room_revenue: 250, adr: 250 });
+      expect(revenue.totals.find(total => total.room_type === 'Suite')).toMatchObject({
+        rooms_sold: 2, room_revenue: 500, adr: 250, revpar: Math.round(500 / (suites * 3) * 100) / 100
+      });
+    });
+  });
+
+  describe('Facilities', () => {
+    test('should not delete a facility still attached to a room type unless forced', async () => {
+      const facilityService = new FacilityService();
+      const wifi = await facilityService.createFacility({ name: 'Wi-Fi', description: 'Free in all rooms' });
+      await expect(facilityService.createFacility({ name: 'Wi-Fi' })).rejects.toThrow(ConflictError);
+      await expect(facilityService.attach('Penthouse', wifi.id)).rejects.toThrow(NotFoundError);
+
+      expect(await facilityService.attach('Suite', wifi.id)).toMatchObject({ room_types: ['Suite'] });
+      expect(await facilityService.attach('Deluxe', wifi.id)).toMatchObject({ room_types: ['Deluxe', 'Suite'] });
+      const suite = (await new RoomService().listRoomTypes()).find(roomType => roomType.roomType === 'Suite');
+      expect(suite!.facilities).toEqual(['Wi-Fi']);
+
+      await expect(facilityService.deleteFacility(wifi.id, false)).rejects.toThrow('Deluxe, Suite');
+      await facilityService.detach('Deluxe', wifi.id);
+      expect(await facilityService.updateFacility(wifi.id, { description: null }))
+        .toMatchObject({ name: 'Wi-Fi', description: null, room_types: ['Suite'] });
+
+      await facilityService.deleteFacility(wifi.id, true);
+      expect(await facilityService.listFacilities()).toEqual([]);
+    });
+  });
+
+  describe('Room Type Comparison', () => {
+    const compare = async (types: string) => {
+      const res: any = { statusCode: 200, status(code: number) { this.statusCode = code; return this; }, json(body: unknown) { this.body = body; return this; } };
+      await compareRoomTypes({ query: { types } } as any, res);
+      return res;
+    };
+
+    test('should compare room types side by side, priced against the cheapest', async () => {
+      const summaries = await new RoomService().listRoomTypes();
+      const summary = (roomType: string) => summaries.find(entry => entry.roomType === roomType)!;
+
+      const res = await compare('suite, Standard');
+      expect(res.statusCode).toBe(200);
+      expect(res.body.data.roomTypes).toEqual([
+        { ...summary('Suite'), priceDifferenceFromCheapest: summary('Suite').minPricePerNight - summary('Standard').minPricePerNight },
+        { ...summary('Standard'), priceDifferenceFromCheapest: 0 }
+      ]);
+      expect(res.body.data.roomTypes[0]).toEqual(expect.objectContaining({
+        roomCount: expect.any(Number), availableRooms: expect.any(Number), maintenanceRooms: 0, facilities: [], photos: []
+      }));
+    });
+
+    test('should answer 404 for an unknown room type and 400 for fewer than two', async () => {
+      const unknown = await compare('Standard,Penthouse');
+      expect(unknown.statusCode).toBe(404);
+      expect(unknown.body).toEqual({ success: false, message: 'Room type not found: Penthouse' });
+
+      expect((await compare('Standard')).statusCode).toBe(400);
+    });
+  });
+
+  describe('Room Type Photos', () => {
+    const PNG = Buffer.from('89504e470d0a1a0a0000000d49484452', 'hex');
+    const JPEG = Buffer.from('ffd8ffe000104a464946', 'hex');
+
+    const form = (fields: Record<string, string>, photo?: { data: Buffer; contentType: string }) => {
+      const boundary = 'test-boundary';
+      const chunks = Object.entries(fields).map(([name, value]) =>
+        Buffer.from(`--${boundary}\r\nContent-Disposition: form-data; name="${name}"\r\n\r\n${value}\r\n`));
+      if (photo) {
+        chunks.push(Buffer.from(
+          `--${boundary}\r\nContent-Disposition: form-data; name="photo"; filename="photo"\r\nContent-Type: ${photo.contentType}\r\n\r\n`
+        ), photo.data, Buffer.from('\r\n'));
+      }
+      chunks.push(Buffer.from(`--${boundary}--\r\n`));
+      return parseMultipart(Buffer.concat(chunks), `multipart/form-data; boundary=${boundary}`);
+    };
+
+    test('should store photos in order and list their URLs with the room type', async () => {
+      const dir = fs.mkdtempSync(path.join(os.tmpdir(), 'photos-'));
+      const storage = new DiskStorage(dir, '/media');
+      const photoService = new RoomPhotoService(storage);
+
+      const first = await photoService.addPhoto('Suite', await form({ caption: 'Bedroom' }, { data: PNG, contentType: 'image/png' }));
+      const cover = await photoService.addPhoto('Suite', await form({ position: '1' }, { data: JPEG, contentType: 'image/jpeg' }));
+      expect(cover).toMatchObject({ position: 1, content_type: 'image/jpeg', url: `/media/${cover.storage_key}` });
+      expect(fs.readFileSync(path.join(dir, first.storage_key))).toEqual(PNG);
+
+      // A text file is not a PNG whatever it claims
+      await expect(photoService.addPhoto('Suite', await form({}, { data: Buffer.from('<script>'), contentType: 'image/png' })))
+        .rejects.toThrow(ValidationError);
+      await expect(photoService.addPhoto('Penthouse', await form({}, { data: PNG, contentType: 'image/png' })))
+        .rejects.toThrow(NotFoundError);
+
+      expect((await photoService.listPhotos('Suite')).map(photo => [photo.id, photo.position]))
+        .toEqual([[cover.id, 1], [first.id, 2]]);
+      const suite = (await new RoomService(storage).listRoomTypes()).find(roomType => roomType.roomType === 'Suite');
+      expect(suite!.photos).toEqual([cover.url, first.url]);
+
+      await photoService.deletePhoto('Suite', cover.id);
+      expect(fs.existsSync(path.join(dir, cover.storage_key))).toBe(false);
+      expect(await photoService.listPhotos('Suite')).toEqual([expect.objectContaining({ id: first.id, position: 1 })]);
+      fs.rmSync(dir, { recursive: true, force: true });
+    });
+
+    test('should reject bodies that are not complete multipart forms', async () => {
+      await expect(parseMultipart(Buffer.from('photo'), 'text/plain')).rejects.toThrow(ValidationError);
+      await expect(parseMultipart(
+        Buffer.from('--b\r\nContent-Disposition: form-data; name="caption"\r\n\r\nBedroom'), 'multipart/form-data; boundary=b'
+      )).rejects.toThrow(ValidationError);
+    });
+  });
+
+  describe('Room Import', () => {
+    test('should parse quoted fields and line breaks', () => {
+      expect(parseCsv('\uFEFFa,b\r\n"1, 2","say ""hi""\nthere"\n\n3,\n')).toEqual([
+        { line: 1, fields: ['a', 'b'] },
+        { line: 2, fields: ['1, 2', 'say "hi"\nthere'] },
+        { line: 5, fields: ['3', ''] }
+      ]);
+      expect(() => parseCsv('a,"b\n')).toThrow('Unterminated');
+    });
+
+    test('should insert valid rows and report the rest by line', async () => {
+      const importService = new RoomImportService();
+      const csv = [
+        'room_number,floor,room_type,price_per_night',
+        'IMP1,7,Standard,',
+        'IMP2,7,Penthouse,900',
+        'IMP3,top,Standard,100',
+        'IMP4,8,Loft,',
+        '101,1,Standard,',
+        'IMP1,7,Standard,'
+      ].join('\n');
+
+      try {
+        const dryRun = await importService.importCsv(csv, { dryRun: true });
+        expect(dryRun).toMatchObject({ rows: 6, created: 2, existing: ['101'], dryRun: true });
+        expect((await pool.query("SELECT 1 FROM rooms WHERE room_number LIKE 'IMP%'")).rows).toEqual([]);
+
+        const report = await importService.importCsv(csv, { dryRun: false });
+        expect(report).toMatchObject({ rows: 6, created: 2, existing: ['101'], dryRun: false });
+        expect(report.errors.map(error => [error.line, error.roomNumber])).toEqual([
+          [4, 'IMP3'], [5, 'IMP4'], [7, 'IMP1']
+        ]);
+        expect(report.errors[1].messages).toEqual(['price_per_night is required for the new room type Loft']);
+
+        const rooms = await pool.query("SELECT room_number, floor, room_type, price_per_night FROM rooms WHERE room_number LIKE 'IMP%' ORDER BY room_number");
+        expect(rooms.rows.map(room => [room.room_number, room.floor, room.room_type, Number(room.price_per_night)])).toEqual([
+          ['IMP1', 7, 'Standard', 100],
+          ['IMP2', 7, 'Penthouse', 900]
+        ]);
+
+        // Importing the same file again creates nothing
+        expect(await importService.importCsv(csv, { dryRun: false })).toMatchObject({ created: 0, existing: ['IMP1', 'IMP2', '101'] });
+      } finally {
+        await pool.query("DELETE FROM rooms WHERE room_number LIKE 'IMP%'");
+      }
+    });
+
+    test('should reject a file with unknown columns', async () => {
+      await expect(new RoomImportService().importCsv('room_number,floor,room_type,balcony\n1,1,Standard,yes', { dryRun: true }))
+        .rejects.toThrow(ValidationError);
+    });
+  });
+
+  describe('Adjoining Rooms', () => {
+    const adjoiningRoomService = new AdjoiningRoomService();
+    const party = {
+      guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890', rooms: 2,
+      checkInDate: '2024-12-01', checkOutDate: '2024-12-05', paymentMethod: 'credit_card'
+    };
+
+    test('should find free connected rooms and book them together', async () => {
+      expect(await adjoiningRoomService.link(2, 1)).toEqual([1]);
+      await adjoiningRoomService.link(2, 3);
+      expect(await adjoiningRoomService.link(3, 4)).toEqual([2, 4]);
+      await expect(adjoiningRoomService.link(5, 5)).rejects.toThrow(ValidationError);
+      await expect(adjoiningRoomService.unlink(1, 5)).rejects.toThrow(NotFoundError);
+
+      const search = { checkInDate: party.checkInDate, checkOutDate: party.checkOutDate, rooms: 2 };
+      expect((await adjoiningRoomService.findSets(search)).map(set => set.roomIds)).toEqual([[1, 2], [3, 4]]);
+      expect((await adjoiningRoomService.findSets({ ...search, rooms: 3 })).map(set => set.roomIds)).toEqual([[1, 2, 3]]);
+
+      const { groupId, bookings } = await bookingService.createAdjoiningBookings({ ...party, roomType: 'Deluxe' });
+      expect(bookings.map(result => result.booking.room_id)).toEqual([3, 4]);
+      expect((await pool.query('SELECT DISTINCT group_id FROM bookings')).rows).toEqual([{ group_id: groupId }]);
+      await expect(bookingService.createAdjoiningBookings({ ...party, roomType: 'Deluxe' })).rejects.toThrow(ConflictError);
+    });
+
+    test('should keep none of the bookings when one room fails', async () => {
+      const promoCodeService = new PromoCodeService();
+      await adjoiningRoomService.link(2, 3);
+      await promoCodeService.createPromoCode({
+        code: 'STANDARD10', discountType: 'percentage', discountValue: 10,
+        validFrom: addDays(today(), -1), validUntil: addDays(today(), 1), roomTypes: ['Standard']
+      });
+
+      // The Standard room takes the code, the Deluxe room next door can't
+      await expect(bookingService.createAdjoiningBookings({ ...party, promoCode: 'STANDARD10' })).rejects.toThrow(ValidationError);
+      expect((await pool.query('SELECT id FROM bookings')).rows).toEqual([]);
+      expect((await pool.query('SELECT is_available FROM rooms WHERE id = 2')).rows[0].is_available).toBe(true);
+      expect((await promoCodeService.listPromoCodes())[0].times_used).toBe(0);
+    });
+  });
+
+  describe('Room Status History', () => {
+    test('should record why the room changed, with the actor and transaction', async () => {
+      const result = await runAsActor('front-desk', () => bookingService.createBooking({
+        guestName: 'John Doe',
+        guestEmail: 'john@example.com',
+        guestPhone: '+1234567890',
+        roomId: 1,
+        checkInDate: '2024-12-01',
+        checkOutDate: '2024-12-05',
+        paymentMethod: 'credit_card'
+      }));
+      await bookingService.cancelBooking(result.booking.id, { code: 'guest_request' });
+      const maintenanceService = new MaintenanceService();
+      const block = await maintenanceService.createBlock(1, { startDate: '2024-12-10', endDate: '2024-12-12', reason: 'Leak' });
+      await maintenanceService.cancelBlock(1, block.id);
+      // Paying fails after the room was taken; the rollback takes the history row with it
+      await expect(bookingService.createBooking({
+        guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890', roomId: 1,
+        checkInDate: '2024-12-01', checkOutDate: '2024-12-05', paymentMethod: 'credit_card', redeemPoints: 100000
+      })).rejects.toThrow(ValidationError);
+
+      const history = await new RoomStatusHistoryService().getHistory(1, { limit: '3' });
+      expect(history!.entries.map(entry => [entry.event, entry.is_available, entry.actor])).toEqual([
+        ['booked', false, 'front-desk'],
+        ['cancelled', true, 'system'],
+        ['maintenance_scheduled', true, 'system']
+      ]);
+      expect(history!.entries[0]).toMatchObject({ booking_id: result.booking.id, start_date: '2024-12-01', end_date: '2024-12-05' });
+      const audit = await pool.query('SELECT transaction_id FROM booking_audit WHERE booking_id = $1 ORDER BY id LIMIT 1', [result.booking.id]);
+      expect(history!.entries[0].transaction_id).toBe(audit.rows[0].transaction_id);
+
+      const rest = await new RoomStatusHistoryService().getHistory(1, { cursor: history!.nextCursor });
+      expect(rest!.entries.map(entry => [entry.event, entry.maintenance_block_id])).toEqual([['maintenance_cancelled', block.id]]);
+      expect(rest!.nextCursor).toBeNull();
+      expect(await new RoomStatusHistoryService().getHistory(999999)).toBeNull();
+
+      // History pages go up to 500 entries, past the booking search's 100
+      expect((await new RoomStatusHistoryService().getHistory(1, { limit: '500' }))!.entries).toHaveLength(4);
+      await expect(new RoomStatusHistoryService().getHistory(1, { limit: '501' })).rejects.toThrow(ValidationError);
+    });
+  });
+
+  describe('Stay Restrictions', () => {
+    const stayRestrictionService = new StayRestrictionService();
+    // Next Monday, and the Wednesday after it
+    const monday = addDays(today(), ((8 - new Date(`${today()}T00:00:00Z`).getUTCDay()) % 7) || 7);
+    const request = {
+      guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890', roomId: 3,
+      checkInDate: monday, checkOutDate: addDays(monday, 2), paymentMethod: 'credit_card'
+    };
+
+    test('should refuse stays that break the room type restrictions and report them in quotes', async () => {
+      await stayRestrictionService.saveRestrictions('Deluxe', { minNights: 3, maxAdvanceDays: 30, closedToArrivalDays: [1, 1] });
+      const saved = await stayRestrictionService.saveRestrictions('Deluxe', { maxNights: 7 });
+      expect(saved).toEqual({ roomType: 'Deluxe', minNights: 3, maxNights: 7, maxAdvanceDays: 30, closedToArrivalDays: [1] });
+      await expect(stayRestrictionService.saveRestrictions('Deluxe', { maxNights: 2 })).rejects.toThrow(ValidationError);
+      await expect(stayRestrictionService.saveRestrictions('Penthouse', { minNights: 2 })).rejects.toThrow(NotFoundError);
+
+      const quote = await bookingService.quoteStay(request);
+      expect(quote.restrictionViolations.map(violation => violation.code)).toEqual(['MIN_STAY', 'CLOSED_TO_ARRIVAL']);
+
+      const error = await bookingService.createBooking(request).catch(caught => caught);
+      expect(error).toBeInstanceOf(StayRestrictionError);
+      expect(error.violations.map((violation: { code: string }) => violation.code)).toEqual(['MIN_STAY', 'CLOSED_TO_ARRIVAL']);
+      expect(Object.keys(error.fields).sort()).toEqual(['checkInDate', 'checkOutDate']);
+
+      const far = addDays(monday, 43);
+      expect((await bookingService.quoteStay({ ...request, checkInDate: far, checkOutDate: addDays(far, 10) }))
+        .restrictionViolations.map(violation => violation.code)).toEqual(['MAX_STAY', 'BEYOND_BOOKING_WINDOW']);
+
+      // Other room types and stays within the rules book as before
+      await bookingService.createBooking({ ...request, roomId: 1 });
+      const booked = await bookingService.createBooking({ ...request, checkInDate: addDays(monday, 1), checkOutDate: addDays(monday, 4) });
+      expect(booked.booking.room_id).toBe(3);
+
+      await stayRestrictionService.removeRestrictions('Deluxe');
+      expect(await stayRestrictionService.listRestrictions()).toEqual([]);
+    });
+
+    test('should apply the restrictions to date changes and holds', async () => {
+      const booked = await bookingService.createBooking({ ...request, checkOutDate: addDays(monday, 3) });
+      await stayRestrictionService.saveRestrictions('Deluxe', { minNights: 3 });
+
+      await expect(bookingService.updateBooking(booked.booking.id, { checkOutDate: addDays(monday, 2) }))
+        .rejects.toThrow(StayRestrictionError);
+      await expect(bookingService.createHold({ roomId: 3, checkInDate: addDays(monday, 7), checkOutDate: addDays(monday, 9) }))
+        .rejects.toThrow(StayRestrictionError);
+      const unchanged = await pool.query('SELECT check_out_date::text FROM bookings WHERE id = $1', [booked.booking.id]);
+      expect(unchanged.rows[0].check_out_date).toBe(addDays(monday, 3));
+
+      await stayRestrictionService.removeRestrictions('Deluxe');
+    });
+  });
+
+  describe('Pending Booking Reaper', () => {
+    const request = {
+      guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890', roomId: 1,
+      checkInDate: addDays(today(), 30), checkOutDate: addDays(today(), 33), paymentMethod: 'credit_card'
+    };
+
+    test('should cancel pending bookings left unpaid past the TTL and count the nights reclaimed', async () => {
+      const unpaid = await bookingService.createBooking(request);
+      const paid = await bookingService.createBooking({ ...request, roomId: 3 });
+      const recent = await bookingService.createBooking({ ...request, roomId: 5 });
+      await pool.query(`UPDATE payments SET status = 'failed' WHERE booking_id = ANY($1)`, [[unpaid.booking.id, recent.booking.id]]);
+      await pool.query(
+        `UPDATE bookings SET created_at = CURRENT_TIMESTAMP - INTERVAL '25 hours' WHERE id = ANY($1)`,
+        [[unpaid.booking.id, paid.booking.id]]
+      );
+      const counters = () => metrics.snapshot().counters;
+      const before = counters();
+
+      expect(await runPendingBookingReaper(24)).toEqual({ cancelled: [unpaid.booking.id], nightsReclaimed: 3 });
+      expect(counters()['pending_bookings.reaped'] ?? 0).toBe((before['pending_bookings.reaped'] ?? 0) + 1);
+      expect(counters()['pending_bookings.nights_reclaimed'] ?? 0).toBe((before['pending_bookings.nights_reclaimed'] ?? 0) + 3);
+
+      const bookings = await pool.query('SELECT id, status, cancellation_reason_code FROM bookings ORDER BY id');
+      expect(bookings.rows.map(row => [row.id, row.status, row.cancellation_reason_code])).toEqual([
+        [unpaid.booking.id, 'cancelled', 'payment_issue'],
+        [paid.booking.id, 'pending', null],
+        [recent.booking.id, 'pending', null]
+      ]);
+      const room = await pool.query('SELECT is_available FROM rooms WHERE id = 1');
+      expect(room.rows[0].is_available).toBe(true);
+      expect(await runPendingBookingReaper(24)).toEqual({ cancelled: [], nightsReclaimed: 0 });
+    });
+  });
+
+  describe('Advisory Lock Strategy', () => {
+    const request = {
+      guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890',
+      checkInDate: addDays(today(), 30), checkOutDate: addDays(today(), 33), paymentMethod: 'credit_card'
+    };
+
+    // The strategy is shared by every BookingService in the process
+    afterEach(() => { bookingService.setLockStrategy(lockingConfig.strategy); });
+
+    test('should split stays into epoch-aligned date buckets', () => {
+      expect(stayBuckets('1970-01-01', '1970-01-08', 7)).toEqual([0, 0]);
+      expect(stayBuckets('1970-01-07', '1970-01-09', 7)).toEqual([0, 1]);
+      expect(stayBuckets('1970-01-15', '1970-01-16', 1)).toEqual([14, 14]);
+    });
+
+    test('should skip rooms whose buckets are locked and refuse a room taken for other buckets', async () => {
+      const advisory = new BookingService();
+      advisory.setLockStrategy('advisory');
+      const [first, last] = stayBuckets(request.checkInDate, request.checkOutDate);
+      const blocker = await pool.connect();
+      try {
+        await blocker.query('BEGIN');
+        await blocker.query('SELECT pg_advisory_xact_lock(3, bucket) FROM generate_series($1::int, $2::int) AS bucket', [first, last]);
+        const assigned = await advisory.createBooking({ ...request, roomType: 'Deluxe' });
+        expect(assigned.booking.room_id).toBe(4);
+      } finally {
+        await blocker.query('ROLLBACK');
+        blocker.release();
+      }
+
+      // Stays a year apart share no bucket, so only the room's free flag keeps them from both booking it
+      const later = { checkInDate: addDays(today(), 300), checkOutDate: addDays(today(), 302) };
+      const results = await Promise.allSettled([
+        advisory.createBooking({ ...request, roomId: 1 }),
+        advisory.createBooking({ ...request, ...later, roomId: 1 })
+      ]);
+      expect(results.filter(result => result.status === 'fulfilled')).toHaveLength(1);
+      const rejected = results.find(result => result.status === 'rejected') as PromiseRejectedResult;
+      expect(rejected.reason).toBeInstanceOf(ConflictError);
+      const bookings = await pool.query('SELECT COUNT(*)::int AS count FROM bookings WHERE room_id = 1');
+      expect(bookings.rows[0].count).toBe(1);
+    });
+
+    test('should apply the strategy to bookings made outside the booking endpoints', async () => {
+      bookingService.setLockStrategy('advisory');
+      const [first, last] = stayBuckets(request.checkInDate, request.checkOutDate);
+      const blocker = await pool.connect();
+      try {
+        await blocker.query('BEGIN');
+        await blocker.query('SELECT pg_advisory_xact_lock(3, bucket) FROM generate_series($1::int, $2::int) AS bucket', [first, last]);
+        const { booking } = await new BookingSagaService().start({ ...request, roomType: 'Deluxe' });
+        expect(booking.room_id).toBe(4);
+      } finally {
+        await blocker.query('ROLLBACK');
+        blocker.release();
+      }
+    });
+  });
+
+  describe('Lock Diagnostics', () => {
+    test('should find every wait cycle once', () => {
+      expect(findWaitCycles(new Map([[7, [3]], [3, [9]], [9, [7]], [4, [3]], [5, []]]))).toEqual([[3, 9, 7]]);
+      expect(findWaitCycles(new Map([[1, [2]], [2, [1, 3]], [3, [2]]]))).toEqual([[1, 2], [2, 3]]);
+      expect(findWaitCycles(new Map([[1, [2]], [2, [3]]]))).toEqual([]);
+    });
+
+    test('should show who holds and who waits for a lock and the deadlocks lost', async () => {
+      const holder = await pool.connect();
+      const waiter = await pool.connect();
+      try {
+        const [holderPid, waiterPid] = await Promise.all([holder, waiter].map(async client =>
+          (await client.query('SELECT pg_backend_pid() AS pid')).rows[0].pid));
+        await holder.query('BEGIN');
+        await holder.query('SELECT id FROM rooms WHERE id = 1 FOR UPDATE');
+        await waiter.query('BEGIN');
+        const blocked = waiter.query('SELECT id FROM rooms WHERE id = 1 FOR UPDATE');
+
+        let diagnostics = await new LockDiagnosticsService().snapshot();
+        for (let i = 0; i < 50 && !diagnostics.waiters.some(entry => entry.pid === waiterPid); i++) {
+          await new Promise(resolve => setTimeout(resolve, 20));
+          diagnostics = await new LockDiagnosticsService().snapshot();
+        }
+        const waiting = diagnostics.waiters.find(entry => entry.pid === waiterPid)!;
+        expect(waiting.blockedBy).toEqual([holderPid]);
+        expect(waiting.query).toContain('FOR UPDATE');
+        const holding = diagnostics.holders.find(entry => entry.pid === holderPid)!;
+        expect(holding.locks).toEqual(expect.arrayContaining([expect.objectContaining({ target: 'rooms', mode: 'RowShareLock' })]));
+        expect(diagnostics.cycles).toEqual([]);
+
+        await holder.query('ROLLBACK');
+        await blocked;
+        await waiter.query('ROLLBACK');
+      } finally {
+        holder.release();
+        waiter.release();
+      }
+
+      await expect(runInTransactionWithRetry(async () => {
+        throw Object.assign(new Error('deadlock detected'), { code: '40P01', detail: 'Process 1 waits for ShareLock on transaction 2' });
+      }, { name: 'deadlockProbe', maxAttempts: 1 })).rejects.toBeInstanceOf(ConflictError);
+      const { recentDeadlocks } = await new LockDiagnosticsService().snapshot();
+      expect(recentDeadlocks[recentDeadlocks.length - 1]).toMatchObject({
+        transaction: 'deadlockProbe', attempt: 1, retried: false, detail: 'Process 1 waits for ShareLock on transaction 2'
+      });
+    });
+  });
+
+  describe('Booking Queue', () => {
+    const sleep = (ms: number) => new Promise(resolve => setTimeout(resolve, ms));
+
+    // Turning the queue on is shared by every BookingService in the process
+    afterEach(() => { bookingService.setBookingQueue(bookingConfig.bookingQueueEnabled); });
+
+    test('should run tasks one at a time per key in arrival order', async () => {
+      const queue = new KeyedQueue({ maxWaiting: 2, timeoutMs: 1000 });
+      const events: string[] = [];
+      const task = (name: string, ms: number) => async () => {
+        events.push(`${name} start`);
+        await sleep(ms);
+        events.push(`${name} end`);
+        return name;
+      };
+
+      const results = await Promise.all([
+        queue.run('room:1', task('a', 30)),
+        queue.run('room:1', task('b', 10)),
+        queue.run('room:2', task('c', 5)),
+        queue.run('room:1', task('d', 1))
+      ]);
+      expect(results).toEqual(['a', 'b', 'c', 'd']);
+      expect(events.filter(event => !event.startsWith('c'))).toEqual(['a start', 'a end', 'b start', 'b end', 'd start', 'd end']);
+      expect(events.indexOf('c end')).toBeLessThan(events.indexOf('a end'));
+      expect(queue.size('room:1')).toBe(0);
+
+      const running = queue.run('room:1', task('e', 50));
+      const waiting = [queue.run('room:1', task('f', 1)), queue.run('room:1', task('g', 1))];
+      await expect(queue.run('room:1', task('h', 1))).rejects.toBeInstanceOf(ConflictError);
+      await Promise.all([running, ...waiting]);
+    });
+
+    test('should keep order behind a task that gave up waiting', async () => {
+      const queue = new KeyedQueue({ maxWaiting: 5, timeoutMs: 40 });
+      const events: string[] = [];
+      const slow = queue.run('room:1', async () => { await sleep(60); events.push('slow end'); });
+      await expect(queue.run('room:1', async () => { events.push('never'); })).rejects.toThrow('Timed out');
+
+      // Queued behind the one that timed out, so it still waits for the slow task
+      await queue.run('room:1', async () => { events.push('after'); });
+      await slow;
+      expect(events).toEqual(['slow end', 'after']);
+      expect(queue.size('room:1')).toBe(0);
+    });
+
+    test('should hand out rooms of a type in arrival order when enabled', async () => {
+      const queued = new BookingService();
+      queued.setBookingQueue(true);
+      const request = {
+        guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890', roomType: 'Deluxe',
+        checkInDate: addDays(today(), 30), checkOutDate: addDays(today(), 32), paymentMethod: 'credit_card'
+      };
+
+      const results = await Promise.allSettled([1, 2, 3].map(() => queued.createBooking(request)));
+      expect(results.map(result => result.status === 'fulfilled' ? result.value.booking.room_id : 'rejected'))
+        .toEqual([3, 4, 'rejected']);
+      expect((results[2] as PromiseRejectedResult).reason).toBeInstanceOf(ConflictError);
+      expect(metrics.snapshot().timings['booking_queue.wait'].count).toBeGreaterThanOrEqual(3);
+    });
+
+    test('should queue saga bookings and waitlist promotions when enabled', async () => {
+      bookingService.setBookingQueue(true);
+      const waits = () => metrics.snapshot().timings['booking_queue.wait']?.count ?? 0;
+      const before = waits();
+
+      await new BookingSagaService().start({
+        guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890', roomId: 1,
+        checkInDate: addDays(today(), 30), checkOutDate: addDays(today(), 32), paymentMethod: 'credit_card'
+      });
+      await new WaitlistService().processRoom(2);
+
+      // Once each: the booking inside the saga's or waitlist's transaction doesn't queue a second time
+      expect(waits()).toBe(before + 2);
+    });
+  });
+
+  describe('Booking Saga', () => {
+    const sagaService = new BookingSagaService();
+    const webhooks = new PaymentWebhookService();
+    const request = {
+      guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890', roomId: 1,
+      checkInDate: addDays(today(), 30), checkOutDate: addDays(today(), 33), paymentMethod: 'credit_card'
+    };
+    const original = { ...sagaConfig };
+
+    // The tests play the gateway's webhooks themselves
+    beforeAll(() => { sagaConfig.simulatedOutcome = 'none'; });
+    afterAll(() => { Object.assign(sagaConfig, original); });
+
+    const gatewayEvent = async (bookingId: number, type: string) => {
+      const payment = await pool.query('SELECT transaction_id FROM payments WHERE booking_id = $1', [bookingId]);
+      return webhooks.handleEvent({
+        id: `evt_${type}_${bookingId}`, type, created: Math.floor(Date.now() / 1000),
+        data: { transactionId: payment.rows[0].transaction_id, failureReason: type === 'payment.failed' ? 'card_declined' : undefined }
+      });
+    };
+
+    test('should book unpaid, charge through the outbox and complete on the gateway\'s confirmation', async () => {
+      const { saga, booking } = await sagaService.start(request);
+      expect(booking.status).toBe('pending');
+      expect(saga).toMatchObject({ booking_id: booking.id, status: 'awaiting_payment', payment_id: null });
+      expect(saga.amount).toBe(Number(booking.total_amount));
+      const unpaid = await pool.query('SELECT count(*)::int AS count FROM payments WHERE booking_id = $1', [booking.id]);
+      expect(unpaid.rows[0].count).toBe(0);
+
+      // The payment is recorded by one message and charged by a second, sent after the first has committed
+      expect(await runOutboxRelay()).toEqual({ sent: 2, failed: 0 });
+      expect(await runOutboxRelay()).toEqual({ sent: 0, failed: 0 });
+      const topics = await pool.query('SELECT topic FROM outbox_messages ORDER BY id');
+      expect(topics.rows.map(row => row.topic)).toEqual(['payment.requested', 'payment.charge']);
+      const payment = await pool.query('SELECT id, status, transaction_id FROM payments WHERE booking_id = $1', [booking.id]);
+      expect(payment.rows[0]).toMatchObject({ status: 'pending', transaction_id: `booking-saga-${saga.id}` });
+      expect((await sagaService.getSaga(saga.id))!.payment_id).toBe(payment.rows[0].id);
+
+      expect((await gatewayEvent(booking.id, 'payment.succeeded')).outcome).toBe('applied');
+      const completed = await sagaService.getSaga(saga.id);
+      expect(completed!.status).toBe('completed');
+      const receipt = await pool.query('SELECT id, total_amount FROM receipts WHERE booking_id = $1', [booking.id]);
+      expect(receipt.rows.map(row => row.id)).toEqual([completed!.receipt_id]);
+      expect(Number(receipt.rows[0].total_amount)).toBe(saga.amount);
+    });
+
+    test('should cancel the booking when the payment fails', async () => {
+      const { saga, booking } = await sagaService.start(request);
+      await runOutboxRelay();
+      await gatewayEvent(booking.id, 'payment.failed');
+
+      expect(await sagaService.getSaga(saga.id)).toMatchObject({
+        status: 'compensated', failure_reason: 'Payment failed: card_declined', receipt_id: null
+      });
+      const cancelled = await pool.query('SELECT status, cancellation_reason_code FROM bookings WHERE id = $1', [booking.id]);
+      expect(cancelled.rows[0]).toEqual({ status: 'cancelled', cancellation_reason_code: 'payment_issue' });
+      const room = await pool.query('SELECT is_available FROM rooms WHERE id = 1');
+      expect(room.rows[0].is_available).toBe(true);
+    });
+
+    test('should cancel bookings whose payment times out and refund a confirmation that comes later', async () => {
+      const { saga, booking } = await sagaService.start(request);
+      await runOutboxRelay();
+      expect(await runBookingSagaMonitor()).toEqual([]);
+      await pool.query(`UPDATE booking_sagas SET expires_at = CURRENT_TIMESTAMP - INTERVAL '1 minute' WHERE id = $1`, [saga.id]);
+
+      expect(await runBookingSagaMonitor()).toEqual([saga.id]);
+      expect((await sagaService.getSaga(saga.id))!.status).toBe('compensated');
+      const cancelled = await pool.query('SELECT status FROM bookings WHERE id = $1', [booking.id]);
+      expect(cancelled.rows[0].status).toBe('cancelled');
+
+      await gatewayEvent(booking.id, 'payment.succeeded');
+      const refunds = await new RefundService().getRefunds(booking.id);
+      expect(refunds!.map(refund => Number(refund.amount))).toEqual([Number(booking.total_amount)]);
+      const receipts = await pool.query('SELECT count(*)::int AS count FROM receipts WHERE booking_id = $1', [booking.id]);
+      expect(receipts.rows[0].count).toBe(0);
+    });
+
+    test('should roll back the booking when the saga can\'t start', async () => {
+      await expect(sagaService.start({ ...request, installments: 2 })).rejects.toThrow(ValidationError);
+      await bookingService.createBooking(request);
+      await expect(sagaService.start(request)).rejects.toThrow(ConflictError);
+      const sagas = await pool.query('SELECT count(*)::int AS count FROM booking_sagas');
+      expect(sagas.rows[0].count).toBe(0);
+    });
+
+    test('should retry failing outbox messages and give up after the last attempt', async () => {
+      Object.assign(sagaConfig, { outboxMaxAttempts: 2, outboxRetryDelayMs: 0 });
+      try {
+        await pool.query(`INSERT INTO outbox_messages (topic, payload) VALUES ('test.failing', '{}'), ('test.unknown', '{}')`);
+        const failing = jest.fn().mockRejectedValue(new Error('gateway unavailable'));
+
+        expect(await new OutboxService().relay({ 'test.failing': failing })).toEqual({ sent: 0, failed: 4 });
+        expect(failing).toHaveBeenCalledTimes(2);
+        const messages = await pool.query('SELECT topic, attempts, last_error, failed_at FROM outbox_messages ORDER BY id');
+        expect(messages.rows.map(row => [row.topic, row.attempts, row.last_error, row.failed_at !== null])).toEqual([
+          ['test.failing', 2, 'gateway unavailable', true],
+          ['test.unknown', 2, 'No handler for topic test.unknown', true]
+        ]);
+      } finally {
+        Object.assign(sagaConfig, original);
+      }
+    });
+  });
+
+  describe('Optimistic Locking', () => {
+    const request = {
+      guestName: 'John Doe', guestEmail: 'john@example.com', guestPhone: '+1234567890', roomId: 1,
+      checkInDate: addDays(today(), 30), checkOutDate: addDays(today(), 33), paymentMethod: 'credit_card'
+    };
+
+    test('should refuse an update guarded by a version that has moved on', async () => {
+      const { booking } = await bookingService.createBooking(request);
+      const update = (version: number) => pool.query(
+        'UPDATE bookings SET version = version + 1 WHERE id = $1 AND version = $2 RETURNING *', [booking.id, version]
+      );
+
+      expect(versionedRow(await update(booking.version), 'booking', booking.id, booking.version).version).toBe(booking.version + 1);
+      const missed = await update(booking.version);
+      expect(() => versionedRow(missed, 'booking', booking.id, booking.version)).toThrow(StaleVersionError);
+      expect(() => versionedRow(missed, 'booking', booking.id, booking.version)).toThrow(ConflictError);
+      expect(() => versionedRow({ rows: [] } as any, 'receipt', 7, 3)).toThrow('Receipt 7 was modified by another request');
+    });
+
+    test('should bump the version on every booking update', async () => {
+      const { booking } = await bookingService.createBooking(request);
+      const versionOf = async () => (await pool.query('SELECT version FROM bookings WHERE id = $1', [booking.id])).rows[0].version;
+
+      await bookingService.updateBooking(booking.id, { guestName: 'John Smith' });
+      expect(await versionOf()).toBe(booking.version + 1);
+      await bookingService.changeStatus(booking.id, 'confirmed');
+      expect(await versionOf()).toBe(booking.version + 2);
+      await bookingService.cancelBooking(booking.id, { code: 'guest_request' });
+      expect(await versionOf()).toBe(booking.version + 3);
+    });
+
+    test('should drop a receipt email outcome once another sender has taken the email over', async () => {
+      const result = await bookingService.createBooking(request);
+      const receiptEmailService = new ReceiptEmailService({
+        // The lease runs out mid-send and a sweep claims the email again
+        send: async () => {
+          await pool.query(
+            `UPDATE receipts SET email_attempts = email_attempts + 1, version = version + 1 WHERE id = $1`,
+            [result.receipt.id]
+          );
+        }
+      });
+
+      expect(await receiptEmailService.deliver(result.receipt.id)).toBe('skipped');
+      const receipt = await pool.query('SELECT email_status, email_attempts, version FROM receipts WHERE id = $1', [result.receipt.id]);
+      expect(receipt.rows[0]).toEqual({ email_status: 'sending', email_attempts: 2, version: 3 });
+    });
   });
-});
\ No newline at end of file
+});
@@ -3,6 +3,9 @@ import { BookingService } from '../src/services/bookingService';
 import { logger } from '../src/utils/logger';
 import { resetBookingCounters } from '../src/scripts/initDb';
 import { Booking, Payment, Receipt } from '../src/types/index';
+import { pool } from '../src/config/database';
+import { AdminService } from '../src/services/adminService';
+import { addDays, today } from '../src/utils/date';
 
 const bookingService = new BookingService();
 
@@ -96,7 +99,7 @@ async function testMixedOperations() {
     
     // Add cancellations
     initialBookings.forEach(bookingId => {
-      promises.push(bookingService.cancelBooking(bookingId));
+      promises.push(bookingService.cancelBooking(bookingId, { code: 'guest_request' }));
     });
     
     // Add new bookings for same rooms
@@ -270,6 +273,105 @@ async function testBulkOperationDeadlocks() {
   }
 }
 
+// Test 5: Cancellation storm (e.g. an event is called off)
+// Every future booking is cancelled at once while other clients search and re-book the same rooms.
+// Checks that each freed room is visible immediately and that no room ends up double-booked.
+async function testCancellationStorm() {
+  console.log('\n=== Test 5: Mass Cancellation Storm ===');
+  
+  bookingService.setRowLocking(true);
+  
+  const checkInDate = addDays(today(), 30);
+  const checkOutDate = addDays(today(), 32);
+  const violations: string[] = [];
+  
+  try {
+    const availableRooms = await pool.query('SELECT id FROM rooms WHERE is_available ORDER BY id LIMIT 10');
+    const roomIds: number[] = availableRooms.rows.map(row => row.id);
+    
+    const bookingIds: number[] = [];
+    for (const roomId of roomIds) {
+      const booking = await bookingService.createBooking({
+        guestName: `Event Guest ${roomId}`,
+        guestEmail: `event${roomId}@test.com`,
+        guestPhone: `555-500${roomId}`,
+        roomId,
+        checkInDate,
+        checkOutDate,
+        paymentMethod: 'credit_card'
+      });
+      bookingIds.push(booking.booking.id);
+    }
+    
+    console.log(`Created ${bookingIds.length} event bookings`);
+    
+    const promises: Promise<any>[] = [];
+    
+    // The storm: cancel everything at once, and check each freed room right after its cancellation commits
+    bookingIds.forEach((bookingId, index) => {
+      promises.push(
+        bookingService.cancelBooking(bookingId, { code: 'hotel_initiated', text: 'Event cancelled' })
+          .then(async () => {
+            const room = await pool.query(
+              `SELECT r.is_available,
+                      EXISTS (SELECT 1 FROM bookings b WHERE b.room_id = r.id AND b.status <> 'cancelled') AS rebooked
+               FROM rooms r WHERE r.id = $1`,
+              [roomIds[index]]
+            );
+            if (!room.rows[0].is_available && !room.rows[0].rebooked) {
+              violations.push(`Room ${roomIds[index]} still unavailable after its booking was cancelled`);
+            }
+          })
+      );
+    });
+    
+    // Concurrent searches and opportunistic re-bookings of the freed rooms
+    roomIds.forEach((roomId, index) => {
+      promises.push(pool.query('SELECT id FROM rooms WHERE is_available'));
+      promises.push(
+        randomDelay(0, 100).then(() => bookingService.createBooking({
+          guestName: `Rebooking Guest ${index}`,
+          guestEmail: `rebook${index}@test.com`,
+          guestPhone: `555-600${index}`,
+          roomId,
+          checkInDate,
+          checkOutDate,
+          paymentMethod: 'credit_card'
+        }))
+      );
+    });
+    
+    const results = await Promise.allSettled(promises);
+    
+    const fulfilled = results.filter(r => r.status === 'fulfilled');
+    const rejected = results.filter(r => r.status === 'rejected');
+    const deadlocks = rejected.filter(r => 
+      r.reason?.message?.toLowerCase().includes('deadlock')
+    );
+    
+    const snapshot = await new AdminService().getConsistencySnapshot();
+    if (snapshot.overlappingBookings > 0) {
+      violations.push(`${snapshot.overlappingBookings} overlapping bookings after the storm`);
+    }
+    
+    console.log(`Results: ${fulfilled.length} successful, ${rejected.length} failed`);
+    console.log(`Deadlocks detected: ${deadlocks.length}`);
+    
+    if (violations.length > 0) {
+      console.log('❌ Consistency violations:');
+      violations.forEach(violation => console.log(`  ${violation}`));
+    } else {
+      console.log('✅ Freed rooms were immediately visible and no room was double-booked');
+    }
+    
+    return { fulfilled: fulfilled.length, rejected: rejected.length, deadlocks: deadlocks.length, violations };
+    
+  } catch (error) {
+    console.error('Test 5 error:', error);
+    return { fulfilled: 0, rejected: 0, deadlocks: 0, violations: [String(error)] };
+  }
+}
+
 // Main test runner
 async function runDeadlockTests() {
   console.log('🚀 Starting Comprehensive Deadlock Tests');
@@ -305,6 +407,9 @@ async function runDeadlockTests() {
     const safeTest = await testConcurrentSameRoomBookings();
     console.log(`With row locking: ${safeTest.deadlocks} deadlocks (should be 0)`);
     
+    const stormTest = await testCancellationStorm();
+    console.log(`Cancellation storm: ${stormTest.violations.length} consistency violations (should be 0)`);
+    
   } catch (error) {
     console.error('Error in deadlock tests:', error);
   }
@@ -316,7 +421,8 @@ export {
   testConcurrentSameRoomBookings,
   testMixedOperations,
   testHighFrequencyOperations,
-  testBulkOperationDeadlocks
+  testBulkOperationDeadlocks,
+  testCancellationStorm
 };
 
 // Run tests if this file is executed directly
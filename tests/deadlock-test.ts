@@ -90,8 +90,8 @@ async function testConcurrentBookingAndCancellation() {
     // Now run concurrent operations
     const promises = [
       // Multiple cancellations of the same booking
-      bookingService.cancelBooking(booking.booking.id),
-      bookingService.cancelBooking(booking.booking.id),
+      bookingService.cancelBooking(booking.booking.id, { code: 'guest_request' }),
+      bookingService.cancelBooking(booking.booking.id, { code: 'guest_request' }),
       // New bookings for same room
       bookingService.createBooking({
         guestName: 'Another User',
@@ -0,0 +1,39 @@
+import fs from 'fs';
+import path from 'path';
+
+// Fragments allowed inside SQL template literals: each is a constant or built only from constants
+const ALLOWED_INTERPOLATIONS = [
+  'lockClause', 'BOOKING_DETAILS_SELECT', 'CANCELLED_IN_RANGE', 'savepoint',
+  'BOOKING_SEARCH_FILTERS', 'order.column', 'order.keyset', 'order.orderBy'
+];
+
+function sourceFiles(dir: string): string[] {
+  return fs.readdirSync(dir, { withFileTypes: true }).flatMap(entry => {
+    const fullPath = path.join(dir, entry.name);
+    if (entry.isDirectory()) {
+      return sourceFiles(fullPath);
+    }
+    return entry.name.endsWith('.ts') ? [fullPath] : [];
+  });
+}
+
+describe('SQL construction', () => {
+  const srcDir = path.join(__dirname, '..', 'src');
+  const files = sourceFiles(srcDir).map(file => path.relative(srcDir, file));
+
+  test.each(files)('%s only interpolates allow-listed SQL fragments', file => {
+    const source = fs.readFileSync(path.join(srcDir, file), 'utf8');
+    const offenders: string[] = [];
+
+    for (const query of source.matchAll(/\.query\(\s*`([^`]*)`/g)) {
+      for (const expression of query[1].matchAll(/\$\{([^}]+)\}/g)) {
+        if (!ALLOWED_INTERPOLATIONS.includes(expression[1].trim())) {
+          offenders.push(expression[1].trim());
+        }
+      }
+    }
+
+    expect(offenders).toEqual([]);
+    expect(source).not.toMatch(/\.query\(\s*(['"`])[^'"`]*\1\s*\+/);
+  });
+});